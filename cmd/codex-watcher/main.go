@@ -5,12 +5,18 @@ import (
     "encoding/json"
     "errors"
     "flag"
+    "fmt"
+    "io"
     "log"
+    "log/slog"
+    "net"
     "net/http"
     "os"
     "os/exec"
     "os/signal"
+    "os/user"
     "path/filepath"
+    "sort"
     "strconv"
     "strings"
     "sync"
@@ -18,15 +24,57 @@ import (
     "time"
 
     "codex-watcher/internal/api"
-    "codex-watcher/internal/indexer"
-    "codex-watcher/internal/search"
+    "codex-watcher/internal/grpcapi"
+    "codex-watcher/internal/publish"
+    "codex-watcher/internal/store"
+    "codex-watcher/pkg/exporter"
+    "codex-watcher/pkg/indexer"
+    "codex-watcher/pkg/search"
 )
 
 type config struct {
     Port     string
     CodexDir string
+    CodexDirs []string
     ClaudeDir string
     Host     string
+    ResumeOffsets bool
+    APITokens []string
+    AllowedOrigins []string
+    AllowedHosts []string // host names a browser may reach the server by, besides loopback and IP addresses
+    ColorLabels string
+    GitHubToken string
+    NotionToken string
+    NotionDatabase string
+    GRPCPort  string
+    VaultDir  string
+    VaultIdle time.Duration
+    WikiRepo  string   // git-backed wiki clone for /api/export/wiki
+    WikiPath  string   // file path template inside WikiRepo
+    WikiMessage string // commit message template
+    WikiPush  bool
+    WikiAuto  []string // wiki targets finished sessions are published to
+    ExportDrain time.Duration
+    IdleGap   time.Duration
+    ColdAfter time.Duration // compress messages of sessions idle this long; 0 = never
+    ScanWorkers int         // files tailed at once per scan; 0 = indexer default
+    Ignore    []string      // glob patterns of session files not to read
+    MaxFileAge time.Duration // skip files not modified for this long; 0 = no limit
+    MaxFileSize int64        // skip files larger than this many bytes; 0 = no limit
+    TrashKeep time.Duration // how long deleted sessions and messages stay restorable; 0 = forever
+    ModelsConfig string
+    Pricing      string
+    DataDir   string // pid, offsets state, audit log, and background log
+    MetaStore string // where session metadata lives: sidecar (default) or central
+    AttachmentsDir string // cache of images and files found in messages
+    ConfigFile string // flat YAML of flag values, re-read on SIGHUP
+    Foreground bool   // container mode: no pid file, JSON logs on stdout
+    PollInterval time.Duration
+    Watch     bool  // follow file system events; polling is the fallback
+    DBPath    string // SQLite index database; "" keeps the index in memory only
+    Defaults  api.Defaults // viewer and export defaults, tunable at runtime
+    Index     indexer.Options // the indexer settings above, models, and MetaStore as the indexer takes them
+    Search    search.Options  // search flags; the API's copy is tunable at runtime
 }
 
 func getenv(key, def string) string {
@@ -36,47 +84,474 @@ func getenv(key, def string) string {
     return def
 }
 
+// dirList is a flag that may be repeated, each value a comma-separated list
+// of directories.
+type dirList []string
+
+func (d *dirList) String() string { return strings.Join(*d, ",") }
+
+func (d *dirList) Set(v string) error {
+    *d = append(*d, splitDirs(v)...)
+    return nil
+}
+
+// splitDirs splits a comma-separated directory list, dropping empty entries.
+func splitDirs(v string) []string {
+    var out []string
+    for _, d := range strings.Split(v, ",") {
+        if d = strings.TrimSpace(d); d != "" { out = append(out, d) }
+    }
+    return out
+}
+
+// homeDir finds the user's home directory when $HOME is unset, as happens in
+// some containers and service managers. It returns "" when there is none.
+func homeDir() string {
+    if h := os.Getenv("HOME"); h != "" { return h }
+    if u, err := user.Current(); err == nil && u.HomeDir != "" && u.HomeDir != "/" { return u.HomeDir }
+    return ""
+}
+
 func resolveConfig() (config, error) {
     var (
         portFlag  = flag.String("port", "", "port to listen on")
-        dirFlag   = flag.String("codex", "", "path to ~/.codex directory")
+        dirFlag   dirList
         claudeFlag= flag.String("claude", "", "path to ~/.claude/projects directory")
         hostFlag  = flag.String("host", "", "host interface to bind (default 0.0.0.0)")
         searchBudget = flag.Int("search_budget_ms", 0, "soft time budget for search (ms, default 350)")
         searchMax    = flag.Int("search_max", 0, "max hits returned (default 200)")
+        searchTools  = flag.Bool("search_tool_outputs", true, "include tool outputs in search (they stay viewable either way)")
+        searchOutMax = flag.Int("search_output_max_bytes", 0, "search only the first N bytes of each tool output (0 = all)")
+        tokenFlag    = flag.String("api_token", "", "require a bearer token for /api: token, role:token, or name:role:token (comma-separated)")
+        vaultFlag    = flag.String("vault", "", "mirror finished sessions as Markdown notes into this Obsidian/Logseq folder")
+        vaultIdle    = flag.Int("vault_idle_min", 30, "minutes without activity before a session is synced to the vault or published by --wiki_auto")
+        wikiRepoFlag = flag.String("wiki_repo", "", "local clone of a git-backed wiki that /api/export/wiki?target=git commits transcripts to")
+        wikiPathFlag = flag.String("wiki_path", "", "file path of a transcript in --wiki_repo; {title} {date} {id} {short_id} {project} {provider} are filled in")
+        wikiMsgFlag  = flag.String("wiki_message", "", "commit message template for --wiki_repo, with the same placeholders as --wiki_path")
+        wikiPushFlag = flag.Bool("wiki_push", false, "push --wiki_repo after each commit")
+        wikiAutoFlag = flag.String("wiki_auto", "", "publish every session that finishes from now on to these wiki targets: confluence, git (comma-separated)")
+        githubFlag   = flag.String("github_token", "", "GitHub token with gist scope for /api/export/gist")
+        notionFlag   = flag.String("notion_token", "", "Notion integration secret for /api/export/notion")
+        notionDBFlag = flag.String("notion_database", "", "ID of the Notion database /api/export/notion adds pages to")
+        grpcFlag     = flag.String("grpc_port", "", "also serve the read-only gRPC API on this port")
+        originsFlag  = flag.String("allowed_origins", "", "extra origins allowed to call mutating /api endpoints (comma-separated)")
+        hostsFlag    = flag.String("allowed_hosts", "", "host names browsers may reach the server by, besides localhost, IP addresses, and this machine's name (comma-separated)")
+        labelsFlag   = flag.String("color_labels", "", "color label palette as name=#hex pairs (comma-separated), replacing the default")
+        drainFlag    = flag.Int("export_drain_sec", 60, "seconds shutdown waits for in-flight exports before cutting them off")
+        idleFlag     = flag.Int("idle_gap_min", 0, "pauses longer than this many minutes don't count toward a session's active duration (default 5)")
+        trashFlag    = flag.Int("trash_days", 30, "days deleted sessions and messages stay in the trash before they are removed for good (0 = keep)")
+        coldFlag     = flag.Int("cold_compress_min", 0, "compress in memory the messages of sessions not read or written for this many minutes (0 = off)")
+        scanFlag     = flag.Int("scan_workers", 0, "session files tailed concurrently by each scan (default 4, 1 = one at a time)")
+        ignoreFlag   = flag.String("ignore", "", "glob patterns of session files not to read (comma-separated), matched against file and directory names, or the path under the root when they contain a slash")
+        maxAgeFlag   = flag.Int("max_file_age_days", 0, "skip session files not modified for this many days (0 = no limit)")
+        maxSizeFlag  = flag.Int("max_file_size_mb", 0, "skip session files larger than this many MB (0 = no limit)")
+        modelsFlag   = flag.String("models_config", "", "JSON file of model aliases and per-1K-token prices (default <codex>/codex-watcher-models.json if present)")
+        pricingFlag  = flag.String("pricing", "", "JSON or TOML file of per-1K-token model prices for cost estimates, overriding --models_config prices")
+        dbFlag       = flag.String("db", "", "persist the index and a full-text search table in this SQLite file, so restarts skip the full rescan")
+        resumeFlag   = flag.Bool("resume_offsets", false, "resume tailing from saved offsets; needs --db, which keeps the lines read before restart")
+        dataFlag     = flag.String("data_dir", "", "directory for the pid, offsets state, audit, and log files (default: the codex dir)")
+        attachFlag   = flag.String("attachments_dir", "", "directory images and files found in messages are cached in and served from (default <data_dir>/attachments)")
+        metaFlag     = flag.String("meta_store", "", "where session titles, pins, colors, and tags are kept: sidecar (a .meta.json next to each session file, default) or central (one file in the data dir)")
+        configFlag   = flag.String("config", "", "YAML file of flag values (key: value per line); command-line flags win")
+        pollFlag     = flag.Int("poll_interval_ms", 0, "how often to rescan session files for new lines (ms, default 1500)")
+        watchFlag    = flag.Bool("watch", true, "pick up new lines from file system events (fsnotify), rescanning every 30s; false polls every poll_interval_ms")
+        collapseFlag = flag.Bool("collapse_tools", true, "render tool blocks collapsed in the viewer")
+        exportFmtFlag = flag.String("export_format", "md", "default format of session exports: md|txt|json|jsonl")
+        exShellFlag  = flag.Bool("export_exclude_shell", true, "leave shell calls out of exports unless the request says otherwise")
+        exToolsFlag  = flag.Bool("export_exclude_tool_outputs", true, "leave tool outputs out of exports unless the request says otherwise")
+        fgFlag       = flag.Bool("foreground", false, "container mode: no pid file, JSON logs on stdout, a read-only data dir is only a warning")
         showUsage = flag.Bool("h", false, "show help")
     )
+    flag.Var(&dirFlag, "codex", "path to ~/.codex directory; repeat or separate with commas to index several")
     flag.Parse()
     if *showUsage {
         flag.Usage()
         os.Exit(0)
     }
+    configFile := getenv("CODEX_WATCHER_CONFIG", "")
+    if *configFlag != "" {
+        configFile = *configFlag
+    }
+    if configFile != "" {
+        if err := applyConfigFile(configFile); err != nil { return config{}, err }
+    }
+    // Without a home directory there are no defaults: joining "" would
+    // silently watch ./.codex relative to wherever the process started.
+    var defCodex, defClaude string
+    if home := homeDir(); home != "" {
+        defCodex = filepath.Join(home, ".codex")
+        defClaude = filepath.Join(home, ".claude", "projects")
+    }
     cfg := config{
         Port:     getenv("PORT", "7077"),
-        CodexDir: getenv("CODEX_DIR", filepath.Join(os.Getenv("HOME"), ".codex")),
-        ClaudeDir: getenv("CLAUDE_DIR", filepath.Join(os.Getenv("HOME"), ".claude", "projects")),
+        CodexDirs: splitDirs(getenv("CODEX_DIR", defCodex)),
+        ClaudeDir: getenv("CLAUDE_DIR", defClaude),
         Host:     getenv("HOST", "0.0.0.0"),
     }
     if *portFlag != "" {
         cfg.Port = *portFlag
     }
-    if *dirFlag != "" {
-        cfg.CodexDir = *dirFlag
+    if len(dirFlag) > 0 {
+        cfg.CodexDirs = dirFlag
     }
+    if len(cfg.CodexDirs) > 0 { cfg.CodexDir = cfg.CodexDirs[0] }
     if *claudeFlag != "" {
         cfg.ClaudeDir = *claudeFlag
     }
     if *hostFlag != "" {
         cfg.Host = *hostFlag
     }
-    if *searchBudget > 0 { search.Budget = time.Duration(*searchBudget) * time.Millisecond }
-    if *searchMax > 0 { search.MaxReturn = *searchMax }
+    cfg.ResumeOffsets = *resumeFlag
+    cfg.DBPath = getenv("CODEX_WATCHER_DB", "")
+    if *dbFlag != "" {
+        cfg.DBPath = *dbFlag
+    }
+    if cfg.ResumeOffsets && cfg.DBPath == "" {
+        // the in-memory index would lose every line read before the restart
+        return cfg, errors.New("--resume_offsets needs --db to keep the lines read before the restart")
+    }
+    cfg.ConfigFile = configFile
+    cfg.Foreground = *fgFlag || getenv("CODEX_WATCHER_FOREGROUND", "") == "1"
+    cfg.GitHubToken = getenv("GITHUB_TOKEN", "")
+    if *githubFlag != "" {
+        cfg.GitHubToken = *githubFlag
+    }
+    cfg.NotionToken = getenv("NOTION_TOKEN", "")
+    if *notionFlag != "" {
+        cfg.NotionToken = *notionFlag
+    }
+    cfg.NotionDatabase = getenv("NOTION_DATABASE_ID", "")
+    if *notionDBFlag != "" {
+        cfg.NotionDatabase = *notionDBFlag
+    }
+    origins := getenv("ALLOWED_ORIGINS", "")
+    if *originsFlag != "" {
+        origins = *originsFlag
+    }
+    for _, o := range strings.Split(origins, ",") {
+        if o = strings.TrimSpace(o); o != "" {
+            cfg.AllowedOrigins = append(cfg.AllowedOrigins, o)
+        }
+    }
+    hosts := getenv("ALLOWED_HOSTS", "")
+    if *hostsFlag != "" {
+        hosts = *hostsFlag
+    }
+    for _, h := range strings.Split(hosts, ",") {
+        if h = strings.TrimSpace(h); h != "" {
+            cfg.AllowedHosts = append(cfg.AllowedHosts, h)
+        }
+    }
+    cfg.GRPCPort = getenv("GRPC_PORT", "")
+    if *grpcFlag != "" {
+        cfg.GRPCPort = *grpcFlag
+    }
+    cfg.VaultDir = getenv("CODEX_WATCHER_VAULT", "")
+    if *vaultFlag != "" {
+        cfg.VaultDir = *vaultFlag
+    }
+    cfg.VaultIdle = time.Duration(*vaultIdle) * time.Minute
+    cfg.WikiRepo = getenv("CODEX_WATCHER_WIKI_REPO", "")
+    if *wikiRepoFlag != "" {
+        cfg.WikiRepo = *wikiRepoFlag
+    }
+    cfg.WikiPath, cfg.WikiMessage, cfg.WikiPush = *wikiPathFlag, *wikiMsgFlag, *wikiPushFlag
+    for _, t := range strings.Split(*wikiAutoFlag, ",") {
+        t = strings.ToLower(strings.TrimSpace(t))
+        switch t {
+        case "":
+        case publish.WikiConfluence, publish.WikiGit:
+            cfg.WikiAuto = append(cfg.WikiAuto, t)
+        default:
+            return config{}, fmt.Errorf("--wiki_auto: unknown target %q (want confluence or git)", t)
+        }
+    }
+    if *pollFlag > 0 { cfg.PollInterval = time.Duration(*pollFlag) * time.Millisecond }
+    cfg.Watch = *watchFlag
+    cfg.ExportDrain = time.Duration(*drainFlag) * time.Second
+    cfg.TrashKeep = time.Duration(*trashFlag) * 24 * time.Hour
+    cfg.Index = indexer.DefaultOptions()
+    if *idleFlag > 0 {
+        cfg.IdleGap = time.Duration(*idleFlag) * time.Minute
+        cfg.Index.IdleGap = cfg.IdleGap
+    }
+    if *coldFlag > 0 {
+        cfg.ColdAfter = time.Duration(*coldFlag) * time.Minute
+        cfg.Index.ColdAfter = cfg.ColdAfter
+    }
+    if *scanFlag > 0 {
+        cfg.ScanWorkers = *scanFlag
+        cfg.Index.ScanWorkers = cfg.ScanWorkers
+    }
+    ignore := getenv("CODEX_WATCHER_IGNORE", "")
+    if *ignoreFlag != "" {
+        ignore = *ignoreFlag
+    }
+    for _, p := range strings.Split(ignore, ",") {
+        if p = strings.TrimSpace(p); p != "" {
+            if _, err := filepath.Match(p, ""); err != nil {
+                return config{}, fmt.Errorf("--ignore: bad pattern %q: %v", p, err)
+            }
+            cfg.Ignore = append(cfg.Ignore, p)
+        }
+    }
+    cfg.Index.IgnorePatterns = cfg.Ignore
+    if *maxAgeFlag > 0 {
+        cfg.MaxFileAge = time.Duration(*maxAgeFlag) * 24 * time.Hour
+        cfg.Index.MaxFileAge = cfg.MaxFileAge
+    }
+    if *maxSizeFlag > 0 {
+        cfg.MaxFileSize = int64(*maxSizeFlag) << 20
+        cfg.Index.MaxFileSize = cfg.MaxFileSize
+    }
+    tokens := getenv("CODEX_WATCHER_TOKEN", "")
+    if *tokenFlag != "" {
+        tokens = *tokenFlag
+    }
+    for _, t := range strings.Split(tokens, ",") {
+        if t = strings.TrimSpace(t); t != "" {
+            cfg.APITokens = append(cfg.APITokens, t)
+        }
+    }
+    cfg.ColorLabels = getenv("COLOR_LABELS", "")
+    if *labelsFlag != "" {
+        cfg.ColorLabels = *labelsFlag
+    }
+    if cfg.ColorLabels != "" {
+        palette, err := parseColorLabels(cfg.ColorLabels)
+        if err != nil { return cfg, err }
+        cfg.Index.ColorLabels = palette
+    }
+    cfg.ModelsConfig = getenv("CODEX_WATCHER_MODELS", "")
+    if *modelsFlag != "" {
+        cfg.ModelsConfig = *modelsFlag
+    }
+    modelsPath := cfg.ModelsConfig
+    if modelsPath == "" {
+        // optional default next to the directory registry
+        p := filepath.Join(cfg.CodexDir, indexer.ModelsFile)
+        if _, err := os.Stat(p); err == nil { modelsPath = p }
+    }
+    if modelsPath != "" {
+        mc, err := indexer.LoadModelConfig(modelsPath)
+        if err != nil { return cfg, err }
+        cfg.Index.Models = mc
+    }
+    cfg.Pricing = getenv("CODEX_WATCHER_PRICING", "")
+    if *pricingFlag != "" {
+        cfg.Pricing = *pricingFlag
+    }
+    if cfg.Pricing != "" {
+        prices, err := indexer.LoadPricing(cfg.Pricing)
+        if err != nil { return cfg, err }
+        cfg.Index.Models = cfg.Index.Models.WithPrices(prices)
+    }
+    cfg.Defaults = api.Defaults{CollapseTools: *collapseFlag, ExportFormat: strings.ToLower(*exportFmtFlag), ExportExcludeShell: *exShellFlag, ExportExcludeToolOutputs: *exToolsFlag}
+    if err := api.SetDefaults(cfg.Defaults); err != nil { return cfg, err }
+    cfg.Search = search.CurrentOptions()
+    if *searchBudget > 0 { cfg.Search.Budget = time.Duration(*searchBudget) * time.Millisecond }
+    if *searchMax > 0 { cfg.Search.MaxReturn = *searchMax }
+    cfg.Search.ToolOutputs = *searchTools
+    if *searchOutMax < 0 { return cfg, fmt.Errorf("--search_output_max_bytes must not be negative") }
+    cfg.Search.MaxOutputBytes = *searchOutMax
     if cfg.CodexDir == "" {
-        return cfg, errors.New("could not resolve ~/.codex directory; set CODEX_DIR or --codex")
+        return cfg, errors.New("could not resolve ~/.codex directory ($HOME is unset and the user has no home); set CODEX_DIR or --codex")
+    }
+    cfg.DataDir = getenv("CODEX_WATCHER_DATA_DIR", "")
+    if *dataFlag != "" {
+        cfg.DataDir = *dataFlag
+    }
+    if err := validateDirs(&cfg); err != nil { return cfg, err }
+    cfg.AttachmentsDir = getenv("CODEX_WATCHER_ATTACHMENTS_DIR", filepath.Join(cfg.DataDir, "attachments"))
+    if *attachFlag != "" {
+        cfg.AttachmentsDir = *attachFlag
+    }
+    cfg.Index.AttachmentDir = cfg.AttachmentsDir
+    cfg.MetaStore = getenv("CODEX_WATCHER_META_STORE", "sidecar")
+    if *metaFlag != "" {
+        cfg.MetaStore = *metaFlag
+    }
+    switch cfg.MetaStore {
+    case "sidecar":
+    case "central":
+        cfg.Index.MetaStorePath = filepath.Join(cfg.DataDir, indexer.MetaStoreFile)
+    default:
+        return cfg, fmt.Errorf("--meta_store: unknown store %q (want sidecar or central)", cfg.MetaStore)
     }
     return cfg, nil
 }
 
+// readConfigFile parses the flat YAML subset the config file uses: one
+// "key: value" per line, # comments, optional quotes around values. Keys are
+// flag names; dashes may stand in for underscores.
+func readConfigFile(path string) (map[string]string, error) {
+    b, err := os.ReadFile(path)
+    if err != nil { return nil, err }
+    vals := make(map[string]string)
+    for i, line := range strings.Split(string(b), "\n") {
+        t := strings.TrimSpace(line)
+        if t == "" || strings.HasPrefix(t, "#") || t == "---" { continue }
+        if line[0] == ' ' || line[0] == '\t' || strings.HasPrefix(t, "- ") {
+            return nil, fmt.Errorf("%s:%d: nested values are not supported", path, i+1)
+        }
+        key, val, ok := strings.Cut(t, ":")
+        if !ok { return nil, fmt.Errorf("%s:%d: want key: value", path, i+1) }
+        key = strings.ReplaceAll(strings.TrimSpace(key), "-", "_")
+        val = strings.TrimSpace(val)
+        if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+            val = val[1 : len(val)-1]
+        } else if j := strings.Index(val, " #"); j >= 0 {
+            val = strings.TrimSpace(val[:j])
+        }
+        vals[key] = val
+    }
+    return vals, nil
+}
+
+// fileSettings records the flags applyConfigFile set, so cmdStart leaves
+// them to the child's own reading of the file and reloads can change them.
+var fileSettings = map[string]bool{}
+
+// applyConfigFile sets every flag named in the config file that was not
+// given on the command line. File values therefore beat environment
+// variables, like flags do.
+func applyConfigFile(path string) error {
+    vals, err := readConfigFile(path)
+    if err != nil { return err }
+    explicit := make(map[string]bool)
+    flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+    for key, val := range vals {
+        if key == "config" || flag.Lookup(key) == nil {
+            return fmt.Errorf("%s: unknown setting %q", path, key)
+        }
+        if explicit[key] { continue }
+        if err := flag.Set(key, val); err != nil { return fmt.Errorf("%s: %s: %w", path, key, err) }
+        fileSettings[key] = true
+    }
+    return nil
+}
+
+// runtimeSettings are the config file keys ReloadConfig hands to
+// api.ApplySettings; api_token is reloaded separately.
+var runtimeSettings = []string{"search_budget_ms", "search_max", "search_tool_outputs", "search_output_max_bytes", "poll_interval_ms", "collapse_tools", "export_format", "export_exclude_shell", "export_exclude_tool_outputs"}
+
+// reloadConfigFile re-reads the config file on SIGHUP or POST
+// /api/admin/reload and applies the settings that can change while running:
+// the runtimeSettings and api_token. Settings given on the command line keep
+// their values, and nothing is applied unless every value is valid. It
+// returns the settings applied.
+func reloadConfigFile(path string, idx *indexer.Indexer, tokens *api.Tokens) ([]string, error) {
+    vals, err := readConfigFile(path)
+    if err != nil { return nil, err }
+    flag.Visit(func(f *flag.Flag) {
+        if !fileSettings[f.Name] { delete(vals, f.Name) }
+    })
+    params := make(map[string][]string)
+    for _, key := range runtimeSettings {
+        if v, ok := vals[key]; ok { params[key] = []string{v} }
+    }
+    changed, err := api.ApplySettings(idx, params)
+    if err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+    var applied []string
+    for _, key := range runtimeSettings {
+        if _, ok := changed[key]; ok { applied = append(applied, key) }
+    }
+    if v, ok := vals["api_token"]; ok {
+        // shared by the REST and gRPC APIs
+        tokens.Set(strings.Split(v, ","))
+        applied = append(applied, "api_token")
+    }
+    return applied, nil
+}
+
+// saveConfigSettings rewrites the given keys in the config file in place,
+// keeping comments and other lines, and appends keys it does not hold yet.
+func saveConfigSettings(path string, values map[string]string) error {
+    b, err := os.ReadFile(path)
+    if err != nil && !os.IsNotExist(err) { return err }
+    lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+    if len(b) == 0 { lines = nil }
+    done := make(map[string]bool)
+    for i, line := range lines {
+        t := strings.TrimSpace(line)
+        if t == "" || strings.HasPrefix(t, "#") { continue }
+        key, _, ok := strings.Cut(t, ":")
+        key = strings.ReplaceAll(strings.TrimSpace(key), "-", "_")
+        if v, want := values[key]; ok && want {
+            lines[i] = key + ": " + v
+            done[key] = true
+        }
+    }
+    keys := make([]string, 0, len(values))
+    for k := range values {
+        if !done[k] { keys = append(keys, k) }
+    }
+    sort.Strings(keys)
+    for _, k := range keys { lines = append(lines, k+": "+values[k]) }
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil { return err }
+    if err := os.Rename(tmp, path); err != nil {
+        os.Remove(tmp)
+        return err
+    }
+    return nil
+}
+
+// validateDirs makes the configured directories absolute, so a re-exec'd
+// server sees the same paths, and rejects ones that exist as plain files.
+// The data dir defaults to the first codex dir.
+func validateDirs(cfg *config) error {
+    if cfg.DataDir == "" { cfg.DataDir = cfg.CodexDir }
+    type dir struct{ flag, env string; path *string }
+    var dirs []dir
+    for i := range cfg.CodexDirs {
+        dirs = append(dirs, dir{"codex", "CODEX_DIR", &cfg.CodexDirs[i]})
+    }
+    for _, d := range append(dirs, []dir{
+        {"claude", "CLAUDE_DIR", &cfg.ClaudeDir},
+        {"data_dir", "CODEX_WATCHER_DATA_DIR", &cfg.DataDir},
+    }...) {
+        if *d.path == "" { continue }
+        abs, err := filepath.Abs(*d.path)
+        if err != nil { return fmt.Errorf("--%s %s: %w", d.flag, *d.path, err) }
+        *d.path = abs
+        if fi, err := os.Stat(abs); err == nil && !fi.IsDir() {
+            return fmt.Errorf("%s is a file, not a directory; point %s or --%s at a directory", abs, d.env, d.flag)
+        }
+    }
+    if len(cfg.CodexDirs) > 0 { cfg.CodexDir = cfg.CodexDirs[0] }
+    return nil
+}
+
+// prepareDataDir creates the data dir and checks that it is writable, so a
+// read-only mount fails at startup instead of losing the pid and state files.
+func prepareDataDir(cfg config) error {
+    if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil {
+        return fmt.Errorf("cannot create data dir %s: %w; set --data_dir or CODEX_WATCHER_DATA_DIR to a writable directory", cfg.DataDir, err)
+    }
+    f, err := os.CreateTemp(cfg.DataDir, ".codex-watcher-probe-*")
+    if err != nil {
+        return fmt.Errorf("data dir %s is not writable: %w; set --data_dir or CODEX_WATCHER_DATA_DIR to a writable directory", cfg.DataDir, err)
+    }
+    f.Close()
+    os.Remove(f.Name())
+    return nil
+}
+
+// parseColorLabels parses "name=#hex,name=#hex" into a label palette.
+func parseColorLabels(spec string) (map[string]string, error) {
+    palette := make(map[string]string)
+    for _, kv := range strings.Split(spec, ",") {
+        name, color, ok := strings.Cut(strings.TrimSpace(kv), "=")
+        name, color = strings.TrimSpace(name), strings.TrimSpace(color)
+        if !ok || name == "" || !strings.HasPrefix(color, "#") || !indexer.ValidColor(color) {
+            return nil, fmt.Errorf("invalid --color_labels entry %q (want name=#hex)", kv)
+        }
+        palette[name] = color
+    }
+    return palette, nil
+}
+
 func main() {
     // Subcommand routing: start|stop|restart|status|browse|serve (internal) or default serve
     if len(os.Args) > 1 {
@@ -106,6 +581,48 @@ func main() {
             if err != nil { log.Fatal(err) }
             if err := cmdBrowse(cfg); err != nil { log.Fatal(err) }
             return
+        case "verify":
+            os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+            cfg, err := resolveConfig()
+            if err != nil { log.Fatal(err) }
+            if !cmdVerify(cfg) { os.Exit(1) }
+            return
+        case "repair":
+            if err := cmdRepair(os.Args[2:]); err != nil { log.Fatal(err) }
+            return
+        case "export-diff":
+            if err := cmdExportDiff(os.Args[2:]); err != nil { log.Fatal(err) }
+            return
+        case "export-site":
+            os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+            opts := registerSiteFlags()
+            cfg, err := resolveConfig()
+            if err != nil { log.Fatal(err) }
+            if err := cmdExportSite(cfg, opts); err != nil { log.Fatal(err) }
+            return
+        case "journal":
+            os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+            opts := registerJournalFlags()
+            cfg, err := resolveConfig()
+            if err != nil { log.Fatal(err) }
+            if err := cmdJournal(cfg, opts); err != nil { log.Fatal(err) }
+            return
+        case "meta":
+            if len(os.Args) < 3 { log.Fatal("usage: codex-watcher meta import [--remove] | export") }
+            action := os.Args[2]
+            os.Args = append([]string{os.Args[0]}, os.Args[3:]...)
+            remove := flag.Bool("remove", false, "with import, delete the sidecars copied into the central store")
+            cfg, err := resolveConfig()
+            if err != nil { log.Fatal(err) }
+            if err := cmdMeta(cfg, action, *remove); err != nil { log.Fatal(err) }
+            return
+        case "once":
+            os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+            opts := registerOnceFlags()
+            cfg, err := resolveConfig()
+            if err != nil { log.Fatal(err) }
+            if err := cmdOnce(cfg, opts); err != nil { log.Fatal(err) }
+            return
         case "serve":
             // fallthrough to run server normally (internal)
             os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
@@ -119,14 +636,55 @@ func main() {
     runServer(cfg)
 }
 
+// serverHosts are the host names browsers may use for the server: the
+// configured ones, the bind host, and this machine's name.
+func serverHosts(cfg config) []string {
+    hosts := append([]string{cfg.Host}, cfg.AllowedHosts...)
+    if h, err := os.Hostname(); err == nil { hosts = append(hosts, h, h+".local") }
+    return hosts
+}
+
 func runServer(cfg config) {
+    if cfg.Foreground {
+        // log.Printf goes through the default slog handler from here on
+        slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+    }
+    if err := prepareDataDir(cfg); err != nil {
+        // In a container the offsets state and audit log are optional
+        if !cfg.Foreground { log.Fatal(err) }
+        log.Printf("warning: %v", err)
+    }
     // Prepare indexer
-    idx := indexer.New(cfg.CodexDir, cfg.ClaudeDir)
+    idx := indexer.New(cfg.CodexDirs, cfg.ClaudeDir, cfg.Index)
+    // the API searches with the process-wide options, which ApplySettings
+    // replaces at runtime
+    search.SetOptions(cfg.Search)
+    // resuming skips the lines read before the restart, which only the
+    // database still has; resolveConfig refuses --resume_offsets without it
+    idx.SetStatePath(stateFilePath(cfg), cfg.ResumeOffsets && cfg.DBPath != "")
+    idx.SetPollInterval(cfg.PollInterval)
+    idx.SetWatch(cfg.Watch)
+    idx.SetTrashRetention(cfg.TrashKeep)
+
+    api.AuditPath = filepath.Join(cfg.DataDir, "codex-watcher-audit.jsonl")
+    publish.GitHubToken = cfg.GitHubToken
+    publish.NotionToken, publish.NotionDatabaseID = cfg.NotionToken, cfg.NotionDatabase
+    // Ticket trackers are configured from the environment only
+    publish.JiraURL, publish.JiraEmail, publish.JiraToken = os.Getenv("JIRA_URL"), os.Getenv("JIRA_EMAIL"), os.Getenv("JIRA_TOKEN")
+    publish.LinearAPIKey = os.Getenv("LINEAR_API_KEY")
+    // so is Confluence; the git wiki comes from flags
+    publish.ConfluenceURL, publish.ConfluenceEmail, publish.ConfluenceToken = os.Getenv("CONFLUENCE_URL"), os.Getenv("CONFLUENCE_EMAIL"), os.Getenv("CONFLUENCE_TOKEN")
+    publish.ConfluenceSpace, publish.ConfluenceParentID = os.Getenv("CONFLUENCE_SPACE"), os.Getenv("CONFLUENCE_PARENT_ID")
+    publish.WikiRepo, publish.WikiPush = cfg.WikiRepo, cfg.WikiPush
+    if cfg.WikiPath != "" { publish.WikiPath = cfg.WikiPath }
+    if cfg.WikiMessage != "" { publish.WikiMessage = cfg.WikiMessage }
 
     // Sanity checks for expected directories
-    codexSessions := filepath.Join(cfg.CodexDir, "sessions")
-    if fi, err := os.Stat(codexSessions); err != nil || !fi.IsDir() {
-        log.Printf("warning: Codex sessions directory not found: %s — no Codex messages will appear until it exists.", codexSessions)
+    for _, dir := range cfg.CodexDirs {
+        codexSessions := filepath.Join(dir, "sessions")
+        if fi, err := os.Stat(codexSessions); err != nil || !fi.IsDir() {
+            log.Printf("warning: Codex sessions directory not found: %s — no Codex messages will appear from it until it exists.", codexSessions)
+        }
     }
     if cfg.ClaudeDir == "" {
         log.Printf("info: CLAUDE_DIR not set; Claude support is disabled.")
@@ -139,29 +697,91 @@ func runServer(cfg config) {
     defer cancel()
 
     var wg sync.WaitGroup
+    if cfg.DBPath != "" {
+        db, err := store.Open(cfg.DBPath)
+        if err != nil { log.Fatal(err) }
+        defer db.Close()
+        files, lines, err := db.Restore(idx)
+        if err != nil { log.Fatal(err) }
+        log.Printf("restored %d lines from %d files in %s", lines, files, cfg.DBPath)
+        // the full-text index narrows searches from here on
+        so := search.CurrentOptions()
+        so.Index = db.Candidates
+        search.SetOptions(so)
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            db.Run(idx, 5*time.Second, ctx.Done())
+        }()
+    }
     wg.Add(1)
     go func() {
         defer wg.Done()
         idx.Run(ctx.Done())
     }()
+    if cfg.VaultDir != "" {
+        vault := &exporter.VaultSync{Dir: cfg.VaultDir, BaseURL: "http://localhost:" + cfg.Port, Idle: cfg.VaultIdle}
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            vault.Run(idx, time.Minute, ctx.Done())
+        }()
+        log.Printf("syncing finished sessions to vault %s", cfg.VaultDir)
+    }
+    if len(cfg.WikiAuto) > 0 {
+        for _, t := range cfg.WikiAuto {
+            if !publish.WikiConfigured(t) { log.Printf("warning: --wiki_auto target %s is not configured; its publishes will fail", t) }
+        }
+        wiki := &publish.WikiSync{Targets: cfg.WikiAuto, StatePath: filepath.Join(cfg.DataDir, "codex-watcher-wiki.json"), Idle: cfg.VaultIdle}
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            wiki.Run(ctx, idx, time.Minute)
+        }()
+        log.Printf("publishing finished sessions to %s", strings.Join(cfg.WikiAuto, ", "))
+    }
 
     // HTTP server
     mux := http.NewServeMux()
+    tokens := api.NewTokens(cfg.APITokens)
+    if cfg.ConfigFile != "" {
+        api.ReloadConfig = func() ([]string, error) { return reloadConfigFile(cfg.ConfigFile, idx, tokens) }
+        api.SaveSettings = func(values map[string]string) error { return saveConfigSettings(cfg.ConfigFile, values) }
+    }
     // Serve static assets from ./static at /static/
     mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
     api.AttachRoutes(mux, idx)
 
     srv := &http.Server{
         Addr:              cfg.Host + ":" + cfg.Port,
-        Handler:           withLogging(mux),
+        Handler:           withLogging(api.WithOriginCheck(api.WithTokens(mux, tokens), cfg.AllowedOrigins, serverHosts(cfg))),
         ReadHeaderTimeout: 5 * time.Second,
         IdleTimeout:       60 * time.Second,
     }
 
-    log.Printf("codex-watcher listening on http://%s:%s (codex=%s, claude=%s)\n", cfg.Host, cfg.Port, cfg.CodexDir, cfg.ClaudeDir)
+    log.Printf("codex-watcher listening on http://%s:%s (codex=%s, claude=%s)\n", cfg.Host, cfg.Port, strings.Join(cfg.CodexDirs, ","), cfg.ClaudeDir)
+
+    // write pid file; a container's process manager tracks the pid itself
+    if !cfg.Foreground {
+        _ = writePIDFile(cfg, os.Getpid())
+    }
 
-    // write pid file
-    _ = writePIDFile(cfg, os.Getpid())
+    hup := make(chan os.Signal, 1)
+    signal.Notify(hup, syscall.SIGHUP)
+    go func() {
+        for range hup {
+            if api.ReloadConfig == nil {
+                log.Printf("SIGHUP ignored: no --config file")
+                continue
+            }
+            applied, err := api.ReloadConfig()
+            if err != nil {
+                log.Printf("config reload failed, keeping the current settings: %v", err)
+                continue
+            }
+            log.Printf("reloaded %s (%s)", cfg.ConfigFile, strings.Join(applied, ", "))
+        }
+    }()
 
     go func() {
         if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -169,22 +789,59 @@ func runServer(cfg config) {
         }
     }()
 
+    stopGRPC := func() {}
+    if cfg.GRPCPort != "" {
+        lis, err := net.Listen("tcp", cfg.Host+":"+cfg.GRPCPort)
+        if err != nil { log.Fatalf("grpc listen: %v", err) }
+        grpcSrv := grpcapi.NewServer(idx, tokens)
+        stopGRPC = grpcSrv.GracefulStop
+        log.Printf("gRPC API listening on %s", lis.Addr())
+        go func() {
+            if err := grpcSrv.Serve(lis); err != nil {
+                log.Printf("grpc server error: %v", err)
+            }
+        }()
+    }
+
     <-ctx.Done()
     log.Println("shutting down...")
-    shutdownCtx, cancel2 := context.WithTimeout(context.Background(), 5*time.Second)
+    // Give long-running exports more time than ordinary requests; past the
+    // deadline they end with an "incomplete" marker rather than a silent cut.
+    grace := 5 * time.Second
+    if n := api.InFlightExports(); n > 0 && cfg.ExportDrain > grace {
+        log.Printf("waiting up to %s for %d in-flight export(s)", cfg.ExportDrain, n)
+        grace = cfg.ExportDrain
+    }
+    shutdownCtx, cancel2 := context.WithTimeout(context.Background(), grace)
     defer cancel2()
-    _ = srv.Shutdown(shutdownCtx)
-    _ = removePIDFile(cfg)
+    stopGRPC()
+    if err := srv.Shutdown(shutdownCtx); err != nil {
+        if n := api.AbortExports(2 * time.Second); n > 0 {
+            log.Printf("aborted %d unfinished export(s)", n)
+        }
+        _ = srv.Close()
+    }
+    if !cfg.Foreground {
+        _ = removePIDFile(cfg)
+    }
     wg.Wait()
 }
 
 func pidFilePath(cfg config) string {
-    return filepath.Join(cfg.CodexDir, "codex-watcher.pid")
+    return filepath.Join(cfg.DataDir, "codex-watcher.pid")
+}
+
+func stateFilePath(cfg config) string {
+    return filepath.Join(cfg.DataDir, "codex-watcher.state.json")
+}
+
+func logFilePath(cfg config) string {
+    return filepath.Join(cfg.DataDir, "codex-watcher.log")
 }
 
 func writePIDFile(cfg config, pid int) error {
     // ensure dir exists
-    _ = os.MkdirAll(cfg.CodexDir, 0o755)
+    _ = os.MkdirAll(cfg.DataDir, 0o755)
     return os.WriteFile(pidFilePath(cfg), []byte(strconv.Itoa(pid)), 0o644)
 }
 
@@ -215,27 +872,74 @@ func cmdStart(cfg config) error {
         log.Printf("already running (pid %d)", pid)
         return nil
     }
+    if err := prepareDataDir(cfg); err != nil { return err }
     exe, err := os.Executable()
     if err != nil { return err }
     // re-exec self with 'serve' subcommand
     args := []string{"serve"}
     if cfg.Port != "" { args = append(args, "--port", cfg.Port) }
-    if cfg.CodexDir != "" { args = append(args, "--codex", cfg.CodexDir) }
+    for _, d := range cfg.CodexDirs { args = append(args, "--codex", d) }
+    if cfg.ClaudeDir != "" { args = append(args, "--claude", cfg.ClaudeDir) }
+    args = append(args, "--data_dir", cfg.DataDir)
     if cfg.Host != "" { args = append(args, "--host", cfg.Host) }
+    if cfg.ResumeOffsets { args = append(args, "--resume_offsets") }
+    if cfg.DBPath != "" { args = append(args, "--db", cfg.DBPath) }
+    if cfg.GRPCPort != "" { args = append(args, "--grpc_port", cfg.GRPCPort) }
+    if cfg.ColorLabels != "" { args = append(args, "--color_labels", cfg.ColorLabels) }
+    if len(cfg.AllowedOrigins) > 0 { args = append(args, "--allowed_origins", strings.Join(cfg.AllowedOrigins, ",")) }
+    if len(cfg.AllowedHosts) > 0 { args = append(args, "--allowed_hosts", strings.Join(cfg.AllowedHosts, ",")) }
+    args = append(args, "--export_drain_sec", strconv.Itoa(int(cfg.ExportDrain/time.Second)))
+    if cfg.IdleGap > 0 { args = append(args, "--idle_gap_min", strconv.Itoa(int(cfg.IdleGap/time.Minute))) }
+    args = append(args, "--trash_days", strconv.Itoa(int(cfg.TrashKeep/(24*time.Hour))))
+    if cfg.ColdAfter > 0 { args = append(args, "--cold_compress_min", strconv.Itoa(int(cfg.ColdAfter/time.Minute))) }
+    if cfg.ScanWorkers > 0 { args = append(args, "--scan_workers", strconv.Itoa(cfg.ScanWorkers)) }
+    if cfg.MetaStore != "sidecar" { args = append(args, "--meta_store", cfg.MetaStore) }
+    args = append(args, "--attachments_dir", cfg.AttachmentsDir)
+    if len(cfg.Ignore) > 0 { args = append(args, "--ignore", strings.Join(cfg.Ignore, ",")) }
+    if cfg.MaxFileAge > 0 { args = append(args, "--max_file_age_days", strconv.Itoa(int(cfg.MaxFileAge/(24*time.Hour)))) }
+    if cfg.MaxFileSize > 0 { args = append(args, "--max_file_size_mb", strconv.FormatInt(cfg.MaxFileSize>>20, 10)) }
+    if cfg.ModelsConfig != "" { args = append(args, "--models_config", cfg.ModelsConfig) }
+    if cfg.NotionDatabase != "" { args = append(args, "--notion_database", cfg.NotionDatabase) }
+    if cfg.Pricing != "" { args = append(args, "--pricing", cfg.Pricing) }
+    if cfg.ConfigFile != "" { args = append(args, "--config", cfg.ConfigFile) }
+    if !cfg.Defaults.CollapseTools && !fileSettings["collapse_tools"] { args = append(args, "--collapse_tools=false") }
+    if cfg.Defaults.ExportFormat != "md" && !fileSettings["export_format"] { args = append(args, "--export_format", cfg.Defaults.ExportFormat) }
+    if !cfg.Defaults.ExportExcludeShell && !fileSettings["export_exclude_shell"] { args = append(args, "--export_exclude_shell=false") }
+    if !cfg.Defaults.ExportExcludeToolOutputs && !fileSettings["export_exclude_tool_outputs"] { args = append(args, "--export_exclude_tool_outputs=false") }
+    if !cfg.Watch && !fileSettings["watch"] { args = append(args, "--watch=false") }
+    if cfg.PollInterval > 0 && !fileSettings["poll_interval_ms"] { args = append(args, "--poll_interval_ms", strconv.Itoa(int(cfg.PollInterval/time.Millisecond))) }
+    if cfg.VaultDir != "" || len(cfg.WikiAuto) > 0 { args = append(args, "--vault_idle_min", strconv.Itoa(int(cfg.VaultIdle/time.Minute))) }
+    if cfg.VaultDir != "" { args = append(args, "--vault", cfg.VaultDir) }
+    if cfg.WikiRepo != "" { args = append(args, "--wiki_repo", cfg.WikiRepo) }
+    if cfg.WikiPath != "" { args = append(args, "--wiki_path", cfg.WikiPath) }
+    if cfg.WikiMessage != "" { args = append(args, "--wiki_message", cfg.WikiMessage) }
+    if cfg.WikiPush { args = append(args, "--wiki_push") }
+    if len(cfg.WikiAuto) > 0 { args = append(args, "--wiki_auto", strings.Join(cfg.WikiAuto, ",")) }
     cmd := exec.Command(exe, args...)
-    // Run child in background without logging to current console
-    if devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
-        // Close in parent after start; child keeps its own fd
-        defer devnull.Close()
-        cmd.Stdout = devnull
-        cmd.Stderr = devnull
+    // pass tokens via the environment so they don't show up in ps output
+    cmd.Env = os.Environ()
+    if len(cfg.APITokens) > 0 {
+        cmd.Env = append(cmd.Env, "CODEX_WATCHER_TOKEN="+strings.Join(cfg.APITokens, ","))
     }
+    if cfg.GitHubToken != "" {
+        cmd.Env = append(cmd.Env, "GITHUB_TOKEN="+cfg.GitHubToken)
+    }
+    if cfg.NotionToken != "" {
+        cmd.Env = append(cmd.Env, "NOTION_TOKEN="+cfg.NotionToken)
+    }
+    // Run child in background, logging to the data dir instead of the console
+    logf, err := os.OpenFile(logFilePath(cfg), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+    if err != nil { return fmt.Errorf("open log file: %w", err) }
+    // Close in parent after start; child keeps its own fd
+    defer logf.Close()
+    cmd.Stdout = logf
+    cmd.Stderr = logf
     // detach from parent session/process group
     cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
     if err := cmd.Start(); err != nil { return err }
     // write child pid
     _ = writePIDFile(cfg, cmd.Process.Pid)
-    log.Printf("started pid %d on http://localhost:%s", cmd.Process.Pid, cfg.Port)
+    log.Printf("started pid %d on http://localhost:%s (log: %s)", cmd.Process.Pid, cfg.Port, logFilePath(cfg))
     return nil
 }
 
@@ -287,7 +991,9 @@ func cmdStatus(cfg config) error {
         TotalSessions int `json:"total_sessions"`
     }
     var st stats
-    if resp, err := client.Get(url); err == nil {
+    req, _ := http.NewRequest(http.MethodGet, url, nil)
+    if secrets := api.TokenSecrets(cfg.APITokens); len(secrets) > 0 { req.Header.Set("Authorization", "Bearer "+secrets[0]) }
+    if resp, err := client.Do(req); err == nil {
         _ = json.NewDecoder(resp.Body).Decode(&st)
         resp.Body.Close()
     }
@@ -299,6 +1005,240 @@ func cmdStatus(cfg config) error {
     return nil
 }
 
+// cmdVerify checks all session files and prints a report. It returns false
+// when any issue was found so automation can rely on the exit code.
+func cmdVerify(cfg config) bool {
+    idx := indexer.New(cfg.CodexDirs, cfg.ClaudeDir, cfg.Index)
+    report := idx.Verify()
+    for _, is := range report.Issues {
+        loc := is.Path
+        if is.Line > 0 { loc += ":" + strconv.Itoa(is.Line) }
+        fmt.Printf("%s: %s: %s\n", loc, is.Kind, is.Detail)
+    }
+    fmt.Printf("verified %d files, %d lines: %d issues\n", report.Files, report.Lines, len(report.Issues))
+    return report.OK()
+}
+
+// onceOptions are the extra flags of the one-shot "once" subcommand.
+type onceOptions struct {
+    out       *string
+    query     *string
+    limit     *int
+    export    *string
+    exportCWD *string
+    format    *string
+}
+
+// registerOnceFlags adds the "once" flags to the global flag set so
+// resolveConfig parses them together with --codex, --claude, etc.
+func registerOnceFlags() onceOptions {
+    return onceOptions{
+        out:       flag.String("out", "-", "output file (- for stdout)"),
+        query:     flag.String("query", "", "also run this search (same syntax as /api/search) and include the hits"),
+        limit:     flag.Int("limit", 200, "maximum search hits with --query"),
+        export:    flag.String("export", "", "write this session's export instead of the index"),
+        exportCWD: flag.String("export_cwd", "", "write the Markdown export of all sessions under this directory instead of the index"),
+        format:    flag.String("format", "md", "format for --export: md|txt|json|jsonl"),
+    }
+}
+
+// cmdOnce scans the configured directories once, writes the index (plus
+// optional search hits) or a single export, and exits without serving HTTP.
+func cmdOnce(cfg config, opts onceOptions) error {
+    idx := indexer.New(cfg.CodexDirs, cfg.ClaudeDir, cfg.Index)
+    if err := idx.Reindex(); err != nil { return err }
+
+    var w io.Writer = os.Stdout
+    if *opts.out != "" && *opts.out != "-" {
+        f, err := os.Create(*opts.out)
+        if err != nil { return err }
+        defer f.Close()
+        w = f
+    }
+    return writeOnce(w, idx, cfg, opts)
+}
+
+// writeOnce writes what cmdOnce outputs for an index already read: the
+// export named by opts, or the JSON summary of cfg's directories with the
+// hits of opts.query.
+func writeOnce(w io.Writer, idx *indexer.Indexer, cfg config, opts onceOptions) error {
+    ef := exporter.Filters{ExcludeShellCalls: true, ExcludeToolOutputs: true}
+    switch {
+    case *opts.export != "":
+        n, err := exporter.WriteSession(w, idx, *opts.export, *opts.format, ef)
+        if err != nil { return err }
+        if n == 0 { return fmt.Errorf("session %s not found or empty", *opts.export) }
+        return nil
+    case *opts.exportCWD != "":
+        _, err := exporter.WriteByDirAllMarkdown(w, idx, *opts.exportCWD, time.Time{}, time.Time{}, ef)
+        return err
+    }
+
+    sessions := idx.Sessions()
+    if sessions == nil { sessions = []indexer.Session{} }
+    doc := map[string]any{
+        "generated_at": time.Now().UTC(),
+        "codex_dir":    cfg.CodexDir,
+        "codex_dirs":   cfg.CodexDirs,
+        "claude_dir":   cfg.ClaudeDir,
+        "stats":        idx.Stats(),
+        "sessions":     sessions,
+    }
+    if *opts.query != "" {
+        // batch jobs want complete results, not the interactive time budget
+        so := cfg.Search
+        if so.Budget < time.Minute { so.Budget = time.Minute }
+        doc["search"] = search.New(idx, so).Exec(search.Parse(*opts.query, "all"), *opts.limit, 0)
+    }
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    return enc.Encode(doc)
+}
+
+// siteFlags are the extra flags of the "export-site" subcommand.
+type siteFlags struct {
+    out       *string
+    title     *string
+    cwd       *string
+    provider  *string
+    after     *string
+    before    *string
+    anonymize *bool
+    meta      *bool
+    stats     *bool
+}
+
+func registerSiteFlags() siteFlags {
+    return siteFlags{
+        out:       flag.String("out", "./site", "output directory"),
+        title:     flag.String("title", "", "site heading (default \"Codex sessions\")"),
+        cwd:       flag.String("cwd", "", "only sessions whose working directory starts with this prefix"),
+        provider:  flag.String("provider", "", "only codex or claude sessions"),
+        after:     flag.String("after", "", "only messages at or after this RFC3339 time"),
+        before:    flag.String("before", "", "only messages at or before this RFC3339 time"),
+        anonymize: flag.Bool("anonymize", false, "replace usernames, home paths, hosts, and emails with placeholders"),
+        meta:      flag.Bool("meta", false, "add a metadata block (provider, models, dates, duration, counts, tags, sources) to each session page"),
+        stats:     flag.Bool("stats", false, "add a footer with message, tool call, duration, and token counts to each session page"),
+    }
+}
+
+// cmdExportSite scans once and renders the selected sessions as a static HTML
+// site with a prebuilt client-side search index.
+func cmdExportSite(cfg config, opts siteFlags) error {
+    o := exporter.SiteOptions{Title: *opts.title, CWDPrefix: *opts.cwd, Provider: *opts.provider}
+    o.Filters = exporter.Filters{ExcludeShellCalls: true, ExcludeToolOutputs: true, Anonymize: *opts.anonymize, Meta: *opts.meta, Stats: *opts.stats}
+    var err error
+    if *opts.after != "" {
+        if o.Filters.After, err = time.Parse(time.RFC3339, *opts.after); err != nil { return fmt.Errorf("--after: %w", err) }
+    }
+    if *opts.before != "" {
+        if o.Filters.Before, err = time.Parse(time.RFC3339, *opts.before); err != nil { return fmt.Errorf("--before: %w", err) }
+    }
+    idx := indexer.New(cfg.CodexDirs, cfg.ClaudeDir, cfg.Index)
+    if err := idx.Reindex(); err != nil { return err }
+    n, err := exporter.WriteSite(idx, *opts.out, o)
+    if err != nil { return err }
+    fmt.Printf("wrote %d sessions to %s\n", n, *opts.out)
+    return nil
+}
+
+// journalFlags are the extra flags of the "journal" subcommand.
+type journalFlags struct {
+    out       *string
+    cwd       *string
+    week      *string
+    anonymize *bool
+}
+
+func registerJournalFlags() journalFlags {
+    return journalFlags{
+        out:       flag.String("out", "-", "output file (- for stdout)"),
+        cwd:       flag.String("cwd", "", "only sessions whose working directory starts with this prefix"),
+        week:      flag.String("week", "", "the week as YYYY-Www or any YYYY-MM-DD in it (default: this week)"),
+        anonymize: flag.Bool("anonymize", false, "replace usernames, home paths, hosts, and emails with placeholders"),
+    }
+}
+
+// cmdJournal scans once and writes the Markdown journal of one week.
+func cmdJournal(cfg config, opts journalFlags) error {
+    week, err := exporter.ParseWeek(*opts.week, time.Now(), time.Local)
+    if err != nil { return err }
+    idx := indexer.New(cfg.CodexDirs, cfg.ClaudeDir, cfg.Index)
+    if err := idx.Reindex(); err != nil { return err }
+    var w io.Writer = os.Stdout
+    if *opts.out != "" && *opts.out != "-" {
+        f, err := os.Create(*opts.out)
+        if err != nil { return err }
+        defer f.Close()
+        w = f
+    }
+    _, err = exporter.WriteJournal(w, idx, *opts.cwd, exporter.JournalOptions{Week: week, Anonymize: *opts.anonymize})
+    return err
+}
+
+// cmdMeta moves session metadata between the sidecar files and the central
+// store in the data dir: import copies sidecars into the store, export
+// writes the store's entries out as sidecars.
+func cmdMeta(cfg config, action string, remove bool) error {
+    cfg.Index.MetaStorePath = filepath.Join(cfg.DataDir, indexer.MetaStoreFile)
+    if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil { return err }
+    idx := indexer.New(cfg.CodexDirs, cfg.ClaudeDir, cfg.Index)
+    if err := idx.Reindex(); err != nil { return err }
+    switch action {
+    case "import":
+        n, err := idx.ImportSidecars(remove)
+        if err != nil { return err }
+        fmt.Printf("imported %d sidecars into %s\n", n, cfg.Index.MetaStorePath)
+    case "export":
+        n, err := idx.ExportSidecars()
+        if err != nil { return err }
+        fmt.Printf("exported %d sessions from %s to sidecars\n", n, cfg.Index.MetaStorePath)
+    default:
+        return fmt.Errorf("usage: codex-watcher meta import [--remove] | export")
+    }
+    return nil
+}
+
+// cmdRepair rewrites the given JSONL files without unparseable lines, moving
+// them into a .bad sidecar unless --drop is set.
+func cmdRepair(args []string) error {
+    fs := flag.NewFlagSet("repair", flag.ExitOnError)
+    drop := fs.Bool("drop", false, "discard bad lines instead of writing them to <file>.bad")
+    if err := fs.Parse(args); err != nil { return err }
+    if fs.NArg() == 0 { return errors.New("usage: codex-watcher repair [--drop] <file.jsonl>...") }
+    for _, path := range fs.Args() {
+        res, err := indexer.RepairFile(path, *drop)
+        if err != nil { return err }
+        switch {
+        case res.Removed == 0:
+            fmt.Printf("%s: ok (%d lines)\n", path, res.Kept)
+        case res.Sidecar != "":
+            fmt.Printf("%s: moved %d bad lines to %s\n", path, res.Removed, res.Sidecar)
+        default:
+            fmt.Printf("%s: dropped %d bad lines\n", path, res.Removed)
+        }
+    }
+    return nil
+}
+
+// cmdExportDiff reports sessions and messages added (or removed) between two
+// export files, e.g. the last published run and a fresh one.
+func cmdExportDiff(args []string) error {
+    fs := flag.NewFlagSet("export-diff", flag.ExitOnError)
+    format := fs.String("format", "text", "report format: text or json")
+    if err := fs.Parse(args); err != nil { return err }
+    if fs.NArg() != 2 { return errors.New("usage: codex-watcher export-diff [--format text|json] <old export> <new export>") }
+    var docs [2]exporter.ExportDoc
+    for i, path := range fs.Args() {
+        f, err := os.Open(path)
+        if err != nil { return err }
+        docs[i], err = exporter.ParseExport(f)
+        f.Close()
+        if err != nil { return fmt.Errorf("%s: %w", path, err) }
+    }
+    return exporter.WriteDiffReport(os.Stdout, exporter.DiffExports(docs[0], docs[1]), *format)
+}
+
 func cmdBrowse(cfg config) error {
     // Prefer loopback for browsing if binding on wildcard
     browseHost := cfg.Host
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"codex-watcher/internal/api"
+	"codex-watcher/pkg/indexer"
+	"codex-watcher/pkg/search"
+)
+
+// onceFixture indexes one Codex session and returns the config and index
+// cmdOnce would have for it.
+func onceFixture(t *testing.T) (config, *indexer.Indexer) {
+	t.Helper()
+	dir := t.TempDir()
+	sessions := filepath.Join(dir, "sessions")
+	if err := os.MkdirAll(sessions, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	lines := `{"id":"m1","role":"user","content":"why is the build flaky?","timestamp":"2024-01-01T09:00:00Z"}` + "\n" +
+		`{"id":"m2","role":"assistant","content":"A race in the cache test.","timestamp":"2024-01-01T09:01:00Z"}` + "\n"
+	if err := os.WriteFile(filepath.Join(sessions, "s1.jsonl"), []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{CodexDir: dir, CodexDirs: []string{dir}, Index: indexer.DefaultOptions(), Search: search.CurrentOptions()}
+	idx := indexer.New(cfg.CodexDirs, cfg.ClaudeDir, cfg.Index)
+	if err := idx.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg, idx
+}
+
+func onceFlags(query, export string) onceOptions {
+	out, cwd, format, limit := "-", "", "md", 200
+	return onceOptions{out: &out, query: &query, limit: &limit, export: &export, exportCWD: &cwd, format: &format}
+}
+
+func TestOnceExportOfMissingSessionFails(t *testing.T) {
+	cfg, idx := onceFixture(t)
+	var b strings.Builder
+	err := writeOnce(&b, idx, cfg, onceFlags("", "nope"))
+	if err == nil || !strings.Contains(err.Error(), "session nope not found or empty") {
+		t.Fatalf("want a not found error, got %v", err)
+	}
+	if err := writeOnce(&b, idx, cfg, onceFlags("", "s1")); err != nil || !strings.Contains(b.String(), "A race in the cache test.") {
+		t.Fatalf("export of s1: %v\n%s", err, b.String())
+	}
+}
+
+func TestOnceSummaryIncludesSessionsAndSearch(t *testing.T) {
+	cfg, idx := onceFixture(t)
+	before := search.CurrentOptions()
+	var b strings.Builder
+	if err := writeOnce(&b, idx, cfg, onceFlags("race", "")); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		CodexDir string            `json:"codex_dir"`
+		Sessions []indexer.Session `json:"sessions"`
+		Stats    indexer.Stats     `json:"stats"`
+		Search   search.Response   `json:"search"`
+	}
+	if err := json.Unmarshal([]byte(b.String()), &doc); err != nil {
+		t.Fatalf("summary is not JSON: %v\n%s", err, b.String())
+	}
+	if doc.CodexDir != cfg.CodexDir || len(doc.Sessions) != 1 || doc.Sessions[0].ID != "s1" || doc.Stats.TotalMessages != 2 {
+		t.Fatalf("unexpected summary: %+v", doc)
+	}
+	if doc.Search.Total != 1 || len(doc.Search.Hits) != 1 || doc.Search.Hits[0].MessageID != "m2" {
+		t.Fatalf("unexpected search: %+v", doc.Search)
+	}
+	if after := search.CurrentOptions(); after.Budget != before.Budget || after.MaxReturn != before.MaxReturn {
+		t.Fatalf("the batch budget leaked into the process-wide options: %+v, was %+v", after, before)
+	}
+}
+
+// resolveArgs runs resolveConfig on a fresh flag set with args as the
+// command line and $HOME in a temp dir, as a new process would.
+func resolveArgs(t *testing.T, args ...string) (config, error) {
+	t.Helper()
+	for _, k := range []string{"CODEX_DIR", "CLAUDE_DIR", "CODEX_WATCHER_CONFIG", "CODEX_WATCHER_DATA_DIR", "CODEX_WATCHER_DB"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("HOME", t.TempDir())
+	oldArgs, oldFlags, oldSettings := os.Args, flag.CommandLine, fileSettings
+	t.Cleanup(func() { os.Args, flag.CommandLine, fileSettings = oldArgs, oldFlags, oldSettings })
+	os.Args = append([]string{"codex-watcher"}, args...)
+	flag.CommandLine = flag.NewFlagSet("codex-watcher", flag.ContinueOnError)
+	fileSettings = map[string]bool{}
+	return resolveConfig()
+}
+
+func TestCodexFlagAndConfigKeyTakeSeveralDirs(t *testing.T) {
+	a, b, c := t.TempDir(), t.TempDir(), t.TempDir()
+	cfg, err := resolveArgs(t, "--codex", a, "--codex", b+","+c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.CodexDirs) != 3 || cfg.CodexDirs[0] != a || cfg.CodexDirs[2] != c || cfg.CodexDir != a {
+		t.Fatalf("codex dirs from flags: %q (primary %q)", cfg.CodexDirs, cfg.CodexDir)
+	}
+
+	file := filepath.Join(t.TempDir(), "codex-watcher.yaml")
+	if err := os.WriteFile(file, []byte("codex: "+a+","+b+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = resolveArgs(t, "--config", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.CodexDirs) != 2 || cfg.CodexDirs[1] != b || !fileSettings["codex"] {
+		t.Fatalf("codex dirs from the config file: %q", cfg.CodexDirs)
+	}
+}
+
+func TestReadConfigFileParsesFlatYAML(t *testing.T) {
+	for _, c := range []struct {
+		name, content string
+		want          map[string]string
+		err           string
+	}{
+		{"keys and comments", "# settings\n---\nport: 8080\nsearch-max: 50 # inline\n\n", map[string]string{"port": "8080", "search_max": "50"}, ""},
+		{"quotes keep a hash", "codex: '/a # b'\nexport_format: \"txt\"\n", map[string]string{"codex": "/a # b", "export_format": "txt"}, ""},
+		{"empty value", "api_token:\n", map[string]string{"api_token": ""}, ""},
+		{"value with colons", "claude: C:\\Users\\me\n", map[string]string{"claude": "C:\\Users\\me"}, ""},
+		{"nested value", "search:\n  max: 5\n", nil, ":2: nested values are not supported"},
+		{"list item", "- port: 1\n", nil, ":1: nested values are not supported"},
+		{"no colon", "port 8080\n", nil, ":1: want key: value"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "codex-watcher.yaml")
+			if err := os.WriteFile(path, []byte(c.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readConfigFile(path)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("want an error containing %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("got %q, want %q", got, c.want)
+			}
+			for k, v := range c.want {
+				if got[k] != v {
+					t.Fatalf("%s = %q, want %q (all: %q)", k, got[k], v, got)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigFileRejectsUnknownKeysAndYieldsToFlags(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "codex-watcher.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	for _, content := range []string{"serch_max: 5\n", "config: other.yaml\n"} {
+		if _, err := resolveArgs(t, "--codex", dir, "--config", write(content)); err == nil || !strings.Contains(err.Error(), "unknown setting") {
+			t.Fatalf("%q: want an unknown setting error, got %v", content, err)
+		}
+	}
+	if _, err := resolveArgs(t, "--codex", dir, "--config", write("search_max: lots\n")); err == nil || !strings.Contains(err.Error(), "search_max") {
+		t.Fatalf("want a bad value error naming the key, got %v", err)
+	}
+
+	cfg, err := resolveArgs(t, "--codex", dir, "--search_max", "5", "--config", write("search_max: 9\nsearch_budget_ms: 700\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Search.MaxReturn != 5 || cfg.Search.Budget != 700*time.Millisecond {
+		t.Fatalf("search options = %+v", cfg.Search)
+	}
+	if fileSettings["search_max"] || !fileSettings["search_budget_ms"] {
+		t.Fatalf("file settings = %v", fileSettings)
+	}
+}
+
+func TestSavedSettingsReloadFromTheConfigFile(t *testing.T) {
+	prevSearch, prevDefaults := search.CurrentOptions(), api.CurrentDefaults()
+	t.Cleanup(func() {
+		search.SetOptions(prevSearch)
+		_ = api.SetDefaults(prevDefaults)
+	})
+	oldFlags, oldSettings := flag.CommandLine, fileSettings
+	t.Cleanup(func() { flag.CommandLine, fileSettings = oldFlags, oldSettings })
+	flag.CommandLine = flag.NewFlagSet("codex-watcher", flag.ContinueOnError)
+	fileSettings = map[string]bool{}
+
+	path := filepath.Join(t.TempDir(), "codex-watcher.yaml")
+	orig := "# tuned by hand\nsearch-max: 9\nport: 8080\n"
+	if err := os.WriteFile(path, []byte(orig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveConfigSettings(path, map[string]string{"search_max": "7", "export_format": "txt"}); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(path)
+	if want := "# tuned by hand\nsearch_max: 7\nport: 8080\nexport_format: txt\n"; string(b) != want {
+		t.Fatalf("saved file = %q, want %q", b, want)
+	}
+
+	idx := indexer.New([]string{t.TempDir()}, "")
+	tokens := api.NewTokens(nil)
+	applied, err := reloadConfigFile(path, idx, tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(applied, ",") != "search_max,export_format" {
+		t.Fatalf("applied %v", applied)
+	}
+	if search.CurrentOptions().MaxReturn != 7 || api.CurrentDefaults().ExportFormat != "txt" {
+		t.Fatalf("reloaded max=%d format=%q", search.CurrentOptions().MaxReturn, api.CurrentDefaults().ExportFormat)
+	}
+
+	// a bad value anywhere leaves every setting as it was
+	if err := saveConfigSettings(path, map[string]string{"search_max": "9", "export_format": "pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloadConfigFile(path, idx, tokens); err == nil {
+		t.Fatal("want an error for export_format: pdf")
+	}
+	if search.CurrentOptions().MaxReturn != 7 {
+		t.Fatalf("a failed reload changed search_max to %d", search.CurrentOptions().MaxReturn)
+	}
+}
+
+func TestHomeDirFallsBackToTheUserEntry(t *testing.T) {
+	t.Setenv("HOME", "/somewhere/else")
+	if got := homeDir(); got != "/somewhere/else" {
+		t.Fatalf("homeDir() = %q with $HOME set", got)
+	}
+	t.Setenv("HOME", "")
+	want := ""
+	if u, err := user.Current(); err == nil && u.HomeDir != "/" {
+		want = u.HomeDir
+	}
+	if got := homeDir(); got != want {
+		t.Fatalf("homeDir() = %q without $HOME, want %q", got, want)
+	}
+}
+
+func TestValidateDirsMakesPathsAbsoluteAndRejectsFiles(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	file := filepath.Join(dir, "plain")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// directories that do not exist yet are fine; the server waits for them
+	cfg := config{CodexDir: "missing-codex", CodexDirs: []string{"missing-codex", "other"}, ClaudeDir: "missing-claude"}
+	if err := validateDirs(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CodexDir != filepath.Join(dir, "missing-codex") || cfg.CodexDirs[1] != filepath.Join(dir, "other") || cfg.ClaudeDir != filepath.Join(dir, "missing-claude") {
+		t.Fatalf("paths not made absolute: %+v", cfg)
+	}
+	if cfg.DataDir != cfg.CodexDir {
+		t.Fatalf("data dir = %q, want the first codex dir", cfg.DataDir)
+	}
+
+	for _, c := range []struct {
+		name string
+		cfg  config
+		want string
+	}{
+		{"codex", config{CodexDirs: []string{dir, file}}, "point CODEX_DIR or --codex"},
+		{"claude", config{CodexDirs: []string{dir}, ClaudeDir: file}, "point CLAUDE_DIR or --claude"},
+		{"data dir", config{CodexDirs: []string{dir}, DataDir: file}, "point CODEX_WATCHER_DATA_DIR or --data_dir"},
+	} {
+		if err := validateDirs(&c.cfg); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: want an error containing %q, got %v", c.name, c.want, err)
+		}
+	}
+
+	// the same checks run from the command line
+	if _, err := resolveArgs(t, "--codex", "nope", "--claude", "nope-either"); err != nil {
+		t.Fatalf("nonexistent --codex and --claude dirs: %v", err)
+	}
+	if _, err := resolveArgs(t, "--codex", file); err == nil {
+		t.Fatal("want an error for a --codex that is a file")
+	}
+}
+
+func TestPrepareDataDirCreatesAndProbesTheDir(t *testing.T) {
+	base := t.TempDir()
+	missing := filepath.Join(base, "a", "b")
+	if err := prepareDataDir(config{DataDir: missing}); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(missing); err != nil || !fi.IsDir() {
+		t.Fatalf("data dir not created: %v", err)
+	}
+	if left, _ := filepath.Glob(filepath.Join(missing, ".codex-watcher-probe-*")); len(left) != 0 {
+		t.Fatalf("probe files left behind: %v", left)
+	}
+
+	file := filepath.Join(base, "plain")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := prepareDataDir(config{DataDir: filepath.Join(file, "sub")}); err == nil || !strings.Contains(err.Error(), "cannot create data dir") {
+		t.Fatalf("want a cannot create error, got %v", err)
+	}
+
+	ro := filepath.Join(base, "ro")
+	if err := os.Mkdir(ro, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(ro, 0o755) })
+	if f, err := os.CreateTemp(ro, "probe"); err == nil {
+		// root ignores the mode; nobody can create files in /proc
+		f.Close()
+		os.Remove(f.Name())
+		if runtime.GOOS != "linux" {
+			t.Skip("this user can write to read-only directories")
+		}
+		ro = "/proc"
+	}
+	if err := prepareDataDir(config{DataDir: ro}); err == nil || !strings.Contains(err.Error(), "is not writable") {
+		t.Fatalf("want a not writable error, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"codex-watcher/pkg/indexer"
+	"codex-watcher/pkg/search"
+)
+
+// ReloadConfig re-reads the server's config file and applies the settings
+// that can change at runtime, returning the names of those it found. main
+// sets it when started with --config; POST /api/admin/reload calls it.
+var ReloadConfig func() ([]string, error)
+
+// SaveSettings writes changed settings (config file key -> value) back to
+// the config file. main sets it when started with --config; without it
+// PATCH /api/admin/settings changes only the running server.
+var SaveSettings func(values map[string]string) error
+
+// Defaults are the runtime-tunable defaults of the UI and of session
+// exports, used when a request does not say otherwise.
+type Defaults struct {
+	CollapseTools            bool   `json:"collapse_tools"` // tool blocks start collapsed
+	ExportFormat             string `json:"export_format"`  // md|txt|json|jsonl
+	ExportExcludeShell       bool   `json:"export_exclude_shell"`
+	ExportExcludeToolOutputs bool   `json:"export_exclude_tool_outputs"`
+}
+
+var (
+	defaultsMu sync.RWMutex
+	defaults   = Defaults{CollapseTools: true, ExportFormat: "md", ExportExcludeShell: true, ExportExcludeToolOutputs: true}
+	// settingsMu serializes the read-modify-write updates of the defaults
+	// and search.Options, so concurrent ones each keep the other's changes
+	settingsMu sync.Mutex
+)
+
+// CurrentDefaults returns the active UI and export defaults.
+func CurrentDefaults() Defaults {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	return defaults
+}
+
+// SetDefaults replaces the UI and export defaults.
+func SetDefaults(d Defaults) error {
+	switch d.ExportFormat {
+	case "md", "txt", "json", "jsonl":
+	default:
+		return fmt.Errorf("unsupported export_format %q", d.ExportFormat)
+	}
+	defaultsMu.Lock()
+	defaults = d
+	defaultsMu.Unlock()
+	return nil
+}
+
+// Settings is the body of /api/admin/settings.
+type Settings struct {
+	SearchBudgetMs int  `json:"search_budget_ms"`
+	SearchMax      int  `json:"search_max"`
+	SearchTools    bool `json:"search_tool_outputs"`
+	SearchOutMax   int  `json:"search_output_max_bytes"` // 0 = no cap
+	PollIntervalMs int  `json:"poll_interval_ms"`
+	Defaults
+}
+
+func currentSettings(idx *indexer.Indexer) Settings {
+	so := search.CurrentOptions()
+	return Settings{
+		SearchBudgetMs: int(so.Budget / time.Millisecond),
+		SearchMax:      so.MaxReturn,
+		SearchTools:    so.ToolOutputs,
+		SearchOutMax:   so.MaxOutputBytes,
+		PollIntervalMs: int(idx.PollInterval() / time.Millisecond),
+		Defaults:       CurrentDefaults(),
+	}
+}
+
+// ApplySettings validates every value in params (keys as in Settings)
+// before changing anything, then applies them and returns the changed
+// settings as config file values.
+func ApplySettings(idx *indexer.Indexer, params map[string][]string) (map[string]string, error) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	cur := currentSettings(idx)
+	next := cur
+	changed := make(map[string]string)
+	for key, vals := range params {
+		if len(vals) == 0 {
+			continue
+		}
+		v := strings.TrimSpace(vals[0])
+		var err error
+		switch key {
+		case "search_budget_ms":
+			next.SearchBudgetMs, err = positiveInt(v)
+		case "search_max":
+			next.SearchMax, err = positiveInt(v)
+		case "search_tool_outputs":
+			next.SearchTools, err = strconv.ParseBool(v)
+		case "search_output_max_bytes":
+			next.SearchOutMax, err = strconv.Atoi(v)
+			if err == nil && next.SearchOutMax < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case "poll_interval_ms":
+			next.PollIntervalMs, err = positiveInt(v)
+		case "collapse_tools":
+			next.CollapseTools, err = strconv.ParseBool(v)
+		case "export_format":
+			next.ExportFormat = strings.ToLower(v)
+		case "export_exclude_shell":
+			next.ExportExcludeShell, err = strconv.ParseBool(v)
+		case "export_exclude_tool_outputs":
+			next.ExportExcludeToolOutputs, err = strconv.ParseBool(v)
+		default:
+			return nil, fmt.Errorf("unknown setting %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid value %q", key, v)
+		}
+		changed[key] = v
+	}
+	if err := SetDefaults(next.Defaults); err != nil {
+		return nil, err
+	}
+	so := search.CurrentOptions()
+	so.MaxReturn = next.SearchMax
+	so.Budget = time.Duration(next.SearchBudgetMs) * time.Millisecond
+	so.ToolOutputs = next.SearchTools
+	so.MaxOutputBytes = next.SearchOutMax
+	search.SetOptions(so)
+	idx.SetPollInterval(time.Duration(next.PollIntervalMs) * time.Millisecond)
+	return changed, nil
+}
+
+func positiveInt(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err == nil && n <= 0 {
+		err = fmt.Errorf("must be positive")
+	}
+	return n, err
+}
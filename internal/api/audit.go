@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditPath is the append-only JSONL file that records mutating operations.
+// main sets it next to the Codex data; empty disables the audit log.
+var AuditPath string
+
+// AuditEntry is one line of the audit log.
+type AuditEntry struct {
+	Ts         time.Time `json:"ts"`
+	Actor      string    `json:"actor"`
+	Role       string    `json:"role,omitempty"`
+	Remote     string    `json:"remote,omitempty"`
+	Op         string    `json:"op"` // delete_session|delete_message|rename|pin|color|redact|note|split|repair|dedupe|restore_trash
+	SessionIDs []string  `json:"session_ids,omitempty"`
+	MessageIDs []string  `json:"message_ids,omitempty"`
+	Files      []string  `json:"files,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	OK         bool      `json:"ok"`
+	Error      string    `json:"error,omitempty"`
+}
+
+var auditMu sync.Mutex
+
+// recordAudit appends e to the audit log, filling in time, actor, and outcome.
+// Failures to write are ignored so auditing never blocks the operation itself.
+func recordAudit(r *http.Request, e AuditEntry, opErr error) {
+	if AuditPath == "" {
+		return
+	}
+	e.Ts = time.Now().UTC()
+	e.Actor = "anonymous"
+	if c, ok := PrincipalFrom(r.Context()); ok {
+		e.Actor, e.Role = c.Name, c.Role.String()
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		e.Remote = host
+	}
+	e.OK = opErr == nil
+	if opErr != nil {
+		e.Error = opErr.Error()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.OpenFile(AuditPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return
+	}
+	_, _ = f.Write(append(b, '\n'))
+	_ = f.Close()
+}
+
+// readAudit returns up to limit entries, newest first, optionally restricted
+// to one operation or session.
+func readAudit(limit int, op, sessionID string) ([]AuditEntry, error) {
+	out := []AuditEntry{}
+	if AuditPath == "" {
+		return out, nil
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.Open(AuditPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return out, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		if op != "" && e.Op != op {
+			continue
+		}
+		if sessionID != "" && !containsString(e.SessionIDs, sessionID) {
+			continue
+		}
+		out = append(out, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// authCookie carries the API token for the browser UI once it has been
+// opened with /?token=<token>.
+const authCookie = "cw_token"
+
+// Role is a permission level; each role includes the ones below it.
+type Role int
+
+const (
+	RoleViewer Role = iota + 1 // read, search, export
+	RoleEditor                 // plus tag, rename, annotate, publish
+	RoleAdmin                  // plus delete, redact, split, repair, prune
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleEditor:
+		return "editor"
+	case RoleAdmin:
+		return "admin"
+	}
+	return ""
+}
+
+func parseRole(s string) (Role, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "viewer":
+		return RoleViewer, true
+	case "editor":
+		return RoleEditor, true
+	case "admin":
+		return RoleAdmin, true
+	}
+	return 0, false
+}
+
+// Credential is one configured API token.
+type Credential struct {
+	Name  string // shown as the actor; defaults to the role name
+	Role  Role
+	Token string
+}
+
+// ParseTokens reads --api_token entries of the form "token", "role:token", or
+// "name:role:token". A bare token is an admin, which keeps single-token setups
+// working unchanged.
+func ParseTokens(entries []string) []Credential {
+	var out []Credential
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		c := Credential{Role: RoleAdmin, Token: e}
+		parts := strings.SplitN(e, ":", 3)
+		switch len(parts) {
+		case 2:
+			if r, ok := parseRole(parts[0]); ok {
+				c = Credential{Role: r, Token: parts[1]}
+			}
+		case 3:
+			if r, ok := parseRole(parts[1]); ok {
+				c = Credential{Name: parts[0], Role: r, Token: parts[2]}
+			}
+		}
+		if c.Name == "" {
+			c.Name = c.Role.String()
+		}
+		if c.Token != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// TokenSecrets returns just the secrets of the given entries, for clients
+// that send one of them to a running server.
+func TokenSecrets(entries []string) []string {
+	creds := ParseTokens(entries)
+	out := make([]string, 0, len(creds))
+	for _, c := range creds {
+		out = append(out, c.Token)
+	}
+	return out
+}
+
+type principalKey struct{}
+
+// PrincipalFrom returns the credential that authorized the request, if any.
+func PrincipalFrom(ctx context.Context) (Credential, bool) {
+	c, ok := ctx.Value(principalKey{}).(Credential)
+	return c, ok
+}
+
+// Tokens holds the active credentials. Set swaps them while serving, so a
+// config reload can rotate tokens without a restart.
+type Tokens struct {
+	creds atomic.Pointer[[]Credential]
+}
+
+// NewTokens parses --api_token entries into a token set.
+func NewTokens(entries []string) *Tokens {
+	t := &Tokens{}
+	t.Set(entries)
+	return t
+}
+
+// Set replaces the credentials. An empty list turns authentication off.
+func (t *Tokens) Set(entries []string) {
+	creds := ParseTokens(entries)
+	t.creds.Store(&creds)
+}
+
+// Authenticate looks tok up in the active set. It returns a nil credential
+// and true while the set is empty, since authentication is then off.
+func (t *Tokens) Authenticate(tok string) (*Credential, bool) {
+	creds := *t.creds.Load()
+	if len(creds) == 0 {
+		return nil, true
+	}
+	for i := range creds {
+		if subtle.ConstantTimeCompare([]byte(tok), []byte(creds[i].Token)) == 1 {
+			return &creds[i], true
+		}
+	}
+	return nil, false
+}
+
+// WithAuth requires one of the configured tokens on every /api/ request and
+// checks the token's role against requiredRole. Clients send the token as
+// "Authorization: Bearer <token>", an X-Api-Token header, a token query
+// parameter, or the cw_token cookie. Opening the UI with ?token= sets that
+// cookie so the page's own fetches are authorized. With no tokens configured
+// the handler is returned unchanged.
+func WithAuth(next http.Handler, tokens []string) http.Handler {
+	if len(ParseTokens(tokens)) == 0 {
+		return next
+	}
+	return WithTokens(next, NewTokens(tokens))
+}
+
+// WithTokens is WithAuth over a token set that may change; requests pass
+// through unchecked while the set is empty.
+func WithTokens(next http.Handler, tokens *Tokens) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tok := requestToken(r)
+		cred, ok := tokens.Authenticate(tok)
+		if ok && cred == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == "/" && cred != nil && r.URL.Query().Get("token") != "" {
+			http.SetCookie(w, &http.Cookie{Name: authCookie, Value: tok, Path: "/", HttpOnly: true, SameSite: http.SameSiteStrictMode})
+		}
+		// CORS preflights never carry credentials; the quicksearch route answers them.
+		preflight := r.Method == http.MethodOptions && r.URL.Path == "/api/quicksearch"
+		if !strings.HasPrefix(r.URL.Path, "/api/") || preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if cred == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="codex-watcher"`)
+			writeJSON(w, 401, map[string]any{"error": "unauthorized"})
+			return
+		}
+		if need := requiredRole(r); cred.Role < need {
+			writeJSON(w, 403, map[string]any{"error": "forbidden: requires " + need.String() + " role", "role": cred.Role.String()})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, *cred)))
+	})
+}
+
+// editorPaths and editorActions change metadata or send data out without
+// touching transcript content; everything else that mutates needs admin.
+var editorPaths = map[string]bool{
+	"/api/sessions/rename":       true,
+	"/api/sessions/update-title": true,
+	"/api/sessions/pin":          true,
+	"/api/sessions/color":        true,
+	"/api/dirs/color":            true,
+	"/api/dirs":                  true,
+	"/api/dirs/hide":             true,
+	"/api/reindex":               true,
+	"/api/scan/secrets":          true,
+	"/api/export/gist":           true,
+	"/api/export/ticket":         true,
+	"/api/export/wiki":           true,
+	"/api/export/notion":         true,
+	"/api/export/by_dir":         true, // POST, for since_last
+}
+
+var editorActions = map[string]bool{
+	"note": true,
+}
+
+// requiredRole maps a request to the least role allowed to make it. Reads are
+// open to viewers except the audit log and /api/admin/; unknown mutating requests fail closed
+// to admin.
+func requiredRole(r *http.Request) Role {
+	if r.URL.Path == "/api/audit" || strings.HasPrefix(r.URL.Path, "/api/admin/") {
+		return RoleAdmin
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return RoleViewer
+	}
+	if editorPaths[r.URL.Path] {
+		return RoleEditor
+	}
+	if _, action, ok := sessionSubroute(r.URL.Path); ok && editorActions[action] {
+		return RoleEditor
+	}
+	return RoleAdmin
+}
+
+func requestToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	if h := r.Header.Get("X-Api-Token"); h != "" {
+		return h
+	}
+	if t := r.URL.Query().Get("token"); t != "" {
+		return t
+	}
+	if c, err := r.Cookie(authCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package api
+
+// branchesHTML is the answer comparison page served at /branches?session=:
+// for each prompt that was edited or retried it shows the alternative
+// answers side by side with a line diff between consecutive versions.
+const branchesHTML = `<!doctype html>
+<html>
+<head>
+  <meta charset="utf-8" />
+  <title>Answer versions · Codex Watcher</title>
+  <link rel="stylesheet" href="/static/css/app.css">
+  <style>
+    .diff { font-family: monospace; white-space: pre-wrap; font-size: 12px; }
+    .diff .add { background: #e6ffec; }
+    .diff .del { background: #ffebe9; text-decoration: line-through; }
+    .versions { display: flex; gap: 8px; overflow-x: auto; }
+    .versions > div { flex: 1 1 0; min-width: 240px; white-space: pre-wrap; }
+  </style>
+</head>
+<body>
+  <header>
+    <div class="fw-700"><a href="/">Codex Watcher</a> · 回答版本对比</div>
+  </header>
+  <div class="content">
+    <p class="meta">编辑过的提问和重试会在对话中留下多个分支；这里按提问列出各版本的回答及其差异。</p>
+    <div id="forks" class="meta">Loading…</div>
+  </div>
+  <script>
+    function escapeHTML(s){ return String(s).replace(/[&<>"']/g, function(c){ return {'&':'&amp;','<':'&lt;','>':'&gt;','"':'&quot;',"'":'&#39;'}[c]; }); }
+    function fmtTime(t){ try{ return t ? new Date(t).toLocaleString() : ''; }catch(e){ return ''; } }
+    function diffHTML(ops){
+      return '<div class="diff">' + (ops || []).map(function(op){
+        var cls = op.op === '+' ? 'add' : (op.op === '-' ? 'del' : '');
+        return '<div class="' + cls + '">' + escapeHTML(op.op === '=' ? '  ' + op.text : op.op + ' ' + op.text) + '</div>';
+      }).join('') + '</div>';
+    }
+    async function load(){
+      var box = document.getElementById('forks');
+      var id = new URLSearchParams(location.search).get('session') || '';
+      if (!id) { box.textContent = '缺少 session 参数。'; return; }
+      try{
+        var res = await fetch('/api/sessions/' + encodeURIComponent(id) + '/branches');
+        var data = await res.json();
+        if (!res.ok) { box.textContent = data.error || 'Failed to load'; return; }
+        var forks = data.forks || [];
+        if (!forks.length) { box.textContent = '这个会话没有编辑过的提问或重试。'; return; }
+        box.innerHTML = forks.map(function(f, n){
+          var head = f.edited ? '提问被编辑了 ' + (f.branches.length - 1) + ' 次' : '同一提问的 ' + f.branches.length + ' 个回答';
+          var prompt = f.edited ? '' : '<div class="item">' + escapeHTML(f.prompt || '') + '</div>';
+          var versions = '<div class="versions">' + f.branches.map(function(b, i){
+            var label = '版本 ' + (i + 1) + (b.current ? ' (当前)' : '') + ' · ' + fmtTime(b.start_at) + (b.model ? ' · ' + escapeHTML(b.model) : '');
+            var asked = f.edited ? '<div><strong>提问:</strong> ' + escapeHTML(b.prompt || '') + '</div>' : '';
+            return '<div class="item"><div class="meta">' + label + '</div>' + asked + '<div>' + escapeHTML(b.answer || '(无回答)') + '</div></div>';
+          }).join('') + '</div>';
+          var diffs = (f.diffs || []).map(function(ops, i){
+            return '<details><summary>版本 ' + (i + 1) + ' → 版本 ' + (i + 2) + ' 的差异</summary>' + diffHTML(ops) + '</details>';
+          }).join('');
+          return '<section><h3>#' + (n + 1) + ' ' + head + '</h3>' + prompt + versions + diffs + '</section>';
+        }).join('');
+      }catch(e){ box.textContent = 'Failed to load: ' + e; }
+    }
+    load();
+  </script>
+</body>
+</html>
+`
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// exportStatusTrailer is sent after every streamed export body: "complete",
+// or "incomplete" when the export failed or was cut off by shutdown. Clients
+// that read trailers (curl --raw, Go's http.Response.Trailer) can tell a
+// truncated file from a finished one.
+const exportStatusTrailer = "X-Export-Status"
+
+var errExportAborted = errors.New("export aborted: server shutting down")
+
+// exportDrain tracks streaming export handlers so shutdown can wait for them
+// and, once its deadline passes, stop them with an explicit marker instead of
+// cutting the connection mid-file.
+type exportDrain struct {
+	wg        sync.WaitGroup
+	active    atomic.Int64
+	abortOnce sync.Once
+	abort     chan struct{}
+}
+
+var exports = &exportDrain{abort: make(chan struct{})}
+
+// InFlightExports reports how many export responses are currently streaming.
+func InFlightExports() int {
+	return int(exports.active.Load())
+}
+
+// AbortExports makes every in-flight export stop at its next write and end
+// its response with an incomplete marker, then waits up to wait for the
+// handlers to return. It reports how many exports were still running.
+func AbortExports(wait time.Duration) int {
+	n := InFlightExports()
+	exports.abortOnce.Do(func() { close(exports.abort) })
+	done := make(chan struct{})
+	go func() {
+		exports.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(wait):
+	}
+	return n
+}
+
+// exportWriter wraps the response of a streaming export. Writes fail with
+// errExportAborted once AbortExports has been called.
+type exportWriter struct {
+	http.ResponseWriter
+	aborted bool
+}
+
+// trackExport registers an export response with the drain tracker. Call
+// finish with the export's error when the handler is done writing.
+func trackExport(w http.ResponseWriter) *exportWriter {
+	exports.wg.Add(1)
+	exports.active.Add(1)
+	w.Header().Set("Trailer", exportStatusTrailer)
+	return &exportWriter{ResponseWriter: w}
+}
+
+func (ew *exportWriter) Write(p []byte) (int, error) {
+	select {
+	case <-exports.abort:
+		ew.aborted = true
+		return 0, errExportAborted
+	default:
+	}
+	return ew.ResponseWriter.Write(p)
+}
+
+// finish sets the status trailer and, for an aborted text export, appends a
+// visible note so a saved file is recognisably truncated.
+func (ew *exportWriter) finish(err error, textual bool) {
+	defer exports.wg.Done()
+	defer exports.active.Add(-1)
+	status := "complete"
+	if err != nil || ew.aborted {
+		status = "incomplete"
+	}
+	if ew.aborted && textual {
+		_, _ = ew.ResponseWriter.Write([]byte("\n\n[export incomplete: the server shut down before it finished]\n"))
+	}
+	ew.Header().Set(exportStatusTrailer, status)
+}
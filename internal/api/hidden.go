@@ -0,0 +1,50 @@
+package api
+
+// hiddenHTML is the ignore-list management page served at /hidden: it lists
+// the directories hidden from the sidebar and unhides them on request.
+const hiddenHTML = `<!doctype html>
+<html>
+<head>
+  <meta charset="utf-8" />
+  <title>Hidden directories · Codex Watcher</title>
+  <link rel="stylesheet" href="/static/css/app.css">
+</head>
+<body>
+  <header>
+    <div class="fw-700"><a href="/">Codex Watcher</a> · 已隐藏的目录</div>
+  </header>
+  <div class="content">
+    <p class="meta">隐藏的目录不会出现在默认会话列表中；其会话不会被删除。</p>
+    <div id="hidden-dirs" class="meta">Loading…</div>
+  </div>
+  <script>
+    function escapeHTML(s){ return String(s).replace(/[&<>"']/g, function(c){ return {'&':'&amp;','<':'&lt;','>':'&gt;','"':'&quot;',"'":'&#39;'}[c]; }); }
+    async function load(){
+      var box = document.getElementById('hidden-dirs');
+      try{
+        var dirs = (await (await fetch('/api/dirs')).json()).dirs || {};
+        var sessions = await (await fetch('/api/sessions?include_hidden=1')).json();
+        var counts = {};
+        (Array.isArray(sessions) ? sessions : []).forEach(function(s){ if (s.dir_hidden) counts[s.cwd] = (counts[s.cwd] || 0) + 1; });
+        var cwds = Object.keys(dirs).filter(function(c){ return dirs[c].hidden; }).sort();
+        if (!cwds.length) { box.textContent = '没有隐藏的目录。'; return; }
+        box.innerHTML = cwds.map(function(c, i){
+          var name = dirs[c].name ? escapeHTML(dirs[c].name) + ' ' : '';
+          return '<div class="item">' + name + '<span class="meta">' + escapeHTML(c) + ' · ' + (counts[c] || 0) + ' sessions</span> '
+            + '<button class="btn" data-i="' + i + '">取消隐藏</button></div>';
+        }).join('');
+        box.querySelectorAll('button[data-i]').forEach(function(b){
+          b.onclick = function(){ unhide(cwds[+b.getAttribute('data-i')]); };
+        });
+      }catch(e){ box.textContent = 'Failed to load: ' + e; }
+    }
+    async function unhide(cwd){
+      var res = await fetch('/api/dirs/hide', {method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({cwd: cwd, hidden: false})});
+      var data = await res.json();
+      if (res.ok && data.ok) { load(); } else { alert('取消隐藏失败: ' + (data.error || 'Unknown error')); }
+    }
+    load();
+  </script>
+</body>
+</html>
+`
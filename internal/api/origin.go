@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WithOriginCheck rejects state-changing /api/ requests that a browser sent
+// from another site, so a web page cannot drive deletes against the watcher on
+// its predictable localhost port. Requests are allowed when their Origin (or,
+// lacking that, Referer) matches the Host they were sent to or one of
+// allowedOrigins (e.g. "https://tools.example.com"). Requests without either
+// header come from non-browser clients such as curl and are allowed.
+//
+// A matching Host only counts when it is trusted: a loopback name, an IP
+// address, or one of allowedHosts or the hosts of allowedOrigins. Otherwise
+// a page whose own domain was rebound to 127.0.0.1 would be same-origin;
+// browser requests for any path under such a Host are refused outright.
+func WithOriginCheck(next http.Handler, allowedOrigins, allowedHosts []string) http.Handler {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	hosts := make(map[string]bool, len(allowedHosts)+len(allowedOrigins))
+	for _, o := range allowedOrigins {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			allowed[strings.ToLower(o)] = true
+			if u, err := url.Parse(o); err == nil && u.Host != "" {
+				hosts[hostName(u.Host)] = true
+			}
+		}
+	}
+	for _, h := range allowedHosts {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts[hostName(h)] = true
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fromBrowser(r) && !trustedHost(r.Host, hosts) {
+			writeJSON(w, 403, map[string]any{"error": "unknown host " + r.Host + "; add it to --allowed_hosts"})
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/api/") || isSafeMethod(r.Method) || sameOrigin(r, allowed) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		writeJSON(w, 403, map[string]any{"error": "cross-origin request blocked"})
+	})
+}
+
+func isSafeMethod(m string) bool {
+	return m == http.MethodGet || m == http.MethodHead || m == http.MethodOptions
+}
+
+// fromBrowser reports whether r carries a header only browsers send.
+func fromBrowser(r *http.Request) bool {
+	return r.Header.Get("Origin") != "" || r.Header.Get("Referer") != "" || r.Header.Get("Sec-Fetch-Site") != ""
+}
+
+// trustedHost reports whether a Host header names this machine in a way a
+// DNS rebinding attack cannot fake: an IP address, localhost, or a name
+// from hosts.
+func trustedHost(hostport string, hosts map[string]bool) bool {
+	h := hostName(hostport)
+	if net.ParseIP(h) != nil || h == "localhost" || strings.HasSuffix(h, ".localhost") {
+		return true
+	}
+	return hosts[h]
+}
+
+// hostName strips the port and brackets from a Host value and lowercases it.
+func hostName(hostport string) string {
+	h := hostport
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		h = host
+	}
+	return strings.ToLower(strings.TrimSuffix(strings.Trim(h, "[]"), "."))
+}
+
+func sameOrigin(r *http.Request, allowed map[string]bool) bool {
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return false
+	}
+	src := r.Header.Get("Origin")
+	if src == "" {
+		ref := r.Header.Get("Referer")
+		if ref == "" {
+			return true
+		}
+		src = ref
+	}
+	if src == "null" {
+		return false
+	}
+	u, err := url.Parse(src)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return allowed[strings.ToLower(u.Scheme+"://"+u.Host)]
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"codex-watcher/pkg/indexer"
+	"codex-watcher/pkg/search"
+)
+
+// quickItem is the compact result shape consumed by launcher extensions
+// (Raycast, Alfred): a title, a one-line subtitle, a deep link into the UI,
+// and the shell command that resumes the session.
+type quickItem struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle"`
+	URL      string `json:"url"`
+	Resume   string `json:"resume,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	LastAt   string `json:"last_at,omitempty"`
+}
+
+// quickSearch matches sessions whose title, cwd, or id contain every term of q,
+// then fills up with sessions that have matching messages. An empty q returns
+// the most recent sessions.
+func quickSearch(idx *indexer.Indexer, q string, baseURL string, limit int) []quickItem {
+	sessions := visibleSessions(idx, idx.Sessions(), "", "", false)
+	terms := strings.Fields(strings.ToLower(q))
+	items := make([]quickItem, 0, limit)
+	seen := make(map[string]bool)
+	byID := make(map[string]indexer.Session, len(sessions))
+	for _, s := range sessions {
+		byID[s.ID] = s
+	}
+	add := func(s indexer.Session) bool {
+		if seen[s.ID] {
+			return len(items) < limit
+		}
+		seen[s.ID] = true
+		items = append(items, newQuickItem(s, baseURL))
+		return len(items) < limit
+	}
+
+	for _, s := range sessions { // newest first
+		hay := strings.ToLower(s.Title + " " + s.CWD + " " + s.ID)
+		match := true
+		for _, t := range terms {
+			if !strings.Contains(hay, t) {
+				match = false
+				break
+			}
+		}
+		if match && !add(s) {
+			return items
+		}
+	}
+	if len(terms) == 0 {
+		return items
+	}
+	res := search.Exec(idx, search.Parse(q, "all"), limit*4, 0)
+	for _, h := range res.Hits {
+		if s, ok := byID[h.SessionID]; ok && !add(s) {
+			break
+		}
+	}
+	return items
+}
+
+func newQuickItem(s indexer.Session, baseURL string) quickItem {
+	sub := make([]string, 0, 3)
+	if s.CWD != "" {
+		sub = append(sub, s.CWD)
+	}
+	if !s.LastAt.IsZero() {
+		sub = append(sub, s.LastAt.Local().Format("2006-01-02 15:04"))
+	}
+	if s.Provider != "" {
+		sub = append(sub, s.Provider)
+	}
+	it := quickItem{
+		ID:       s.ID,
+		Title:    s.Title,
+		Subtitle: strings.Join(sub, " · "),
+		URL:      baseURL + "/?session=" + url.QueryEscape(s.ID),
+		Resume:   resumeCommand(s),
+		Provider: s.Provider,
+	}
+	if it.Title == "" {
+		it.Title = s.ID
+	}
+	if !s.LastAt.IsZero() {
+		it.LastAt = s.LastAt.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	return it
+}
+
+// resumeCommand mirrors buildSessionCommand in the UI.
+func resumeCommand(s indexer.Session) string {
+	if s.CWD == "" {
+		return ""
+	}
+	var cmd string
+	switch s.Provider {
+	case indexer.ProviderClaude:
+		parts := strings.Split(s.ID, ":")
+		cmd = "claude -r " + parts[len(parts)-1]
+	case indexer.ProviderCodex:
+		cmd = "codex resume " + s.ID
+	default:
+		return ""
+	}
+	path := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s.CWD)
+	return `cd "` + path + `" && ` + cmd
+}
+
+// requestBaseURL reconstructs the externally visible origin of r for deep links.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// revealPath shows path in the host's file manager: selected in Finder on
+// macOS and in Explorer on Windows, its folder via xdg-open elsewhere. It is
+// a variable so tests do not open windows.
+var revealPath = func(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", "-R", path)
+	case "windows":
+		cmd = exec.Command("explorer", "/select,", path)
+	default:
+		cmd = exec.Command("xdg-open", filepath.Dir(path))
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// explorer exits non-zero even on success; just reap the process
+	go cmd.Wait()
+	return nil
+}
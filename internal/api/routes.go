@@ -1,17 +1,25 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"codex-watcher/internal/exporter"
-	"codex-watcher/internal/indexer"
-	"codex-watcher/internal/search"
+	"codex-watcher/internal/publish"
+	"codex-watcher/pkg/exporter"
+	"codex-watcher/pkg/indexer"
+	"codex-watcher/pkg/search"
 )
 
 // shouldHideSession returns true if a session should be hidden from the UI and search results.
@@ -33,16 +41,22 @@ var funcMap = template.FuncMap{
 }
 
 func AttachRoutes(mux *http.ServeMux, idx *indexer.Indexer) {
-	// Set up session filter for search functionality
-	search.SessionFilter = shouldHideSession
+	// searches hide what the session lists hide
+	settingsMu.Lock()
+	so := search.CurrentOptions()
+	so.SessionFilter = shouldHideSession
+	search.SetOptions(so)
+	settingsMu.Unlock()
 	// UI
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		tmpl := template.Must(template.New("index").Funcs(funcMap).Parse(indexHTML))
-		filtered := visibleSessions(idx, idx.Sessions(), "", "")
+		filtered := visibleSessions(idx, idx.Sessions(), "", "", false)
 		data := struct {
-			Sessions []indexer.Session
-			Stats    indexer.Stats
-		}{Sessions: filtered, Stats: visibleStats(idx, "", "")}
+			Sessions      []indexer.Session
+			Stats         indexer.Stats
+			CollapseTools bool
+			Notion        bool
+		}{Sessions: filtered, Stats: visibleStats(idx, "", ""), CollapseTools: CurrentDefaults().CollapseTools, Notion: publish.NotionConfigured()}
 		_ = tmpl.Execute(w, data)
 	})
 
@@ -50,9 +64,54 @@ func AttachRoutes(mux *http.ServeMux, idx *indexer.Indexer) {
 	mux.HandleFunc("/api/sessions", func(w http.ResponseWriter, r *http.Request) {
 		src := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("source")))
 		proj := strings.TrimSpace(r.URL.Query().Get("project"))
-		filtered := visibleSessions(idx, idx.Sessions(), src, proj)
+		withHidden := r.URL.Query().Get("include_hidden") == "1"
+		filtered := visibleSessions(idx, idx.Sessions(), src, proj, withHidden)
+		switch outcome := r.URL.Query().Get("outcome"); outcome {
+		case "":
+		case "failed", "ok":
+			kept := filtered[:0]
+			for _, s := range filtered {
+				if (len(s.FailureReasons) > 0) == (outcome == "failed") {
+					kept = append(kept, s)
+				}
+			}
+			filtered = kept
+		default:
+			writeJSON(w, 400, map[string]any{"error": "outcome must be failed or ok"})
+			return
+		}
+		if tool := r.URL.Query().Get("tool"); tool != "" {
+			kept := filtered[:0]
+			for _, s := range filtered {
+				if indexer.UsedTool(s.ToolCounts, tool) {
+					kept = append(kept, s)
+				}
+			}
+			filtered = kept
+		}
+		if thread := r.URL.Query().Get("thread"); thread != "" {
+			// one chain of resumed/compacted sessions, oldest first
+			kept := filtered[:0]
+			for _, s := range filtered {
+				if s.ThreadID == thread || (s.ThreadID == "" && s.ID == thread) {
+					kept = append(kept, s)
+				}
+			}
+			filtered = kept
+			sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].FirstAt.Before(filtered[j].FirstAt) })
+		} else if v := r.URL.Query().Get("threads"); v == "1" || v == "true" {
+			filtered = collapseThreads(filtered)
+		}
 		writeJSON(w, 200, filtered)
 	})
+	// Sessions with Claude subagent runs nested under the conversation that
+	// spawned them
+	mux.HandleFunc("/api/sessions/tree", func(w http.ResponseWriter, r *http.Request) {
+		src := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("source")))
+		proj := strings.TrimSpace(r.URL.Query().Get("project"))
+		withHidden := r.URL.Query().Get("include_hidden") == "1"
+		writeJSON(w, 200, map[string]any{"sessions": sessionTree(visibleSessions(idx, idx.Sessions(), src, proj, withHidden))})
+	})
 	mux.HandleFunc("/api/messages", func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
 		sessionID := q.Get("session_id")
@@ -63,6 +122,33 @@ func AttachRoutes(mux *http.ServeMux, idx *indexer.Indexer) {
 				limit = n
 			}
 		}
+		if v := q.Get("at"); v != "" {
+			// Jump to date: the window of limit messages around the one
+			// nearest the timestamp
+			at, err := parseAtTime(v)
+			if err != nil {
+				writeJSON(w, 400, map[string]any{"error": err.Error()})
+				return
+			}
+			if limit <= 0 {
+				limit = 200
+			}
+			all := reorderMessagesForDisplay(indexer.VisibleMessages(idx.Messages(sessionID, 0), 0))
+			window, anchor, offset := messageWindow(all, at, limit)
+			if anchor < 0 {
+				writeJSON(w, 404, map[string]any{"error": "no timestamped messages"})
+				return
+			}
+			writeJSON(w, 200, map[string]any{
+				"anchor_id":    all[anchor].ID,
+				"anchor_index": anchor,
+				"anchor_ts":    all[anchor].Ts,
+				"offset":       offset,
+				"total":        len(all),
+				"messages":     window,
+			})
+			return
+		}
 		msgs := indexer.VisibleMessages(idx.Messages(sessionID, 0), limit)
 		writeJSON(w, 200, reorderMessagesForDisplay(msgs))
 	})
@@ -84,12 +170,160 @@ func AttachRoutes(mux *http.ServeMux, idx *indexer.Indexer) {
 		// Default to searching across all fields; ignore explicit 'in' parameter
 		parsed := search.Parse(raw, "all")
 		res := search.Exec(idx, parsed, limit, offset)
+		if v := q.Get("explain"); v == "1" || v == "true" {
+			plan := search.Explain(idx, parsed)
+			res.Explain = &plan
+		}
 		writeJSON(w, 200, res)
 	})
+	// Launcher integrations (Raycast/Alfred): compact results, callable cross-origin read-only
+	mux.HandleFunc("/api/quicksearch", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, X-Api-Token")
+		switch r.Method {
+		case http.MethodOptions:
+			w.WriteHeader(204)
+			return
+		case http.MethodGet:
+		default:
+			w.WriteHeader(405)
+			return
+		}
+		limit := 20
+		if s := r.URL.Query().Get("limit"); s != "" {
+			if n, err := strconv.Atoi(s); err == nil && n > 0 && n <= 100 {
+				limit = n
+			}
+		}
+		items := quickSearch(idx, r.URL.Query().Get("q"), requestBaseURL(r), limit)
+		writeJSON(w, 200, map[string]any{"items": items})
+	})
+	// Stats are recomputed only when the index revision moves. Clients send
+	// the revision they hold in If-Revision-Newer and get 304 while it stands.
+	statsCache := newStatsCache()
 	mux.HandleFunc("/api/stats", func(w http.ResponseWriter, r *http.Request) {
 		src := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("source")))
 		proj := strings.TrimSpace(r.URL.Query().Get("project"))
-		writeJSON(w, 200, visibleStats(idx, src, proj))
+		rev := idx.Revision()
+		w.Header().Set("X-Revision", strconv.FormatUint(rev, 10))
+		if h := strings.TrimSpace(r.Header.Get("If-Revision-Newer")); h != "" {
+			if have, err := strconv.ParseUint(h, 10, 64); err == nil && rev <= have {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		writeJSON(w, 200, statsCache.get(idx, src, proj))
+	})
+	// Active time per day and directory for one month, as JSON or CSV
+	mux.HandleFunc("/api/stats/timesheet", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		month, err := exporter.ParseMonth(q.Get("month"), time.Now(), time.Local)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		ts := exporter.BuildTimesheet(idx, q.Get("cwd"), month)
+		switch q.Get("format") {
+		case "", "json":
+			writeJSON(w, 200, ts)
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", "attachment; filename=\"timesheet-"+ts.Month+".csv\"")
+			_ = exporter.WriteTimesheetCSV(w, ts)
+		default:
+			writeJSON(w, 400, map[string]any{"error": "format must be json or csv"})
+		}
+	})
+	// Size of the session files per working directory, largest first
+	mux.HandleFunc("/api/stats/disk", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		src := strings.ToLower(strings.TrimSpace(q.Get("source")))
+		sessions := visibleSessions(idx, idx.Sessions(), src, strings.TrimSpace(q.Get("project")), q.Get("include_hidden") == "1")
+		writeJSON(w, 200, idx.DiskUsage(sessions))
+	})
+	// One entry per working directory, aggregated from the session list
+	mux.HandleFunc("/api/projects", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		src := strings.ToLower(strings.TrimSpace(q.Get("source")))
+		withHidden := q.Get("include_hidden") == "1"
+		projects := projectSummaries(visibleSessions(idx, idx.Sessions(), src, "", withHidden))
+		if q.Get("sort") == "cost" {
+			sort.SliceStable(projects, func(i, j int) bool { return projects[i].Cost > projects[j].Cost })
+		}
+		writeJSON(w, 200, map[string]any{"projects": projects})
+	})
+	// Models seen, grouped by their configured aliases, with prices
+	mux.HandleFunc("/api/models", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]any{"models": idx.ModelUsages()})
+	})
+	// Readiness probe: 503 until the initial scan has completed
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		p := idx.Progress()
+		code := 200
+		if !p.Ready {
+			code = 503
+		}
+		writeJSON(w, code, map[string]any{"ready": p.Ready, "indexing": p})
+	})
+	// Re-read the config file, like SIGHUP; admin only
+	mux.HandleFunc("/api/admin/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
+		}
+		if ReloadConfig == nil {
+			writeJSON(w, 409, map[string]any{"error": "server was started without --config"})
+			return
+		}
+		applied, err := ReloadConfig()
+		recordAudit(r, AuditEntry{Op: "reload", Detail: strings.Join(applied, ",")}, err)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"ok": true, "applied": applied})
+	})
+	// Runtime tuning; admin only, persisted to the config file when there is one
+	mux.HandleFunc("/api/admin/settings", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, 200, map[string]any{"settings": currentSettings(idx), "persisted": SaveSettings != nil})
+		case http.MethodPatch, http.MethodPost:
+			params, err := requestParams(w, r)
+			if err != nil {
+				writeJSON(w, 400, map[string]any{"error": err.Error()})
+				return
+			}
+			delete(params, "token") // auth, not a setting
+			changed, err := ApplySettings(idx, params)
+			if err == nil && len(changed) > 0 && SaveSettings != nil {
+				if err = SaveSettings(changed); err != nil {
+					err = fmt.Errorf("applied but not saved: %w", err)
+				}
+			}
+			keys := make([]string, 0, len(changed))
+			for k, v := range changed {
+				keys = append(keys, k+"="+v)
+			}
+			sort.Strings(keys)
+			recordAudit(r, AuditEntry{Op: "settings", Detail: strings.Join(keys, ",")}, err)
+			if err != nil {
+				code := 400
+				if changed != nil {
+					code = 500
+				}
+				writeJSON(w, code, map[string]any{"error": err.Error()})
+				return
+			}
+			writeJSON(w, 200, map[string]any{"settings": currentSettings(idx), "persisted": SaveSettings != nil})
+		default:
+			w.WriteHeader(405)
+		}
+	})
+	// Liveness probe: the process is up and serving, even mid-scan
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]any{"ok": true})
 	})
 	mux.HandleFunc("/api/fields", func(w http.ResponseWriter, r *http.Request) {
 		st := idx.Stats()
@@ -113,12 +347,19 @@ func AttachRoutes(mux *http.ServeMux, idx *indexer.Indexer) {
 			w.WriteHeader(405)
 			return
 		}
-		sessionID := r.URL.Query().Get("session_id")
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		sessionID := q.Get("session_id")
 		if sessionID == "" {
 			writeJSON(w, 400, map[string]any{"error": "missing session_id"})
 			return
 		}
-		if err := idx.DeleteSession(sessionID); err != nil {
+		err = idx.DeleteSession(sessionID)
+		recordAudit(r, AuditEntry{Op: "delete_session", SessionIDs: []string{sessionID}}, err)
+		if err != nil {
 			writeJSON(w, 500, map[string]any{"error": err.Error()})
 			return
 		}
@@ -131,135 +372,1214 @@ func AttachRoutes(mux *http.ServeMux, idx *indexer.Indexer) {
 			w.WriteHeader(405)
 			return
 		}
-		sessionID := r.URL.Query().Get("session_id")
-		messageID := r.URL.Query().Get("message_id")
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		sessionID := q.Get("session_id")
+		messageID := q.Get("message_id")
 		if sessionID == "" || messageID == "" {
 			writeJSON(w, 400, map[string]any{"error": "missing session_id or message_id"})
 			return
 		}
-		if err := idx.DeleteMessage(sessionID, messageID); err != nil {
+		err = idx.DeleteMessage(sessionID, messageID)
+		recordAudit(r, AuditEntry{Op: "delete_message", SessionIDs: []string{sessionID}, MessageIDs: []string{messageID}}, err)
+		if err != nil {
 			writeJSON(w, 500, map[string]any{"error": err.Error()})
 			return
 		}
 		writeJSON(w, 200, map[string]any{"ok": true, "deleted_message": messageID})
 	})
 
-	// Update session title
-	mux.HandleFunc("/api/sessions/update-title", func(w http.ResponseWriter, r *http.Request) {
+	// Trash: deleted sessions and messages, restorable until they expire
+	mux.HandleFunc("/api/trash", func(w http.ResponseWriter, r *http.Request) {
+		entries, err := idx.Trash()
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		// the deleted lines themselves stay out of the listing
+		for i := range entries {
+			entries[i].Text = ""
+		}
+		writeJSON(w, 200, map[string]any{"entries": entries})
+	})
+	mux.HandleFunc("/api/trash/restore", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.WriteHeader(405)
 			return
 		}
-		sessionID := r.URL.Query().Get("session_id")
-		newTitle := r.URL.Query().Get("title")
-		if sessionID == "" {
-			writeJSON(w, 400, map[string]any{"error": "missing session_id"})
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
 			return
 		}
-		if newTitle == "" {
-			writeJSON(w, 400, map[string]any{"error": "missing title"})
+		id := q.Get("id")
+		if id == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing id"})
+			return
+		}
+		e, err := idx.RestoreTrash(id)
+		audit := AuditEntry{Op: "restore_trash", Detail: id}
+		if e.SessionID != "" {
+			audit.SessionIDs = []string{e.SessionID}
+		}
+		if e.MessageID != "" {
+			audit.MessageIDs = []string{e.MessageID}
+		}
+		recordAudit(r, audit, err)
+		if err != nil {
+			code := 500
+			if errors.Is(err, indexer.ErrTrashNotFound) {
+				code = 404
+			}
+			writeJSON(w, code, map[string]any{"error": err.Error()})
+			return
+		}
+		e.Text = ""
+		writeJSON(w, 200, map[string]any{"ok": true, "restored": e})
+	})
+
+	// Cached attachment blobs: /api/attachments/{id}, the id of a message's
+	// attachment. Content-addressed, so they never change.
+	mux.HandleFunc("/api/attachments/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(405)
+			return
+		}
+		path, mediaType, ok := idx.AttachmentFile(strings.TrimPrefix(r.URL.Path, "/api/attachments/"))
+		if !ok {
+			writeJSON(w, 404, map[string]any{"error": "attachment not found"})
+			return
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			writeJSON(w, 404, map[string]any{"error": "attachment not found"})
 			return
 		}
-		if err := idx.UpdateSessionTitle(sessionID, newTitle); err != nil {
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
 			writeJSON(w, 500, map[string]any{"error": err.Error()})
 			return
 		}
-		writeJSON(w, 200, map[string]any{"ok": true, "title": newTitle})
+		w.Header().Set("Content-Type", mediaType)
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// an SVG or HTML file opened directly must not run scripts
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+		http.ServeContent(w, r, "", fi.ModTime(), f)
 	})
 
-	// Export: single session
-	mux.HandleFunc("/api/export/session", func(w http.ResponseWriter, r *http.Request) {
+	// Per-message views: /api/messages/{id}/markdown[?quote=1&session_id=...]
+	mux.HandleFunc("/api/messages/", func(w http.ResponseWriter, r *http.Request) {
+		messageID, action, ok := messageSubroute(r.URL.Path)
+		if !ok || action != "markdown" {
+			writeJSON(w, 404, map[string]any{"error": "not found"})
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(405)
+			return
+		}
 		q := r.URL.Query()
+		// message IDs are only unique within a session; without session_id
+		// the newest session holding the ID wins
+		var sess indexer.Session
+		var msg *indexer.Message
+		for _, s := range idx.Sessions() {
+			if sid := q.Get("session_id"); sid != "" && s.ID != sid {
+				continue
+			}
+			msgs := idx.PeekMessages(s.ID)
+			for _, m := range msgs {
+				if m.ID == messageID {
+					msg = m
+					break
+				}
+			}
+			if msg != nil {
+				sess = s
+				if view, ok := idx.SessionView(s, indexer.VisibleMessages(msgs, 0)); ok {
+					sess = view
+				} else {
+					sess.Title = indexer.SessionDisplayTitle(s, nil)
+				}
+				break
+			}
+		}
+		if msg == nil {
+			writeJSON(w, 404, map[string]any{"error": "message not found"})
+			return
+		}
+		md := exporter.MessageMarkdown(msg)
+		if v := q.Get("quote"); v == "1" || v == "true" {
+			link := requestBaseURL(r) + "/?session=" + url.QueryEscape(sess.ID) + "&message=" + url.QueryEscape(msg.ID)
+			md = exporter.QuoteMessage(msg, sess, link)
+		}
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		_, _ = io.WriteString(w, md)
+	})
+
+	// Redact message content in place (memory + JSONL file)
+	mux.HandleFunc("/api/messages/redact", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
+		}
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
 		sessionID := q.Get("session_id")
-		if sessionID == "" {
-			writeJSON(w, 400, map[string]any{"error": "missing session_id"})
+		messageID := q.Get("message_id")
+		if sessionID == "" || messageID == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing session_id or message_id"})
 			return
 		}
-		format := q.Get("format")
-		if format == "" {
-			format = "md"
+		err = idx.RedactMessage(sessionID, messageID)
+		recordAudit(r, AuditEntry{Op: "redact", SessionIDs: []string{sessionID}, MessageIDs: []string{messageID}}, err)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
 		}
-		// filters
-		var f exporter.Filters
-		// policy toggles (default exclude)
-		f.ExcludeShellCalls = true
-		f.ExcludeToolOutputs = true
-		if s := strings.TrimSpace(q.Get("exclude_shell")); s != "" {
-			if s == "0" || strings.EqualFold(s, "false") {
-				f.ExcludeShellCalls = false
-			}
+		writeJSON(w, 200, map[string]any{"ok": true, "redacted_message": messageID})
+	})
+
+	// Duplicate session files: GET reports identical files, POST dedupe trashes extra copies
+	mux.HandleFunc("/api/duplicates", func(w http.ResponseWriter, r *http.Request) {
+		groups, err := idx.FindDuplicates()
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
 		}
-		if s := strings.TrimSpace(q.Get("exclude_tool_outputs")); s != "" {
-			if s == "0" || strings.EqualFold(s, "false") {
-				f.ExcludeToolOutputs = false
-			}
+		if groups == nil {
+			groups = []indexer.DuplicateGroup{}
 		}
-		if v := q.Get("text_only"); v != "" {
-			if v == "1" || v == "true" {
-				f.TextOnly = true
-			}
+		writeJSON(w, 200, groups)
+	})
+	mux.HandleFunc("/api/duplicates/dedupe", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
 		}
-		if v := q.Get("include_roles"); v != "" {
-			f.IncludeRoles = splitCSV(v)
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
 		}
-		if v := q.Get("include_types"); v != "" {
-			f.IncludeTypes = splitCSV(v)
+		trashed, err := idx.Dedupe(q.Get("hash"))
+		recordAudit(r, AuditEntry{Op: "dedupe", Files: trashed, Detail: q.Get("hash")}, err)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error(), "trashed": trashed})
+			return
 		}
-		if v := q.Get("limit"); v != "" {
-			if n, err := strconv.Atoi(v); err == nil {
-				f.MaxMessages = n
-			}
+		if trashed == nil {
+			trashed = []string{}
 		}
-		// lookup session for filename/meta
-		var sess indexer.Session
-		for _, s := range idx.Sessions() {
-			if s.ID == sessionID {
-				sess = s
-				break
+		writeJSON(w, 200, map[string]any{"ok": true, "trashed": trashed})
+	})
+
+	// Secret scanning: POST starts a background scan, GET reports its status/findings
+	secretScan := &secretScanJob{}
+	mux.HandleFunc("/api/scan/secrets", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, 200, secretScan.status())
+		case http.MethodPost:
+			started := secretScan.start(idx)
+			st := secretScan.status()
+			st["started"] = started
+			writeJSON(w, 202, st)
+		default:
+			w.WriteHeader(405)
+		}
+	})
+
+	// Project-level TODOs: the latest plan of each session under cwd
+	mux.HandleFunc("/api/todos", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		openOnly := q.Get("all") != "1" && q.Get("all") != "true"
+		sessions := idx.ProjectTodos(q.Get("cwd"), openOnly)
+		items := 0
+		for _, s := range sessions {
+			items += len(s.Todos)
+		}
+		writeJSON(w, 200, map[string]any{"cwd": q.Get("cwd"), "count": items, "sessions": sessions})
+	})
+
+	// Per-session actions: /api/sessions/{id}/{action}
+	mux.HandleFunc("/api/sessions/", func(w http.ResponseWriter, r *http.Request) {
+		sessionID, action, ok := sessionSubroute(r.URL.Path)
+		if !ok {
+			writeJSON(w, 404, map[string]any{"error": "not found"})
+			return
+		}
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		switch action {
+		case "turns":
+			if r.Method != http.MethodGet {
+				w.WriteHeader(405)
+				return
+			}
+			msgs := indexer.VisibleMessages(idx.Messages(sessionID, 0), 0)
+			if len(msgs) == 0 {
+				writeJSON(w, 404, map[string]any{"error": "session not found"})
+				return
 			}
+			turns := indexer.GroupTurns(reorderMessagesForDisplay(msgs))
+			writeJSON(w, 200, map[string]any{"session_id": sessionID, "count": len(turns), "turns": turns})
+		case "todos":
+			if r.Method != http.MethodGet {
+				w.WriteHeader(405)
+				return
+			}
+			if _, found := findSession(idx, sessionID); !found {
+				writeJSON(w, 404, map[string]any{"error": "session not found"})
+				return
+			}
+			todos := idx.Todos(sessionID)
+			open := 0
+			for _, t := range todos {
+				if t.Open() {
+					open++
+				}
+			}
+			writeJSON(w, 200, map[string]any{"session_id": sessionID, "open": open, "todos": todos})
+		case "links":
+			if r.Method != http.MethodGet {
+				w.WriteHeader(405)
+				return
+			}
+			if _, found := findSession(idx, sessionID); !found {
+				writeJSON(w, 404, map[string]any{"error": "session not found"})
+				return
+			}
+			links := idx.Links(sessionID)
+			writeJSON(w, 200, map[string]any{"session_id": sessionID, "count": len(links), "links": links})
+		case "branches":
+			if r.Method != http.MethodGet {
+				w.WriteHeader(405)
+				return
+			}
+			if _, found := findSession(idx, sessionID); !found {
+				writeJSON(w, 404, map[string]any{"error": "session not found"})
+				return
+			}
+			forks := indexer.Forks(idx.Messages(sessionID, 0))
+			if forks == nil {
+				forks = []indexer.Fork{}
+			}
+			writeJSON(w, 200, map[string]any{"session_id": sessionID, "count": len(forks), "forks": forks})
+		case "raw":
+			if r.Method != http.MethodGet {
+				w.WriteHeader(405)
+				return
+			}
+			messageID := q.Get("message_id")
+			var msg *indexer.Message
+			for _, m := range idx.Messages(sessionID, 0) {
+				if m.ID == messageID {
+					msg = m
+					break
+				}
+			}
+			if messageID == "" || msg == nil {
+				writeJSON(w, 404, map[string]any{"error": "message not found"})
+				return
+			}
+			raw, err := idx.FullRaw(msg)
+			if err != nil {
+				writeJSON(w, 500, map[string]any{"error": err.Error()})
+				return
+			}
+			writeJSON(w, 200, map[string]any{"session_id": sessionID, "message_id": messageID, "truncated": msg.RawTruncated, "raw": raw})
+		case "note":
+			if r.Method != http.MethodPost {
+				w.WriteHeader(405)
+				return
+			}
+			text := q.Get("text")
+			if text == "" {
+				writeJSON(w, 400, map[string]any{"error": "missing text"})
+				return
+			}
+			note, err := idx.AppendNote(sessionID, text, q.Get("author"))
+			recordAudit(r, AuditEntry{Op: "note", SessionIDs: []string{sessionID}}, err)
+			if err != nil {
+				writeJSON(w, 500, map[string]any{"error": err.Error()})
+				return
+			}
+			writeJSON(w, 200, map[string]any{"ok": true, "note": note})
+		case "split":
+			if r.Method != http.MethodPost {
+				w.WriteHeader(405)
+				return
+			}
+			at := q.Get("at")
+			if at == "" {
+				writeJSON(w, 400, map[string]any{"error": "missing at (message_id)"})
+				return
+			}
+			newID, err := idx.SplitSession(sessionID, at)
+			recordAudit(r, AuditEntry{Op: "split", SessionIDs: []string{sessionID, newID}, MessageIDs: []string{at}}, err)
+			if err != nil {
+				writeJSON(w, 500, map[string]any{"error": err.Error()})
+				return
+			}
+			writeJSON(w, 200, map[string]any{"ok": true, "session_id": sessionID, "new_session_id": newID})
+		case "reveal":
+			// Runs a command on the host, so it stays admin-only like other
+			// unlisted POSTs.
+			if r.Method != http.MethodPost {
+				w.WriteHeader(405)
+				return
+			}
+			sess, found := findSession(idx, sessionID)
+			if !found {
+				writeJSON(w, 404, map[string]any{"error": "session not found"})
+				return
+			}
+			path := ""
+			for _, p := range sess.Paths {
+				if _, err := os.Stat(p); err == nil {
+					path = p
+					break
+				}
+			}
+			if path == "" {
+				writeJSON(w, 404, map[string]any{"error": "session file not found", "paths": sess.Paths})
+				return
+			}
+			if err := revealPath(path); err != nil {
+				writeJSON(w, 500, map[string]any{"error": err.Error(), "path": path})
+				return
+			}
+			writeJSON(w, 200, map[string]any{"ok": true, "path": path})
+		case "repair":
+			// Rewrites files on disk: POST only, and dropping bad lines needs an explicit opt-in.
+			if r.Method != http.MethodPost {
+				w.WriteHeader(405)
+				return
+			}
+			drop := q.Get("drop") == "1" || q.Get("drop") == "true"
+			results, err := idx.RepairSession(sessionID, drop)
+			var files []string
+			for _, res := range results {
+				if res.Removed > 0 {
+					files = append(files, res.Path)
+				}
+			}
+			detail := "quarantine"
+			if drop {
+				detail = "drop"
+			}
+			recordAudit(r, AuditEntry{Op: "repair", SessionIDs: []string{sessionID}, Files: files, Detail: detail}, err)
+			if err != nil {
+				writeJSON(w, 500, map[string]any{"error": err.Error(), "results": results})
+				return
+			}
+			writeJSON(w, 200, map[string]any{"ok": true, "results": results})
+		default:
+			writeJSON(w, 404, map[string]any{"error": "unknown action: " + action})
+		}
+	})
+
+	// Rename a session: session_id and title as query parameters or in a
+	// JSON body. The title is kept in the session's metadata (.meta.json or
+	// the central store); update-title is the older name of the route.
+	renameSession := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
+		}
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		sessionID := q.Get("session_id")
+		newTitle := strings.TrimSpace(q.Get("title"))
+		if sessionID == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing session_id"})
+			return
+		}
+		if newTitle == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing title"})
+			return
 		}
-		if sess.ID == "" {
+		if _, found := findSession(idx, sessionID); !found {
 			writeJSON(w, 404, map[string]any{"error": "session not found"})
 			return
 		}
+		err = idx.UpdateSessionTitle(sessionID, newTitle)
+		recordAudit(r, AuditEntry{Op: "rename", SessionIDs: []string{sessionID}, Detail: newTitle}, err)
+		switch {
+		case errors.Is(err, indexer.ErrReadOnly):
+			writeJSON(w, 409, map[string]any{"error": err.Error()})
+			return
+		case err != nil:
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"ok": true, "title": newTitle})
+	}
+	mux.HandleFunc("/api/sessions/rename", renameSession)
+	mux.HandleFunc("/api/sessions/update-title", renameSession)
 
-		// headers
-		switch format {
-		case "jsonl":
-			w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
-		case "json":
-			w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		case "txt":
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		default:
-			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
-			format = "md"
+	// Pin or unpin a session (pinned sessions are listed first)
+	mux.HandleFunc("/api/sessions/pin", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
+		}
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		sessionID := q.Get("session_id")
+		if sessionID == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing session_id"})
+			return
+		}
+		pinned := true
+		if v := strings.TrimSpace(q.Get("pinned")); v == "0" || strings.EqualFold(v, "false") {
+			pinned = false
+		}
+		err = idx.SetPinned(sessionID, pinned)
+		detail := "pin"
+		if !pinned {
+			detail = "unpin"
+		}
+		recordAudit(r, AuditEntry{Op: "pin", SessionIDs: []string{sessionID}, Detail: detail}, err)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"ok": true, "pinned": pinned})
+	})
+
+	// Color labels: palette and directory colors; POST sets a session's or a directory's label
+	mux.HandleFunc("/api/labels", func(w http.ResponseWriter, r *http.Request) {
+		dirs := make(map[string]string)
+		for cwd, m := range idx.DirMetas() {
+			if m.Color != "" {
+				dirs[cwd] = m.Color
+			}
+		}
+		writeJSON(w, 200, map[string]any{"palette": idx.ColorLabels(), "dirs": dirs})
+	})
+	mux.HandleFunc("/api/sessions/color", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
+		}
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		sessionID, color := q.Get("session_id"), strings.TrimSpace(q.Get("color"))
+		if sessionID == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing session_id"})
+			return
+		}
+		if color != "" && !idx.ValidColor(color) {
+			writeJSON(w, 400, map[string]any{"error": "unknown color: " + color})
+			return
+		}
+		err = idx.SetSessionColor(sessionID, color)
+		recordAudit(r, AuditEntry{Op: "color", SessionIDs: []string{sessionID}, Detail: color}, err)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"ok": true, "color": color})
+	})
+	mux.HandleFunc("/api/dirs/color", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
+		}
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		cwd, color := q.Get("cwd"), strings.TrimSpace(q.Get("color"))
+		if cwd == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing cwd"})
+			return
+		}
+		if color != "" && !idx.ValidColor(color) {
+			writeJSON(w, 400, map[string]any{"error": "unknown color: " + color})
+			return
+		}
+		err = idx.SetDirColor(cwd, color)
+		recordAudit(r, AuditEntry{Op: "color", Detail: cwd + "=" + color}, err)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"ok": true, "color": color})
+	})
+
+	// Directory metadata: GET lists merged name/description/tags/color per cwd
+	// (registry over <cwd>/.codex-watcher.json); POST sets the registry's
+	// name, description, and default tags for one cwd
+	mux.HandleFunc("/api/dirs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			writeJSON(w, 200, map[string]any{"dirs": idx.DirMetas()})
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
+		}
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		cwd := q.Get("cwd")
+		if cwd == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing cwd"})
+			return
+		}
+		var tags []string
+		for _, v := range q["tags"] {
+			tags = append(tags, strings.Split(v, ",")...)
+		}
+		err = idx.SetDirInfo(cwd, q.Get("name"), q.Get("description"), tags)
+		recordAudit(r, AuditEntry{Op: "dir-meta", Detail: cwd}, err)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"ok": true, "dir": idx.DirInfo(cwd)})
+	})
+
+	// Ignore list: POST hides (hidden=1, default) or unhides a cwd group in
+	// default listings; /hidden is the page to review and unhide
+	mux.HandleFunc("/api/dirs/hide", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
+		}
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		cwd := q.Get("cwd")
+		if cwd == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing cwd"})
+			return
+		}
+		hidden := true
+		if v := strings.TrimSpace(q.Get("hidden")); v == "0" || strings.EqualFold(v, "false") {
+			hidden = false
+		}
+		err = idx.SetDirHidden(cwd, hidden)
+		detail := "hide " + cwd
+		if !hidden {
+			detail = "unhide " + cwd
+		}
+		recordAudit(r, AuditEntry{Op: "dir-meta", Detail: detail}, err)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"ok": true, "hidden": hidden})
+	})
+	mux.HandleFunc("/hidden", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = io.WriteString(w, hiddenHTML)
+	})
+	mux.HandleFunc("/branches", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = io.WriteString(w, branchesHTML)
+	})
+
+	// Audit log of mutating operations, newest first
+	mux.HandleFunc("/api/audit", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		limit := 200
+		if s := q.Get("limit"); s != "" {
+			if n, err := strconv.Atoi(s); err == nil {
+				limit = n
+			}
+		}
+		entries, err := readAudit(limit, q.Get("op"), q.Get("session_id"))
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, 200, entries)
+	})
+
+	// Export: single session
+	mux.HandleFunc("/api/export/session", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		sessionID := q.Get("session_id")
+		if sessionID == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing session_id"})
+			return
+		}
+		format := q.Get("format")
+		if format == "" {
+			format = CurrentDefaults().ExportFormat
+		}
+		if v := q.Get("turns"); v != "" {
+			if _, err := exporter.ParseTurnRanges(v); err != nil {
+				writeJSON(w, 400, map[string]any{"error": err.Error()})
+				return
+			}
+		}
+		f := sessionExportFilters(q)
+		// lookup session for filename/meta
+		sess, found := findSession(idx, sessionID)
+		if !found {
+			writeJSON(w, 404, map[string]any{"error": "session not found"})
+			return
+		}
+
+		// headers
+		switch format {
+		case "jsonl":
+			w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+		case "json":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		case "txt":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		default:
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			format = "md"
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// the name must not leak what an anonymized body hides
+		if f.Anonymize {
+			sess = exporter.NewAnonymizer().Session(sess)
+		}
+		filename := exportFilename(q, format, func(v string) string { return exporter.BuildAttachmentName(sess, format, v) })
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+
+		ew := trackExport(w)
+		n, err := exporter.WriteSession(ew, idx, sessionID, format, f)
+		ew.finish(err, format == "md" || format == "txt")
+		if err != nil && !ew.aborted {
+			// best effort error write
+			w.WriteHeader(500)
+			_, _ = w.Write([]byte("export error: " + err.Error()))
+			return
+		}
+		if n == 0 {
+			// No content — easier for clients to detect
+			w.Header().Set("X-Export-Empty", "1")
+		}
+	})
+
+	// Export preview: the first messages a session export with the same
+	// parameters would write, and how many in total. limit is the preview
+	// size here; pass the export's own limit as export_limit.
+	mux.HandleFunc("/api/export/preview", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		sessionID := q.Get("session_id")
+		if sessionID == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing session_id"})
+			return
+		}
+		if v := q.Get("turns"); v != "" {
+			if _, err := exporter.ParseTurnRanges(v); err != nil {
+				writeJSON(w, 400, map[string]any{"error": err.Error()})
+				return
+			}
+		}
+		if _, found := findSession(idx, sessionID); !found {
+			writeJSON(w, 404, map[string]any{"error": "session not found"})
+			return
+		}
+		f := sessionExportFilters(q)
+		f.MaxMessages = 0
+		if v := q.Get("export_limit"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil {
+				f.MaxMessages = n
+			}
+		}
+		limit := 20
+		if v := q.Get("limit"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				limit = min(n, 500)
+			}
+		}
+		writeJSON(w, 200, exporter.PreviewSession(idx, sessionID, f, limit))
+	})
+
+	// Export: paste-ready context (plain text, trimmed to a budget)
+	mux.HandleFunc("/api/export/clip", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		sessionID := q.Get("session_id")
+		if sessionID == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing session_id"})
+			return
+		}
+		if _, found := findSession(idx, sessionID); !found {
+			writeJSON(w, 404, map[string]any{"error": "session not found"})
+			return
+		}
+		var opt exporter.ClipOptions
+		if v := q.Get("max_tokens"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				opt.MaxTokens = n
+			}
+		}
+		if v := q.Get("max_chars"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				opt.MaxChars = n
+			}
+		}
+		if v := q.Get("anonymize"); v == "1" || v == "true" {
+			opt.Anonymize = true
+		}
+		var buf bytes.Buffer
+		n, err := exporter.WriteClip(&buf, idx, sessionID, opt)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if n == 0 {
+			w.Header().Set("X-Export-Empty", "1")
+		}
+		_, _ = w.Write(buf.Bytes())
+	})
+
+	// Context pack: a Markdown brief for resuming work in a directory
+	mux.HandleFunc("/api/export/context_pack", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		cwd := q.Get("cwd")
+		if cwd == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing cwd"})
+			return
+		}
+		var opt exporter.ContextPackOptions
+		if v := q.Get("sessions"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				opt.Sessions = n
+			}
+		}
+		if v := q.Get("anonymize"); v == "1" || v == "true" {
+			opt.Anonymize = true
+		}
+		var buf bytes.Buffer
+		n, err := exporter.WriteContextPack(&buf, idx, cwd, opt)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if n == 0 {
+			w.Header().Set("X-Export-Empty", "1")
+		}
+		_, _ = w.Write(buf.Bytes())
+	})
+
+	// Weekly journal: a directory's sessions of one week as a Markdown report
+	mux.HandleFunc("/api/export/journal", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		week, err := exporter.ParseWeek(q.Get("week"), time.Now(), time.Local)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		opt := exporter.JournalOptions{Week: week}
+		if v := q.Get("anonymize"); v == "1" || v == "true" {
+			opt.Anonymize = true
+		}
+		var buf bytes.Buffer
+		n, err := exporter.WriteJournal(&buf, idx, q.Get("cwd"), opt)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if n == 0 {
+			w.Header().Set("X-Export-Empty", "1")
+		}
+		_, _ = w.Write(buf.Bytes())
+	})
+
+	// Sessions as an iCalendar feed, for subscribing from a calendar app
+	mux.HandleFunc("/api/calendar.ics", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		src := strings.ToLower(strings.TrimSpace(q.Get("source")))
+		sessions := visibleSessions(idx, idx.Sessions(), src, strings.TrimSpace(q.Get("project")), false)
+		cwd := q.Get("cwd")
+		var since time.Time
+		if v := q.Get("days"); v != "" {
+			days, err := strconv.Atoi(v)
+			if err != nil || days <= 0 {
+				writeJSON(w, 400, map[string]any{"error": "days must be a positive number"})
+				return
+			}
+			since = time.Now().AddDate(0, 0, -days)
+		}
+		kept := sessions[:0]
+		for _, s := range sessions {
+			if cwd != "" && !strings.HasPrefix(s.CWD, cwd) {
+				continue
+			}
+			if !since.IsZero() && s.LastAt.Before(since) {
+				continue
+			}
+			kept = append(kept, s)
+		}
+		sort.SliceStable(kept, func(i, j int) bool { return kept[i].FirstAt.Before(kept[j].FirstAt) })
+		name := "codex-watcher"
+		if dm := idx.DirInfo(cwd); cwd != "" && dm.Name != "" {
+			name += ": " + dm.Name
+		} else if cwd != "" {
+			name += ": " + cwd
+		}
+		var buf bytes.Buffer
+		if _, err := exporter.WriteCalendar(&buf, kept, exporter.CalendarOptions{Name: name, BaseURL: requestBaseURL(r)}); err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		_, _ = w.Write(buf.Bytes())
+	})
+
+	// Export: by directory (markdown, all types)
+	mux.HandleFunc("/api/export/by_dir", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
+		}
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		cwd := q.Get("cwd")
+		if cwd == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing cwd"})
+			return
+		}
+		// optional dates
+		var after, before time.Time
+		if s := q.Get("after"); s != "" {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				after = t
+			}
+		}
+		if s := q.Get("before"); s != "" {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				before = t
+			}
+		}
+		// policy toggles (default exclude)
+		var ef exporter.Filters
+		d := CurrentDefaults()
+		ef.ExcludeShellCalls = d.ExportExcludeShell
+		ef.ExcludeToolOutputs = d.ExportExcludeToolOutputs
+		if s := strings.TrimSpace(q.Get("exclude_shell")); s != "" {
+			if s == "0" || strings.EqualFold(s, "false") {
+				ef.ExcludeShellCalls = false
+			}
+		}
+		if s := strings.TrimSpace(q.Get("exclude_tool_outputs")); s != "" {
+			if s == "0" || strings.EqualFold(s, "false") {
+				ef.ExcludeToolOutputs = false
+			}
+		}
+		if v := q.Get("anonymize"); v == "1" || v == "true" {
+			ef.Anonymize = true
+		}
+		if v := q.Get("meta"); v == "1" || v == "true" {
+			ef.Meta = true
+		}
+		if v := q.Get("todos"); v == "1" || v == "true" {
+			ef.Todos = true
+		}
+		if v := q.Get("references"); v == "1" || v == "true" {
+			ef.References = true
+		}
+		if v := q.Get("stats"); v == "1" || v == "true" {
+			ef.Stats = true
+		}
+		// since_last: start after this cwd's watermark and advance it to the
+		// newest message seen now, so the next call picks up from here. It
+		// changes state, so it is POST only.
+		var through time.Time
+		sinceLast := q.Get("since_last") == "1" || q.Get("since_last") == "true"
+		if sinceLast && r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, 405, map[string]any{"error": "since_last advances the export watermark; send it as POST"})
+			return
+		}
+		if sinceLast {
+			ef.Incremental = true
+			mark := idx.DirInfo(cwd).ExportedThrough
+			if !mark.IsZero() {
+				w.Header().Set("X-Export-Since", mark.Format(time.RFC3339Nano))
+				if next := mark.Add(time.Nanosecond); next.After(after) {
+					after = next
+				}
+			}
+			for _, s := range idx.Sessions() {
+				if strings.HasPrefix(s.CWD, cwd) && s.LastAt.After(through) {
+					through = s.LastAt
+				}
+			}
+			if !before.IsZero() && before.Before(through) {
+				through = before
+			}
+			before = through
+			if !through.IsZero() {
+				w.Header().Set("X-Export-Through", through.Format(time.RFC3339Nano))
+			}
+		}
+		// headers — always markdown
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		name := cwd
+		if ef.Anonymize {
+			name = exporter.NewAnonymizer().Apply(cwd)
+		}
+		filename := exportFilename(q, "md", func(v string) string { return exporter.BuildDirAttachmentName(name, "all_md", "md", v) },
+			after.Format(time.RFC3339Nano), before.Format(time.RFC3339Nano))
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+
+		ew := trackExport(w)
+		n, err := exporter.WriteByDirAllMarkdown(ew, idx, cwd, after, before, ef)
+		ew.finish(err, true)
+		if err != nil && !ew.aborted {
+			w.WriteHeader(500)
+			_, _ = w.Write([]byte("export error: " + err.Error()))
+			return
+		}
+		if sinceLast && err == nil && !ew.aborted && through.After(after) {
+			merr := idx.SetDirExportWatermark(cwd, through)
+			recordAudit(r, AuditEntry{Op: "export-watermark", Detail: cwd + " through " + through.UTC().Format(time.RFC3339)}, merr)
+		}
+		if n == 0 {
+			w.Header().Set("X-Export-Empty", "1")
+		}
+	})
+
+	// Publish the Markdown export as a gist (secret unless public=1)
+	mux.HandleFunc("/api/export/gist", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
+		}
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		sessionID := q.Get("session_id")
+		if sessionID == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing session_id"})
+			return
+		}
+		sess, found := findSession(idx, sessionID)
+		if !found {
+			writeJSON(w, 404, map[string]any{"error": "session not found"})
+			return
+		}
+		f := sessionExportFilters(q)
+		var buf bytes.Buffer
+		if _, err := exporter.WriteSession(&buf, idx, sessionID, "md", f); err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		if f.Anonymize {
+			sess = exporter.NewAnonymizer().Session(sess)
+		}
+		filename, _ := url.PathUnescape(exportFilename(q, "md", func(v string) string { return exporter.BuildAttachmentName(sess, "md", v) }))
+		public := q.Get("public") == "1" || q.Get("public") == "true"
+		gistURL, err := publish.CreateGist(r.Context(), filename, "codex-watcher: "+indexer.SessionDisplayTitle(sess, nil), buf.String(), public)
+		if err != nil {
+			code := 502
+			if errors.Is(err, publish.ErrNotConfigured) {
+				code = 501
+			}
+			writeJSON(w, code, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"ok": true, "url": gistURL})
+	})
+
+	// Publish the Markdown export as a page in the configured Notion database
+	mux.HandleFunc("/api/export/notion", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
+		}
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		sessionID := q.Get("session_id")
+		if sessionID == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing session_id"})
+			return
+		}
+		sess, found := findSession(idx, sessionID)
+		if !found {
+			writeJSON(w, 404, map[string]any{"error": "session not found"})
+			return
+		}
+		f := sessionExportFilters(q)
+		var buf bytes.Buffer
+		if _, err := exporter.WriteSession(&buf, idx, sessionID, "md", f); err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		if f.Anonymize {
+			sess = exporter.NewAnonymizer().Session(sess)
+		}
+		project := sess.DirName
+		if project == "" {
+			project = sess.CWDBase
+		}
+		pageURL, err := publish.CreateNotionPage(r.Context(), publish.NotionPage{
+			Title:    indexer.SessionDisplayTitle(sess, nil),
+			Date:     sess.FirstAt,
+			Project:  project,
+			Provider: sess.Provider,
+			Tags:     sess.Tags,
+			Markdown: buf.String(),
+		})
+		if err != nil {
+			code := 502
+			if errors.Is(err, publish.ErrNotConfigured) {
+				code = 501
+			}
+			writeJSON(w, code, map[string]any{"error": err.Error(), "url": pageURL})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"ok": true, "url": pageURL})
+	})
+
+	// Publish the Markdown export to Confluence or commit it to a git-backed wiki
+	mux.HandleFunc("/api/export/wiki", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
+		}
+		q, err := requestParams(w, r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		sessionID := q.Get("session_id")
+		if sessionID == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing session_id"})
+			return
+		}
+		target := q.Get("target")
+		if target != publish.WikiConfluence && target != publish.WikiGit {
+			writeJSON(w, 400, map[string]any{"error": "target must be confluence or git"})
+			return
+		}
+		sess, found := findSession(idx, sessionID)
+		if !found {
+			writeJSON(w, 404, map[string]any{"error": "session not found"})
+			return
+		}
+		f := sessionExportFilters(q)
+		var buf bytes.Buffer
+		if _, err := exporter.WriteSession(&buf, idx, sessionID, "md", f); err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		if f.Anonymize {
+			sess = exporter.NewAnonymizer().Session(sess)
+		}
+		loc, err := publish.PublishWiki(r.Context(), target, publish.NewWikiPage(sess, buf.String()))
+		if err != nil {
+			code := 502
+			if errors.Is(err, publish.ErrNotConfigured) {
+				code = 501
+			}
+			writeJSON(w, code, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"ok": true, "target": target, "url": loc})
+	})
+
+	// Attach a transcript to a Jira/Linear ticket (comment, or file attachment on Jira)
+	mux.HandleFunc("/api/export/ticket", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(405)
+			return
 		}
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("Content-Disposition", "attachment; filename=\""+exporter.BuildAttachmentName(sess, format)+"\"")
-
-		n, err := exporter.WriteSession(w, idx, sessionID, format, f)
+		q, err := requestParams(w, r)
 		if err != nil {
-			// best effort error write
-			w.WriteHeader(500)
-			_, _ = w.Write([]byte("export error: " + err.Error()))
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
 			return
 		}
-		if n == 0 {
-			// No content — easier for clients to detect
-			w.Header().Set("X-Export-Empty", "1")
+		sessionID, tracker, ticket := q.Get("session_id"), q.Get("tracker"), q.Get("ticket")
+		if sessionID == "" || tracker == "" || ticket == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing session_id, tracker, or ticket"})
+			return
+		}
+		sess, found := findSession(idx, sessionID)
+		if !found {
+			writeJSON(w, 404, map[string]any{"error": "session not found"})
+			return
+		}
+		f := sessionExportFilters(q)
+		var buf bytes.Buffer
+		if _, err := exporter.WriteSession(&buf, idx, sessionID, "md", f); err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
 		}
+		if f.Anonymize {
+			sess = exporter.NewAnonymizer().Session(sess)
+		}
+		filename, _ := url.PathUnescape(exportFilename(q, "md", func(v string) string { return exporter.BuildAttachmentName(sess, "md", v) }))
+		attach := q.Get("mode") == "attachment"
+		link, err := publish.PostToTicket(r.Context(), tracker, ticket, filename, indexer.SessionDisplayTitle(sess, nil), buf.String(), attach)
+		if err != nil {
+			code := 502
+			if errors.Is(err, publish.ErrNotConfigured) {
+				code = 501
+			}
+			writeJSON(w, code, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"ok": true, "url": link})
 	})
 
-	// Export: by directory (markdown, all types)
-	mux.HandleFunc("/api/export/by_dir", func(w http.ResponseWriter, r *http.Request) {
+	// Flashcards: user question / final assistant answer pairs for Anki import
+	mux.HandleFunc("/api/export/flashcards", func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
+		sessionID := q.Get("session_id")
 		cwd := q.Get("cwd")
-		if cwd == "" {
-			writeJSON(w, 400, map[string]any{"error": "missing cwd"})
+		format := strings.ToLower(q.Get("format"))
+		if format == "" {
+			format = "tsv"
+		}
+		if format != "tsv" && format != "csv" {
+			writeJSON(w, 400, map[string]any{"error": "unsupported format: " + format})
 			return
 		}
-		// optional dates
 		var after, before time.Time
 		if s := q.Get("after"); s != "" {
 			if t, err := time.Parse(time.RFC3339, s); err == nil {
@@ -271,40 +1591,40 @@ func AttachRoutes(mux *http.ServeMux, idx *indexer.Indexer) {
 				before = t
 			}
 		}
-		// policy toggles (default exclude)
-		var ef exporter.Filters
-		ef.ExcludeShellCalls = true
-		ef.ExcludeToolOutputs = true
-		if s := strings.TrimSpace(q.Get("exclude_shell")); s != "" {
-			if s == "0" || strings.EqualFold(s, "false") {
-				ef.ExcludeShellCalls = false
-			}
+		var f exporter.Filters
+		if v := q.Get("anonymize"); v == "1" || v == "true" {
+			f.Anonymize = true
 		}
-		if s := strings.TrimSpace(q.Get("exclude_tool_outputs")); s != "" {
-			if s == "0" || strings.EqualFold(s, "false") {
-				ef.ExcludeToolOutputs = false
-			}
+		cards := exporter.CollectFlashcards(idx, sessionID, cwd, after, before, f)
+
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/tab-separated-values; charset=utf-8")
 		}
-		// headers — always markdown
-		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("Content-Disposition", "attachment; filename=\""+exporter.BuildDirAttachmentName(cwd, "all_md", "md")+"\"")
-
-		n, err := exporter.WriteByDirAllMarkdown(w, idx, cwd, after, before, ef)
-		if err != nil {
-			w.WriteHeader(500)
-			_, _ = w.Write([]byte("export error: " + err.Error()))
-			return
+		name := cwd
+		if f.Anonymize {
+			name = exporter.NewAnonymizer().Apply(cwd)
 		}
-		if n == 0 {
+		filename := exportFilename(q, format, func(v string) string { return exporter.BuildDirAttachmentName(name, "flashcards", format, v) })
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+		if len(cards) == 0 {
 			w.Header().Set("X-Export-Empty", "1")
 		}
+		if _, err := exporter.WriteFlashcards(w, cards, format); err != nil {
+			w.WriteHeader(500)
+			_, _ = w.Write([]byte("export error: " + err.Error()))
+		}
 	})
 }
 
-func visibleSessions(idx *indexer.Indexer, sessions []indexer.Session, source string, project string) []indexer.Session {
+func visibleSessions(idx *indexer.Indexer, sessions []indexer.Session, source string, project string, includeHidden bool) []indexer.Session {
 	filtered := make([]indexer.Session, 0, len(sessions))
 	for _, s := range sessions {
+		if s.DirHidden && !includeHidden {
+			continue
+		}
 		if source != "" && strings.ToLower(s.Provider) != source {
 			continue
 		}
@@ -314,40 +1634,304 @@ func visibleSessions(idx *indexer.Indexer, sessions []indexer.Session, source st
 		if shouldHideSession(s) {
 			continue
 		}
-		visibleMsgs := indexer.VisibleMessages(idx.Messages(s.ID, 0), 0)
-		view, ok := indexer.SessionView(s, visibleMsgs)
+		visibleMsgs := indexer.VisibleMessages(idx.PeekMessages(s.ID), 0)
+		view, ok := idx.SessionView(s, visibleMsgs)
 		if !ok {
 			continue
 		}
 		filtered = append(filtered, view)
 	}
 	sort.Slice(filtered, func(i, j int) bool {
+		if filtered[i].Pinned != filtered[j].Pinned {
+			return filtered[i].Pinned
+		}
 		return filtered[i].LastAt.After(filtered[j].LastAt)
 	})
 	return filtered
 }
 
+// sessionNode is a session with the subagent runs it spawned.
+type sessionNode struct {
+	indexer.Session
+	Subagents []*sessionNode `json:"subagents,omitempty"`
+}
+
+// sessionTree nests subagent sessions under their parent session, oldest
+// first; the top level keeps the order of sessions. A subagent whose parent
+// is not listed stays at the top level.
+func sessionTree(sessions []indexer.Session) []*sessionNode {
+	nodes := make(map[string]*sessionNode, len(sessions))
+	for _, s := range sessions {
+		nodes[s.ID] = &sessionNode{Session: s}
+	}
+	var roots []*sessionNode
+	for _, s := range sessions {
+		n := nodes[s.ID]
+		if p := nodes[s.ParentSessionID]; p != nil && p != n {
+			p.Subagents = append(p.Subagents, n)
+			continue
+		}
+		roots = append(roots, n)
+	}
+	for _, n := range nodes {
+		sort.SliceStable(n.Subagents, func(i, j int) bool { return n.Subagents[i].FirstAt.Before(n.Subagents[j].FirstAt) })
+	}
+	if roots == nil {
+		roots = []*sessionNode{}
+	}
+	return roots
+}
+
+// collapseThreads keeps one entry per chain of continued sessions: the most
+// recently active one, listed where the chain's latest activity puts it.
+func collapseThreads(sessions []indexer.Session) []indexer.Session {
+	latest := make(map[string]int) // thread id -> index in sessions
+	for i, s := range sessions {
+		if s.ThreadID == "" {
+			continue
+		}
+		if j, ok := latest[s.ThreadID]; !ok || s.LastAt.After(sessions[j].LastAt) {
+			latest[s.ThreadID] = i
+		}
+	}
+	out := make([]indexer.Session, 0, len(sessions))
+	for i, s := range sessions {
+		if s.ThreadID == "" || latest[s.ThreadID] == i {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 func visibleStats(idx *indexer.Indexer, source string, project string) indexer.Stats {
 	stats := idx.Stats()
 	stats.TotalMessages = 0
 	stats.TotalSessions = 0
 	stats.ByRole = make(map[string]int)
 	stats.ByModel = make(map[string]int)
+	stats.ByMCPServer = make(map[string]int)
+	stats.ByMCPTool = make(map[string]int)
+	stats.ByLanguage = make(map[string]int)
+	stats.ByTool = make(map[string]int)
+	stats.ActiveDuration = 0
+	stats.InputTokens, stats.OutputTokens = 0, 0
+	stats.Cost, stats.UnpricedTokens = 0, 0
+	all := stats.ByProvider
+	stats.ByProvider = make(map[string]indexer.ProviderStats)
+	if source != "" {
+		stats.BadLines = all[source].BadLines
+	}
 
-	sessions := visibleSessions(idx, idx.Sessions(), source, project)
+	sessions := visibleSessions(idx, idx.Sessions(), source, project, false)
 	stats.TotalSessions = len(sessions)
 	for _, s := range sessions {
 		stats.TotalMessages += s.MessageCount
+		stats.ActiveDuration += s.ActiveDuration
 		for role, count := range s.Roles {
 			stats.ByRole[role] += count
 		}
 		for model, count := range s.Models {
 			stats.ByModel[model] += count
 		}
+		for call, count := range s.MCPTools {
+			server, _, _ := strings.Cut(call, "/")
+			stats.ByMCPServer[server] += count
+			stats.ByMCPTool[call] += count
+		}
+		for lang, count := range s.Languages {
+			stats.ByLanguage[lang] += count
+		}
+		for tool, count := range s.ToolCounts {
+			stats.ByTool[tool] += count
+		}
+		stats.AddProviderSession(s)
+	}
+	for p, ps := range all {
+		if (ps.BadLines > 0 || ps.IngestLag != nil) && (source == "" || p == source) {
+			cur := stats.ByProvider[p]
+			cur.BadLines = ps.BadLines
+			cur.IngestLag = ps.IngestLag
+			stats.ByProvider[p] = cur
+		}
 	}
 	return stats
 }
 
+// maxStatsScopes bounds the source/project scopes statsCache keeps; the
+// scope comes from the query string, so without a bound every distinct
+// project value a client sends would stay cached.
+const maxStatsScopes = 32
+
+// statsCache keeps the last visibleStats result per source/project scope,
+// valid until the index revision changes.
+type statsCache struct {
+	mu      sync.Mutex
+	entries map[string]indexer.Stats
+}
+
+func newStatsCache() *statsCache {
+	return &statsCache{entries: make(map[string]indexer.Stats)}
+}
+
+func (c *statsCache) get(idx *indexer.Indexer, source, project string) indexer.Stats {
+	key := source + "\x00" + project
+	rev := idx.Revision()
+	c.mu.Lock()
+	st, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && st.Revision == rev {
+		st.Indexing = idx.Progress() // fresh ETA
+		return st
+	}
+	st = visibleStats(idx, source, project)
+	c.mu.Lock()
+	if cur, ok := c.entries[key]; !ok || cur.Revision <= st.Revision {
+		for k, e := range c.entries {
+			if e.Revision < st.Revision {
+				delete(c.entries, k) // never served again
+			}
+		}
+		for k := range c.entries {
+			if _, kept := c.entries[key]; kept || len(c.entries) < maxStatsScopes {
+				break
+			}
+			delete(c.entries, k)
+		}
+		c.entries[key] = st
+	}
+	c.mu.Unlock()
+	return st
+}
+
+// projectSummary aggregates the sessions of one working directory.
+type projectSummary struct {
+	CWD            string         `json:"cwd"`
+	Name           string         `json:"name,omitempty"` // directory metadata display name
+	Hidden         bool           `json:"hidden,omitempty"`
+	Sessions       int            `json:"sessions"`
+	Messages       int            `json:"messages"`
+	FirstAt        time.Time      `json:"first_at,omitempty"`
+	LastAt         time.Time      `json:"last_at,omitempty"`
+	ActiveDuration time.Duration  `json:"active_duration,omitempty"`
+	InputTokens    int            `json:"input_tokens"`
+	OutputTokens   int            `json:"output_tokens"`
+	Cost           float64        `json:"cost,omitempty"` // estimated USD, see Session.Cost
+	Providers      map[string]int `json:"providers"`      // sessions per provider
+	Tags           []string       `json:"tags,omitempty"`
+}
+
+// projectSummaries groups sessions by CWD, most recently active first.
+// Sessions without a CWD are grouped under "".
+func projectSummaries(sessions []indexer.Session) []projectSummary {
+	byCWD := make(map[string]*projectSummary)
+	var order []string
+	for _, s := range sessions {
+		p := byCWD[s.CWD]
+		if p == nil {
+			p = &projectSummary{CWD: s.CWD, Name: s.DirName, Hidden: s.DirHidden, Providers: make(map[string]int)}
+			byCWD[s.CWD] = p
+			order = append(order, s.CWD)
+		}
+		p.Sessions++
+		p.Messages += s.MessageCount
+		p.ActiveDuration += s.ActiveDuration
+		p.InputTokens += s.InputTokens
+		p.OutputTokens += s.OutputTokens
+		p.Cost += s.Cost
+		if !s.FirstAt.IsZero() && (p.FirstAt.IsZero() || s.FirstAt.Before(p.FirstAt)) {
+			p.FirstAt = s.FirstAt
+		}
+		if s.LastAt.After(p.LastAt) {
+			p.LastAt = s.LastAt
+		}
+		if s.Provider != "" {
+			p.Providers[s.Provider]++
+		}
+		for _, t := range s.Tags {
+			if !containsFold(p.Tags, t) {
+				p.Tags = append(p.Tags, t)
+			}
+		}
+	}
+	out := make([]projectSummary, 0, len(order))
+	for _, cwd := range order {
+		p := byCWD[cwd]
+		sort.Strings(p.Tags)
+		out = append(out, *p)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].LastAt.Equal(out[j].LastAt) {
+			return out[i].LastAt.After(out[j].LastAt)
+		}
+		return out[i].CWD < out[j].CWD
+	})
+	return out
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretScanJob runs indexer.ScanSecrets in the background and keeps the last result.
+type secretScanJob struct {
+	mu         sync.Mutex
+	running    bool
+	startedAt  time.Time
+	finishedAt time.Time
+	findings   []indexer.SecretFinding
+}
+
+// start launches a scan unless one is already running.
+func (j *secretScanJob) start(idx *indexer.Indexer) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.running {
+		return false
+	}
+	j.running = true
+	j.startedAt = time.Now()
+	go func() {
+		findings := idx.ScanSecrets()
+		j.mu.Lock()
+		j.findings = findings
+		j.finishedAt = time.Now()
+		j.running = false
+		j.mu.Unlock()
+	}()
+	return true
+}
+
+func (j *secretScanJob) status() map[string]any {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	sessions := make(map[string]bool)
+	for _, f := range j.findings {
+		sessions[f.SessionID] = true
+	}
+	findings := j.findings
+	if findings == nil {
+		findings = []indexer.SecretFinding{}
+	}
+	out := map[string]any{
+		"running":  j.running,
+		"sessions": len(sessions),
+		"messages": len(j.findings),
+		"findings": findings,
+	}
+	if !j.startedAt.IsZero() {
+		out["started_at"] = j.startedAt
+	}
+	if !j.finishedAt.IsZero() {
+		out["finished_at"] = j.finishedAt
+	}
+	return out
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -356,6 +1940,225 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	_ = enc.Encode(v)
 }
 
+// maxParamsBody caps JSON request bodies accepted by requestParams.
+const maxParamsBody = 1 << 20
+
+// requestParams returns the parameters of a mutating request: the query
+// string, overlaid with the fields of a JSON object body when the request
+// is sent as application/json. Scalar fields become strings ("true",
+// "42"); arrays of scalars become repeated values. Query-only callers keep
+// working unchanged.
+func requestParams(w http.ResponseWriter, r *http.Request) (url.Values, error) {
+	q := r.URL.Query()
+	ct := r.Header.Get("Content-Type")
+	if r.Body == nil || !strings.HasPrefix(strings.ToLower(strings.TrimSpace(ct)), "application/json") {
+		return q, nil
+	}
+	var body map[string]any
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxParamsBody))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		if errors.Is(err, io.EOF) {
+			return q, nil
+		}
+		return nil, fmt.Errorf("invalid JSON body: %w", err)
+	}
+	for k, v := range body {
+		vals, ok := paramStrings(v)
+		if !ok {
+			return nil, fmt.Errorf("invalid JSON body: field %q must be a string, number, boolean, or array of those", k)
+		}
+		q[k] = vals
+	}
+	return q, nil
+}
+
+func paramStrings(v any) ([]string, bool) {
+	switch t := v.(type) {
+	case nil:
+		return nil, true
+	case string:
+		return []string{t}, true
+	case json.Number:
+		return []string{t.String()}, true
+	case bool:
+		return []string{strconv.FormatBool(t)}, true
+	case []any:
+		out := make([]string, 0, len(t))
+		for _, el := range t {
+			s, ok := paramStrings(el)
+			if !ok || len(s) > 1 {
+				return nil, false
+			}
+			out = append(out, s...)
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// exportFilename is an export's (path-escaped) file name: the caller's
+// filename= when usable, else the one name builds with a variant hashed from
+// the query and any extra values (such as a computed date window) that
+// shape the content.
+func exportFilename(q url.Values, format string, name func(variant string) string, extra ...string) string {
+	if fn := exporter.AttachmentFilename(q.Get("filename"), format); fn != "" {
+		return fn
+	}
+	opts := url.Values{}
+	for k, v := range q {
+		if k != "filename" && k != "token" {
+			opts[k] = v
+		}
+	}
+	return name(exporter.ExportVariant(append([]string{opts.Encode()}, extra...)...))
+}
+
+// sessionExportFilters parses the single-session export options shared by
+// /api/export/session and the publishing endpoints.
+func sessionExportFilters(q url.Values) exporter.Filters {
+	var f exporter.Filters
+	// policy toggles (default exclude, see /api/admin/settings)
+	d := CurrentDefaults()
+	f.ExcludeShellCalls = d.ExportExcludeShell
+	f.ExcludeToolOutputs = d.ExportExcludeToolOutputs
+	if s := strings.TrimSpace(q.Get("exclude_shell")); s != "" {
+		if s == "0" || strings.EqualFold(s, "false") {
+			f.ExcludeShellCalls = false
+		}
+	}
+	if s := strings.TrimSpace(q.Get("exclude_tool_outputs")); s != "" {
+		if s == "0" || strings.EqualFold(s, "false") {
+			f.ExcludeToolOutputs = false
+		}
+	}
+	if v := q.Get("text_only"); v != "" {
+		if v == "1" || v == "true" {
+			f.TextOnly = true
+		}
+	}
+	if v := q.Get("anonymize"); v == "1" || v == "true" {
+		f.Anonymize = true
+	}
+	if v := q.Get("include_roles"); v != "" {
+		f.IncludeRoles = splitCSV(v)
+	}
+	if v := q.Get("include_types"); v != "" {
+		f.IncludeTypes = splitCSV(v)
+	}
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			f.MaxMessages = n
+		}
+	}
+	if v := q.Get("max_tokens"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			f.MaxTokens = n
+		}
+	}
+	if v := q.Get("turns"); v != "" {
+		f.Turns, _ = exporter.ParseTurnRanges(v)
+	}
+	if v := q.Get("meta"); v == "1" || v == "true" {
+		f.Meta = true
+	}
+	if v := q.Get("todos"); v == "1" || v == "true" {
+		f.Todos = true
+	}
+	if v := q.Get("references"); v == "1" || v == "true" {
+		f.References = true
+	}
+	if v := q.Get("stats"); v == "1" || v == "true" {
+		f.Stats = true
+	}
+	return f
+}
+
+func findSession(idx *indexer.Indexer, sessionID string) (indexer.Session, bool) {
+	for _, s := range idx.Sessions() {
+		if s.ID == sessionID {
+			return s, true
+		}
+	}
+	return indexer.Session{}, false
+}
+
+// parseAtTime accepts RFC 3339, the browser's datetime-local format (local
+// time), or unix seconds/milliseconds.
+func parseAtTime(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid at %q: want RFC 3339, YYYY-MM-DDTHH:MM, or unix time", v)
+}
+
+// messageWindow finds the message whose timestamp is nearest at and returns
+// up to size messages centered on it, the anchor's index in msgs (-1 when no
+// message has a timestamp), and the window's offset in msgs.
+func messageWindow(msgs []*indexer.Message, at time.Time, size int) ([]*indexer.Message, int, int) {
+	anchor := -1
+	var best time.Duration
+	for i, m := range msgs {
+		if m.Ts.IsZero() {
+			continue
+		}
+		d := m.Ts.Sub(at)
+		if d < 0 {
+			d = -d
+		}
+		if anchor < 0 || d < best {
+			anchor, best = i, d
+		}
+	}
+	if anchor < 0 {
+		return nil, -1, 0
+	}
+	start := anchor - size/2
+	if start > len(msgs)-size {
+		start = len(msgs) - size
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + size
+	if end > len(msgs) {
+		end = len(msgs)
+	}
+	return msgs[start:end], anchor, start
+}
+
+// messageSubroute splits "/api/messages/{id}/{action}" like sessionSubroute.
+func messageSubroute(path string) (string, string, bool) {
+	return sessionSubroute("/api/sessions/" + strings.TrimPrefix(path, "/api/messages/"))
+}
+
+// sessionSubroute splits "/api/sessions/{id}/{action}" into its parts.
+// The id may be URL-escaped (Claude IDs contain colons).
+func sessionSubroute(path string) (string, string, bool) {
+	rest := strings.TrimPrefix(path, "/api/sessions/")
+	i := strings.LastIndex(rest, "/")
+	if i <= 0 || i == len(rest)-1 {
+		return "", "", false
+	}
+	id, err := url.PathUnescape(rest[:i])
+	if err != nil || id == "" {
+		return "", "", false
+	}
+	return id, rest[i+1:], true
+}
+
 func splitCSV(s string) []string {
 	out := []string{}
 	for _, p := range strings.Split(s, ",") {
@@ -460,13 +2263,7 @@ func toolCallID(msg *indexer.Message) string {
 }
 
 func toolMessageData(msg *indexer.Message) map[string]any {
-	if msg == nil || msg.Raw == nil {
-		return nil
-	}
-	if payload, ok := msg.Raw["payload"].(map[string]any); ok && payload != nil {
-		return payload
-	}
-	return msg.Raw
+	return indexer.MessageData(msg)
 }
 
 func stringValue(v any) string {
@@ -499,6 +2296,11 @@ const indexHTML = `<!doctype html>
     function truncate(s, n){ s=(s||'').toString(); if(s.length<=n) return s; return s.slice(0, Math.max(0,n-1)) + '…'; }
     function oneLine(s){ try{ return String(s||'').replace(/\s+/g,' ').trim(); }catch(e){ return ''} }
     function capFirst(s){ try{ s=String(s||''); if(!s) return s; return s.charAt(0).toUpperCase()+s.slice(1); }catch(e){ return s } }
+    // "mcp__server__tool" -> "MCP server · tool"; '' for built-in tools
+    function mcpToolLabel(name){
+      var m = /^mcp__(.+?)__(.+)$/.exec(String(name||''));
+      return m ? ('MCP ' + escapeHTML(m[1]) + ' · ' + escapeHTML(m[2])) : '';
+    }
     function toolEventData(m){
       var raw = (m && m.raw && typeof m.raw === 'object') ? m.raw : null;
       if (raw && raw.payload && typeof raw.payload === 'object') return raw.payload;
@@ -630,6 +2432,8 @@ const indexHTML = `<!doctype html>
     async function loadSessions(){
       sessionsLoadPromise = (async function(){
         try{
+          await loadLabels();
+          await loadDirInfo();
           const res = await fetch('/api/sessions?source=' + encodeURIComponent(currentSource));
           const data = await res.json();
           sessionsCache = Array.isArray(data) ? data : [];
@@ -715,11 +2519,15 @@ const indexHTML = `<!doctype html>
       return md;
     }
 
-    function copyMessage(ix, anchorId){
+    async function quotedMarkdown(m){
+      var res = await fetch('/api/messages/' + encodeURIComponent(m.id) + '/markdown?quote=1&session_id=' + encodeURIComponent(currentSessionId || ''));
+      return res.ok ? await res.text() : (markdownForMessage(m) || '');
+    }
+    function copyMessage(ix, anchorId, ev){
       try {
         var m = (messagesCache || [])[ix];
-        var md = markdownForMessage(m) || '';
-        copyToClipboard(md).then(function(ok){
+        var md = (ev && ev.shiftKey && m && m.id) ? quotedMarkdown(m) : Promise.resolve(markdownForMessage(m) || '');
+        md.then(copyToClipboard).then(function(ok){
           var el = document.getElementById('copy:'+anchorId);
           if (el) { var old = el.textContent; el.textContent = ok? '✓ Copied' : 'Copy failed'; setTimeout(function(){ try{ el.textContent = '⧉ Copy'; }catch(e){} }, 1200); }
         });
@@ -741,13 +2549,15 @@ const indexHTML = `<!doctype html>
         var isReasoning = !!(m.thinking && String(m.thinking).trim());
         var isFuncCall = (m.type === 'function_call') || (m.raw && m.raw.type === 'function_call');
         var isFuncOut = (m.type === 'function_call_output') || (m.raw && m.raw.type === 'function_call_output');
-        var rolePillClass = isReasoning ? 'role-assistant' : (role === 'user' ? 'role-user' : (role === 'assistant' ? 'role-assistant' : 'role-tool'));
+        var isNote = (m.type === 'watcher_note');
+        var rolePillClass = isNote ? 'role-note' : (isReasoning ? 'role-assistant' : (role === 'user' ? 'role-user' : (role === 'assistant' ? 'role-assistant' : 'role-tool')));
         var tsHTML = '';
         var model = (m.model ? '<span class="pill">' + m.model + '</span>' : '');
         var toolData = toolEventData(m);
         var toolNameRaw = toolData.name || 'tool';
-        var toolName = capFirst(toolNameRaw);
-        var pillLabel = isReasoning ? 'Assistant Thinking' : (isFuncCall ? ('Tool: ' + toolName) : (isFuncOut ? ('Tool Output' + (toolData.name ? (': ' + capFirst(toolData.name)) : '')) : (role || 'message')));
+        var toolName = mcpToolLabel(toolNameRaw) || capFirst(toolNameRaw);
+        if (isFuncCall && (m.tool_kind === 'mcp' || mcpToolLabel(toolNameRaw))) rolePillClass = 'role-mcp';
+        var pillLabel = isNote ? ('Note' + (m.raw && m.raw.author ? (': ' + escapeHTML(String(m.raw.author))) : '')) : isReasoning ? 'Assistant Thinking' : (isFuncCall ? ('Tool: ' + toolName) : (isFuncOut ? ('Tool Output' + (toolData.name ? (': ' + capFirst(toolData.name)) : '')) : (role || 'message')));
         var id2 = null;
         // Detect first Claude tool result id to place header arrow
         var firstToggleId = null;
@@ -805,9 +2615,9 @@ const indexHTML = `<!doctype html>
           arrow = ' <span id="'+firstToggleId+':arrow0" class="pill clickable" data-toggle="'+firstToggleId+'">' + sym2 + '</span>';
         }
         var anchorId = (m.id && String(m.id).trim() !== '') ? ('msg-' + m.id) : ('msg-L' + (m.line_no || 0));
-        var copyBtn = '<span id="'+('copy:'+anchorId).replace(/"/g,'&quot;')+'" class="pill clickable" title="Copy markdown" onclick="copyMessage('+ix+', \''+anchorId.replace(/'/g,"\\'")+'\')">⧉</span>';
+        var copyBtn = '<span id="'+('copy:'+anchorId).replace(/"/g,'&quot;')+'" class="pill clickable" title="Copy markdown (Shift: quoted, with source)" onclick="copyMessage('+ix+', \''+anchorId.replace(/'/g,"\\'")+'\', event)">⧉</span>';
         var delBtn = (m.id && String(m.id).trim() !== '') ? '<span class="pill clickable delete-btn" style="color:#c33;" title="删除此消息" onclick="deleteMessage(\''+currentSessionId.replace(/'/g,"\\'")+'\', \''+m.id.replace(/'/g,"\\'")+'\', '+ix+')">×</span>' : '';
-        return '<div class="msg" id="' + anchorId + '">'
+        return '<div class="msg' + (isNote ? ' note' : '') + '" id="' + anchorId + '">'
           + '<div class="meta"><div class="role"><span class="pill ' + rolePillClass + '">' + pillLabel + '</span>' + arrow + ' ' + model + '</div><div class="tool">' + copyBtn + ' ' + delBtn + '</div></div>'
           + '<div class="content">' + html + '</div>'
           + '</div>';
@@ -815,6 +2625,7 @@ const indexHTML = `<!doctype html>
       if (!el.innerHTML || !el.innerHTML.trim()) {
         el.innerHTML = '<div class="meta empty-hint">此会话没有可显示的文本</div>';
       }
+      el.insertAdjacentHTML('afterbegin', scrubberHTML(data));
       try { hljs.highlightAll(); } catch(e) {}
       attachMessageDelegates();
       // Mark the selected session in the sidebar list
@@ -837,6 +2648,31 @@ const indexHTML = `<!doctype html>
       } catch(e) {}
     }
 
+    // Date scrubber: a slider over the session's time span; releasing it asks
+    // /api/messages?at= for the nearest message and scrolls there
+    function scrubberHTML(msgs){
+      var lo = 0, hi = 0;
+      (msgs || []).forEach(function(m){ var t = m.ts ? Date.parse(m.ts) : NaN; if (isNaN(t) || t <= 0) return; if (!lo || t < lo) lo = t; if (t > hi) hi = t; });
+      if (!lo || hi - lo < 60000) return '';
+      return '<div class="scrubber meta"><span>跳转到时间</span>'
+        + '<input id="date-scrubber" type="range" min="' + lo + '" max="' + hi + '" step="60000" value="' + lo + '" oninput="scrubberLabel(this.value)" onchange="jumpToTime(this.value)" />'
+        + '<span id="scrubber-label">' + new Date(lo).toLocaleString() + '</span></div>';
+    }
+    function scrubberLabel(ms){ var el = document.getElementById('scrubber-label'); if (el) el.textContent = new Date(+ms).toLocaleString(); }
+    async function jumpToTime(ms){
+      if (!currentSessionId) return;
+      try{
+        var res = await fetch('/api/messages?session_id=' + encodeURIComponent(currentSessionId) + '&at=' + encodeURIComponent(ms) + '&limit=1');
+        var data = await res.json(); if (!res.ok) return;
+        var m = (data.messages || [])[0]; if (!m) return;
+        var node = document.getElementById(m.id ? ('msg-' + m.id) : ('msg-L' + (m.line_no || 0)));
+        if (!node) return;
+        try { node.scrollIntoView({behavior:'smooth', block:'start'}); } catch(e) { node.scrollIntoView(); }
+        node.classList.add('focus');
+        setTimeout(function(){ try{ node.classList.remove('focus'); }catch(e){} }, 2200);
+      }catch(e){}
+    }
+
     function setActiveSessionInList(id){
       var nodes = document.querySelectorAll('#sessions .item[data-id]');
       for (var i=0;i<nodes.length;i++){
@@ -849,9 +2685,26 @@ const indexHTML = `<!doctype html>
 
     function tryString(v){ if(typeof v==='string') return v; try{ return JSON.stringify(v, null, 2)}catch(e){return ''}}
 
+    // Images found in the message (served from the attachment cache) and
+    // links to its other attachments
+    function attachmentsHTML(m){
+      return ((m && m.attachments) || []).map(function(a){
+        var label = a.name || a.media_type || a.kind || 'attachment';
+        if (!a.cached) {
+          return '<div class="meta mt-1">📎 ' + escapeHTML(a.url || a.path || label) + '</div>';
+        }
+        var href = '/api/attachments/' + encodeURIComponent(a.id);
+        if (a.kind === 'image') {
+          return '<div class="mt-1"><a href="' + href + '" target="_blank" rel="noopener"><img src="' + href + '" alt="' + escapeHTML(label) + '" loading="lazy" style="max-width:100%;max-height:480px"></a></div>';
+        }
+        return '<div class="meta mt-1">📎 <a href="' + href + '" target="_blank" rel="noopener">' + escapeHTML(label) + '</a></div>';
+      }).join('');
+    }
+
     function renderContent(m){
       var md = '';
       var htmlBuilt = '';
+      var att = attachmentsHTML(m);
       if (m && typeof m.content === 'string' && m.content.trim() !== '') {
         md = m.content;
       } else if (m && m.raw && m.raw.content && Array.isArray(m.raw.content)) {
@@ -948,7 +2801,7 @@ const indexHTML = `<!doctype html>
           }
         });
         // If nothing meaningful, return empty to let caller skip rendering the message
-        if (!hasMeaningful) { return ''; }
+        if (!hasMeaningful && !att) { return ''; }
       } else if (m && m.raw && (m.raw.type === 'function_call' || m.type === 'function_call')) {
         // Render function call arguments; prefer commands for shell
         var toolData2 = toolEventData(m);
@@ -1013,16 +2866,17 @@ const indexHTML = `<!doctype html>
         }
       } else if (m && m.raw && typeof m.raw.text === 'string') {
         md = m.raw.text;
-      } else {
+      } else if (!att) {
         return '';
       }
-      if (htmlBuilt) { return DOMPurify.sanitize(htmlBuilt); }
-      try { return DOMPurify.sanitize(marked.parse(md)); } catch(e) { return escapeHTML(md); }
+      if (htmlBuilt) { return DOMPurify.sanitize(htmlBuilt + att); }
+      try { return DOMPurify.sanitize(marked.parse(md) + att); } catch(e) { return escapeHTML(md) + DOMPurify.sanitize(att); }
     }
 
     function escapeHTML(s){ return (s||'').toString().replace(/[&<>"']/g, function(c){return {'&':'&amp;','<':'&lt;','>':'&gt;','"':'&quot;','\'':'&#39;'}[c]||c;}) }
     let viewMode = 'time-cwd'; // 'cwd-time' | 'time-cwd' | 'flat'
-    let collapseTools = true;
+    let collapseTools = {{.CollapseTools}};
+    let notionEnabled = {{.Notion}};
     let sessionsCache = [];
     window.pendingFocus = null; // { sessionId, messageId, lineNo }
     function setViewMode(v){ viewMode = v; try{ localStorage.setItem('viewMode', viewMode); }catch(e){} renderSessions(sessionsCache); if (currentSessionId) selectSession(currentSessionId); }
@@ -1077,6 +2931,16 @@ const indexHTML = `<!doctype html>
       }catch(e){}
     }
 
+    // Context pack for resuming work in a directory
+    function openContextPack(cwd){
+      window.open('/api/export/context_pack?cwd=' + encodeURIComponent(cwd), '_blank');
+    }
+
+    // This week's journal for a directory
+    function openJournal(cwd){
+      window.open('/api/export/journal?cwd=' + encodeURIComponent(cwd), '_blank');
+    }
+
     // Search
     async function runSearch(){
       if (sessionsLoadPromise) {
@@ -1118,22 +2982,26 @@ const indexHTML = `<!doctype html>
     }
     function tokensFromQuery(q){
       if(!q) return [];
-      var arr = q.split(/\s+/).filter(Boolean);
+      // quoted phrases stay whole; the ideographic space separates like a space
+      var arr = q.replace(/\u3000/g,' ').match(/-?"[^"]*"|\S+/g) || [];
       var out = [];
       for (var i=0;i<arr.length;i++){
         var t = arr[i];
         if (!t) continue;
         if (t === 'OR') continue;
-        if (t[0] === '-') t = t.slice(1);
+        if (t[0] === '-') continue; // exclusions are not in the text
+        if (t[0] === '"' && t[t.length-1]==='"') { t = t.slice(1,-1); if (t) out.push(t); continue; }
         if (t.indexOf(':')>0) continue; // field
-        if (t[0] === '"' && t[t.length-1]==='"') t = t.slice(1,-1);
         if (t[0] === '/' && t.lastIndexOf('/')>0) continue; // regex: skip naive highlight
-        t = t.replace(/\*/g,'');
+        // wildcard: mark its longest literal piece
+        t = t.split('*').sort(function(a,b){ return b.length-a.length; })[0];
         if (t) out.push(t);
       }
       return out.slice(0,5);
     }
-    function hiSnippet(s, q){ if(!s) return ''; var toks = tokensFromQuery(q); var out=escapeHTML(s); try{ for(var i=0;i<toks.length;i++){ var t=toks[i]; var rx=new RegExp(t.replace(/[.*+?^${}()|[\]\\]/g,'\\$&'),'ig'); out=out.replace(rx, function(m){return '<mark>'+m+'</mark>';}); } }catch(e){} return out; }
+    // marks are the matched pieces the server found (CJK- and wildcard-aware);
+    // without them the query's own words are marked
+    function hiSnippet(s, q, marks){ if(!s) return ''; var toks = (marks && marks.length) ? marks : tokensFromQuery(q); var out=escapeHTML(s); try{ for(var i=0;i<toks.length;i++){ var t=escapeHTML(toks[i]); var rx=new RegExp(t.replace(/[.*+?^${}()|[\]\\]/g,'\\$&'),'ig'); out=out.replace(rx, function(m){return '<mark>'+m+'</mark>';}); } }catch(e){} return out; }
     function highlightInElement(root, q){
       try{
         if(!root) return; var toks = tokensFromQuery(q); if(!toks || toks.length===0) return;
@@ -1192,14 +3060,14 @@ const indexHTML = `<!doctype html>
         var title = ((sess && (sess.title||'').trim()) || titleFromHits(group.hits) || nameForSession(group.sid));
         var copyBtnId = 'copy-cmd-search-' + (group.sid||'').replace(/[^a-zA-Z0-9-]/g, '-');
         var copyBtn = (sess && sess.cwd && supportsResumeProvider(sess.provider)) ? ('<span id="'+copyBtnId+'" class="pill clickable ml-1" title="Copy resume command" onclick="event.stopPropagation(); copySessionCommand(\''+group.sid.replace(/'/g,"\\'")+'\', \''+sess.cwd.replace(/'/g,"\\'")+'\', \''+sess.provider+'\', \''+copyBtnId+'\'); return false;">⏯</span>') : '';
-        var editBtn = '<span class="pill clickable ml-1" title="编辑标题" onclick="event.stopPropagation(); editSessionTitle(\''+ group.sid.replace(/'/g,"\\'") +'\', \''+ title.replace(/'/g,"\\'") +'\'); return false;">✏️</span>';
+        var editBtn = '<span class="pill clickable ml-1" title="编辑标题" onclick="event.stopPropagation(); editSessionTitle(\''+ group.sid.replace(/'/g,"\\'") +'\', \''+ title.replace(/'/g,"\\'") +'\', this); return false;">✏️</span>';
         var delBtn = '<span class="pill clickable delete-btn" style="color:#c33;" title="删除会话" onclick="event.stopPropagation(); deleteSession(\''+ group.sid.replace(/'/g,"\\'") +'\', \''+ title.replace(/'/g,"\\'") +'\'); return false;">×</span>';
         var groupAttrSid = escapeHTML(group.sid||'');
         html += '<div class="group">' + '<div class="item" data-sid="'+groupAttrSid+'" onclick="toggleGroup(\'' + key.replace(/'/g,"\'") + '\')"><strong>' + escapeHTML(title) + '</strong> <span class="meta">(' + group.hits.length + ')</span> ' + caret + (startAt ? ('<br /><span class="meta">' + startAt + '</span>') : '') + '<br /><span class="meta">' + copyBtn + ' ' + editBtn + ' ' + delBtn + '</span></div>';
         if (!collapsed){
         for (var j=0;j<group.hits.length;j++){
           var h = group.hits[j]; var pill = (h.type && h.type!=='') ? ('<span class="pill">'+h.type+'</span>') : (h.role? ('<span class="pill">'+h.role+'</span>') : '<span class="pill">message</span>');
-          var field = h.field || 'content'; var snippet = hiSnippet(h.content||'', q);
+          var field = h.field || 'content'; var snippet = hiSnippet(h.content||'', q, h.marks);
           var anchor = (h.message_id && String(h.message_id).trim() !== '') ? String(h.message_id) : ('L'+(h.line_no||0));
           var safeAnchorAttr = escapeHTML(anchor);
           html += '<div class="result-item" data-session-id="'+groupAttrSid+'" data-anchor="'+safeAnchorAttr+'" onclick="openHit(\''+group.sid+'\', \''+anchor.replace(/'/g,"\\'")+'\', '+(h.line_no||0)+')">' + '<div class="meta">' + pill + ' <span class="pill">' + field + '</span></div>' + '<div>' + (snippet? snippet : '<span class="meta">(no preview)</span>') + '</div>' + '</div>';
@@ -1263,13 +3131,18 @@ const indexHTML = `<!doctype html>
       }
     }
 
+    // POST a JSON body so ids and titles stay out of URLs and access logs
+    function postJSON(url, body){
+      return fetch(url, {method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(body)});
+    }
+
     // Delete session with confirmation
     async function deleteSession(sessionId, sessionTitle){
       if(!sessionId) return;
       var title = sessionTitle || sessionId;
-      if(!confirm('确定要删除会话 "' + title + '" 吗？\n\n此操作将永久删除会话文件，无法恢复！')) return;
+      if(!confirm('确定要删除会话 "' + title + '" 吗？\n\n会话文件将移入回收站，保留期内可通过 /api/trash/restore 恢复。')) return;
       try{
-        var res = await fetch('/api/sessions/delete?session_id=' + encodeURIComponent(sessionId), {method: 'POST'});
+        var res = await postJSON('/api/sessions/delete', {session_id: sessionId});
         var data = await res.json();
         if(res.ok && data.ok){
           loadSessions(); // Reload session list
@@ -1284,9 +3157,9 @@ const indexHTML = `<!doctype html>
     // Delete message with confirmation
     async function deleteMessage(sessionId, messageId, messageIndex){
       if(!sessionId || !messageId) return;
-      if(!confirm('确定要删除这条消息吗？\n\n此操作将重写会话文件，删除的消息无法恢复！')) return;
+      if(!confirm('确定要删除这条消息吗？\n\n此操作将重写会话文件，删除的消息移入回收站，保留期内可恢复。')) return;
       try{
-        var res = await fetch('/api/messages/delete?session_id=' + encodeURIComponent(sessionId) + '&message_id=' + encodeURIComponent(messageId), {method: 'POST'});
+        var res = await postJSON('/api/messages/delete', {session_id: sessionId, message_id: messageId});
         var data = await res.json();
         if(res.ok && data.ok){
           // Reload messages for current session
@@ -1299,19 +3172,167 @@ const indexHTML = `<!doctype html>
       }
     }
 
-    // Edit session title
-    function editSessionTitle(sessionId, currentTitle){
+    // Color labels: palette and directory colors from /api/labels
+    var labelPalette = {}, dirColors = {};
+    async function loadLabels(){
+      try{ var r = await fetch('/api/labels'); var d = await r.json(); labelPalette = d.palette || {}; dirColors = d.dirs || {}; }catch(e){}
+    }
+    // Directory metadata (display name, description, default tags) from /api/dirs
+    var dirInfo = {};
+    async function loadDirInfo(){
+      try{ var r = await fetch('/api/dirs'); var d = await r.json(); dirInfo = d.dirs || {}; }catch(e){}
+    }
+    function dirName(cwd){ var m = dirInfo[cwd]; return (m && m.name) || baseName(cwd); }
+    function dirDescHTML(cwd){
+      var m = dirInfo[cwd]; if (!m) return '';
+      var out = m.description ? '<br /> <span class="meta">' + escapeHTML(m.description) + '</span>' : '';
+      (m.tags || []).forEach(function(t){ out += ' <span class="pill">#' + escapeHTML(t) + '</span>'; });
+      return out;
+    }
+    async function editDirInfo(cwd){
+      var m = dirInfo[cwd] || {};
+      var name = prompt('目录显示名称 (留空使用目录名):', m.name || ''); if (name === null) return;
+      var desc = prompt('目录描述:', m.description || ''); if (desc === null) return;
+      var tags = prompt('默认标签 (逗号分隔):', (m.tags || []).join(', ')); if (tags === null) return;
+      var res = await postJSON('/api/dirs', {cwd: cwd, name: name, description: desc, tags: tags}); var data = await res.json();
+      if(res.ok && data.ok){ await loadDirInfo(); refreshSessions().catch(()=>{}); } else { alert('保存目录信息失败: ' + (data.error || 'Unknown error')); }
+    }
+    async function hideDir(cwd){
+      if (!cwd || !confirm('在列表中隐藏目录 ' + cwd + ' ？\n会话不会被删除，可在「已隐藏」页面恢复。')) return;
+      var res = await postJSON('/api/dirs/hide', {cwd: cwd, hidden: true}); var data = await res.json();
+      if(res.ok && data.ok){ refreshSessions().catch(()=>{}); } else { alert('隐藏目录失败: ' + (data.error || 'Unknown error')); }
+    }
+    function colorValue(c){ return c ? (labelPalette[c] || c) : ''; }
+    function tintStyle(c){ var v = colorValue(c); return v ? ' style="border-left: 4px solid ' + escapeHTML(v) + ';"' : ''; }
+    function askColor(current){
+      var names = Object.keys(labelPalette).sort().join(', ');
+      var c = prompt('颜色标签 (' + names + ' 或 #hex，留空清除):', current || '');
+      return c === null ? null : c.trim();
+    }
+    function colorButton(it){
+      return '<span class="pill clickable ml-1" title="颜色标签" onclick="event.stopPropagation(); pickSessionColor(\''+ it.id.replace(/'/g,"\\'") +'\', \''+ (it.color||'').replace(/'/g,"\\'") +'\'); return false;">🎨</span>';
+    }
+    async function pickSessionColor(sessionId, current){
+      var c = askColor(current); if (c === null) return;
+      var res = await postJSON('/api/sessions/color', {session_id: sessionId, color: c}); var data = await res.json();
+      if(res.ok && data.ok){ refreshSessions().catch(()=>{}); } else { alert('设置颜色失败: ' + (data.error || 'Unknown error')); }
+    }
+    async function pickDirColor(cwd){
+      var c = askColor(dirColors[cwd]); if (c === null) return;
+      var res = await postJSON('/api/dirs/color', {cwd: cwd, color: c}); var data = await res.json();
+      if(res.ok && data.ok){ await loadLabels(); refreshSessions().catch(()=>{}); } else { alert('设置颜色失败: ' + (data.error || 'Unknown error')); }
+    }
+
+    // Compare the answers of edited prompts and retries (Claude branches)
+    function branchesButton(it){
+      if (it.provider !== 'claude') return '';
+      return '<span class="pill clickable ml-1" title="对比回答版本" onclick="event.stopPropagation(); window.open(\'/branches?session=\' + encodeURIComponent(\''+ it.id.replace(/'/g,"\\'") +'\'), \'_blank\'); return false;">🔀</span>';
+    }
+    function revealButton(it){
+      return '<span class="pill clickable ml-1" title="在文件夹中显示" onclick="event.stopPropagation(); revealSession(\''+ it.id.replace(/'/g,"\\'") +'\'); return false;">📂</span>';
+    }
+    async function revealSession(sessionId){
+      try{
+        var res = await fetch('/api/sessions/' + encodeURIComponent(sessionId) + '/reveal', {method: 'POST'});
+        var data = await res.json();
+        if(!(res.ok && data.ok)){ alert('无法显示文件: ' + (data.error || 'Unknown error')); }
+      }catch(e){ alert('无法显示文件: ' + e.message); }
+    }
+    // Publish the session as a page in the configured Notion database
+    function notionButton(it){
+      if (!notionEnabled) return '';
+      return '<span class="pill clickable ml-1" title="发布到 Notion" onclick="event.stopPropagation(); exportNotion(\''+ it.id.replace(/'/g,"\\'") +'\'); return false;">🅽</span>';
+    }
+    async function exportNotion(sessionId){
+      try{
+        var res = await postJSON('/api/export/notion', {session_id: sessionId});
+        var data = await res.json();
+        if(res.ok && data.ok){ if (data.url) window.open(data.url, '_blank'); }
+        else { alert('发布到 Notion 失败: ' + (data.error || 'Unknown error')); }
+      }catch(e){ alert('发布到 Notion 失败: ' + e.message); }
+    }
+    // Copy a paste-ready context block for starting a new agent session
+    function clipButton(it){
+      var id = 'clip-' + (it.id||'').replace(/[^a-zA-Z0-9-]/g, '-');
+      return '<span id="'+id+'" class="pill clickable ml-1" title="复制为上下文" onclick="event.stopPropagation(); copyClip(\''+ it.id.replace(/'/g,"\\'") +'\', \''+id+'\'); return false;">📋</span>';
+    }
+    async function copyClip(sessionId, elementId){
+      var ok = false;
+      try{
+        var res = await fetch('/api/export/clip?session_id=' + encodeURIComponent(sessionId));
+        ok = res.ok && await copyToClipboard(await res.text());
+      }catch(e){}
+      var el = document.getElementById(elementId);
+      if (el) {
+        var old = el.textContent;
+        el.textContent = ok ? '✓' : '✗';
+        setTimeout(function(){ try{ el.textContent = old; }catch(e){} }, 1000);
+      }
+    }
+
+    // Pin toggle shown next to each session
+    function pinButton(it){
+      var on = !!it.pinned;
+      return '<span class="pill clickable ml-1" title="' + (on ? '取消置顶' : '置顶') + '" onclick="event.stopPropagation(); togglePin(\''+ it.id.replace(/'/g,"\\'") +'\', ' + (!on) + '); return false;">' + (on ? '📌' : '📍') + '</span>';
+    }
+    async function togglePin(sessionId, pinned){
+      try{
+        var res = await postJSON('/api/sessions/pin', {session_id: sessionId, pinned: pinned});
+        var data = await res.json();
+        if(res.ok && data.ok){ refreshSessions().catch(()=>{}); } else { alert('置顶失败: ' + (data.error || 'Unknown error')); }
+      }catch(e){ alert('置顶失败: ' + e.message); }
+    }
+
+    // Edit session title in place: the title of the list item turns into a
+    // text field; Enter or leaving it saves, Escape cancels
+    function editSessionTitle(sessionId, currentTitle, btn){
       if(!sessionId) return;
-      var newTitle = prompt('请输入新标题:', currentTitle || '');
-      if(newTitle === null || newTitle.trim() === '') return; // User cancelled or empty
-      updateSessionTitle(sessionId, newTitle.trim());
+      var item = btn && btn.closest ? btn.closest('.item') : null;
+      var strong = item ? item.querySelector('strong') : null;
+      if(!strong){
+        var newTitle = prompt('请输入新标题:', currentTitle || '');
+        if(newTitle === null || newTitle.trim() === '') return; // User cancelled or empty
+        updateSessionTitle(sessionId, newTitle.trim());
+        return;
+      }
+      if(strong.querySelector('input')) return; // already editing
+      var before = strong.innerHTML;
+      var input = document.createElement('input');
+      input.type = 'text';
+      input.className = 'rename-input';
+      input.value = currentTitle === '(No title)' ? '' : (currentTitle || '');
+      input.setAttribute('aria-label', '会话标题');
+      input.style.width = '100%';
+      strong.innerHTML = '';
+      strong.appendChild(input);
+      var done = false;
+      function finish(save){
+        if(done) return;
+        done = true;
+        var v = input.value.trim();
+        if(save && v && v !== currentTitle){
+          strong.textContent = v;
+          updateSessionTitle(sessionId, v).then(function(ok){ if(!ok) strong.innerHTML = before; });
+        } else {
+          strong.innerHTML = before;
+        }
+      }
+      input.addEventListener('click', function(e){ e.stopPropagation(); });
+      input.addEventListener('keydown', function(e){
+        e.stopPropagation();
+        if(e.key === 'Enter'){ e.preventDefault(); finish(true); }
+        else if(e.key === 'Escape'){ e.preventDefault(); finish(false); }
+      });
+      input.addEventListener('blur', function(){ finish(true); });
+      input.focus();
+      input.select();
     }
 
     // Update session title via API
     async function updateSessionTitle(sessionId, newTitle){
-      if(!sessionId || !newTitle) return;
+      if(!sessionId || !newTitle) return false;
       try{
-        var res = await fetch('/api/sessions/update-title?session_id=' + encodeURIComponent(sessionId) + '&title=' + encodeURIComponent(newTitle), {method: 'POST'});
+        var res = await postJSON('/api/sessions/rename', {session_id: sessionId, title: newTitle});
         var data = await res.json();
         if(res.ok && data.ok){
           // Update the title in the sessions cache
@@ -1326,12 +3347,13 @@ const indexHTML = `<!doctype html>
           if (isSearchViewVisible() && lastSearch && lastSearch.res) {
             renderSearchResults(lastSearch.res, lastSearch.q||'');
           }
-        } else {
-          alert('更新标题失败: ' + (data.error || 'Unknown error'));
+          return true;
         }
+        alert('更新标题失败: ' + (data.error || 'Unknown error'));
       }catch(e){
         alert('更新标题失败: ' + e.message);
       }
+      return false;
     }
 
     function formatPath(p){ if(!p) return '(Unknown)';
@@ -1348,7 +3370,7 @@ const indexHTML = `<!doctype html>
       var groups=[];
       for (var k in m){
         var arr=m[k].slice();
-        arr.sort(function(a,b){ var da = new Date(a.last_at||0).getTime(); var db = new Date(b.last_at||0).getTime(); return db-da; });
+        arr.sort(function(a,b){ if(!!a.pinned !== !!b.pinned) return a.pinned ? -1 : 1; var da = new Date(a.last_at||0).getTime(); var db = new Date(b.last_at||0).getTime(); return db-da; });
         var last = arr.length? arr[0].last_at : '';
         groups.push({cwd:k, items:arr, lastAt:last});
       }
@@ -1362,6 +3384,9 @@ const indexHTML = `<!doctype html>
       var m={}; list.forEach(function(it){ var lbl=bucketLabel(it.last_at); (m[lbl]||(m[lbl]=[])).push(it); });
       var order=['Today','Yesterday','Last 7 days','Last 30 days'];
       var buckets=[];
+      // Pinned sessions get their own bucket on top instead of a time bucket
+      var pinned = list.filter(function(it){ return it.pinned; }).sort(sortByLastAtDesc);
+      if (pinned.length) { order.forEach(function(lbl){ if(m[lbl]) m[lbl] = m[lbl].filter(function(it){ return !it.pinned; }); }); buckets.push({label:'Pinned', items: pinned}); }
       order.forEach(function(lbl){ if(m[lbl]&&m[lbl].length){ m[lbl].sort(sortByLastAtDesc); buckets.push({label:lbl, items:m[lbl]}); } });
       // Add an "All" bucket with everything, sorted
       var all = list.slice().sort(sortByLastAtDesc);
@@ -1378,13 +3403,11 @@ const indexHTML = `<!doctype html>
       const filtered = all;
       const s = document.getElementById('sessions');
       function parseDateSafe(v){ var d=new Date(v); return isNaN(d)? null : d; }
-      function endAtOf(it){ var a=parseDateSafe(it.last_at), b=parseDateSafe(it.file_mod_at); if(a&&b) return a>b?a:b; return a||b; }
       function fmtStartCountDur(it){
         var start = parseDateSafe(it.first_at);
-        var end = endAtOf(it) || start;
         var count = (it.message_count||0);
         var startStr = start? start.toLocaleString() : '';
-        var durMs = (start && end) ? (end - start) : 0;
+        var durMs = (it.active_duration || 0) / 1e6; // active time from the server, idle gaps excluded
         function human(ms){ if(ms<=0) return '0s'; var s=Math.floor(ms/1000); var d=Math.floor(s/86400); s%=86400; var h=Math.floor(s/3600); s%=3600; var m=Math.floor(s/60); s%=60; var out=[]; if(d) out.push(d+'d'); if(h) out.push(h+'h'); if(m) out.push(m+'m'); if(s && out.length<2) out.push(s+'s'); return out.join(' ')||'0s'; }
         return startStr + ' · ' + count + ' msgs · ' + human(durMs);
       }
@@ -1396,11 +3419,12 @@ const indexHTML = `<!doctype html>
           var title = it.title || '(No title)';
           var copyBtnId = 'copy-cmd-' + (it.id||'').replace(/[^a-zA-Z0-9-]/g, '-');
           var copyBtn = (it.cwd && supportsResumeProvider(it.provider)) ? ('<span id="'+copyBtnId+'" class="pill clickable ml-1" title="Copy resume command" onclick="event.stopPropagation(); copySessionCommand(\''+it.id.replace(/'/g,"\\'")+'\', \''+it.cwd.replace(/'/g,"\\'")+'\', \''+it.provider+'\', \''+copyBtnId+'\'); return false;">⏯</span>') : '';
-          var editBtn = '<span class="pill clickable ml-1" title="编辑标题" onclick="event.stopPropagation(); editSessionTitle(\''+ it.id.replace(/'/g,"\\'") +'\', \''+ title.replace(/'/g,"\\'") +'\'); return false;">✏️</span>';
+          var editBtn = '<span class="pill clickable ml-1" title="编辑标题" onclick="event.stopPropagation(); editSessionTitle(\''+ it.id.replace(/'/g,"\\'") +'\', \''+ title.replace(/'/g,"\\'") +'\', this); return false;">✏️</span>';
+          var pinBtn = pinButton(it) + colorButton(it) + clipButton(it) + revealButton(it) + branchesButton(it) + notionButton(it);
           var delBtn = '<span class="pill clickable delete-btn" style="color:#c33;" title="删除会话" onclick="event.stopPropagation(); deleteSession(\''+ it.id.replace(/'/g,"\\'") +'\', \''+ (it.title||it.id).replace(/'/g,"\\'") +'\'); return false;">×</span>';
-          return '<div class="item" data-id="' + it.id + '" onclick="selectSession(\'' + it.id + '\')">'
-            + '<div><strong>' + escapeHTML(title) + '</strong></div>'
-            + '<div class="meta">' + meta + ' ' + copyBtn + ' ' + editBtn + ' ' + delBtn + '</div>'
+          return '<div class="item" data-id="' + it.id + '"' + tintStyle(it.color) + ' onclick="selectSession(\'' + it.id + '\')">'
+            + '<div>' + (it.pinned ? '📌 ' : '') + '<strong>' + escapeHTML(title) + '</strong></div>'
+            + '<div class="meta">' + meta + ' ' + copyBtn + ' ' + pinBtn + ' ' + editBtn + ' ' + delBtn + '</div>'
             + '<div class="meta">' + pills + '</div>'
             + '</div>';
         }).join('');
@@ -1417,7 +3441,7 @@ const indexHTML = `<!doctype html>
           var collapsed = getCollapsed(key);
           var caret = collapsed ? '▸' : '▾';
           var title = formatPath(g.cwd);
-          var titleBase = baseName(g.cwd);
+          var titleBase = escapeHTML(dirName(g.cwd));
           var sessionsHTML = '';
           if(!collapsed){
             sessionsHTML = g.items.map(function(it){
@@ -1426,18 +3450,19 @@ const indexHTML = `<!doctype html>
               var title = it.title || '(No title)';
               var copyBtnId = 'copy-cmd-' + (it.id||'').replace(/[^a-zA-Z0-9-]/g, '-');
               var copyBtn = (it.cwd && supportsResumeProvider(it.provider)) ? ('<span id="'+copyBtnId+'" class="pill clickable ml-1" title="Copy resume command" onclick="event.stopPropagation(); copySessionCommand(\''+it.id.replace(/'/g,"\\'")+'\', \''+it.cwd.replace(/'/g,"\\'")+'\', \''+it.provider+'\', \''+copyBtnId+'\'); return false;">⏯</span>') : '';
-              var editBtn = '<span class="pill clickable ml-1" title="编辑标题" onclick="event.stopPropagation(); editSessionTitle(\''+ it.id.replace(/'/g,"\\'") +'\', \''+ title.replace(/'/g,"\\'") +'\'); return false;">✏️</span>';
+              var editBtn = '<span class="pill clickable ml-1" title="编辑标题" onclick="event.stopPropagation(); editSessionTitle(\''+ it.id.replace(/'/g,"\\'") +'\', \''+ title.replace(/'/g,"\\'") +'\', this); return false;">✏️</span>';
+              var pinBtn = pinButton(it) + colorButton(it) + clipButton(it) + revealButton(it) + branchesButton(it) + notionButton(it);
               var delBtn = '<span class="pill clickable delete-btn" style="color:#c33;" title="删除会话" onclick="event.stopPropagation(); deleteSession(\''+ it.id.replace(/'/g,"\\'") +'\', \''+ (it.title||it.id).replace(/'/g,"\\'") +'\'); return false;">×</span>';
-              return '<div class="item" data-id="' + it.id + '" onclick="selectSession(\'' + it.id + '\')">'
-                + '<div><strong>' + escapeHTML(title) + '</strong></div>'
-                + '<div class="meta">' + meta + ' ' + copyBtn + ' ' + editBtn + ' ' + delBtn + '</div>'
+              return '<div class="item" data-id="' + it.id + '"' + tintStyle(it.color) + ' onclick="selectSession(\'' + it.id + '\')">'
+                + '<div>' + (it.pinned ? '📌 ' : '') + '<strong>' + escapeHTML(title) + '</strong></div>'
+                + '<div class="meta">' + meta + ' ' + copyBtn + ' ' + pinBtn + ' ' + editBtn + ' ' + delBtn + '</div>'
                 + '<div class="meta">' + pills + '</div>'
                 + '</div>';
             }).join('');
           }
           var lastAtG = (g.lastAt ? new Date(g.lastAt).toLocaleString() : '');
               return '<div class="group">'
-                + '<div class="item' + (collapsed ? '' : ' expanded') + '" onclick="toggleGroup(\'' + (key.replace(/'/g,"\'")) + '\')" title="' + (g.cwd||'') + '">' + caret + ' <strong class="fw-600">' + titleBase + '</strong><span class="meta ml-1 clickable" title="导出该目录" onclick="event.stopPropagation(); exportDir(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">⤴︎</span><br /> <span class="meta">' + title + '</span><br /> <span class="meta">' + g.items.length + ' sessions • ' + lastAtG + '</span></div>'
+                + '<div class="item' + (collapsed ? '' : ' expanded') + '"' + tintStyle(dirColors[g.cwd]) + ' onclick="toggleGroup(\'' + (key.replace(/'/g,"\'")) + '\')" title="' + (g.cwd||'') + '">' + caret + ' <strong class="fw-600">' + titleBase + '</strong><span class="meta ml-1 clickable" title="导出该目录" onclick="event.stopPropagation(); exportDir(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">⤴︎</span><span class="meta ml-1 clickable" title="生成上下文包" onclick="event.stopPropagation(); openContextPack(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">🧭</span><span class="meta ml-1 clickable" title="本周日志" onclick="event.stopPropagation(); openJournal(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">📓</span><span class="meta ml-1 clickable" title="目录颜色" onclick="event.stopPropagation(); pickDirColor(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">🎨</span><span class="meta ml-1 clickable" title="编辑目录信息" onclick="event.stopPropagation(); editDirInfo(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">✏️</span><span class="meta ml-1 clickable" title="隐藏该目录" onclick="event.stopPropagation(); hideDir(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">🙈</span>' + dirDescHTML(g.cwd) + '<br /> <span class="meta">' + title + '</span><br /> <span class="meta">' + g.items.length + ' sessions • ' + lastAtG + '</span></div>'
                 + (collapsed ? '' : sessionsHTML)
                 + '</div>';
         }).join('');
@@ -1460,7 +3485,7 @@ const indexHTML = `<!doctype html>
               var collapsed = getCollapsed(key);
               var caret = collapsed ? '▸' : '▾';
               var title = formatPath(g.cwd);
-              var titleBase = baseName(g.cwd);
+              var titleBase = escapeHTML(dirName(g.cwd));
               var sessionsHTML = '';
               if(!collapsed){
                 sessionsHTML = g.items.map(function(it){
@@ -1469,18 +3494,19 @@ const indexHTML = `<!doctype html>
                   var title = it.title || '(No title)';
                   var copyBtnId = 'copy-cmd-' + (it.id||'').replace(/[^a-zA-Z0-9-]/g, '-');
                   var copyBtn = (it.cwd && supportsResumeProvider(it.provider)) ? ('<span id="'+copyBtnId+'" class="pill clickable ml-1" title="Copy resume command" onclick="event.stopPropagation(); copySessionCommand(\''+it.id.replace(/'/g,"\\'")+'\', \''+it.cwd.replace(/'/g,"\\'")+'\', \''+it.provider+'\', \''+copyBtnId+'\'); return false;">⏯</span>') : '';
-                  var editBtn = '<span class="pill clickable ml-1" title="编辑标题" onclick="event.stopPropagation(); editSessionTitle(\''+ it.id.replace(/'/g,"\\'") +'\', \''+ title.replace(/'/g,"\\'") +'\'); return false;">✏️</span>';
+                  var editBtn = '<span class="pill clickable ml-1" title="编辑标题" onclick="event.stopPropagation(); editSessionTitle(\''+ it.id.replace(/'/g,"\\'") +'\', \''+ title.replace(/'/g,"\\'") +'\', this); return false;">✏️</span>';
+                  var pinBtn = pinButton(it) + colorButton(it) + clipButton(it) + revealButton(it) + branchesButton(it) + notionButton(it);
                   var delBtn = '<span class="pill clickable delete-btn" style="color:#c33;" title="删除会话" onclick="event.stopPropagation(); deleteSession(\''+ it.id.replace(/'/g,"\\'") +'\', \''+ (it.title||it.id).replace(/'/g,"\\'") +'\'); return false;">×</span>';
-                  return '<div class="item" data-id="' + it.id + '" onclick="selectSession(\'' + it.id + '\')">'
-                    + '<div><strong>' + escapeHTML(title) + '</strong></div>'
-                    + '<div class="meta">' + meta + ' ' + copyBtn + ' ' + editBtn + ' ' + delBtn + '</div>'
+                  return '<div class="item" data-id="' + it.id + '"' + tintStyle(it.color) + ' onclick="selectSession(\'' + it.id + '\')">'
+                    + '<div>' + (it.pinned ? '📌 ' : '') + '<strong>' + escapeHTML(title) + '</strong></div>'
+                    + '<div class="meta">' + meta + ' ' + copyBtn + ' ' + pinBtn + ' ' + editBtn + ' ' + delBtn + '</div>'
                     + '<div class="meta">' + pills + '</div>'
                     + '</div>';
                 }).join('');
               }
               var lastAtG = (g.lastAt ? new Date(g.lastAt).toLocaleString() : '');
               return '<div class="group">'
-                + '<div class="item' + (collapsed ? '' : ' expanded') + '" onclick="toggleGroup(\'' + key.replace(/'/g,"\'") + '\')" title="' + (g.cwd||'') + '">' + caret + ' <strong class="fw-600">' + titleBase + '</strong><span class="meta ml-1 clickable" title="导出该目录" onclick="event.stopPropagation(); exportDir(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">⤴︎</span><br /> <span class="meta">' + title + '</span><br /> <span class="meta">' + g.items.length + ' sessions • ' + lastAtG + '</span></div>'
+                + '<div class="item' + (collapsed ? '' : ' expanded') + '"' + tintStyle(dirColors[g.cwd]) + ' onclick="toggleGroup(\'' + key.replace(/'/g,"\'") + '\')" title="' + (g.cwd||'') + '">' + caret + ' <strong class="fw-600">' + titleBase + '</strong><span class="meta ml-1 clickable" title="导出该目录" onclick="event.stopPropagation(); exportDir(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">⤴︎</span><span class="meta ml-1 clickable" title="生成上下文包" onclick="event.stopPropagation(); openContextPack(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">🧭</span><span class="meta ml-1 clickable" title="本周日志" onclick="event.stopPropagation(); openJournal(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">📓</span><span class="meta ml-1 clickable" title="目录颜色" onclick="event.stopPropagation(); pickDirColor(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">🎨</span><span class="meta ml-1 clickable" title="编辑目录信息" onclick="event.stopPropagation(); editDirInfo(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">✏️</span><span class="meta ml-1 clickable" title="隐藏该目录" onclick="event.stopPropagation(); hideDir(\''+ (g.cwd||'').replace(/'/g,"\\'") +'\'); return false;">🙈</span>' + dirDescHTML(g.cwd) + '<br /> <span class="meta">' + title + '</span><br /> <span class="meta">' + g.items.length + ' sessions • ' + lastAtG + '</span></div>'
                 + (collapsed ? '' : sessionsHTML)
                 + '</div>';
             }).join('');
@@ -1500,18 +3526,39 @@ const indexHTML = `<!doctype html>
         try { renderSearchResults(lastSearch.res, lastSearch.q||''); } catch(e){}
       }
     }
+    // Initial-scan progress banner; polls /api/stats until indexing is done
+    async function pollIndexing(){
+      var banner = document.getElementById('indexing-banner');
+      try{
+        var r = await fetch('/api/stats', {headers: banner.dataset.rev ? {'If-Revision-Newer': banner.dataset.rev} : {}});
+        if (r.status === 304) { setTimeout(pollIndexing, 2000); return; }
+        var st = await r.json(); var p = st.indexing || {}; banner.dataset.rev = String(st.revision || '');
+        if (p.ready || !p.active) { banner.classList.add('hidden'); if (banner.dataset.shown) { banner.dataset.shown = ''; refreshSessions().catch(()=>{}); } return; }
+        var pct = p.bytes_total > 0 ? Math.floor(100 * p.bytes_done / p.bytes_total) : 0;
+        var eta = p.eta_seconds > 0 ? ' · ~' + (p.eta_seconds >= 60 ? Math.round(p.eta_seconds/60) + ' min' : p.eta_seconds + ' s') + ' left' : '';
+        banner.textContent = 'Indexing sessions… ' + p.files_done + '/' + p.files_total + ' files (' + pct + '%)' + eta + ' — lists and stats are incomplete until this finishes.';
+        banner.classList.remove('hidden'); banner.dataset.shown = '1';
+      }catch(e){}
+      setTimeout(pollIndexing, 2000);
+    }
     window.addEventListener('load', ()=>{
+      pollIndexing();
       try{ viewMode = localStorage.getItem('viewMode') || 'time-cwd'; }catch(e){ viewMode='time-cwd'; }
       var sel = document.getElementById('viewModeSelect');
       if (sel) sel.value = viewMode;
+      // Deep link: /?session=<id>[&message=<id>] (used by /api/quicksearch results and quoted messages)
+      var linked = '', linkedMsg = '';
+      try{ var params = new URLSearchParams(window.location.search); linked = params.get('session') || ''; linkedMsg = params.get('message') || ''; }catch(e){}
+      if (linked) { currentSource = linked.indexOf('claude:') === 0 ? 'claude' : 'codex'; }
       loadSessions();
       // Try to restore last opened session per source after loadSessions completes
       setTimeout(function(){
         try{
-          var last = localStorage.getItem('last:'+(currentSource||'codex'));
+          var last = linked || localStorage.getItem('last:'+(currentSource||'codex'));
           if (last) {
             // If it exists in the current list, reselect
             var node = document.querySelector('#sessions .item[data-id="'+CSS.escape(last)+'"]');
+            if (node && linked && linkedMsg) window.pendingFocus = { sessionId: linked, messageId: linkedMsg, lineNo: 0 };
             if (node) selectSession(last);
           }
         }catch(e){}
@@ -1525,13 +3572,17 @@ const indexHTML = `<!doctype html>
     <div class="row stats">
       <div title="Sessions">🗂 {{ .Stats.TotalSessions }}</div>
       <div title="Messages">💬 {{ .Stats.TotalMessages }}</div>
+      {{ if .Stats.ByMCPServer }}<div title="MCP tool calls by server:{{ range $server, $n := .Stats.ByMCPServer }} {{ $server }}={{ $n }}{{ end }}">🔌 {{ len .Stats.ByMCPServer }}</div>{{ end }}
+      {{ if .Stats.ByLanguage }}<div title="Code blocks by language (search with lang:):{{ range $lang, $n := .Stats.ByLanguage }} {{ $lang }}={{ $n }}{{ end }}">⌨ {{ len .Stats.ByLanguage }}</div>{{ end }}
     </div>
+    <a class="meta ml-1" href="/hidden" title="管理已隐藏的目录">已隐藏</a>
     <div class="flex-1"></div>
     <div class="searchbar searchbar--max">
       <input id="searchInput" type="text" placeholder="Search across sessions… (quotes, -exclude, OR, fields, /re/flags)" onkeydown="if(event.key==='Enter'){runSearch()}" />
       <button class="btn" onclick="runSearch()">Search</button>
     </div>
   </header>
+  <div id="indexing-banner" class="banner hidden"></div>
   <div class="container">
     <div class="sidebar">
       <div id="search-results" class="hidden"></div>
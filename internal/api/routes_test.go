@@ -1,14 +1,23 @@
 package api
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
-	"codex-watcher/internal/indexer"
+	"codex-watcher/pkg/indexer"
+	"codex-watcher/pkg/search"
 )
 
 func TestIndexHTMLShowsResumeButtonForCodexSessions(t *testing.T) {
@@ -28,8 +37,12 @@ func TestIndexHTMLShowsResumeButtonForCodexSessions(t *testing.T) {
 }
 
 func TestIndexHTMLCollapsesToolBlocksByDefault(t *testing.T) {
-	if !strings.Contains(indexHTML, "let collapseTools = true;") {
-		t.Fatalf("indexHTML should render tool blocks collapsed by default")
+	mux := http.NewServeMux()
+	AttachRoutes(mux, indexer.New([]string{"/tmp/.codex"}, ""))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(rec.Body.String(), "let collapseTools =  true ;") { // html/template pads JS values
+		t.Fatalf("index page should render tool blocks collapsed by default")
 	}
 
 	if !strings.Contains(indexHTML, "Show more") {
@@ -121,7 +134,7 @@ func testToolMessage(id, typ, callID string) *indexer.Message {
 }
 
 func TestAPIHidesMemoryMessagesFromSessionsAndMessages(t *testing.T) {
-	idx := indexer.New("/tmp/.codex", "")
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
 	now := time.Date(2026, time.March, 18, 12, 0, 0, 0, time.UTC)
 
 	idx.IngestForTest("s-visible", map[string]any{
@@ -192,3 +205,1286 @@ func TestAPIHidesMemoryMessagesFromSessionsAndMessages(t *testing.T) {
 		t.Fatalf("session message_count=%d want 1", sessions[0].MessageCount)
 	}
 }
+
+func TestSessionSubroute(t *testing.T) {
+	id, action, ok := sessionSubroute("/api/sessions/claude%3Aproj%3Aabc/note")
+	if !ok || id != "claude:proj:abc" || action != "note" {
+		t.Fatalf("got id=%q action=%q ok=%v", id, action, ok)
+	}
+	if _, _, ok := sessionSubroute("/api/sessions/abc"); ok {
+		t.Fatalf("path without action should not match")
+	}
+}
+
+func TestQuicksearchWithAuth(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	now := time.Date(2026, time.March, 18, 12, 0, 0, 0, time.UTC)
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "Fix the login flow", "cwd": "/work/app", "ts": now.Format(time.RFC3339)})
+	idx.IngestForTest("s2", map[string]any{"id": "m2", "session_id": "s2", "role": "user", "content": "Write release notes", "cwd": "/work/docs", "ts": now.Format(time.RFC3339)})
+
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	h := WithAuth(mux, []string{"secret"})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/quicksearch?q=login", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("missing token status=%d want 401", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/api/quicksearch", nil))
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("preflight status=%d headers=%v", rec.Code, rec.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/quicksearch?q=login", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var out struct {
+		Items []quickItem `json:"items"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Items) != 1 || out.Items[0].ID != "s1" {
+		t.Fatalf("unexpected items: %+v", out.Items)
+	}
+	it := out.Items[0]
+	if it.URL != "http://example.com/?session=s1" || it.Resume != `cd "/work/app" && codex resume s1` {
+		t.Fatalf("unexpected item: %+v", it)
+	}
+}
+
+func TestWithAuthEnforcesRoles(t *testing.T) {
+	var got Credential
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFrom(r.Context())
+		w.WriteHeader(204)
+	})
+	h := WithAuth(next, []string{"viewer:v-tok", "alice:editor:e-tok", "a-tok"})
+
+	cases := []struct {
+		token, method, path string
+		want                int
+	}{
+		{"v-tok", http.MethodGet, "/api/sessions", 204},
+		{"v-tok", http.MethodPost, "/api/sessions/update-title", 403},
+		{"e-tok", http.MethodPost, "/api/sessions/update-title", 204},
+		{"e-tok", http.MethodPost, "/api/sessions/rename", 204},
+		{"e-tok", http.MethodPost, "/api/sessions/s1/note", 204},
+		{"e-tok", http.MethodPost, "/api/sessions/delete", 403},
+		{"e-tok", http.MethodPost, "/api/sessions/s1/split", 403},
+		{"a-tok", http.MethodPost, "/api/sessions/delete", 204},
+		{"nope", http.MethodGet, "/api/sessions", 401},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s %s %s: status=%d want %d", c.token, c.method, c.path, rec.Code, c.want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/sessions/s1/note", nil)
+	req.Header.Set("X-Api-Token", "e-tok")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got.Name != "alice" || got.Role != RoleEditor {
+		t.Fatalf("principal = %+v", got)
+	}
+}
+
+func TestAuditRecordsMutations(t *testing.T) {
+	defer func(p string) { AuditPath = p }(AuditPath)
+	AuditPath = filepath.Join(t.TempDir(), "audit.jsonl")
+
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	h := WithAuth(mux, []string{"bob:admin:tok"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/messages/redact?session_id=missing&message_id=m1", nil)
+	req.Header.Set("Authorization", "Bearer tok")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/audit", nil)
+	req.Header.Set("Authorization", "Bearer tok")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var entries []AuditEntry
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %+v", entries)
+	}
+	e := entries[0]
+	if e.Op != "redact" || e.Actor != "bob" || e.OK || e.Error == "" || e.MessageIDs[0] != "m1" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+}
+
+func TestWithOriginCheckBlocksCrossSiteWrites(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(204) })
+	h := WithOriginCheck(next, []string{"https://tools.example.com/"}, []string{"watcher.lan"})
+
+	cases := []struct {
+		method, host, origin, referer, fetchSite string
+		want                                     int
+	}{
+		{http.MethodPost, "", "", "", "", 204},
+		{http.MethodPost, "", "http://localhost:7077", "", "", 204},
+		{http.MethodPost, "", "https://evil.example", "", "", 403},
+		{http.MethodPost, "", "null", "", "", 403},
+		{http.MethodPost, "", "", "https://evil.example/page", "", 403},
+		{http.MethodPost, "", "", "http://localhost:7077/", "", 204},
+		{http.MethodPost, "", "", "", "cross-site", 403},
+		{http.MethodPost, "", "https://tools.example.com", "", "", 204},
+		{http.MethodGet, "", "https://evil.example", "", "", 204},
+		// DNS rebinding: the page's own name now points at the watcher
+		{http.MethodPost, "evil.example:7077", "http://evil.example:7077", "", "", 403},
+		{http.MethodGet, "evil.example:7077", "", "", "same-origin", 403},
+		{http.MethodGet, "evil.example:7077", "", "", "", 204},
+		{http.MethodPost, "watcher.lan:7077", "http://watcher.lan:7077", "", "", 204},
+		{http.MethodPost, "192.168.1.5:7077", "http://192.168.1.5:7077", "", "", 204},
+		{http.MethodPost, "[::1]:7077", "http://[::1]:7077", "", "", 204},
+		{http.MethodPost, "tools.example.com", "https://tools.example.com", "", "", 204},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "http://localhost:7077/api/sessions/delete?session_id=s1", nil)
+		if c.host != "" {
+			req.Host = c.host
+		}
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		if c.referer != "" {
+			req.Header.Set("Referer", c.referer)
+		}
+		if c.fetchSite != "" {
+			req.Header.Set("Sec-Fetch-Site", c.fetchSite)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s host=%q origin=%q referer=%q site=%q: status=%d want %d", c.method, c.host, c.origin, c.referer, c.fetchSite, rec.Code, c.want)
+		}
+	}
+
+	// the page itself lists sessions, so a rebound name cannot load it either
+	req := httptest.NewRequest(http.MethodGet, "http://evil.example:7077/", nil)
+	req.Header.Set("Sec-Fetch-Site", "none")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != 403 {
+		t.Fatalf("UI under an unknown host: status=%d", rec.Code)
+	}
+}
+
+func TestRequestParamsMergesJSONBody(t *testing.T) {
+	body := `{"session_id":"s 1","title":"Long title & more","drop":true,"n":3,"ids":["a","b"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/sessions/update-title?session_id=old&author=cli", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	q, err := requestParams(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Get("session_id") != "s 1" || q.Get("title") != "Long title & more" || q.Get("author") != "cli" {
+		t.Fatalf("unexpected params: %v", q)
+	}
+	if q.Get("drop") != "true" || q.Get("n") != "3" || len(q["ids"]) != 2 {
+		t.Fatalf("unexpected scalar conversion: %v", q)
+	}
+
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	for _, c := range []struct {
+		body string
+		want string
+	}{
+		{`{"session_id":"s1"}`, "missing title"},
+		{`{"session_id":`, "invalid JSON body"},
+		{`{"session_id":{"x":1}}`, "must be a string"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/sessions/update-title", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != 400 || !strings.Contains(rec.Body.String(), c.want) {
+			t.Errorf("body %s: status=%d resp=%s", c.body, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestAbortExportsMarksStreamIncomplete(t *testing.T) {
+	defer func(d *exportDrain) { exports = d }(exports)
+	exports = &exportDrain{abort: make(chan struct{})}
+
+	rec := httptest.NewRecorder()
+	ew := trackExport(rec)
+	if _, err := ew.Write([]byte("# partial export")); err != nil {
+		t.Fatal(err)
+	}
+	if InFlightExports() != 1 {
+		t.Fatalf("in-flight = %d", InFlightExports())
+	}
+	aborted := make(chan int)
+	go func() { aborted <- AbortExports(time.Second) }()
+	<-exports.abort
+	_, err := ew.Write([]byte("more"))
+	if err != errExportAborted {
+		t.Fatalf("write after abort: %v", err)
+	}
+	ew.finish(err, true)
+	if n := <-aborted; n != 1 {
+		t.Fatalf("aborted = %d", n)
+	}
+	res := rec.Result()
+	if got := res.Trailer.Get(exportStatusTrailer); got != "incomplete" {
+		t.Fatalf("trailer = %q", got)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "more") || !strings.Contains(body, "export incomplete") {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestSessionsListPinnedFirst(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sessions"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for id, ts := range map[string]string{"old": "2024-01-01T00:00:00Z", "new": "2024-02-01T00:00:00Z"} {
+		line := `{"type":"message","role":"user","content":"hi ` + id + `","timestamp":"` + ts + `"}` + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "sessions", id+".jsonl"), []byte(line), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx := indexer.New([]string{dir}, "")
+	if err := idx.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/sessions/pin", strings.NewReader(`{"session_id":"old"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("pin: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sessions", nil))
+	var list []indexer.Session
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != "old" || !list[0].Pinned || list[1].ID != "new" {
+		t.Fatalf("unexpected order: %+v", list)
+	}
+}
+
+func TestRenameSessionPersistsTitle(t *testing.T) {
+	dir := t.TempDir()
+	sessions := filepath.Join(dir, "sessions")
+	if err := os.MkdirAll(sessions, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	line := `{"type":"message","role":"user","content":"hi","timestamp":"2024-01-01T00:00:00Z"}` + "\n"
+	if err := os.WriteFile(filepath.Join(sessions, "s1.jsonl"), []byte(line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	idx := indexer.New([]string{dir}, "")
+	if err := idx.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/sessions/rename", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := post(`{"session_id":"s1","title":"  Fix the flaky build  "}`); rec.Code != 200 {
+		t.Fatalf("rename: %d %s", rec.Code, rec.Body.String())
+	}
+	if sess, _ := findSession(idx, "s1"); sess.Title != "Fix the flaky build" {
+		t.Fatalf("title = %q", sess.Title)
+	}
+	b, err := os.ReadFile(filepath.Join(sessions, "s1.meta.json"))
+	if err != nil || !strings.Contains(string(b), `"custom_title": "Fix the flaky build"`) {
+		t.Fatalf("meta.json = %s (%v)", b, err)
+	}
+
+	// the title survives a rebuild of the index
+	if err := idx.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	if sess, _ := findSession(idx, "s1"); sess.Title != "Fix the flaky build" {
+		t.Fatalf("title after reindex = %q", sess.Title)
+	}
+
+	if rec := post(`{"session_id":"nope","title":"x"}`); rec.Code != 404 {
+		t.Fatalf("unknown session: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := post(`{"session_id":"s1","title":"   "}`); rec.Code != 400 {
+		t.Fatalf("blank title: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHiddenDirLeftOutOfSessionList(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sessions"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for id, cwd := range map[string]string{"keep": "/work/app", "scratch": "/tmp/scratch"} {
+		line := `{"type":"message","role":"user","content":"hi","cwd":"` + cwd + `","timestamp":"2024-01-01T00:00:00Z"}` + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "sessions", id+".jsonl"), []byte(line), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx := indexer.New([]string{dir}, "")
+	if err := idx.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/dirs/hide", strings.NewReader(`{"cwd":"/tmp/scratch"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("hide: %d %s", rec.Code, rec.Body.String())
+	}
+
+	ids := func(url string) []string {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var list []indexer.Session
+		if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, s := range list {
+			out = append(out, s.ID)
+		}
+		return out
+	}
+	if got := ids("/api/sessions"); len(got) != 1 || got[0] != "keep" {
+		t.Fatalf("hidden directory still listed: %v", got)
+	}
+	if got := ids("/api/sessions?include_hidden=1"); len(got) != 2 {
+		t.Fatalf("include_hidden should list everything: %v", got)
+	}
+}
+
+func TestMessagesAtReturnsWindowNearTimestamp(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sessions"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for h := 9; h <= 17; h++ {
+		fmt.Fprintf(&b, `{"type":"message","id":"m%d","role":"user","content":"hour %d","timestamp":"2024-01-01T%02d:00:00Z"}`+"\n", h, h, h)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sessions", "s.jsonl"), []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	idx := indexer.New([]string{dir}, "")
+	if err := idx.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/messages?session_id=s&at=2024-01-01T15:10:00Z&limit=3", nil))
+	if rec.Code != 200 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var got struct {
+		AnchorID string             `json:"anchor_id"`
+		Offset   int                `json:"offset"`
+		Total    int                `json:"total"`
+		Messages []*indexer.Message `json:"messages"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.AnchorID != "m15" || got.Total != 9 || len(got.Messages) != 3 || got.Messages[0].ID != "m14" || got.Offset != 5 {
+		t.Fatalf("unexpected window: %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/messages?session_id=s&at=3pm", nil))
+	if rec.Code != 400 {
+		t.Fatalf("bad at should be rejected, got %d", rec.Code)
+	}
+}
+
+func TestExportByDirSinceLastEmitsOnlyNewMessages(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sessions"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "sessions", "s.jsonl")
+	line := func(text, ts string) string {
+		return `{"type":"message","role":"user","content":"` + text + `","cwd":"/work/app","timestamp":"` + ts + `"}` + "\n"
+	}
+	if err := os.WriteFile(path, []byte(line("first entry", "2024-01-01T09:00:00Z")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	idx := indexer.New([]string{dir}, "")
+	if err := idx.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	export := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/export/by_dir?cwd=/work/app&since_last=1", nil))
+		if rec.Code != 200 {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+
+	// advancing the watermark is a write, so a GET may not do it
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/export/by_dir?cwd=/work/app&since_last=1", nil))
+	if rec.Code != 405 || !idx.DirInfo("/work/app").ExportedThrough.IsZero() {
+		t.Fatalf("GET since_last: status %d, watermark %v", rec.Code, idx.DirInfo("/work/app").ExportedThrough)
+	}
+
+	if rec := export(); !strings.Contains(rec.Body.String(), "first entry") {
+		t.Fatalf("first export missing message:\n%s", rec.Body.String())
+	}
+	if got := idx.DirInfo("/work/app").ExportedThrough; !got.Equal(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("watermark = %v", got)
+	}
+	if rec := export(); strings.Contains(rec.Body.String(), "first entry") || rec.Header().Get("X-Export-Empty") != "1" {
+		t.Fatalf("repeat export should be empty:\n%s", rec.Body.String())
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(line("second entry", "2024-01-01T10:00:00Z"))
+	_ = f.Close()
+	if err := idx.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	body := export().Body.String()
+	if !strings.Contains(body, "second entry") || strings.Contains(body, "USER\n\nfirst entry") {
+		t.Fatalf("incremental export should hold only the new message:\n%s", body)
+	}
+}
+
+func TestExportFilenamesDifferByOptionsAndAcceptOverride(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "hi", "cwd": "/work/app"})
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	name := func(target string) string {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != 200 {
+			t.Fatalf("%s: status %d: %s", target, rec.Code, rec.Body.String())
+		}
+		return rec.Header().Get("Content-Disposition")
+	}
+	full := name("/api/export/by_dir?cwd=/work/app")
+	if again := name("/api/export/by_dir?cwd=/work/app"); again != full {
+		t.Fatalf("the same export should keep its name: %q vs %q", full, again)
+	}
+	if withMeta := name("/api/export/by_dir?cwd=/work/app&meta=1"); withMeta == full {
+		t.Fatalf("exports with different options share the name %q", full)
+	}
+	if md, txt := name("/api/export/session?session_id=s1&format=md"), name("/api/export/session?session_id=s1&format=md&turns=1"); md == txt {
+		t.Fatalf("session exports with different options share the name %q", md)
+	}
+	if got := name("/api/export/session?session_id=s1&format=txt&filename=../notes/my%20log"); got != `attachment; filename="my_log.txt"` {
+		t.Fatalf("filename override = %q", got)
+	}
+}
+
+func TestAnonymizedExportNamesHideTheUser(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "jdoe here", "cwd": "/home/jdoe"})
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	for _, target := range []string{
+		"/api/export/session?session_id=s1&anonymize=1",
+		"/api/export/session?session_id=s1&format=json&anonymize=1",
+		"/api/export/by_dir?cwd=/home/jdoe&anonymize=1",
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != 200 {
+			t.Fatalf("%s: status %d: %s", target, rec.Code, rec.Body.String())
+		}
+		if cd := rec.Header().Get("Content-Disposition"); cd == "" || strings.Contains(cd, "jdoe") {
+			t.Fatalf("%s: filename leaks the user: %q", target, cd)
+		}
+	}
+}
+
+func TestRevealOpensTheSessionFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sessions"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "sessions", "s1.jsonl")
+	if err := os.WriteFile(path, []byte(`{"id":"m1","session_id":"s1","role":"user","content":"hi"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	idx := indexer.New([]string{dir}, "")
+	if err := idx.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	if sessions := idx.Sessions(); len(sessions) != 1 || len(sessions[0].Paths) != 1 || sessions[0].Paths[0] != path {
+		t.Fatalf("sessions should carry absolute paths: %+v", sessions)
+	}
+	var revealed string
+	defer func(orig func(string) error) { revealPath = orig }(revealPath)
+	revealPath = func(p string) error { revealed = p; return nil }
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/sessions/s1/reveal", nil))
+	if rec.Code != 200 || revealed != path {
+		t.Fatalf("status %d, revealed %q: %s", rec.Code, revealed, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sessions/s1/reveal", nil))
+	if rec.Code != 405 {
+		t.Fatalf("GET should not reveal, got %d", rec.Code)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/sessions/s1/reveal", nil))
+	if rec.Code != 404 {
+		t.Fatalf("a missing file should be 404, got %d", rec.Code)
+	}
+}
+
+func TestMessageMarkdownQuoteCarriesProvenance(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "Ship the release", "ts": "2024-03-04T05:06:07Z"})
+	idx.IngestForTest("s1", map[string]any{"id": "m2", "session_id": "s1", "role": "assistant", "content": "Done.\n\nTagged v1.2.", "ts": "2024-03-04T05:07:07Z"})
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	if rec := get("/api/messages/m2/markdown"); rec.Code != 200 || rec.Body.String() != "Done.\n\nTagged v1.2." {
+		t.Fatalf("plain markdown: %d %q", rec.Code, rec.Body.String())
+	}
+	rec := get("/api/messages/m2/markdown?quote=1&session_id=s1")
+	want := "> Done.\n>\n> Tagged v1.2.\n\n— Assistant in *Ship the release*, 2024-03-04 · [open](http://example.com/?session=s1&message=m2)\n"
+	if rec.Code != 200 || rec.Body.String() != want {
+		t.Fatalf("quoted markdown: %d\n%s", rec.Code, rec.Body.String())
+	}
+	if rec := get("/api/messages/m2/markdown?session_id=other"); rec.Code != 404 {
+		t.Fatalf("a message outside the session should be 404, got %d", rec.Code)
+	}
+}
+
+func TestExportPreviewMatchesSessionExport(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	for i, role := range []string{"user", "assistant", "user", "assistant", "user"} {
+		idx.IngestForTest("s1", map[string]any{"id": "m" + strconv.Itoa(i), "session_id": "s1", "role": role, "content": "turn " + strconv.Itoa(i)})
+	}
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/export/preview?session_id=s1&include_roles=user&limit=2", nil))
+	if rec.Code != 200 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var got struct {
+		Total    int `json:"total"`
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Total != 3 || len(got.Messages) != 2 || got.Messages[0].Content != "turn 0" || got.Messages[1].Content != "turn 2" {
+		t.Fatalf("preview = %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/export/preview?session_id=nope", nil))
+	if rec.Code != 404 {
+		t.Fatalf("unknown session: status %d", rec.Code)
+	}
+}
+
+func TestStatsBreakDownByProvider(t *testing.T) {
+	dir := t.TempDir()
+	codexDir, claudeDir := filepath.Join(dir, "codex"), filepath.Join(dir, "claude")
+	if err := os.MkdirAll(filepath.Join(codexDir, "sessions"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(claudeDir, "-work-app"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	codex := `{"type":"message","role":"user","content":"hello codex","timestamp":"2024-01-01T09:00:00Z"}` + "\n" +
+		`{"type":"message","role":"assistant","content":"hi","timestamp":"2024-01-01T09:01:00Z"}` + "\n"
+	claude := `{"type":"user","sessionId":"abc","message":{"role":"user","content":"hello claude"},"timestamp":"2024-02-01T10:00:00Z"}` + "\n" +
+		"{not json\n"
+	if err := os.WriteFile(filepath.Join(codexDir, "sessions", "c.jsonl"), []byte(codex), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(claudeDir, "-work-app", "abc.jsonl"), []byte(claude), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	idx := indexer.New([]string{codexDir}, claudeDir)
+	if err := idx.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	get := func(url string) indexer.Stats {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var st indexer.Stats
+		if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+
+	st := get("/api/stats")
+	cx, cl := st.ByProvider["codex"], st.ByProvider["claude"]
+	if cx.Sessions != 1 || cx.Messages != 2 || cx.Tokens == 0 || cx.BadLines != 0 {
+		t.Fatalf("unexpected codex stats: %+v", cx)
+	}
+	if cl.Sessions != 1 || cl.Messages != 1 || cl.BadLines != 1 || !cl.FirstAt.Equal(time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected claude stats: %+v", cl)
+	}
+
+	st = get("/api/stats?source=codex")
+	if len(st.ByProvider) != 1 || st.TotalSessions != 1 || st.BadLines != 0 {
+		t.Fatalf("source=codex should scope the totals: %+v", st)
+	}
+}
+
+func TestProjectsAggregatesSessionsByCWD(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("a1", map[string]any{"id": "m1", "session_id": "a1", "role": "user", "content": "one", "cwd": "/work/app", "ts": "2024-01-01T09:00:00Z"})
+	idx.IngestForTest("a1", map[string]any{"id": "m2", "session_id": "a1", "role": "assistant", "content": "two", "cwd": "/work/app", "ts": "2024-01-01T09:05:00Z"})
+	idx.IngestForTest("a2", map[string]any{"id": "m3", "session_id": "a2", "role": "user", "content": "three", "cwd": "/work/app", "ts": "2024-01-03T09:00:00Z"})
+	idx.IngestForTest("d1", map[string]any{"id": "m4", "session_id": "d1", "role": "user", "content": "four", "cwd": "/work/docs", "ts": "2024-01-02T09:00:00Z"})
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/projects", nil))
+	var resp struct {
+		Projects []projectSummary `json:"projects"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Projects) != 2 || resp.Projects[0].CWD != "/work/app" {
+		t.Fatalf("want /work/app first of two projects: %+v", resp.Projects)
+	}
+	app := resp.Projects[0]
+	if app.Sessions != 2 || app.Messages != 3 || app.Providers["codex"] != 2 {
+		t.Fatalf("unexpected counts: %+v", app)
+	}
+	if !app.FirstAt.Equal(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)) || !app.LastAt.Equal(time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected activity window: %v .. %v", app.FirstAt, app.LastAt)
+	}
+}
+
+func TestDiskStatsTotalFileSizesPerCWD(t *testing.T) {
+	dir := t.TempDir()
+	sessions := filepath.Join(dir, "sessions")
+	if err := os.MkdirAll(sessions, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	line := func(cwd, text string) string {
+		return `{"type":"message","role":"user","content":"` + text + `","cwd":"` + cwd + `","timestamp":"2024-01-01T09:00:00Z"}` + "\n"
+	}
+	files := map[string]string{
+		"big.jsonl":   strings.Repeat(line("/work/app", "a long prompt"), 50),
+		"small.jsonl": line("/work/app", "hi"),
+		"docs.jsonl":  line("/work/docs", "hi"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(sessions, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx := indexer.New([]string{dir}, "")
+	if err := idx.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stats/disk", nil))
+	var du indexer.DiskUsage
+	if err := json.NewDecoder(rec.Body).Decode(&du); err != nil {
+		t.Fatal(err)
+	}
+	size := func(names ...string) (n int64) {
+		for _, name := range names {
+			n += int64(len(files[name]))
+		}
+		return n
+	}
+	if du.Bytes != size("big.jsonl", "small.jsonl", "docs.jsonl") || du.Files != 3 || du.Sessions != 3 || len(du.Projects) != 2 {
+		t.Fatalf("unexpected totals: %+v", du)
+	}
+	app := du.Projects[0]
+	if app.CWD != "/work/app" || app.Bytes != size("big.jsonl", "small.jsonl") || app.Files != 2 || len(app.Largest) != 2 || app.Largest[0].ID != "big" || app.Largest[0].Bytes != size("big.jsonl") {
+		t.Fatalf("unexpected /work/app usage: %+v", app)
+	}
+	for _, s := range idx.Sessions() {
+		if s.DiskBytes != size(s.ID+".jsonl") {
+			t.Fatalf("%s: disk_bytes %d", s.ID, s.DiskBytes)
+		}
+	}
+}
+
+func TestAttachmentsAreCachedAndServed(t *testing.T) {
+	dir := t.TempDir()
+	sessions := filepath.Join(dir, "sessions")
+	if err := os.MkdirAll(sessions, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	png := []byte("\x89PNG\r\n\x1a\nnot really a png")
+	shot := filepath.Join(dir, "shot.png")
+	if err := os.WriteFile(shot, []byte("\x89PNG\r\n\x1a\nscreenshot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.StdEncoding.EncodeToString(png)
+	line := `{"type":"message","role":"user","timestamp":"2024-01-01T09:00:00Z","content":[` +
+		`{"type":"input_text","text":"look"},` +
+		`{"type":"input_image","image_url":"data:image/png;base64,` + b64 + `"},` +
+		`{"type":"image","source":{"type":"base64","media_type":"image/png","data":"` + b64 + `"}},` +
+		`{"type":"local_image","path":"` + shot + `"},` +
+		`{"type":"input_image","image_url":"https://example.com/a.png"}]}` + "\n"
+	if err := os.WriteFile(filepath.Join(sessions, "s1.jsonl"), []byte(line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	o := indexer.DefaultOptions()
+	o.AttachmentDir = filepath.Join(t.TempDir(), "attachments")
+	idx := indexer.New([]string{dir}, "", o)
+	if err := idx.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	msgs := idx.Messages("s1", 0)
+	if len(msgs) != 1 {
+		t.Fatalf("want 1 message, got %d", len(msgs))
+	}
+	atts := msgs[0].Attachments
+	// the two inline copies of png are one attachment
+	if len(atts) != 3 {
+		t.Fatalf("want 3 attachments, got %+v", atts)
+	}
+	if a := atts[0]; a.Kind != "image" || a.MediaType != "image/png" || a.Size != int64(len(png)) || !a.Cached {
+		t.Fatalf("unexpected inline attachment: %+v", a)
+	}
+	if a := atts[1]; a.Path != shot || !a.Cached || a.Name != "shot.png" {
+		t.Fatalf("unexpected local attachment: %+v", a)
+	}
+	if a := atts[2]; a.URL != "https://example.com/a.png" || a.Cached {
+		t.Fatalf("unexpected linked attachment: %+v", a)
+	}
+
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	get := func(id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/attachments/"+id, nil))
+		return rec
+	}
+	rec := get(atts[0].ID)
+	if rec.Code != 200 || rec.Body.String() != string(png) || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("unexpected blob response: %d %q %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	for _, id := range []string{atts[2].ID, "deadbeef", "nope"} {
+		if rec := get(id); rec.Code != 404 {
+			t.Fatalf("%s: want 404, got %d", id, rec.Code)
+		}
+	}
+}
+
+func TestStatsNotModifiedUntilRevisionMoves(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "one", "ts": "2024-01-01T09:00:00Z"})
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	get := func(rev string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+		if rev != "" {
+			req.Header.Set("If-Revision-Newer", rev)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("")
+	var st indexer.Stats
+	if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	rev := rec.Header().Get("X-Revision")
+	if st.Revision == 0 || rev != strconv.FormatUint(st.Revision, 10) || st.TotalMessages != 1 {
+		t.Fatalf("unexpected stats %+v (X-Revision %q)", st, rev)
+	}
+	if rec := get(rev); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("unchanged index: want 304, got %d", rec.Code)
+	}
+
+	idx.IngestForTest("s1", map[string]any{"id": "m2", "session_id": "s1", "role": "assistant", "content": "two", "ts": "2024-01-01T09:01:00Z"})
+	rec = get(rev)
+	if rec.Code != 200 {
+		t.Fatalf("after ingest: want 200, got %d", rec.Code)
+	}
+	st = indexer.Stats{}
+	if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st.TotalMessages != 2 {
+		t.Fatalf("cached stats served after a change: %+v", st)
+	}
+}
+
+func TestStatsCacheIsBoundedAndOwnsItsMaps(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "one", "ts": "2024-01-01T09:00:00Z"})
+	c := newStatsCache()
+	for i := 0; i < 3*maxStatsScopes; i++ {
+		c.get(idx, "", fmt.Sprintf("/work/p%d", i))
+	}
+	if n := len(c.entries); n > maxStatsScopes {
+		t.Fatalf("%d scopes cached, limit %d", n, maxStatsScopes)
+	}
+
+	// a cached result must not change as the index does
+	st := c.get(idx, "", "")
+	idx.IngestForTest("s1", map[string]any{"id": "m2", "session_id": "s1", "role": "user", "content": "two", "novel_key": true})
+	if st.Fields["novel_key"] != 0 {
+		t.Fatalf("cached stats share the live field counts: %v", st.Fields)
+	}
+}
+
+func TestAdminReloadRotatesTokens(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	tokens := NewTokens([]string{"old-tok"})
+	h := WithTokens(mux, tokens)
+	ReloadConfig = func() ([]string, error) {
+		tokens.Set([]string{"new-tok"})
+		return []string{"api_token"}, nil
+	}
+	defer func() { ReloadConfig = nil }()
+	do := func(method, url, tok string) int {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do(http.MethodPost, "/api/admin/reload", "old-tok"); code != 200 {
+		t.Fatalf("reload: %d", code)
+	}
+	if code := do(http.MethodGet, "/api/stats", "old-tok"); code != 401 {
+		t.Fatalf("old token still accepted: %d", code)
+	}
+	if code := do(http.MethodGet, "/api/stats", "new-tok"); code != 200 {
+		t.Fatalf("new token rejected: %d", code)
+	}
+	tokens.Set(nil)
+	if code := do(http.MethodGet, "/api/stats", ""); code != 200 {
+		t.Fatalf("empty token set should disable auth: %d", code)
+	}
+}
+
+func TestAdminSettingsPatchAppliesAndPersists(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	h := WithAuth(mux, []string{"viewer:v-tok", "a-tok"})
+	var saved map[string]string
+	SaveSettings = func(values map[string]string) error { saved = values; return nil }
+	prevDefaults, prevSearch := CurrentDefaults(), search.CurrentOptions()
+	defer func() {
+		SaveSettings = nil
+		_ = SetDefaults(prevDefaults)
+		search.SetOptions(prevSearch)
+	}()
+	do := func(method, tok, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/admin/settings", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+tok)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "v-tok", ""); rec.Code != 403 {
+		t.Fatalf("viewer read settings: %d", rec.Code)
+	}
+	if rec := do(http.MethodPatch, "a-tok", `{"search_max":"x"}`); rec.Code != 400 || saved != nil {
+		t.Fatalf("invalid value: %d, saved %v", rec.Code, saved)
+	}
+	rec := do(http.MethodPatch, "a-tok", `{"search_max":42,"export_exclude_shell":false}`)
+	if rec.Code != 200 {
+		t.Fatalf("patch: %d %s", rec.Code, rec.Body.String())
+	}
+	if search.CurrentOptions().MaxReturn != 42 || CurrentDefaults().ExportExcludeShell {
+		t.Fatalf("settings not applied: max=%d defaults=%+v", search.CurrentOptions().MaxReturn, CurrentDefaults())
+	}
+	if saved["search_max"] != "42" || saved["export_exclude_shell"] != "false" || len(saved) != 2 {
+		t.Fatalf("unexpected persisted values: %v", saved)
+	}
+	if f := sessionExportFilters(url.Values{}); f.ExcludeShellCalls || !f.ExcludeToolOutputs {
+		t.Fatalf("export filters ignore the defaults: %+v", f)
+	}
+}
+
+func TestApplySettingsWhileSearching(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	for i := 0; i < 20; i++ {
+		id := strconv.Itoa(i)
+		idx.IngestForTest("s"+id, map[string]any{"id": "u" + id, "session_id": "s" + id, "role": "user", "content": "build the needle " + id})
+		idx.IngestForTest("s"+id, map[string]any{"id": "o" + id, "session_id": "s" + id, "type": "function_call_output", "output": "needle in the output"})
+	}
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	prevDefaults, prevSearch := CurrentDefaults(), search.CurrentOptions()
+	defer func() {
+		_ = SetDefaults(prevDefaults)
+		search.SetOptions(prevSearch)
+	}()
+
+	// run with -race: settings change under searches, explains, and exports
+	stop := make(chan struct{})
+	applied := make(chan error)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				applied <- nil
+				return
+			default:
+			}
+			on := strconv.FormatBool(i%2 == 0)
+			if _, err := ApplySettings(idx, map[string][]string{
+				"search_budget_ms": {strconv.Itoa(100 + i%50)}, "search_max": {strconv.Itoa(10 + i%50)},
+				"search_tool_outputs": {on}, "search_output_max_bytes": {strconv.Itoa(i % 50)},
+				"export_exclude_tool_outputs": {on},
+			}); err != nil {
+				applied <- err
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for _, u := range []string{"/api/search?q=needle&scope=all", "/api/search?q=needle&explain=1", "/api/export/session?session_id=s1"} {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			for i := 0; i < 30; i++ {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, u, nil))
+				if rec.Code != 200 {
+					t.Errorf("%s: %d %s", u, rec.Code, rec.Body.String())
+					return
+				}
+			}
+		}(u)
+	}
+	wg.Wait()
+	close(stop)
+	if err := <-applied; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ApplySettings(idx, map[string][]string{"search_max": {"7"}, "search_tool_outputs": {"false"}}); err != nil {
+		t.Fatal(err)
+	}
+	if so := search.CurrentOptions(); so.MaxReturn != 7 || so.ToolOutputs {
+		t.Fatalf("settings not applied: %+v", so)
+	}
+}
+
+func TestApplySettingsWaitsForTheUpdateInProgress(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	prevDefaults, prevSearch := CurrentDefaults(), search.CurrentOptions()
+	defer func() {
+		_ = SetDefaults(prevDefaults)
+		search.SetOptions(prevSearch)
+	}()
+	if _, err := ApplySettings(idx, map[string][]string{"search_max": {"10"}, "collapse_tools": {"true"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// each update waits for the one in progress, then starts from its result
+	settingsMu.Lock()
+	var wg sync.WaitGroup
+	for _, p := range []map[string][]string{{"search_max": {"5"}}, {"collapse_tools": {"false"}}} {
+		wg.Add(1)
+		go func(p map[string][]string) {
+			defer wg.Done()
+			if _, err := ApplySettings(idx, p); err != nil {
+				t.Error(err)
+			}
+		}(p)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if search.CurrentOptions().MaxReturn != 10 || !CurrentDefaults().CollapseTools {
+		settingsMu.Unlock()
+		t.Fatal("settings changed while another update was in progress")
+	}
+	settingsMu.Unlock()
+	wg.Wait()
+	if search.CurrentOptions().MaxReturn != 5 || CurrentDefaults().CollapseTools {
+		t.Fatalf("an update was lost: max %d, collapse %v", search.CurrentOptions().MaxReturn, CurrentDefaults().CollapseTools)
+	}
+}
+
+func TestSessionsOutcomeFilterFindsLikelyFailedRuns(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("bad", map[string]any{"id": "b1", "session_id": "bad", "role": "user", "content": "migrate the schema"})
+	idx.IngestForTest("bad", map[string]any{"id": "b2", "session_id": "bad", "type": "function_call_output", "output": `{"output":"boom","metadata":{"exit_code":1}}`})
+	idx.IngestForTest("bad", map[string]any{"id": "b3", "session_id": "bad", "type": "function_call_output", "output": "Exit code: 2\nOutput:\nno such table"})
+	idx.IngestForTest("bad", map[string]any{"id": "b4", "session_id": "bad", "role": "assistant", "content": "Sorry, I couldn't get the migration to run."})
+	idx.IngestForTest("stop", map[string]any{"id": "s1", "session_id": "stop", "role": "user", "content": "refactor everything"})
+	idx.IngestForTest("stop", map[string]any{"id": "s2", "session_id": "stop", "role": "user", "content": "[Request interrupted by user]"})
+	idx.IngestForTest("good", map[string]any{"id": "g1", "session_id": "good", "role": "user", "content": "add a test"})
+	idx.IngestForTest("good", map[string]any{"id": "g2", "session_id": "good", "type": "function_call_output", "output": "Exit code: 0\nOutput:\nok"})
+	idx.IngestForTest("good", map[string]any{"id": "g3", "session_id": "good", "role": "assistant", "content": "Added and passing."})
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+
+	get := func(url string) map[string][]string {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var sessions []indexer.Session
+		if err := json.Unmarshal(rec.Body.Bytes(), &sessions); err != nil {
+			t.Fatalf("%s: %d %s", url, rec.Code, rec.Body.String())
+		}
+		out := make(map[string][]string)
+		for _, s := range sessions {
+			out[s.ID] = s.FailureReasons
+		}
+		return out
+	}
+	failed := get("/api/sessions?outcome=failed")
+	if len(failed) != 2 || strings.Join(failed["bad"], ",") != "apology,tool_errors" || strings.Join(failed["stop"], ",") != "interrupted" {
+		t.Fatalf("failed sessions = %v", failed)
+	}
+	if ok := get("/api/sessions?outcome=ok"); len(ok) != 1 || ok["good"] != nil {
+		t.Fatalf("ok sessions = %v", ok)
+	}
+	for _, s := range idx.Sessions() {
+		if tagged := strings.Contains(strings.Join(s.Tags, ","), indexer.FailedTag); tagged != (s.ID != "good") {
+			t.Fatalf("session %s tags = %v", s.ID, s.Tags)
+		}
+	}
+}
+
+func TestSessionsThreadsGroupContinuedSessions(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("s1", map[string]any{"type": "session_meta", "timestamp": "2026-06-02T10:00:00Z", "cwd": "/work/app", "payload": map[string]any{"id": "s1"}})
+	idx.IngestForTest("s1", map[string]any{"id": "a1", "session_id": "s1", "role": "user", "content": "port the parser", "ts": "2026-06-02T10:00:01Z"})
+	idx.IngestForTest("s1", map[string]any{"id": "a2", "session_id": "s1", "role": "assistant", "content": "working on it", "ts": "2026-06-02T10:40:00Z"})
+	idx.IngestForTest("s2", map[string]any{"type": "session_meta", "timestamp": "2026-06-02T11:00:00Z", "cwd": "/work/app", "payload": map[string]any{"id": "s2", "forked_from_id": "s1"}})
+	idx.IngestForTest("s2", map[string]any{"id": "b1", "session_id": "s2", "role": "user", "content": "continue", "ts": "2026-06-02T11:00:01Z"})
+	idx.IngestForTest("s2", map[string]any{"id": "b2", "session_id": "s2", "role": "assistant", "content": "done with lexing", "ts": "2026-06-02T11:30:00Z"})
+	// no parent named: the latest earlier session in the same directory
+	idx.IngestForTest("s3", map[string]any{"id": "c1", "session_id": "s3", "cwd": "/work/app", "role": "user", "ts": "2026-06-02T12:00:00Z",
+		"content": "This session is being continued from a previous conversation that ran out of context."})
+	idx.IngestForTest("s3", map[string]any{"id": "c2", "session_id": "s3", "role": "assistant", "content": "finished", "ts": "2026-06-02T12:10:00Z"})
+	idx.IngestForTest("other", map[string]any{"id": "o1", "session_id": "other", "cwd": "/work/app", "role": "user", "content": "unrelated", "ts": "2026-06-02T09:00:00Z"})
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+
+	get := func(url string) []indexer.Session {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var sessions []indexer.Session
+		if err := json.Unmarshal(rec.Body.Bytes(), &sessions); err != nil {
+			t.Fatalf("%s: %d %s", url, rec.Code, rec.Body.String())
+		}
+		return sessions
+	}
+	byID := make(map[string]indexer.Session)
+	for _, s := range get("/api/sessions") {
+		byID[s.ID] = s
+	}
+	if byID["s2"].ParentID != "s1" || byID["s3"].ParentID != "s2" || byID["other"].ParentID != "" {
+		t.Fatalf("parents: s2=%q s3=%q other=%q", byID["s2"].ParentID, byID["s3"].ParentID, byID["other"].ParentID)
+	}
+	if strings.Join(byID["s1"].ChildIDs, ",") != "s2" || byID["s3"].ThreadID != "s1" || byID["other"].ThreadID != "" {
+		t.Fatalf("s1 children %v, s3 thread %q, other thread %q", byID["s1"].ChildIDs, byID["s3"].ThreadID, byID["other"].ThreadID)
+	}
+	var ids []string
+	for _, s := range get("/api/sessions?threads=1") {
+		ids = append(ids, s.ID)
+	}
+	if strings.Join(ids, ",") != "s3,other" {
+		t.Fatalf("collapsed threads = %v", ids)
+	}
+	ids = nil
+	for _, s := range get("/api/sessions?thread=s1") {
+		ids = append(ids, s.ID)
+	}
+	if strings.Join(ids, ",") != "s1,s2,s3" {
+		t.Fatalf("thread members = %v", ids)
+	}
+}
+
+func TestSessionsTreeNestsClaudeSubagents(t *testing.T) {
+	dir := t.TempDir()
+	claudeDir := filepath.Join(dir, "claude")
+	sub := filepath.Join(claudeDir, "-work-app", "main", "subagents")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	main := `{"type":"user","uuid":"m1","sessionId":"main","message":{"role":"user","content":"review the parser"},"timestamp":"2026-06-02T10:00:00Z"}` + "\n" +
+		`{"type":"assistant","uuid":"m2","sessionId":"main","message":{"role":"assistant","content":"delegating"},"timestamp":"2026-06-02T10:01:00Z"}` + "\n"
+	agent := func(id, text, ts string) string {
+		return `{"type":"user","uuid":"` + id + `-1","sessionId":"main","isSidechain":true,"agentId":"` + id + `","message":{"role":"user","content":"` + text + `"},"timestamp":"` + ts + `"}` + "\n"
+	}
+	files := map[string]string{
+		filepath.Join(claudeDir, "-work-app", "main.jsonl"): main,
+		filepath.Join(sub, "agent-b2.jsonl"):                agent("b2", "check tests", "2026-06-02T10:03:00Z"),
+		filepath.Join(sub, "agent-a1.jsonl"):                agent("a1", "find callers", "2026-06-02T10:02:00Z"),
+	}
+	for path, body := range files {
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx := indexer.New([]string{filepath.Join(dir, "codex")}, claudeDir)
+	if err := idx.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	mainID := "claude:-work-app:main"
+	s, ok := findSession(idx, "claude:-work-app:agent-a1")
+	if !ok || s.ParentSessionID != mainID || s.AgentID != "a1" {
+		t.Fatalf("subagent session: %+v", s)
+	}
+	if m, _ := findSession(idx, mainID); m.MessageCount != 2 {
+		t.Fatalf("main session should keep only its own messages, has %d", m.MessageCount)
+	}
+
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sessions/tree", nil))
+	var got struct {
+		Sessions []struct {
+			ID        string `json:"id"`
+			Subagents []struct {
+				ID string `json:"id"`
+			} `json:"subagents"`
+		} `json:"sessions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%d %s", rec.Code, rec.Body.String())
+	}
+	if len(got.Sessions) != 1 || got.Sessions[0].ID != mainID || len(got.Sessions[0].Subagents) != 2 {
+		t.Fatalf("tree = %s", rec.Body.String())
+	}
+	if a, b := got.Sessions[0].Subagents[0].ID, got.Sessions[0].Subagents[1].ID; a != "claude:-work-app:agent-a1" || b != "claude:-work-app:agent-b2" {
+		t.Fatalf("subagents out of order: %s, %s", a, b)
+	}
+}
+
+func TestSessionsFilterByToolUsed(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("s1", map[string]any{"type": "response_item", "payload": map[string]any{"type": "function_call", "name": "shell", "arguments": `{"command":["ls"]}`}})
+	idx.IngestForTest("s1", map[string]any{"type": "response_item", "payload": map[string]any{"type": "function_call", "name": "shell", "arguments": `{"command":["pwd"]}`}})
+	idx.IngestForTest("s1", map[string]any{"type": "response_item", "payload": map[string]any{"type": "web_search_call", "action": map[string]any{"query": "go 1.21 min"}}})
+	idx.IngestForTest("s2", map[string]any{"role": "assistant", "message": map[string]any{"role": "assistant", "content": []any{
+		map[string]any{"type": "tool_use", "name": "WebSearch", "input": map[string]any{"query": "hcl"}},
+	}}})
+	idx.IngestForTest("s3", map[string]any{"type": "response_item", "payload": map[string]any{"type": "custom_tool_call", "name": "apply_patch", "input": "*** Begin Patch"}})
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sessions?tool=web_search", nil))
+	var sessions []indexer.Session
+	if err := json.Unmarshal(rec.Body.Bytes(), &sessions); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, s := range sessions {
+		ids = append(ids, s.ID)
+	}
+	sort.Strings(ids)
+	if strings.Join(ids, ",") != "s1,s2" {
+		t.Fatalf("tool=web_search kept %v", ids)
+	}
+	for _, s := range sessions {
+		if s.ID == "s1" && (s.ToolCounts["shell"] != 2 || s.ToolCounts["web_search"] != 1) {
+			t.Fatalf("s1 tool counts = %v", s.ToolCounts)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+	var st indexer.Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.ByTool["shell"] != 2 || st.ByTool["web_search"] != 1 || st.ByTool["WebSearch"] != 1 || st.ByTool["apply_patch"] != 1 {
+		t.Fatalf("by_tool = %v", st.ByTool)
+	}
+}
+
+func TestListingAndSearchLeaveColdSessionsCompressed(t *testing.T) {
+	o := indexer.DefaultOptions()
+	o.ColdAfter = time.Minute
+	idx := indexer.New([]string{"/tmp/.codex"}, "", o)
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "needle in the archive"})
+	idx.CompressColdForTest(time.Now().Add(2 * time.Minute))
+	if c := idx.Stats().Cold; c == nil || c.Sessions != 1 {
+		t.Fatalf("s1 should start cold: %+v", c)
+	}
+	mux := http.NewServeMux()
+	AttachRoutes(mux, idx)
+	for _, path := range []string{"/api/sessions", "/api/search?q=needle", "/api/search?q=needle&explain=1"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "s1") {
+			t.Fatalf("%s: %d %s", path, rec.Code, rec.Body.String())
+		}
+		if c := idx.Stats().Cold; c == nil || c.Sessions != 1 {
+			t.Fatalf("%s thawed the cold session: %+v", path, c)
+		}
+	}
+}
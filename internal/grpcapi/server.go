@@ -0,0 +1,229 @@
+// Package grpcapi serves a read-only gRPC mirror of the REST API for typed
+// clients (editor plugins, internal tools). The schema lives in
+// watcherpb/watcher.proto.
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"codex-watcher/internal/api"
+	"codex-watcher/internal/grpcapi/watcherpb"
+	"codex-watcher/pkg/exporter"
+	"codex-watcher/pkg/indexer"
+	"codex-watcher/pkg/search"
+)
+
+// exportChunkSize bounds the payload of each ExportChunk.
+const exportChunkSize = 32 * 1024
+
+type server struct {
+	watcherpb.UnimplementedWatcherServer
+	idx *indexer.Indexer
+}
+
+// NewServer returns a gRPC server with the Watcher service registered. While
+// tokens holds any credentials, every call must send "authorization: Bearer
+// <token>" metadata. The set is shared with the REST API, so a config reload
+// that rotates or revokes tokens applies to both.
+func NewServer(idx *indexer.Indexer, tokens *api.Tokens) *grpc.Server {
+	var opts []grpc.ServerOption
+	if tokens != nil {
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, h grpc.UnaryHandler) (any, error) {
+				if err := authorize(ctx, tokens); err != nil {
+					return nil, err
+				}
+				return h(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, h grpc.StreamHandler) error {
+				if err := authorize(ss.Context(), tokens); err != nil {
+					return err
+				}
+				return h(srv, ss)
+			}),
+		)
+	}
+	s := grpc.NewServer(opts...)
+	watcherpb.RegisterWatcherServer(s, &server{idx: idx})
+	return s
+}
+
+func authorize(ctx context.Context, tokens *api.Tokens) error {
+	if _, ok := tokens.Authenticate(""); ok {
+		return nil // no tokens configured
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, h := range md.Get("authorization") {
+		if len(h) <= 7 || !strings.EqualFold(h[:7], "Bearer ") {
+			continue
+		}
+		if _, ok := tokens.Authenticate(strings.TrimSpace(h[7:])); ok {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+}
+
+func (s *server) ListSessions(_ context.Context, req *watcherpb.ListSessionsRequest) (*watcherpb.ListSessionsResponse, error) {
+	source := strings.ToLower(strings.TrimSpace(req.GetSource()))
+	out := &watcherpb.ListSessionsResponse{}
+	var views []indexer.Session
+	for _, sess := range s.idx.Sessions() {
+		if source != "" && strings.ToLower(sess.Provider) != source {
+			continue
+		}
+		if req.GetProject() != "" && sess.Project != req.GetProject() {
+			continue
+		}
+		if hide := search.CurrentOptions().SessionFilter; hide != nil && hide(sess) {
+			continue
+		}
+		if view, ok := s.idx.SessionView(sess, indexer.VisibleMessages(s.idx.PeekMessages(sess.ID), 0)); ok {
+			views = append(views, view)
+		}
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].LastAt.After(views[j].LastAt) })
+	for _, v := range views {
+		models := make(map[string]int32, len(v.Models))
+		for k, n := range v.Models {
+			models[k] = int32(n)
+		}
+		out.Sessions = append(out.Sessions, &watcherpb.Session{
+			Id:           v.ID,
+			Title:        v.Title,
+			Provider:     v.Provider,
+			Project:      v.Project,
+			Cwd:          v.CWD,
+			FirstAt:      timestamp(v.FirstAt),
+			LastAt:       timestamp(v.LastAt),
+			MessageCount: int32(v.MessageCount),
+			TextCount:    int32(v.TextCount),
+			Models:       models,
+			Tags:         v.Tags,
+		})
+	}
+	return out, nil
+}
+
+func (s *server) GetMessages(req *watcherpb.GetMessagesRequest, stream watcherpb.Watcher_GetMessagesServer) error {
+	if req.GetSessionId() == "" {
+		return status.Error(codes.InvalidArgument, "missing session_id")
+	}
+	for _, m := range indexer.VisibleMessages(s.idx.Messages(req.GetSessionId(), 0), int(req.GetLimit())) {
+		err := stream.Send(&watcherpb.Message{
+			Id:        m.ID,
+			SessionId: m.SessionID,
+			Ts:        timestamp(m.Ts),
+			Role:      m.Role,
+			Type:      m.Type,
+			Model:     m.Model,
+			Content:   m.Content,
+			Thinking:  m.Thinking,
+			ToolName:  m.ToolName,
+			Source:    m.Source,
+			Provider:  m.Provider,
+			LineNo:    int32(m.LineNo),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *server) Search(_ context.Context, req *watcherpb.SearchRequest) (*watcherpb.SearchResponse, error) {
+	res := search.Exec(s.idx, search.Parse(req.GetQuery(), "all"), int(req.GetLimit()), int(req.GetOffset()))
+	out := &watcherpb.SearchResponse{TookMs: int32(res.TookMS), Truncated: res.Truncated, Total: int32(res.Total)}
+	for _, h := range res.Hits {
+		out.Hits = append(out.Hits, &watcherpb.SearchHit{
+			SessionId:    h.SessionID,
+			MessageId:    h.MessageID,
+			SessionTitle: h.SessionTitle,
+			Role:         h.Role,
+			Type:         h.Type,
+			Model:        h.Model,
+			Source:       h.Source,
+			LineNo:       int32(h.LineNo),
+			Ts:           timestamp(h.Ts),
+			Field:        h.Field,
+			Content:      h.Content,
+		})
+	}
+	return out, nil
+}
+
+func (s *server) Export(req *watcherpb.ExportRequest, stream watcherpb.Watcher_ExportServer) error {
+	found := false
+	for _, sess := range s.idx.Sessions() {
+		if sess.ID == req.GetSessionId() {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return status.Errorf(codes.NotFound, "session not found: %s", req.GetSessionId())
+	}
+	format := strings.ToLower(req.GetFormat())
+	if format == "" {
+		format = "md"
+	}
+	f := exporter.Filters{
+		ExcludeShellCalls:  !req.GetIncludeShell(),
+		ExcludeToolOutputs: !req.GetIncludeToolOutputs(),
+		Anonymize:          req.GetAnonymize(),
+		MaxTokens:          int(req.GetMaxTokens()),
+	}
+	w := &chunkWriter{stream: stream}
+	if _, err := exporter.WriteSession(w, s.idx, req.GetSessionId(), format, f); err != nil {
+		if strings.HasPrefix(err.Error(), "unsupported format") {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		return err
+	}
+	return w.flush()
+}
+
+// chunkWriter buffers export output into ExportChunk messages.
+type chunkWriter struct {
+	stream watcherpb.Watcher_ExportServer
+	buf    []byte
+}
+
+var _ io.Writer = (*chunkWriter)(nil)
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	c.buf = append(c.buf, p...)
+	for len(c.buf) >= exportChunkSize {
+		if err := c.stream.Send(&watcherpb.ExportChunk{Data: c.buf[:exportChunkSize]}); err != nil {
+			return 0, err
+		}
+		c.buf = append([]byte(nil), c.buf[exportChunkSize:]...)
+	}
+	return len(p), nil
+}
+
+func (c *chunkWriter) flush() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	err := c.stream.Send(&watcherpb.ExportChunk{Data: c.buf})
+	c.buf = nil
+	return err
+}
+
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
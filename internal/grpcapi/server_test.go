@@ -0,0 +1,142 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"codex-watcher/internal/api"
+	"codex-watcher/internal/grpcapi/watcherpb"
+	"codex-watcher/pkg/indexer"
+)
+
+func dialTestServer(t *testing.T, idx *indexer.Indexer, tokens *api.Tokens) watcherpb.WatcherClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := NewServer(idx, tokens)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return watcherpb.NewWatcherClient(conn)
+}
+
+func TestWatcherService(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	now := time.Date(2026, time.March, 18, 12, 0, 0, 0, time.UTC)
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "Fix the login flow", "cwd": "/work/app", "ts": now.Format(time.RFC3339)})
+	idx.IngestForTest("s1", map[string]any{"id": "m2", "session_id": "s1", "role": "assistant", "content": "Patched the handler", "ts": now.Add(time.Minute).Format(time.RFC3339)})
+
+	client := dialTestServer(t, idx, api.NewTokens([]string{"secret"}))
+	ctx := context.Background()
+	if _, err := client.ListSessions(ctx, &watcherpb.ListSessionsRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated, got %v", err)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+
+	list, err := client.ListSessions(ctx, &watcherpb.ListSessionsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Sessions) != 1 || list.Sessions[0].Id != "s1" || list.Sessions[0].MessageCount != 2 {
+		t.Fatalf("unexpected sessions: %v", list.Sessions)
+	}
+
+	ms, err := client.GetMessages(ctx, &watcherpb.GetMessagesRequest{SessionId: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for {
+		m, err := ms.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, m.Id)
+	}
+	if strings.Join(ids, ",") != "m1,m2" {
+		t.Fatalf("messages = %v", ids)
+	}
+
+	res, err := client.Search(ctx, &watcherpb.SearchRequest{Query: "handler"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 1 || res.Hits[0].MessageId != "m2" {
+		t.Fatalf("unexpected hits: %v", res.Hits)
+	}
+
+	ex, err := client.Export(ctx, &watcherpb.ExportRequest{SessionId: "s1", Format: "md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []byte
+	for {
+		c, err := ex.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, c.Data...)
+	}
+	if !strings.Contains(string(out), "Patched the handler") {
+		t.Fatalf("unexpected export:\n%s", out)
+	}
+}
+
+func TestTokenReloadAppliesToGRPC(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	tokens := api.NewTokens(nil)
+	client := dialTestServer(t, idx, tokens)
+	ctx := context.Background()
+	if _, err := client.ListSessions(ctx, &watcherpb.ListSessionsRequest{}); err != nil {
+		t.Fatalf("open server: %v", err)
+	}
+
+	// tokens added by a reload are required from then on
+	tokens.Set([]string{"old"})
+	if _, err := client.ListSessions(ctx, &watcherpb.ListSessionsRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("after adding a token: %v", err)
+	}
+	old := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer old")
+	if _, err := client.ListSessions(old, &watcherpb.ListSessionsRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a revoked token stops working for unary and streaming calls alike
+	tokens.Set([]string{"viewer:new"})
+	if _, err := client.ListSessions(old, &watcherpb.ListSessionsRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("revoked token on ListSessions: %v", err)
+	}
+	ms, err := client.GetMessages(old, &watcherpb.GetMessagesRequest{SessionId: "s1"})
+	if err == nil {
+		_, err = ms.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("revoked token on GetMessages: %v", err)
+	}
+	fresh := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer new")
+	if _, err := client.ListSessions(fresh, &watcherpb.ListSessionsRequest{}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,296 @@
+// Read-only gRPC API of codex-watcher. Regenerate the Go code with
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//          --go-grpc_out=. --go-grpc_opt=paths=source_relative watcher.proto
+// from this directory.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: watcher.proto
+
+package watcherpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Watcher_ListSessions_FullMethodName = "/codexwatcher.v1.Watcher/ListSessions"
+	Watcher_GetMessages_FullMethodName  = "/codexwatcher.v1.Watcher/GetMessages"
+	Watcher_Search_FullMethodName       = "/codexwatcher.v1.Watcher/Search"
+	Watcher_Export_FullMethodName       = "/codexwatcher.v1.Watcher/Export"
+)
+
+// WatcherClient is the client API for Watcher service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Watcher exposes the same data as the REST API under /api.
+type WatcherClient interface {
+	// ListSessions returns visible sessions, newest activity first.
+	ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...grpc.CallOption) (*ListSessionsResponse, error)
+	// GetMessages streams the visible messages of one session in the order they were read.
+	GetMessages(ctx context.Context, in *GetMessagesRequest, opts ...grpc.CallOption) (Watcher_GetMessagesClient, error)
+	// Search runs a query using the /api/search syntax.
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	// Export streams a session export in the requested format.
+	Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (Watcher_ExportClient, error)
+}
+
+type watcherClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWatcherClient(cc grpc.ClientConnInterface) WatcherClient {
+	return &watcherClient{cc}
+}
+
+func (c *watcherClient) ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...grpc.CallOption) (*ListSessionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSessionsResponse)
+	err := c.cc.Invoke(ctx, Watcher_ListSessions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *watcherClient) GetMessages(ctx context.Context, in *GetMessagesRequest, opts ...grpc.CallOption) (Watcher_GetMessagesClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Watcher_ServiceDesc.Streams[0], Watcher_GetMessages_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &watcherGetMessagesClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Watcher_GetMessagesClient interface {
+	Recv() (*Message, error)
+	grpc.ClientStream
+}
+
+type watcherGetMessagesClient struct {
+	grpc.ClientStream
+}
+
+func (x *watcherGetMessagesClient) Recv() (*Message, error) {
+	m := new(Message)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *watcherClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, Watcher_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *watcherClient) Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (Watcher_ExportClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Watcher_ServiceDesc.Streams[1], Watcher_Export_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &watcherExportClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Watcher_ExportClient interface {
+	Recv() (*ExportChunk, error)
+	grpc.ClientStream
+}
+
+type watcherExportClient struct {
+	grpc.ClientStream
+}
+
+func (x *watcherExportClient) Recv() (*ExportChunk, error) {
+	m := new(ExportChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WatcherServer is the server API for Watcher service.
+// All implementations must embed UnimplementedWatcherServer
+// for forward compatibility
+//
+// Watcher exposes the same data as the REST API under /api.
+type WatcherServer interface {
+	// ListSessions returns visible sessions, newest activity first.
+	ListSessions(context.Context, *ListSessionsRequest) (*ListSessionsResponse, error)
+	// GetMessages streams the visible messages of one session in the order they were read.
+	GetMessages(*GetMessagesRequest, Watcher_GetMessagesServer) error
+	// Search runs a query using the /api/search syntax.
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+	// Export streams a session export in the requested format.
+	Export(*ExportRequest, Watcher_ExportServer) error
+	mustEmbedUnimplementedWatcherServer()
+}
+
+// UnimplementedWatcherServer must be embedded to have forward compatible implementations.
+type UnimplementedWatcherServer struct {
+}
+
+func (UnimplementedWatcherServer) ListSessions(context.Context, *ListSessionsRequest) (*ListSessionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSessions not implemented")
+}
+func (UnimplementedWatcherServer) GetMessages(*GetMessagesRequest, Watcher_GetMessagesServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetMessages not implemented")
+}
+func (UnimplementedWatcherServer) Search(context.Context, *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedWatcherServer) Export(*ExportRequest, Watcher_ExportServer) error {
+	return status.Errorf(codes.Unimplemented, "method Export not implemented")
+}
+func (UnimplementedWatcherServer) mustEmbedUnimplementedWatcherServer() {}
+
+// UnsafeWatcherServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WatcherServer will
+// result in compilation errors.
+type UnsafeWatcherServer interface {
+	mustEmbedUnimplementedWatcherServer()
+}
+
+func RegisterWatcherServer(s grpc.ServiceRegistrar, srv WatcherServer) {
+	s.RegisterService(&Watcher_ServiceDesc, srv)
+}
+
+func _Watcher_ListSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSessionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WatcherServer).ListSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Watcher_ListSessions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WatcherServer).ListSessions(ctx, req.(*ListSessionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Watcher_GetMessages_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetMessagesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WatcherServer).GetMessages(m, &watcherGetMessagesServer{ServerStream: stream})
+}
+
+type Watcher_GetMessagesServer interface {
+	Send(*Message) error
+	grpc.ServerStream
+}
+
+type watcherGetMessagesServer struct {
+	grpc.ServerStream
+}
+
+func (x *watcherGetMessagesServer) Send(m *Message) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Watcher_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WatcherServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Watcher_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WatcherServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Watcher_Export_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WatcherServer).Export(m, &watcherExportServer{ServerStream: stream})
+}
+
+type Watcher_ExportServer interface {
+	Send(*ExportChunk) error
+	grpc.ServerStream
+}
+
+type watcherExportServer struct {
+	grpc.ServerStream
+}
+
+func (x *watcherExportServer) Send(m *ExportChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Watcher_ServiceDesc is the grpc.ServiceDesc for Watcher service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Watcher_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "codexwatcher.v1.Watcher",
+	HandlerType: (*WatcherServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListSessions",
+			Handler:    _Watcher_ListSessions_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _Watcher_Search_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetMessages",
+			Handler:       _Watcher_GetMessages_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Export",
+			Handler:       _Watcher_Export_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "watcher.proto",
+}
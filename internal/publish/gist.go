@@ -0,0 +1,107 @@
+// Package publish sends exported transcripts to external services (gists,
+// trackers, wikis, Notion). Credentials are set once at startup by main.
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// GitHubToken authorizes gist creation (needs the "gist" scope).
+	GitHubToken string
+	// GitHubAPI is the GitHub REST base URL; override for GitHub Enterprise.
+	GitHubAPI = "https://api.github.com"
+
+	httpClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+// ErrNotConfigured is returned when an integration has no credentials.
+var ErrNotConfigured = errors.New("integration not configured")
+
+// CreateGist publishes content as a single-file gist and returns its HTML URL.
+// Gists are secret unless public is set.
+func CreateGist(ctx context.Context, filename, description, content string, public bool) (string, error) {
+	if strings.TrimSpace(GitHubToken) == "" {
+		return "", fmt.Errorf("gist: %w (set GITHUB_TOKEN or --github_token)", ErrNotConfigured)
+	}
+	body := map[string]any{
+		"description": description,
+		"public":      public,
+		"files": map[string]any{
+			filename: map[string]string{"content": content},
+		},
+	}
+	var out struct {
+		HTMLURL string `json:"html_url"`
+	}
+	headers := map[string]string{
+		"Authorization":        "Bearer " + GitHubToken,
+		"Accept":               "application/vnd.github+json",
+		"X-GitHub-Api-Version": "2022-11-28",
+	}
+	if err := postJSON(ctx, strings.TrimRight(GitHubAPI, "/")+"/gists", headers, body, &out); err != nil {
+		return "", fmt.Errorf("gist: %w", err)
+	}
+	return out.HTMLURL, nil
+}
+
+// postJSON sends body as JSON and decodes a 2xx response into out (if non-nil).
+func postJSON(ctx context.Context, url string, headers map[string]string, body any, out any) error {
+	return sendJSON(ctx, http.MethodPost, url, headers, body, out)
+}
+
+// sendJSON is postJSON for any method; a nil body sends none.
+func sendJSON(ctx context.Context, method, url string, headers map[string]string, body any, out any) error {
+	var req *http.Request
+	var err error
+	if body == nil {
+		req, err = http.NewRequestWithContext(ctx, method, url, nil)
+	} else {
+		req, err = newJSONRequest(ctx, url, body)
+	}
+	if err != nil {
+		return err
+	}
+	req.Method = method
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return doRequest(req, out)
+}
+
+func newJSONRequest(ctx context.Context, url string, body any) (*http.Request, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func doRequest(req *http.Request, out any) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Redacted(), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
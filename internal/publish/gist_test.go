@@ -0,0 +1,39 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCreateGist(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gists" || r.Header.Get("Authorization") != "Bearer tok" {
+			t.Errorf("unexpected request %s %s auth=%q", r.Method, r.URL.Path, r.Header.Get("Authorization"))
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(201)
+		_, _ = w.Write([]byte(`{"html_url":"https://gist.github.com/abc"}`))
+	}))
+	defer srv.Close()
+	defer func(tok, api string) { GitHubToken, GitHubAPI = tok, api }(GitHubToken, GitHubAPI)
+	GitHubToken, GitHubAPI = "tok", srv.URL
+
+	u, err := CreateGist(context.Background(), "s.md", "desc", "# hi\n", false)
+	if err != nil || u != "https://gist.github.com/abc" {
+		t.Fatalf("CreateGist = %q, %v", u, err)
+	}
+	files, _ := got["files"].(map[string]any)
+	if got["public"] != false || files["s.md"] == nil {
+		t.Fatalf("unexpected payload: %v", got)
+	}
+
+	GitHubToken = ""
+	if _, err := CreateGist(context.Background(), "s.md", "", "", false); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("expected ErrNotConfigured, got %v", err)
+	}
+}
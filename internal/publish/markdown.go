@@ -0,0 +1,61 @@
+package publish
+
+import "strings"
+
+// mdBlock is one block of an export as wiki targets render it.
+type mdBlock struct {
+	kind  string // heading, code, or paragraph
+	level int    // 1-3 for headings
+	text  string
+}
+
+// splitMarkdown cuts an export into # to ### headings, fenced code blocks,
+// and paragraphs; other Markdown (lists, emphasis) stays in the paragraph
+// text. An unterminated fence runs to the end.
+func splitMarkdown(md string) []mdBlock {
+	var blocks []mdBlock
+	var para, code []string
+	inCode := false
+	flushPara := func() {
+		if text := strings.TrimSpace(strings.Join(para, "\n")); text != "" {
+			blocks = append(blocks, mdBlock{kind: "paragraph", text: text})
+		}
+		para = nil
+	}
+	for _, line := range strings.Split(md, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			if inCode {
+				blocks = append(blocks, mdBlock{kind: "code", text: strings.Join(code, "\n")})
+				inCode, code = false, nil
+			} else {
+				flushPara()
+				inCode = true
+			}
+			continue
+		}
+		if inCode {
+			code = append(code, line)
+			continue
+		}
+		level := 0
+		for level < len(trimmed) && level < 4 && trimmed[level] == '#' {
+			level++
+		}
+		if level >= 1 && level <= 3 && strings.HasPrefix(trimmed[level:], " ") {
+			flushPara()
+			blocks = append(blocks, mdBlock{kind: "heading", level: level, text: strings.TrimSpace(trimmed[level:])})
+			continue
+		}
+		if trimmed == "" {
+			flushPara()
+			continue
+		}
+		para = append(para, line)
+	}
+	if inCode {
+		blocks = append(blocks, mdBlock{kind: "code", text: strings.Join(code, "\n")})
+	}
+	flushPara()
+	return blocks
+}
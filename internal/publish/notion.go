@@ -0,0 +1,174 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	// NotionToken is a Notion internal integration secret; the target
+	// database must be shared with the integration.
+	NotionToken string
+	// NotionDatabaseID is the database new pages are created in.
+	NotionDatabaseID string
+	// NotionAPI is the Notion REST base URL.
+	NotionAPI = "https://api.notion.com/v1"
+)
+
+const (
+	notionVersion   = "2022-06-28"
+	notionTextMax   = 2000 // characters per rich text item
+	notionItemsMax  = 100  // rich text items per block
+	notionBatchMax  = 100  // blocks per request
+	notionPlainLang = "plain text"
+)
+
+// NotionPage is a session export to publish as a database page.
+type NotionPage struct {
+	Title    string
+	Date     time.Time
+	Project  string
+	Provider string
+	Tags     []string
+	Markdown string
+}
+
+// NotionConfigured reports whether CreateNotionPage has credentials.
+func NotionConfigured() bool {
+	return strings.TrimSpace(NotionToken) != "" && strings.TrimSpace(NotionDatabaseID) != ""
+}
+
+// CreateNotionPage adds p to the configured database and returns the page
+// URL. Date, Project, Provider, and Tags are set on the database properties
+// of those names (matched case-insensitively) when their type fits; the
+// title goes to the database's title property and the Markdown becomes the
+// page body.
+func CreateNotionPage(ctx context.Context, p NotionPage) (string, error) {
+	if !NotionConfigured() {
+		return "", fmt.Errorf("notion: %w (set NOTION_TOKEN and NOTION_DATABASE_ID)", ErrNotConfigured)
+	}
+	base := strings.TrimRight(NotionAPI, "/")
+	headers := map[string]string{
+		"Authorization":  "Bearer " + NotionToken,
+		"Notion-Version": notionVersion,
+	}
+	var db struct {
+		Properties map[string]struct {
+			Type string `json:"type"`
+		} `json:"properties"`
+	}
+	if err := sendJSON(ctx, http.MethodGet, base+"/databases/"+NotionDatabaseID, headers, nil, &db); err != nil {
+		return "", fmt.Errorf("notion: %w", err)
+	}
+	props := make(map[string]any)
+	for name, prop := range db.Properties {
+		var v any
+		switch strings.ToLower(name) + "/" + prop.Type {
+		case "date/date":
+			if !p.Date.IsZero() {
+				v = map[string]any{"date": map[string]any{"start": p.Date.Format(time.RFC3339)}}
+			}
+		case "project/rich_text", "provider/rich_text":
+			if s := notionField(name, p); s != "" {
+				v = map[string]any{"rich_text": notionText(s)}
+			}
+		case "project/select", "provider/select":
+			if s := notionField(name, p); s != "" {
+				v = map[string]any{"select": map[string]any{"name": notionOption(s)}}
+			}
+		case "tags/multi_select":
+			opts := make([]map[string]any, 0, len(p.Tags))
+			for _, t := range p.Tags {
+				opts = append(opts, map[string]any{"name": notionOption(t)})
+			}
+			v = map[string]any{"multi_select": opts}
+		}
+		if prop.Type == "title" {
+			v = map[string]any{"title": notionText(p.Title)}
+		}
+		if v != nil {
+			props[name] = v
+		}
+	}
+	blocks := markdownBlocks(p.Markdown)
+	first := blocks
+	if len(first) > notionBatchMax {
+		first = first[:notionBatchMax]
+	}
+	body := map[string]any{
+		"parent":     map[string]any{"database_id": NotionDatabaseID},
+		"properties": props,
+		"children":   first,
+	}
+	var page struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := sendJSON(ctx, http.MethodPost, base+"/pages", headers, body, &page); err != nil {
+		return "", fmt.Errorf("notion: %w", err)
+	}
+	// the rest of a long transcript is appended in batches
+	for rest := blocks[len(first):]; len(rest) > 0; {
+		n := min(len(rest), notionBatchMax)
+		if err := sendJSON(ctx, http.MethodPatch, base+"/blocks/"+page.ID+"/children", headers, map[string]any{"children": rest[:n]}, nil); err != nil {
+			return page.URL, fmt.Errorf("notion: page created but appending the transcript failed: %w", err)
+		}
+		rest = rest[n:]
+	}
+	return page.URL, nil
+}
+
+func notionField(name string, p NotionPage) string {
+	if strings.EqualFold(name, "provider") {
+		return p.Provider
+	}
+	return p.Project
+}
+
+// notionOption makes s a valid select option name: no commas, at most 100
+// characters.
+func notionOption(s string) string {
+	s = strings.ReplaceAll(s, ",", " ")
+	if utf8.RuneCountInString(s) > 100 {
+		s = string([]rune(s)[:100])
+	}
+	return s
+}
+
+// notionText splits s into rich text items within Notion's length limits,
+// cutting what does not fit in one block.
+func notionText(s string) []map[string]any {
+	var out []map[string]any
+	runes := []rune(s)
+	for len(runes) > 0 && len(out) < notionItemsMax {
+		n := min(len(runes), notionTextMax)
+		out = append(out, map[string]any{"type": "text", "text": map[string]any{"content": string(runes[:n])}})
+		runes = runes[n:]
+	}
+	if out == nil {
+		out = []map[string]any{}
+	}
+	return out
+}
+
+// markdownBlocks converts an export to Notion blocks: headings, code
+// blocks, and paragraphs (see splitMarkdown).
+func markdownBlocks(md string) []map[string]any {
+	blocks := []map[string]any{}
+	for _, b := range splitMarkdown(md) {
+		kind, content := "paragraph", map[string]any{"rich_text": notionText(b.text)}
+		switch b.kind {
+		case "heading":
+			kind = fmt.Sprintf("heading_%d", b.level)
+		case "code":
+			kind = "code"
+			content["language"] = notionPlainLang
+		}
+		blocks = append(blocks, map[string]any{"object": "block", "type": kind, kind: content})
+	}
+	return blocks
+}
@@ -0,0 +1,78 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateNotionPageFillsMatchingPropertiesAndAppendsLongBodies(t *testing.T) {
+	var page map[string]any
+	appended := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("Notion-Version") == "" {
+			t.Errorf("missing auth headers on %s", r.URL.Path)
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/databases/db1":
+			_, _ = w.Write([]byte(`{"properties":{"Name":{"type":"title"},"Date":{"type":"date"},"project":{"type":"select"},"Provider":{"type":"rich_text"},"Tags":{"type":"multi_select"},"Notes":{"type":"rich_text"}}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/pages":
+			_ = json.NewDecoder(r.Body).Decode(&page)
+			_, _ = w.Write([]byte(`{"id":"p1","url":"https://notion.so/p1"}`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/blocks/p1/children":
+			var body struct{ Children []any }
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			appended += len(body.Children)
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(404)
+		}
+	}))
+	defer srv.Close()
+	defer func(a, tk, db string) { NotionAPI, NotionToken, NotionDatabaseID = a, tk, db }(NotionAPI, NotionToken, NotionDatabaseID)
+	NotionAPI, NotionToken, NotionDatabaseID = srv.URL, "secret", "db1"
+
+	var md strings.Builder
+	md.WriteString("# Fix login\n\n```\ngo test ./...\n```\n")
+	for i := 0; i < 120; i++ {
+		fmt.Fprintf(&md, "\nparagraph %d\n", i)
+	}
+	link, err := CreateNotionPage(context.Background(), NotionPage{
+		Title: "Fix login", Date: time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC),
+		Project: "api", Provider: "codex", Tags: []string{"auth"}, Markdown: md.String(),
+	})
+	if err != nil || link != "https://notion.so/p1" {
+		t.Fatalf("CreateNotionPage = %q, %v", link, err)
+	}
+	props, _ := page["properties"].(map[string]any)
+	b, _ := json.Marshal(props)
+	for _, want := range []string{`"Name":{"title":[{"text":{"content":"Fix login"}`, `"Date":{"date":{"start":"2026-10-01T09:00:00Z"}}`, `"project":{"select":{"name":"api"}}`, `"Provider":{"rich_text"`, `"Tags":{"multi_select":[{"name":"auth"}]}`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("properties missing %s: %s", want, b)
+		}
+	}
+	if _, ok := props["Notes"]; ok {
+		t.Error("unrelated properties should be left alone")
+	}
+	children, _ := page["children"].([]any)
+	if len(children) != 100 || appended != 22 {
+		t.Fatalf("blocks: %d in the page, %d appended", len(children), appended)
+	}
+	if first, _ := children[0].(map[string]any); first["type"] != "heading_1" {
+		t.Fatalf("first block = %v", first)
+	}
+	if code, _ := children[1].(map[string]any); code["type"] != "code" {
+		t.Fatalf("second block = %v", code)
+	}
+
+	NotionToken = ""
+	if _, err := CreateNotionPage(context.Background(), NotionPage{}); err == nil || !strings.Contains(err.Error(), ErrNotConfigured.Error()) {
+		t.Fatalf("expected not configured, got %v", err)
+	}
+}
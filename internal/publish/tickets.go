@@ -0,0 +1,186 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// JiraURL is the Jira site base URL, e.g. https://example.atlassian.net.
+	JiraURL string
+	// JiraEmail and JiraToken authenticate with Jira Cloud basic auth (API token).
+	JiraEmail string
+	JiraToken string
+
+	// LinearAPIKey is a Linear personal API key.
+	LinearAPIKey string
+	// LinearAPI is the Linear GraphQL endpoint.
+	LinearAPI = "https://api.linear.app/graphql"
+)
+
+const (
+	jiraCommentMax   = 32000 // Jira rejects comments over 32767 characters
+	linearCommentMax = 60000
+)
+
+// Ticket trackers accepted by PostToTicket.
+const (
+	TrackerJira   = "jira"
+	TrackerLinear = "linear"
+)
+
+// PostToTicket adds a transcript to a tracker issue. With attach set, Jira gets
+// the Markdown as a file attachment; otherwise (and always for Linear) it is
+// posted as a comment, truncated to the tracker's size limit. It returns a URL
+// for the created comment or attachment when the tracker reports one.
+func PostToTicket(ctx context.Context, tracker, ticket, filename, title, markdown string, attach bool) (string, error) {
+	ticket = strings.TrimSpace(ticket)
+	if ticket == "" {
+		return "", fmt.Errorf("missing ticket")
+	}
+	switch strings.ToLower(tracker) {
+	case TrackerJira:
+		if attach {
+			return jiraAttach(ctx, ticket, filename, markdown)
+		}
+		body := "Agent transcript: " + title + "\n{noformat}\n" + truncateText(markdown, jiraCommentMax) + "\n{noformat}"
+		return jiraComment(ctx, ticket, body)
+	case TrackerLinear:
+		return linearComment(ctx, ticket, "**Agent transcript:** "+title+"\n\n"+truncateText(markdown, linearCommentMax))
+	default:
+		return "", fmt.Errorf("unsupported tracker: %s", tracker)
+	}
+}
+
+func jiraConfigured() error {
+	if strings.TrimSpace(JiraURL) == "" || JiraEmail == "" || JiraToken == "" {
+		return fmt.Errorf("jira: %w (set JIRA_URL, JIRA_EMAIL, JIRA_TOKEN)", ErrNotConfigured)
+	}
+	return nil
+}
+
+func jiraIssueURL(ticket, suffix string) string {
+	return strings.TrimRight(JiraURL, "/") + "/rest/api/2/issue/" + url.PathEscape(ticket) + suffix
+}
+
+func jiraComment(ctx context.Context, ticket, body string) (string, error) {
+	if err := jiraConfigured(); err != nil {
+		return "", err
+	}
+	req, err := newJSONRequest(ctx, jiraIssueURL(ticket, "/comment"), map[string]string{"body": body})
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(JiraEmail, JiraToken)
+	var out struct {
+		ID string `json:"id"`
+	}
+	if err := doRequest(req, &out); err != nil {
+		return "", fmt.Errorf("jira: %w", err)
+	}
+	return strings.TrimRight(JiraURL, "/") + "/browse/" + url.PathEscape(ticket) + "?focusedCommentId=" + url.QueryEscape(out.ID), nil
+}
+
+func jiraAttach(ctx context.Context, ticket, filename, content string) (string, error) {
+	if err := jiraConfigured(); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write([]byte(content)); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, jiraIssueURL(ticket, "/attachments"), &buf)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-Atlassian-Token", "no-check")
+	req.SetBasicAuth(JiraEmail, JiraToken)
+	var out []struct {
+		Content string `json:"content"`
+	}
+	if err := doRequest(req, &out); err != nil {
+		return "", fmt.Errorf("jira: %w", err)
+	}
+	if len(out) > 0 {
+		return out[0].Content, nil
+	}
+	return "", nil
+}
+
+// linearComment resolves an identifier such as ENG-123 and comments on it.
+func linearComment(ctx context.Context, ticket, body string) (string, error) {
+	if strings.TrimSpace(LinearAPIKey) == "" {
+		return "", fmt.Errorf("linear: %w (set LINEAR_API_KEY)", ErrNotConfigured)
+	}
+	var issue struct {
+		Data struct {
+			Issue struct {
+				ID string `json:"id"`
+			} `json:"issue"`
+		} `json:"data"`
+	}
+	if err := linearQuery(ctx, `query($id: String!) { issue(id: $id) { id } }`, map[string]any{"id": ticket}, &issue); err != nil {
+		return "", err
+	}
+	if issue.Data.Issue.ID == "" {
+		return "", fmt.Errorf("linear: issue not found: %s", ticket)
+	}
+	var created struct {
+		Data struct {
+			CommentCreate struct {
+				Success bool `json:"success"`
+				Comment struct {
+					URL string `json:"url"`
+				} `json:"comment"`
+			} `json:"commentCreate"`
+		} `json:"data"`
+	}
+	mutation := `mutation($issueId: String!, $body: String!) { commentCreate(input: {issueId: $issueId, body: $body}) { success comment { url } } }`
+	if err := linearQuery(ctx, mutation, map[string]any{"issueId": issue.Data.Issue.ID, "body": body}, &created); err != nil {
+		return "", err
+	}
+	if !created.Data.CommentCreate.Success {
+		return "", fmt.Errorf("linear: comment was not created")
+	}
+	return created.Data.CommentCreate.Comment.URL, nil
+}
+
+func linearQuery(ctx context.Context, query string, vars map[string]any, out any) error {
+	req, err := newJSONRequest(ctx, LinearAPI, map[string]any{"query": query, "variables": vars})
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", LinearAPIKey)
+	if err := doRequest(req, out); err != nil {
+		return fmt.Errorf("linear: %w", err)
+	}
+	return nil
+}
+
+// truncateText cuts s to at most max bytes on a rune boundary, noting the cut.
+func truncateText(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	const note = "\n\n… (truncated)"
+	cut := max - len(note)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + note
+}
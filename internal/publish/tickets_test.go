@@ -0,0 +1,46 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPostToTicketJiraComment(t *testing.T) {
+	var body map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/issue/ENG-1/comment" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if u, p, ok := r.BasicAuth(); !ok || u != "me@example.com" || p != "tok" {
+			t.Errorf("missing basic auth")
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"id":"100"}`))
+	}))
+	defer srv.Close()
+	defer func(u, e, tk string) { JiraURL, JiraEmail, JiraToken = u, e, tk }(JiraURL, JiraEmail, JiraToken)
+	JiraURL, JiraEmail, JiraToken = srv.URL, "me@example.com", "tok"
+
+	link, err := PostToTicket(context.Background(), "jira", "ENG-1", "s.md", "Fix login", "# Fix login\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != srv.URL+"/browse/ENG-1?focusedCommentId=100" {
+		t.Fatalf("link = %q", link)
+	}
+	if !strings.Contains(body["body"], "{noformat}\n# Fix login\n") {
+		t.Fatalf("unexpected comment body: %q", body["body"])
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	s := strings.Repeat("é", 100)
+	out := truncateText(s, 50)
+	if len(out) > 50 || !strings.HasSuffix(out, "(truncated)") || !strings.HasPrefix(out, "é") {
+		t.Fatalf("truncateText = %q", out)
+	}
+}
@@ -0,0 +1,280 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"codex-watcher/pkg/indexer"
+)
+
+var (
+	// ConfluenceURL is the Confluence base URL including its context path,
+	// e.g. https://example.atlassian.net/wiki.
+	ConfluenceURL string
+	// ConfluenceEmail and ConfluenceToken authenticate with Confluence Cloud
+	// basic auth (API token); without an email the token is sent as a Data
+	// Center personal access token.
+	ConfluenceEmail string
+	ConfluenceToken string
+	// ConfluenceSpace is the key of the space pages are created in.
+	ConfluenceSpace string
+	// ConfluenceParentID optionally nests new pages under this page.
+	ConfluenceParentID string
+
+	// WikiRepo is a local clone of a git-backed wiki (GitHub/GitLab wiki or
+	// any docs repo) transcripts are committed to.
+	WikiRepo string
+	// WikiPath is where a transcript goes in WikiRepo and WikiMessage its
+	// commit message; both expand the placeholders listed at ExpandWikiTemplate.
+	WikiPath    = "transcripts/{date} {title} ({short_id}).md"
+	WikiMessage = "Add transcript: {title}"
+	// WikiPush pushes WikiRepo after each commit.
+	WikiPush bool
+
+	wikiGitMu sync.Mutex // one git operation on WikiRepo at a time
+)
+
+// Wiki targets accepted by PublishWiki.
+const (
+	WikiConfluence = "confluence"
+	WikiGit        = "git"
+)
+
+const confluenceTitleMax = 255
+
+// WikiPage is a session export to publish to a wiki.
+type WikiPage struct {
+	SessionID string
+	Title     string
+	Date      time.Time
+	Project   string
+	Provider  string
+	Markdown  string
+}
+
+// NewWikiPage describes session s with its Markdown export.
+func NewWikiPage(s indexer.Session, markdown string) WikiPage {
+	project := s.DirName
+	if project == "" {
+		project = s.CWDBase
+	}
+	return WikiPage{
+		SessionID: s.ID,
+		Title:     indexer.SessionDisplayTitle(s, nil),
+		Date:      s.FirstAt,
+		Project:   project,
+		Provider:  s.Provider,
+		Markdown:  markdown,
+	}
+}
+
+// WikiConfigured reports whether target has what PublishWiki needs.
+func WikiConfigured(target string) bool {
+	switch target {
+	case WikiConfluence:
+		return confluenceConfigured() == nil
+	case WikiGit:
+		return strings.TrimSpace(WikiRepo) != ""
+	}
+	return false
+}
+
+// PublishWiki adds p to a wiki target and returns where it went: the page
+// URL for Confluence, the file's path in the repo for git.
+func PublishWiki(ctx context.Context, target string, p WikiPage) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(target)) {
+	case WikiConfluence:
+		return createConfluencePage(ctx, p)
+	case WikiGit:
+		return commitToWiki(ctx, p)
+	default:
+		return "", fmt.Errorf("unsupported wiki target: %s", target)
+	}
+}
+
+// ExpandWikiTemplate fills {title}, {date} (YYYY-MM-DD of the session
+// start), {id}, {short_id} (first 8 characters), {project}, and {provider}
+// in tmpl. With path set the values are made safe as file name parts.
+func ExpandWikiTemplate(tmpl string, p WikiPage, path bool) string {
+	date := ""
+	if !p.Date.IsZero() {
+		date = p.Date.Local().Format("2006-01-02")
+	}
+	short := p.SessionID
+	if len(short) > 8 {
+		short = short[:8]
+	}
+	title := p.Title
+	if path {
+		if r := []rune(title); len(r) > 60 {
+			title = strings.TrimSpace(string(r[:60]))
+		}
+	}
+	vals := []string{"{title}", title, "{date}", date, "{id}", p.SessionID, "{short_id}", short, "{project}", p.Project, "{provider}", p.Provider}
+	if path {
+		for i := 1; i < len(vals); i += 2 {
+			vals[i] = pathPart(vals[i])
+		}
+	}
+	return strings.NewReplacer(vals...).Replace(tmpl)
+}
+
+// pathPart replaces path separators and characters file systems or wikis
+// reject with "-".
+func pathPart(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|#`, r) {
+			return '-'
+		}
+		return r
+	}, s)
+	s = strings.Trim(strings.TrimSpace(s), ".")
+	if s == "" {
+		return "untitled"
+	}
+	return s
+}
+
+func confluenceConfigured() error {
+	if strings.TrimSpace(ConfluenceURL) == "" || ConfluenceToken == "" || strings.TrimSpace(ConfluenceSpace) == "" {
+		return fmt.Errorf("confluence: %w (set CONFLUENCE_URL, CONFLUENCE_TOKEN, CONFLUENCE_SPACE)", ErrNotConfigured)
+	}
+	return nil
+}
+
+// createConfluencePage creates a page in ConfluenceSpace. Titles must be
+// unique in a space, so the page title carries the date and short session id.
+func createConfluencePage(ctx context.Context, p WikiPage) (string, error) {
+	if err := confluenceConfigured(); err != nil {
+		return "", err
+	}
+	title := ExpandWikiTemplate("{date} {title} ({short_id})", p, false)
+	if r := []rune(title); len(r) > confluenceTitleMax {
+		title = string(r[:confluenceTitleMax])
+	}
+	body := map[string]any{
+		"type":  "page",
+		"title": strings.TrimSpace(title),
+		"space": map[string]any{"key": ConfluenceSpace},
+		"body": map[string]any{
+			"storage": map[string]any{"value": confluenceStorage(p.Markdown), "representation": "storage"},
+		},
+	}
+	if ConfluenceParentID != "" {
+		body["ancestors"] = []map[string]any{{"id": ConfluenceParentID}}
+	}
+	base := strings.TrimRight(ConfluenceURL, "/")
+	req, err := newJSONRequest(ctx, base+"/rest/api/content", body)
+	if err != nil {
+		return "", err
+	}
+	if ConfluenceEmail != "" {
+		req.SetBasicAuth(ConfluenceEmail, ConfluenceToken)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+ConfluenceToken)
+	}
+	var out struct {
+		ID    string `json:"id"`
+		Links struct {
+			Base  string `json:"base"`
+			WebUI string `json:"webui"`
+		} `json:"_links"`
+	}
+	if err := doRequest(req, &out); err != nil {
+		return "", fmt.Errorf("confluence: %w", err)
+	}
+	if out.Links.WebUI == "" {
+		return base + "/pages/viewpage.action?pageId=" + out.ID, nil
+	}
+	if out.Links.Base == "" {
+		out.Links.Base = base
+	}
+	return out.Links.Base + out.Links.WebUI, nil
+}
+
+// confluenceStorage converts an export to Confluence storage format:
+// headings, code macros, and paragraphs (see splitMarkdown).
+func confluenceStorage(md string) string {
+	var b strings.Builder
+	for _, blk := range splitMarkdown(md) {
+		switch blk.kind {
+		case "heading":
+			fmt.Fprintf(&b, "<h%d>%s</h%d>", blk.level, html.EscapeString(blk.text), blk.level)
+		case "code":
+			// "]]>" cannot appear inside CDATA, so it is split across two sections
+			text := strings.ReplaceAll(blk.text, "]]>", "]]]]><![CDATA[>")
+			b.WriteString(`<ac:structured-macro ac:name="code"><ac:plain-text-body><![CDATA[` + text + `]]></ac:plain-text-body></ac:structured-macro>`)
+		default:
+			b.WriteString("<p>" + strings.ReplaceAll(html.EscapeString(blk.text), "\n", "<br/>") + "</p>")
+		}
+	}
+	return b.String()
+}
+
+// commitToWiki writes p to WikiPath in WikiRepo and commits only that file.
+// Publishing an unchanged transcript again makes no commit.
+func commitToWiki(ctx context.Context, p WikiPage) (string, error) {
+	repo := strings.TrimSpace(WikiRepo)
+	if repo == "" {
+		return "", fmt.Errorf("wiki: %w (set --wiki_repo)", ErrNotConfigured)
+	}
+	rel := filepath.Clean(filepath.FromSlash(ExpandWikiTemplate(WikiPath, p, true)))
+	if filepath.IsAbs(rel) || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("wiki: path %q is outside the repo", rel)
+	}
+	wikiGitMu.Lock()
+	defer wikiGitMu.Unlock()
+	path := filepath.Join(repo, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("wiki: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(p.Markdown), 0o644); err != nil {
+		return "", fmt.Errorf("wiki: %w", err)
+	}
+	if _, err := wikiGit(ctx, repo, "add", "--", rel); err != nil {
+		return "", err
+	}
+	changed, err := wikiGit(ctx, repo, "status", "--porcelain", "--", rel)
+	if err != nil {
+		return "", err
+	}
+	if changed == "" {
+		return filepath.ToSlash(rel), nil
+	}
+	args := []string{"commit", "-q", "-m", ExpandWikiTemplate(WikiMessage, p, false)}
+	// commit as codex-watcher when the repo has no identity of its own
+	if email, _ := wikiGit(ctx, repo, "config", "user.email"); email == "" {
+		args = append([]string{"-c", "user.name=codex-watcher", "-c", "user.email=codex-watcher@localhost"}, args...)
+	}
+	if _, err := wikiGit(ctx, repo, append(args, "--", rel)...); err != nil {
+		return "", err
+	}
+	if WikiPush {
+		if _, err := wikiGit(ctx, repo, "push", "-q"); err != nil {
+			return filepath.ToSlash(rel), err
+		}
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// wikiGit runs git in repo and returns its trimmed output.
+func wikiGit(ctx context.Context, repo string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repo}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		// "git config" exits 1 for an unset key
+		if args[0] == "config" {
+			return "", nil
+		}
+		return "", fmt.Errorf("wiki: git %s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
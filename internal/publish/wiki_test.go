@@ -0,0 +1,119 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateConfluencePageSendsStorageFormat(t *testing.T) {
+	var got struct {
+		Title     string
+		Space     struct{ Key string }
+		Ancestors []struct{ ID string }
+		Body      struct {
+			Storage struct{ Value, Representation string }
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "me@example.com" || pass != "tok" {
+			t.Errorf("missing basic auth")
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/wiki/rest/api/content" {
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"id":"42","_links":{"base":"https://example.atlassian.net/wiki","webui":"/spaces/ENG/pages/42"}}`))
+	}))
+	defer srv.Close()
+	defer func(u, e, tk, sp, par string) {
+		ConfluenceURL, ConfluenceEmail, ConfluenceToken, ConfluenceSpace, ConfluenceParentID = u, e, tk, sp, par
+	}(ConfluenceURL, ConfluenceEmail, ConfluenceToken, ConfluenceSpace, ConfluenceParentID)
+	ConfluenceURL, ConfluenceEmail, ConfluenceToken, ConfluenceSpace, ConfluenceParentID = srv.URL+"/wiki", "me@example.com", "tok", "ENG", "7"
+
+	page := WikiPage{
+		SessionID: "0123456789abcdef",
+		Title:     "Fix <flaky> test",
+		Date:      time.Date(2026, 10, 14, 9, 0, 0, 0, time.Local),
+		Markdown:  "# Fix\n\nuse a & b\nnext line\n\n```\nif a]]>b {}\n```\n",
+	}
+	url, err := PublishWiki(context.Background(), WikiConfluence, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://example.atlassian.net/wiki/spaces/ENG/pages/42" {
+		t.Fatalf("url = %q", url)
+	}
+	if got.Title != "2026-10-14 Fix <flaky> test (01234567)" || got.Space.Key != "ENG" || len(got.Ancestors) != 1 || got.Ancestors[0].ID != "7" {
+		t.Fatalf("unexpected page: %+v", got)
+	}
+	want := `<h1>Fix</h1><p>use a &amp; b<br/>next line</p><ac:structured-macro ac:name="code"><ac:plain-text-body><![CDATA[if a]]]]><![CDATA[>b {}]]></ac:plain-text-body></ac:structured-macro>`
+	if got.Body.Storage.Value != want || got.Body.Storage.Representation != "storage" {
+		t.Fatalf("storage = %q", got.Body.Storage.Value)
+	}
+
+	ConfluenceToken = ""
+	if _, err := PublishWiki(context.Background(), WikiConfluence, page); err == nil || !strings.Contains(err.Error(), "CONFLUENCE_TOKEN") {
+		t.Fatalf("expected a not-configured error, got %v", err)
+	}
+}
+
+func TestCommitToWikiUsesPathAndMessageTemplates(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	defer func(r, p, m string, push bool) { WikiRepo, WikiPath, WikiMessage, WikiPush = r, p, m, push }(WikiRepo, WikiPath, WikiMessage, WikiPush)
+	WikiRepo, WikiPath, WikiMessage, WikiPush = repo, "{project}/{date} {title}.md", "Transcript {short_id} ({provider})", false
+
+	page := WikiPage{
+		SessionID: "abcdef0123456789",
+		Title:     "Refactor a/b: part 1",
+		Date:      time.Date(2026, 10, 14, 9, 0, 0, 0, time.Local),
+		Project:   "api",
+		Provider:  "codex",
+		Markdown:  "# Refactor\n",
+	}
+	rel, err := PublishWiki(context.Background(), WikiGit, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel != "api/2026-10-14 Refactor a-b- part 1.md" {
+		t.Fatalf("path = %q", rel)
+	}
+	if b, err := os.ReadFile(filepath.Join(repo, filepath.FromSlash(rel))); err != nil || string(b) != "# Refactor\n" {
+		t.Fatalf("file = %q, %v", b, err)
+	}
+	log, err := exec.Command("git", "-C", repo, "log", "--format=%s").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(log)) != "Transcript abcdef01 (codex)" {
+		t.Fatalf("log = %q", log)
+	}
+
+	// republishing the same transcript makes no second commit
+	if _, err := PublishWiki(context.Background(), WikiGit, page); err != nil {
+		t.Fatal(err)
+	}
+	log, _ = exec.Command("git", "-C", repo, "log", "--format=%s").Output()
+	if n := len(strings.Split(strings.TrimSpace(string(log)), "\n")); n != 1 {
+		t.Fatalf("expected 1 commit, got %d", n)
+	}
+
+	WikiPath = "../{title}.md"
+	page.Title = ".."
+	if _, err := PublishWiki(context.Background(), WikiGit, page); err == nil {
+		t.Fatal("expected a path outside the repo to be rejected")
+	}
+}
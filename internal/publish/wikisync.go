@@ -0,0 +1,124 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"codex-watcher/pkg/exporter"
+	"codex-watcher/pkg/indexer"
+)
+
+// WikiSync publishes each finished session once to its wiki targets. The
+// first run only records the sessions already finished, so turning it on
+// does not flood the wiki with old transcripts.
+type WikiSync struct {
+	Targets   []string      // WikiConfluence and/or WikiGit
+	StatePath string        // JSON file of what was published
+	Idle      time.Duration // a session is finished once idle this long
+
+	// published maps session id to target to the published location; ""
+	// marks a session that was finished before the sync started
+	published map[string]map[string]string
+	loaded    bool
+}
+
+// Run syncs every interval until ctx is done.
+func (ws *WikiSync) Run(ctx context.Context, idx *indexer.Indexer, interval time.Duration) {
+	_, _ = ws.SyncOnce(ctx, idx, time.Now())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = ws.SyncOnce(ctx, idx, time.Now())
+		}
+	}
+}
+
+// SyncOnce publishes sessions that are idle as of now and not yet published
+// to every target. It returns the number of pages published.
+func (ws *WikiSync) SyncOnce(ctx context.Context, idx *indexer.Indexer, now time.Time) (int, error) {
+	baseline := false
+	if !ws.loaded {
+		ws.published = make(map[string]map[string]string)
+		b, err := os.ReadFile(ws.StatePath)
+		if err == nil {
+			_ = json.Unmarshal(b, &ws.published)
+		} else if os.IsNotExist(err) {
+			baseline = true
+		}
+		ws.loaded = true
+	}
+
+	published := 0
+	var firstErr error
+	for _, s := range idx.Sessions() {
+		view, ok := idx.SessionView(s, indexer.VisibleMessages(idx.PeekMessages(s.ID), 0))
+		if !ok || view.LastAt.IsZero() || now.Sub(view.LastAt) < ws.Idle {
+			continue
+		}
+		done := ws.published[s.ID]
+		if done == nil {
+			done = make(map[string]string)
+			ws.published[s.ID] = done
+		}
+		if baseline {
+			for _, t := range ws.Targets {
+				done[t] = ""
+			}
+			continue
+		}
+		var page *WikiPage
+		for _, t := range ws.Targets {
+			if _, ok := done[t]; ok {
+				continue
+			}
+			if page == nil {
+				var buf bytes.Buffer
+				if _, err := exporter.WriteSession(&buf, idx, s.ID, "md", exporter.Filters{ExcludeShellCalls: true, ExcludeToolOutputs: true}); err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					break
+				}
+				p := NewWikiPage(view, buf.String())
+				page = &p
+			}
+			loc, err := PublishWiki(ctx, t, *page)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			done[t] = loc
+			published++
+		}
+	}
+	if err := ws.save(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return published, firstErr
+}
+
+func (ws *WikiSync) save() error {
+	b, err := json.MarshalIndent(ws.published, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := ws.StatePath + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, ws.StatePath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace %s: %w", ws.StatePath, err)
+	}
+	return nil
+}
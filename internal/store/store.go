@@ -0,0 +1,410 @@
+// Package store persists the index in SQLite (--db), so a restart replays
+// saved lines instead of rereading every session file, and keeps an FTS5
+// table that narrows /api/search before the in-memory matcher runs.
+//
+// The database holds, per session file, the tail state and every line read
+// so far, plus one full-text row per message with its content and tool text.
+// The session files stay the source of truth: a file that changed underneath
+// the saved state is dropped from the database and read again.
+package store
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	_ "modernc.org/sqlite" // pure Go driver, so builds stay CGO-free
+
+	"codex-watcher/pkg/indexer"
+	"codex-watcher/pkg/search"
+)
+
+// schemaVersion is bumped whenever the layout changes; a database with
+// another version is emptied and rebuilt from the session files.
+const schemaVersion = 1
+
+const schema = `
+CREATE TABLE IF NOT EXISTS meta (key TEXT PRIMARY KEY, value TEXT);
+CREATE TABLE IF NOT EXISTS files (
+	path TEXT PRIMARY KEY, source TEXT, provider TEXT, project TEXT, session_id TEXT,
+	offset INTEGER, line_no INTEGER, size INTEGER, mod_ns INTEGER
+);
+CREATE TABLE IF NOT EXISTS lines (
+	path TEXT, line_no INTEGER, line TEXT, PRIMARY KEY (path, line_no)
+) WITHOUT ROWID;
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+	source UNINDEXED, line_no UNINDEXED, content, tools, tokenize = 'trigram'
+);
+`
+
+// minTermRunes is the shortest text the trigram index can look up.
+const minTermRunes = 3
+
+// DB is an open index database.
+type DB struct {
+	db *sql.DB
+
+	mu    sync.Mutex        // serializes Restore and Sync
+	epoch uint64            // indexer epoch the rows belong to
+	gens  map[string]uint64 // indexer FileState.Gen per path at the last sync
+
+	synced atomic.Pointer[map[string]int] // source -> last line in messages_fts
+}
+
+// Open opens or creates the database at path.
+func Open(path string) (*DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// one connection: SQLite serializes writers anyway, and pragmas are
+	// per connection
+	db.SetMaxOpenConns(1)
+	for _, stmt := range []string{"PRAGMA journal_mode = WAL", "PRAGMA synchronous = NORMAL", "PRAGMA busy_timeout = 5000"} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var version string
+	err = db.QueryRow(`SELECT value FROM meta WHERE key = 'schema_version'`).Scan(&version)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if version != strconv.Itoa(schemaVersion) {
+		if _, err := db.Exec(`DELETE FROM files; DELETE FROM lines; DELETE FROM messages_fts;
+			INSERT OR REPLACE INTO meta (key, value) VALUES ('schema_version', ?)`, strconv.Itoa(schemaVersion)); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	d := &DB{db: db, gens: make(map[string]uint64)}
+	d.synced.Store(&map[string]int{})
+	return d, nil
+}
+
+// Close closes the database.
+func (d *DB) Close() error { return d.db.Close() }
+
+type fileRow struct {
+	indexer.FileState
+}
+
+func fileRows(tx querier) (map[string]fileRow, error) {
+	rows, err := tx.Query(`SELECT path, source, provider, project, session_id, offset, line_no, size, mod_ns FROM files`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]fileRow)
+	for rows.Next() {
+		var r fileRow
+		var modNs int64
+		if err := rows.Scan(&r.Path, &r.Source, &r.Provider, &r.Project, &r.SessionID, &r.Offset, &r.LineNo, &r.Size, &modNs); err != nil {
+			return nil, err
+		}
+		if modNs != 0 {
+			r.ModAt = time.Unix(0, modNs).UTC()
+		}
+		out[r.Path] = r
+	}
+	return out, rows.Err()
+}
+
+// Restore replays the saved lines of every file that still matches its
+// saved state into idx, which must not be running yet. Files that changed
+// are dropped here and read from disk by the first scan. It returns the
+// number of files and lines restored.
+func (d *DB) Restore(idx *indexer.Indexer) (files, lines int, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rows, err := fileRows(d.db)
+	if err != nil {
+		return 0, 0, err
+	}
+	synced := make(map[string]int)
+	for path, r := range rows {
+		saved, err := d.savedLines(path)
+		if err != nil {
+			return files, lines, err
+		}
+		if !idx.RestoreFile(r.FileState, saved) {
+			if err := d.forget(d.db, r.FileState); err != nil {
+				return files, lines, err
+			}
+			continue
+		}
+		files++
+		lines += len(saved)
+		synced[r.Source] = r.LineNo
+	}
+	d.epoch = idx.Epoch()
+	d.gens = make(map[string]uint64)
+	for _, st := range idx.FileStates() {
+		d.gens[st.Path] = st.Gen
+	}
+	d.synced.Store(&synced)
+	return files, lines, nil
+}
+
+func (d *DB) savedLines(path string) ([]string, error) {
+	rows, err := d.db.Query(`SELECT line FROM lines WHERE path = ? ORDER BY line_no`, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		out = append(out, line)
+	}
+	return out, rows.Err()
+}
+
+// execer and querier are met by both *sql.DB and *sql.Tx. With a single
+// connection, code running inside a transaction must go through it.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// forget deletes everything saved for one file.
+func (d *DB) forget(tx execer, r indexer.FileState) error {
+	if _, err := tx.Exec(`DELETE FROM files WHERE path = ?`, r.Path); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM lines WHERE path = ?`, r.Path); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DELETE FROM messages_fts WHERE source = ?`, r.Source)
+	return err
+}
+
+// Sync writes what idx read since the last sync: new lines are appended,
+// files the indexer rewrote or reset are saved again from the start, and
+// files it no longer tracks are deleted. A Reindex empties the database.
+func (d *DB) Sync(idx *indexer.Indexer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if epoch := idx.Epoch(); epoch != d.epoch {
+		if _, err := tx.Exec(`DELETE FROM files; DELETE FROM lines; DELETE FROM messages_fts`); err != nil {
+			return err
+		}
+		d.epoch, d.gens = epoch, make(map[string]uint64)
+	}
+	rows, err := fileRows(tx)
+	if err != nil {
+		return err
+	}
+	gens := make(map[string]uint64)
+	synced := make(map[string]int)
+	for _, st := range idx.FileStates() {
+		r, have := rows[st.Path]
+		delete(rows, st.Path)
+		from := indexer.FileState{Path: st.Path, Source: st.Source}
+		if have {
+			if g, ok := d.gens[st.Path]; ok && g == st.Gen && st.Offset >= r.Offset && st.LineNo >= r.LineNo {
+				from = r.FileState
+			} else if err := d.forget(tx, r.FileState); err != nil {
+				return err
+			}
+		}
+		if have && from.Offset == st.Offset && from.LineNo == st.LineNo {
+			gens[st.Path], synced[st.Source] = st.Gen, st.LineNo
+			continue
+		}
+		lines, err := readLines(st.Path, from.Offset, st.Offset)
+		if err == nil && len(lines) != st.LineNo-from.LineNo && from.Offset > 0 {
+			// our copy drifted from the file: save it again from the start
+			if err := d.forget(tx, from); err != nil {
+				return err
+			}
+			from = indexer.FileState{Path: st.Path, Source: st.Source}
+			lines, err = readLines(st.Path, 0, st.Offset)
+		}
+		if err != nil || len(lines) != st.LineNo-from.LineNo {
+			// the file moved on since the indexer read it; retry next time
+			if from.Offset > 0 {
+				if err := d.forget(tx, from); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for i, line := range lines {
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO lines (path, line_no, line) VALUES (?, ?, ?)`, st.Path, from.LineNo+i+1, line); err != nil {
+				return err
+			}
+		}
+		for _, m := range idx.FileMessages(st.Path, from.LineNo) {
+			if m.LineNo > st.LineNo {
+				break // ingested after the snapshot; the next sync adds it
+			}
+			if _, err := tx.Exec(`INSERT INTO messages_fts (source, line_no, content, tools) VALUES (?, ?, ?, ?)`,
+				m.Source, m.LineNo, m.Content, search.ToolText(m)); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO files (path, source, provider, project, session_id, offset, line_no, size, mod_ns)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			st.Path, st.Source, st.Provider, st.Project, st.SessionID, st.Offset, st.LineNo, st.Size, st.ModAt.UnixNano()); err != nil {
+			return err
+		}
+		gens[st.Path], synced[st.Source] = st.Gen, st.LineNo
+	}
+	for _, r := range rows {
+		if err := d.forget(tx, r.FileState); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	d.gens = gens
+	d.synced.Store(&synced)
+	return nil
+}
+
+// readLines returns the non-blank lines between two offsets of a file,
+// numbered as the indexer numbers them.
+func readLines(path string, from, to int64) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(from, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(io.LimitReader(f, to-from))
+	var out []string
+	for {
+		line, err := r.ReadString('\n')
+		if strings.TrimSpace(line) != "" {
+			out = append(out, strings.TrimRight(line, "\r\n"))
+		}
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Run syncs every interval while the index changes, and once more when done
+// closes.
+func (d *DB) Run(idx *indexer.Indexer, interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var last uint64
+	for {
+		select {
+		case <-done:
+			_ = d.Sync(idx)
+			return
+		case <-t.C:
+			if rev := idx.Revision(); rev != last {
+				if err := d.Sync(idx); err == nil {
+					last = rev
+				}
+			}
+		}
+	}
+}
+
+// Candidates narrows a search with the full-text table; install it as
+// search.Index. It can answer queries whose every OR group has a positive
+// term or phrase of at least three characters; other clauses are left to
+// the in-memory matcher. Messages ingested since the last sync always pass.
+func (d *DB) Candidates(q search.Query) (func(m *indexer.Message) bool, bool) {
+	expr, ok := matchExpr(q)
+	if !ok {
+		return nil, false
+	}
+	rows, err := d.db.Query(`SELECT source, line_no FROM messages_fts WHERE messages_fts MATCH ?`, expr)
+	if err != nil {
+		return nil, false
+	}
+	defer rows.Close()
+	type key struct {
+		source string
+		line   int
+	}
+	hits := make(map[key]bool)
+	for rows.Next() {
+		var k key
+		if err := rows.Scan(&k.source, &k.line); err != nil {
+			return nil, false
+		}
+		hits[k] = true
+	}
+	if rows.Err() != nil {
+		return nil, false
+	}
+	synced := *d.synced.Load()
+	return func(m *indexer.Message) bool {
+		return hits[key{m.Source, m.LineNo}] || m.LineNo > synced[m.Source]
+	}, true
+}
+
+// matchExpr builds the FTS5 query for q: per OR group, the AND of its
+// positive text clauses, restricted to the columns of q's scope.
+func matchExpr(q search.Query) (string, bool) {
+	cols := "{content tools}"
+	switch q.Scope {
+	case search.ScopeContent:
+		cols = "content"
+	case search.ScopeTools:
+		cols = "tools"
+	}
+	var groups []string
+	for _, g := range q.Groups {
+		var terms []string
+		for _, c := range g {
+			if c.Negative {
+				continue
+			}
+			switch c.Kind {
+			case search.KindTerm, search.KindPhrase, search.KindPrefix:
+				v := strings.TrimSpace(strings.TrimSuffix(c.Value, "*"))
+				if utf8.RuneCountInString(v) >= minTermRunes {
+					terms = append(terms, `"`+strings.ReplaceAll(v, `"`, `""`)+`"`)
+				}
+			}
+		}
+		if len(terms) == 0 {
+			return "", false // this group could match anything
+		}
+		groups = append(groups, cols+" : ("+strings.Join(terms, " AND ")+")")
+	}
+	if len(groups) == 0 {
+		return "", false
+	}
+	return strings.Join(groups, " OR "), true
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"codex-watcher/pkg/indexer"
+	"codex-watcher/pkg/search"
+)
+
+func TestRestoreReplaysSavedLinesAndIndexNarrowsSearch(t *testing.T) {
+	dir := t.TempDir()
+	sessDir := filepath.Join(dir, "sessions")
+	if err := os.MkdirAll(sessDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(sessDir, "s1.jsonl")
+	lines := strings.Join([]string{
+		`{"id":"m1","session_id":"s1","role":"user","content":"deploy the walrus service","ts":"2024-01-02T03:04:05Z"}`,
+		`{"id":"m2","session_id":"s1","role":"assistant","content":"done","ts":"2024-01-02T03:05:05Z"}`,
+	}, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(dir, "index.db")
+
+	x := indexer.New([]string{dir}, "")
+	if err := x.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Sync(x); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// a new process restores from the database without reading the file
+	db, err = Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	y := indexer.New([]string{dir}, "")
+	files, n, err := db.Restore(y)
+	if err != nil || files != 1 || n != 2 {
+		t.Fatalf("Restore = %d files, %d lines, %v", files, n, err)
+	}
+	if msgs := y.Messages("s1", 0); len(msgs) != 2 || msgs[0].Content != "deploy the walrus service" {
+		t.Fatalf("restored messages = %+v", msgs)
+	}
+
+	// appended lines are read from the restored offset, not from the start
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"m3","session_id":"s1","role":"user","content":"and the walrus docs","ts":"2024-01-02T03:06:05Z"}` + "\n")
+	f.Close()
+	done := make(chan struct{})
+	close(done)
+	y.Run(done)
+	if n := len(y.Messages("s1", 0)); n != 3 {
+		t.Fatalf("expected 3 messages after tailing, got %d", n)
+	}
+
+	// m3 is not in the full-text table yet but must still be found
+	mayMatch, ok := db.Candidates(search.Parse("walrus", "content"))
+	if !ok {
+		t.Fatal("walrus should be answerable by the index")
+	}
+	var got []string
+	for _, m := range y.Messages("s1", 0) {
+		if mayMatch(m) {
+			got = append(got, m.ID)
+		}
+	}
+	if strings.Join(got, ",") != "m1,m3" {
+		t.Fatalf("candidates = %v", got)
+	}
+	if err := db.Sync(y); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := db.savedLines(path); len(saved) != 3 {
+		t.Fatalf("expected 3 saved lines after sync, got %d", len(saved))
+	}
+	if _, ok := db.Candidates(search.Parse("ok", "content")); ok {
+		t.Fatal("terms shorter than a trigram should fall back to a full scan")
+	}
+}
@@ -0,0 +1,220 @@
+// Package client talks to a running codex-watcher over its HTTP API: list
+// sessions, read their messages, search, and export. The types mirror the
+// JSON the server writes.
+//
+//	c := client.New("http://127.0.0.1:7077")
+//	res, err := c.Search(ctx, "role:user flaky", client.SearchOptions{Limit: 20})
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Client is a codex-watcher API client. Its fields may be changed before
+// first use.
+type Client struct {
+	BaseURL string       // e.g. http://127.0.0.1:7077
+	Token   string       // --api_token of the server, if it has one
+	HTTP    *http.Client // http.DefaultClient when nil
+}
+
+// New returns a client for the server at baseURL.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// Error is a non-2xx answer of the server.
+type Error struct {
+	StatusCode int
+	Message    string // the server's "error" field, else the response body
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("codex-watcher: %d %s", e.StatusCode, e.Message)
+}
+
+// SessionsOptions narrows Sessions; zero values list everything visible.
+type SessionsOptions struct {
+	Source        string // codex|claude
+	Project       string
+	IncludeHidden bool
+	Outcome       string // failed|ok
+	Tool          string // only sessions that called this tool
+	Thread        string // one chain of continued sessions, oldest first
+	Threads       bool   // only the latest session of each chain
+}
+
+// Sessions lists sessions, most recently active first.
+func (c *Client) Sessions(ctx context.Context, opts SessionsOptions) ([]Session, error) {
+	q := url.Values{}
+	set(q, "source", opts.Source)
+	set(q, "project", opts.Project)
+	set(q, "outcome", opts.Outcome)
+	set(q, "tool", opts.Tool)
+	set(q, "thread", opts.Thread)
+	setBool(q, "include_hidden", opts.IncludeHidden)
+	setBool(q, "threads", opts.Threads)
+	var out []Session
+	err := c.getJSON(ctx, "/api/sessions", q, &out)
+	return out, err
+}
+
+// Messages returns the last limit visible messages of a session in display
+// order; a limit of 0 uses the server's default of 200, a negative one
+// returns all.
+func (c *Client) Messages(ctx context.Context, sessionID string, limit int) ([]Message, error) {
+	q := url.Values{"session_id": {sessionID}}
+	if limit != 0 {
+		q.Set("limit", strconv.Itoa(max(limit, 0)))
+	}
+	var out []Message
+	err := c.getJSON(ctx, "/api/messages", q, &out)
+	return out, err
+}
+
+// SearchOptions pages a search.
+type SearchOptions struct {
+	Limit   int // 0 = server default (50)
+	Offset  int
+	Explain bool // fill SearchResult.Explain with the query plan
+}
+
+// Search runs a query in the server's search syntax (terms, "phrases",
+// -exclusions, OR, /regex/, and field filters such as role: or in:tools).
+func (c *Client) Search(ctx context.Context, query string, opts SearchOptions) (*SearchResult, error) {
+	q := url.Values{"q": {query}}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		q.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	setBool(q, "explain", opts.Explain)
+	var out SearchResult
+	if err := c.getJSON(ctx, "/api/search", q, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ExportOptions picks the format and content of an export; zero values
+// take the server's defaults.
+type ExportOptions struct {
+	Format             string // md|txt|json|jsonl
+	TextOnly           bool
+	Anonymize          bool
+	IncludeToolOutputs bool       // the server leaves tool outputs out by default
+	IncludeShell       bool       // and shell calls
+	Turns              string     // e.g. "1-3,7"
+	Params             url.Values // any other /api/export/session parameters
+}
+
+// Export writes a session export to w.
+func (c *Client) Export(ctx context.Context, sessionID string, opts ExportOptions, w io.Writer) error {
+	q := url.Values{}
+	for k, v := range opts.Params {
+		q[k] = v
+	}
+	q.Set("session_id", sessionID)
+	set(q, "format", opts.Format)
+	set(q, "turns", opts.Turns)
+	setBool(q, "text_only", opts.TextOnly)
+	setBool(q, "anonymize", opts.Anonymize)
+	if opts.IncludeToolOutputs {
+		q.Set("exclude_tool_outputs", "0")
+	}
+	if opts.IncludeShell {
+		q.Set("exclude_shell", "0")
+	}
+	resp, err := c.get(ctx, "/api/export/session", q)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Attachment fetches a cached attachment of a message and its media type.
+// The caller closes the reader.
+func (c *Client) Attachment(ctx context.Context, id string) (io.ReadCloser, string, error) {
+	resp, err := c.get(ctx, "/api/attachments/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, q url.Values, v any) error {
+	resp, err := c.get(ctx, path, q)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("codex-watcher: decoding %s: %w", path, err)
+	}
+	return nil
+}
+
+// get sends a GET and returns the response if it is a 2xx one.
+func (c *Client) get(ctx context.Context, path string, q url.Values) (*http.Response, error) {
+	u := c.BaseURL + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+func responseError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	e := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(b, &body) == nil && body.Error != "" {
+		e.Message = body.Error
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
+
+func set(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
+
+func setBool(q url.Values, key string, v bool) {
+	if v {
+		q.Set(key, "1")
+	}
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"codex-watcher/internal/api"
+	"codex-watcher/pkg/indexer"
+	"codex-watcher/pkg/search"
+)
+
+// jsonFields lists the JSON keys of a struct type.
+func jsonFields(t reflect.Type) []string {
+	var out []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func TestTypesMirrorServerModels(t *testing.T) {
+	pairs := []struct{ server, client any }{
+		{indexer.Session{}, Session{}},
+		{indexer.Message{}, Message{}},
+		{indexer.Attachment{}, Attachment{}},
+		{search.Result{}, SearchHit{}},
+		{search.Response{}, SearchResult{}},
+	}
+	for _, p := range pairs {
+		st, ct := reflect.TypeOf(p.server), reflect.TypeOf(p.client)
+		if got, want := jsonFields(ct), jsonFields(st); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s fields %v, want those of %s: %v", ct.Name(), got, st, want)
+		}
+	}
+}
+
+func TestClientAgainstServer(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "fix the flaky test", "ts": "2024-01-01T09:00:00Z"})
+	idx.IngestForTest("s1", map[string]any{"id": "m2", "session_id": "s1", "role": "assistant", "content": "done", "ts": "2024-01-01T09:01:00Z"})
+	mux := http.NewServeMux()
+	api.AttachRoutes(mux, idx)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	c := New(srv.URL + "/")
+	ctx := context.Background()
+
+	sessions, err := c.Sessions(ctx, SessionsOptions{})
+	if err != nil || len(sessions) != 1 || sessions[0].ID != "s1" || sessions[0].MessageCount != 2 {
+		t.Fatalf("Sessions = %+v, %v", sessions, err)
+	}
+	msgs, err := c.Messages(ctx, "s1", -1)
+	if err != nil || len(msgs) != 2 || msgs[0].ID != "m1" || msgs[1].Content != "done" {
+		t.Fatalf("Messages = %+v, %v", msgs, err)
+	}
+	res, err := c.Search(ctx, "flaky role:user", SearchOptions{Limit: 10, Explain: true})
+	if err != nil || res.Total != 1 || res.Hits[0].MessageID != "m1" || len(res.Explain) == 0 {
+		t.Fatalf("Search = %+v, %v", res, err)
+	}
+	var buf bytes.Buffer
+	if err := c.Export(ctx, "s1", ExportOptions{Format: "md"}, &buf); err != nil || !strings.Contains(buf.String(), "fix the flaky test") {
+		t.Fatalf("Export = %q, %v", buf.String(), err)
+	}
+	err = c.Export(ctx, "nope", ExportOptions{}, &buf)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 404 || apiErr.Message != "session not found" {
+		t.Fatalf("Export of a missing session: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Session is a session as /api/sessions lists it. It mirrors the indexer's
+// Session; see the README for what each field holds.
+type Session struct {
+	ID              string         `json:"id"`
+	Title           string         `json:"title,omitempty"`
+	FirstAt         time.Time      `json:"first_at,omitempty"`
+	LastAt          time.Time      `json:"last_at,omitempty"`
+	ActiveDuration  time.Duration  `json:"active_duration,omitempty"` // ns on the wire
+	FileModAt       time.Time      `json:"file_mod_at,omitempty"`
+	MessageCount    int            `json:"message_count"`
+	TextCount       int            `json:"text_count"`
+	InputTokens     int            `json:"input_tokens"`
+	OutputTokens    int            `json:"output_tokens"`
+	Cost            float64        `json:"cost,omitempty"` // estimated USD
+	UnpricedTokens  int            `json:"unpriced_tokens,omitempty"`
+	CWD             string         `json:"cwd,omitempty"`
+	CWDBase         string         `json:"cwd_base,omitempty"`
+	GitBranch       string         `json:"git_branch,omitempty"`
+	GitRepo         string         `json:"git_repo,omitempty"`
+	GitCommit       string         `json:"git_commit,omitempty"`
+	Models          map[string]int `json:"models,omitempty"`
+	Roles           map[string]int `json:"roles,omitempty"`
+	Tags            []string       `json:"tags,omitempty"`
+	Sources         []string       `json:"sources,omitempty"`
+	Provider        string         `json:"provider,omitempty"` // codex|claude
+	Project         string         `json:"project,omitempty"`
+	Root            string         `json:"root,omitempty"`
+	Paths           []string       `json:"paths,omitempty"`
+	DiskBytes       int64          `json:"disk_bytes,omitempty"`
+	Pinned          bool           `json:"pinned,omitempty"`
+	Color           string         `json:"color,omitempty"`
+	Archived        bool           `json:"archived,omitempty"`
+	Summary         string         `json:"summary,omitempty"`
+	Notes           string         `json:"notes,omitempty"`
+	DirName         string         `json:"dir_name,omitempty"`
+	DirHidden       bool           `json:"dir_hidden,omitempty"`
+	MCPTools        map[string]int `json:"mcp_tools,omitempty"`
+	Languages       map[string]int `json:"languages,omitempty"`
+	ToolCounts      map[string]int `json:"tool_counts,omitempty"`
+	OpenTodos       int            `json:"open_todos,omitempty"`
+	FailureReasons  []string       `json:"failure_reasons,omitempty"`
+	ParentID        string         `json:"parent_id,omitempty"`
+	ChildIDs        []string       `json:"child_ids,omitempty"`
+	ThreadID        string         `json:"thread_id,omitempty"`
+	ParentSessionID string         `json:"parent_session_id,omitempty"`
+	AgentID         string         `json:"agent_id,omitempty"`
+}
+
+// Message is one line of a session as /api/messages returns it.
+type Message struct {
+	ID           string         `json:"id,omitempty"`
+	SessionID    string         `json:"session_id,omitempty"`
+	Ts           time.Time      `json:"ts,omitempty"`
+	Role         string         `json:"role,omitempty"`
+	Content      string         `json:"content,omitempty"`
+	Thinking     string         `json:"thinking,omitempty"`
+	Model        string         `json:"model,omitempty"`
+	Type         string         `json:"type,omitempty"`
+	ToolName     string         `json:"tool_name,omitempty"`
+	ToolKind     string         `json:"tool_kind,omitempty"` // shell|mcp|builtin
+	Raw          map[string]any `json:"raw,omitempty"`       // the log line as read
+	Source       string         `json:"source"`              // file path under its root
+	Provider     string         `json:"provider"`            // codex|claude
+	LineNo       int            `json:"line_no"`
+	RawTruncated bool           `json:"raw_truncated,omitempty"`
+	TokenCount   int            `json:"token_count,omitempty"`
+	TsEstimated  bool           `json:"ts_estimated,omitempty"` // Ts is a neighbour's or the file's mod time
+	Attachments  []Attachment   `json:"attachments,omitempty"`
+}
+
+// Attachment is an image or file found in a message. Cached ones can be
+// fetched with Client.Attachment.
+type Attachment struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"` // image|file
+	MediaType string `json:"media_type,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Cached    bool   `json:"cached,omitempty"`
+}
+
+// SearchHit is one matching message of a search.
+type SearchHit struct {
+	SessionID    string    `json:"session_id"`
+	MessageID    string    `json:"message_id,omitempty"`
+	SessionTitle string    `json:"session_title,omitempty"`
+	Role         string    `json:"role,omitempty"`
+	Type         string    `json:"type,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	Source       string    `json:"source,omitempty"`
+	LineNo       int       `json:"line_no,omitempty"`
+	Ts           time.Time `json:"ts,omitempty"`
+	Field        string    `json:"field,omitempty"` // content|tool_cmd|stdout|stderr
+	Content      string    `json:"content,omitempty"`
+	Marks        []string  `json:"marks,omitempty"`
+}
+
+// SearchResult is a page of search hits.
+type SearchResult struct {
+	TookMS          int                       `json:"took_ms"`
+	Truncated       bool                      `json:"truncated"`
+	Total           int                       `json:"total"`
+	TotalIsEstimate bool                      `json:"total_is_estimate,omitempty"` // Total is a lower bound
+	Hits            []SearchHit               `json:"hits"`
+	Facets          map[string]map[string]int `json:"facets,omitempty"`
+	Explain         json.RawMessage           `json:"explain,omitempty"` // with SearchOptions.Explain
+}
@@ -0,0 +1,142 @@
+package exporter
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"codex-watcher/pkg/indexer"
+)
+
+var (
+	emailRe    = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	homePathRe = regexp.MustCompile(`(/Users/|/home/|[A-Za-z]:\\Users\\)([A-Za-z0-9._\-]+)`)
+	hostnameRe = regexp.MustCompile(`(?i)\b[a-z0-9][a-z0-9\-]*(?:\.[a-z0-9\-]+)*\.(?:local|lan|internal|corp|home|localdomain)\b`)
+	promptRe   = regexp.MustCompile(`\b([a-z_][a-z0-9_\-]*)@([A-Za-z0-9][A-Za-z0-9\-]*)(:[~/])`)
+)
+
+// genericAccounts are login names too common as plain words to replace in prose.
+var genericAccounts = map[string]bool{"root": true, "admin": true, "user": true, "ubuntu": true, "runner": true}
+
+// Anonymizer rewrites usernames, home-directory paths, hostnames, and email
+// addresses to stable placeholders (user1, host1, email1@example.com). The same
+// input value always maps to the same placeholder within one Anonymizer, so a
+// transcript stays readable after anonymization.
+type Anonymizer struct {
+	users  map[string]string
+	hosts  map[string]string
+	emails map[string]string
+	known  map[string]*regexp.Regexp // whole-word matchers for learned names
+}
+
+// NewAnonymizer returns an Anonymizer seeded with the local user and hostname so
+// they are replaced even where they appear without surrounding context.
+func NewAnonymizer() *Anonymizer {
+	a := &Anonymizer{
+		users:  make(map[string]string),
+		hosts:  make(map[string]string),
+		emails: make(map[string]string),
+		known:  make(map[string]*regexp.Regexp),
+	}
+	for _, k := range []string{"USER", "USERNAME"} {
+		if u := strings.TrimSpace(os.Getenv(k)); len(u) >= 3 && !genericAccounts[u] {
+			a.placeholder(a.users, "user", u)
+		}
+	}
+	if h, err := os.Hostname(); err == nil {
+		if h = strings.TrimSpace(h); len(h) >= 3 && h != "localhost" {
+			a.placeholder(a.hosts, "host", h)
+		}
+	}
+	return a
+}
+
+// Apply anonymizes s. A nil Anonymizer returns s unchanged.
+func (a *Anonymizer) Apply(s string) string {
+	if a == nil || s == "" {
+		return s
+	}
+	s = emailRe.ReplaceAllStringFunc(s, func(m string) string {
+		return a.placeholder(a.emails, "email", strings.ToLower(m)) + "@example.com"
+	})
+	s = homePathRe.ReplaceAllStringFunc(s, func(m string) string {
+		sub := homePathRe.FindStringSubmatch(m)
+		return sub[1] + a.placeholder(a.users, "user", sub[2])
+	})
+	s = promptRe.ReplaceAllStringFunc(s, func(m string) string {
+		sub := promptRe.FindStringSubmatch(m)
+		return a.placeholder(a.users, "user", sub[1]) + "@" + a.placeholder(a.hosts, "host", sub[2]) + sub[3]
+	})
+	s = hostnameRe.ReplaceAllStringFunc(s, func(m string) string {
+		return a.placeholder(a.hosts, "host", strings.ToLower(m))
+	})
+	// bare occurrences of names learned above (e.g. "henry" in prose)
+	s = a.replaceKnown(s, a.hosts)
+	s = a.replaceKnown(s, a.users)
+	return s
+}
+
+// Session anonymizes the session fields an export shows or names its file
+// after: title, cwd, cwd base name, directory name, and tags.
+func (a *Anonymizer) Session(s indexer.Session) indexer.Session {
+	if a == nil {
+		return s
+	}
+	// the cwd first, so the user its home path names is known by the time
+	// the title mentions them bare
+	s.CWD = a.Apply(s.CWD)
+	s.CWDBase = a.Apply(s.CWDBase)
+	s.DirName = a.Apply(s.DirName)
+	s.Title = a.Apply(s.Title)
+	if len(s.Tags) > 0 {
+		tags := make([]string, len(s.Tags))
+		for i, t := range s.Tags {
+			tags[i] = a.Apply(t)
+		}
+		s.Tags = tags
+	}
+	return s
+}
+
+func (a *Anonymizer) placeholder(m map[string]string, prefix, value string) string {
+	if p, ok := m[value]; ok {
+		return p
+	}
+	// values already rewritten by an earlier pass keep their placeholder
+	for _, p := range m {
+		if p == value {
+			return p
+		}
+	}
+	p := fmt.Sprintf("%s%d", prefix, len(m)+1)
+	m[value] = p
+	return p
+}
+
+func (a *Anonymizer) replaceKnown(s string, m map[string]string) string {
+	// longest first so "henry-mbp" wins over "henry"
+	values := make([]string, 0, len(m))
+	for value := range m {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+	for _, value := range values {
+		if len(value) < 3 || genericAccounts[value] || !strings.Contains(s, value) {
+			continue
+		}
+		re := a.known[value]
+		if re == nil {
+			re = regexp.MustCompile(`\b` + regexp.QuoteMeta(value) + `\b`)
+			a.known[value] = re
+		}
+		s = re.ReplaceAllString(s, m[value])
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// CalendarOptions tunes WriteCalendar.
+type CalendarOptions struct {
+	Name    string // calendar display name
+	BaseURL string // watcher origin for deep links, e.g. http://localhost:7077
+}
+
+const (
+	icsLineMax     = 75 // octets per content line before folding (RFC 5545 3.1)
+	icsMinDuration = time.Minute
+	icsTimeFormat  = "20060102T150405Z"
+)
+
+// WriteCalendar writes sessions as an iCalendar feed, one event per session
+// from its first to its last message, titled after the session and linking
+// back to it in the watcher. Sessions without timestamps are left out. It
+// returns the number of events written.
+func WriteCalendar(w io.Writer, sessions []indexer.Session, opt CalendarOptions) (int, error) {
+	var b strings.Builder
+	name := opt.Name
+	if name == "" {
+		name = "codex-watcher"
+	}
+	icsLine(&b, "BEGIN:VCALENDAR")
+	icsLine(&b, "VERSION:2.0")
+	icsLine(&b, "PRODID:-//codex-watcher//sessions//EN")
+	icsLine(&b, "CALSCALE:GREGORIAN")
+	icsLine(&b, "X-WR-CALNAME:"+icsText(name))
+	n := 0
+	for _, s := range sessions {
+		if s.FirstAt.IsZero() {
+			continue
+		}
+		end := s.LastAt
+		if end.Sub(s.FirstAt) < icsMinDuration {
+			// zero-length events are hidden by some calendar apps
+			end = s.FirstAt.Add(icsMinDuration)
+		}
+		icsLine(&b, "BEGIN:VEVENT")
+		icsLine(&b, "UID:"+icsText(s.ID)+"@codex-watcher")
+		icsLine(&b, "DTSTAMP:"+s.LastAt.UTC().Format(icsTimeFormat))
+		icsLine(&b, "DTSTART:"+s.FirstAt.UTC().Format(icsTimeFormat))
+		icsLine(&b, "DTEND:"+end.UTC().Format(icsTimeFormat))
+		icsLine(&b, "SUMMARY:"+icsText(indexer.SessionDisplayTitle(s, nil)))
+		desc := []string{fmt.Sprintf("%s · %d messages", s.Provider, s.MessageCount)}
+		if s.CWD != "" {
+			desc = append(desc, s.CWD)
+		}
+		if s.ActiveDuration > 0 {
+			desc = append(desc, "active "+s.ActiveDuration.Round(time.Minute).String())
+		}
+		if opt.BaseURL != "" {
+			link := strings.TrimRight(opt.BaseURL, "/") + "/?session=" + url.QueryEscape(s.ID)
+			icsLine(&b, "URL:"+link)
+			desc = append(desc, link)
+		}
+		icsLine(&b, "DESCRIPTION:"+icsText(strings.Join(desc, "\n")))
+		if s.CWDBase != "" {
+			icsLine(&b, "CATEGORIES:"+icsText(s.CWDBase))
+		}
+		icsLine(&b, "END:VEVENT")
+		n++
+	}
+	icsLine(&b, "END:VCALENDAR")
+	_, err := io.WriteString(w, b.String())
+	return n, err
+}
+
+// icsText escapes a TEXT value.
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// icsLine writes a content line with CRLF, folding it into continuation
+// lines of at most icsLineMax octets without splitting a UTF-8 sequence.
+func icsLine(b *strings.Builder, line string) {
+	limit := icsLineMax
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = icsLineMax - 1 // the leading space counts
+	}
+	b.WriteString(line + "\r\n")
+}
@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// DefaultClipTokens is the budget of WriteClip when neither limit is set.
+const DefaultClipTokens = 4000
+
+// ClipOptions bounds a clipboard export. Both limits apply when set.
+type ClipOptions struct {
+	MaxTokens int // estimated tokens, see EstimateTokens
+	MaxChars  int // characters (runes), including the footer
+	Anonymize bool
+}
+
+// WriteClip writes a plain-text transcript meant to be pasted into a new
+// agent session as context: prompts and replies only (no tool calls, tool
+// output, reasoning, or environment context), the most recent turns that fit
+// the budget, and a one-line provenance footer. It returns the number of
+// messages written.
+func WriteClip(w io.Writer, idx *indexer.Indexer, sessionID string, opt ClipOptions) (int, error) {
+	msgs := indexer.VisibleMessages(idx.Messages(sessionID, 0), 0)
+	SortMessagesForExport(msgs)
+	sess := indexer.Session{ID: sessionID}
+	for _, s := range idx.Sessions() {
+		if s.ID == sessionID {
+			sess = s
+			if view, ok := idx.SessionView(s, msgs); ok {
+				sess = view
+			}
+			break
+		}
+	}
+	var anon *Anonymizer
+	if opt.Anonymize {
+		anon = NewAnonymizer()
+	}
+
+	type clipMsg struct{ role, text string }
+	var kept []clipMsg
+	for _, m := range msgs {
+		role := ""
+		switch indexer.TurnKind(m) {
+		case indexer.TurnPrompt:
+			role = "User"
+		case indexer.TurnAnswer:
+			role = "Assistant"
+		default:
+			continue
+		}
+		if text := strings.TrimSpace(m.Content); text != "" {
+			kept = append(kept, clipMsg{role, anon.Apply(text)})
+		}
+	}
+	total := len(kept)
+
+	tokens := opt.MaxTokens
+	if tokens <= 0 && opt.MaxChars <= 0 {
+		tokens = DefaultClipTokens
+	}
+	if tokens > 0 {
+		kept = trimToTokenBudget(kept, tokens,
+			func(m clipMsg) string { return strings.ToLower(m.role) },
+			func(m clipMsg) string { return m.text })
+	}
+
+	block := func(m clipMsg) string { return m.role + ": " + m.text + "\n\n" }
+	footer := func(n int) string {
+		title := strings.TrimSpace(sess.Title)
+		if title == "" {
+			title = indexer.SessionDisplayTitle(sess, nil)
+		}
+		line := fmt.Sprintf("(Context from %s session %q", sess.Provider, anon.Apply(title))
+		if sess.Provider == "" {
+			line = fmt.Sprintf("(Context from session %q", anon.Apply(title))
+		}
+		if strings.TrimSpace(sess.CWD) != "" {
+			line += " in " + anon.Apply(sess.CWD)
+		}
+		if !sess.FirstAt.IsZero() {
+			line += ", " + sess.FirstAt.Format("2006-01-02")
+			if last := sess.LastAt.Format("2006-01-02"); !sess.LastAt.IsZero() && last != sess.FirstAt.Format("2006-01-02") {
+				line += " to " + last
+			}
+		}
+		if n < total {
+			line += fmt.Sprintf("; last %d of %d messages", n, total)
+		}
+		return line + ", via codex-watcher)\n"
+	}
+
+	if opt.MaxChars > 0 {
+		// Drop the oldest messages until the rest fits; the newest message is
+		// always kept, cut from the front if it alone is too long.
+		size := runeLen(footer(0)) // the longest footer, with a "last n of m" note
+		start := len(kept)
+		for start > 0 {
+			n := runeLen(block(kept[start-1]))
+			if size+n > opt.MaxChars && start < len(kept) {
+				break
+			}
+			size += n
+			start--
+		}
+		kept = kept[start:]
+		// don't open on a reply whose prompt was dropped
+		for len(kept) > 1 && kept[0].role != "User" {
+			size -= runeLen(block(kept[0]))
+			kept = kept[1:]
+		}
+		if len(kept) == 1 && size > opt.MaxChars {
+			r := []rune(kept[0].text)
+			if cut := size - opt.MaxChars + 1; cut < len(r) {
+				kept[0].text = "…" + string(r[cut:])
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, m := range kept {
+		b.WriteString(block(m))
+	}
+	b.WriteString(footer(len(kept)))
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return 0, err
+	}
+	return len(kept), nil
+}
+
+func runeLen(s string) int { return len([]rune(s)) }
@@ -0,0 +1,229 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// DefaultContextPackSessions is how many recent sessions a context pack
+// summarizes when the caller does not say.
+const DefaultContextPackSessions = 5
+
+// ContextPackOptions tunes WriteContextPack.
+type ContextPackOptions struct {
+	Sessions  int // recent sessions to summarize (0 = DefaultContextPackSessions)
+	Anonymize bool
+}
+
+// decisionMarkers flag sentences that record a choice. Matching is
+// case-insensitive and deliberately conservative.
+var decisionMarkers = []string{
+	"decided", "decision:", "we'll go with", "going with", "chose ", "opted",
+	"instead of", "settled on", "let's use", "决定", "改用", "采用", "选择了",
+}
+
+const (
+	packSummaryRunes  = 600
+	packDecisionRunes = 240
+	packMaxDecisions  = 10
+)
+
+// WriteContextPack writes a Markdown brief for resuming work in a directory:
+// the project description, a summary of the latest sessions (last prompt and
+// final answer), their open plan items, and recent decisions. It returns
+// the number of sessions summarized.
+func WriteContextPack(w io.Writer, idx *indexer.Indexer, cwdPrefix string, opt ContextPackOptions) (int, error) {
+	limit := opt.Sessions
+	if limit <= 0 {
+		limit = DefaultContextPackSessions
+	}
+	var anon *Anonymizer
+	if opt.Anonymize {
+		anon = NewAnonymizer()
+	}
+
+	type packSession struct {
+		sess indexer.Session
+		msgs []*indexer.Message
+	}
+	var sel []packSession
+	for _, s := range idx.Sessions() {
+		if cwdPrefix != "" && !strings.HasPrefix(s.CWD, cwdPrefix) {
+			continue
+		}
+		msgs := indexer.VisibleMessages(idx.PeekMessages(s.ID), 0)
+		view, ok := idx.SessionView(s, msgs)
+		if !ok {
+			continue
+		}
+		SortMessagesForExport(msgs)
+		sel = append(sel, packSession{view, msgs})
+	}
+	sort.SliceStable(sel, func(i, j int) bool {
+		if !sel[i].sess.LastAt.Equal(sel[j].sess.LastAt) {
+			return sel[i].sess.LastAt.After(sel[j].sess.LastAt)
+		}
+		return sel[i].sess.ID < sel[j].sess.ID
+	})
+	if len(sel) > limit {
+		sel = sel[:limit]
+	}
+
+	var b strings.Builder
+	name := cwdPrefix
+	dm := idx.DirInfo(cwdPrefix)
+	if dm.Name != "" {
+		name = dm.Name
+	}
+	b.WriteString("# Context pack: " + escapeMD(anon.Apply(name)) + "\n\n")
+	if lines := projectLines(dm, anon); len(lines) > 0 {
+		for i := range lines {
+			lines[i] = escapeMD(lines[i])
+		}
+		b.WriteString(strings.Join(lines, "  \n") + "\n\n")
+	}
+	if cwdPrefix != "" && dm.Name != "" {
+		b.WriteString("CWD: " + escapeMD(anon.Apply(cwdPrefix)) + "\n\n")
+	}
+	if len(sel) == 0 {
+		b.WriteString("_No sessions recorded for this directory._\n")
+		_, err := io.WriteString(w, b.String())
+		return 0, err
+	}
+
+	b.WriteString("## Recent sessions\n\n")
+	for _, ps := range sel {
+		s := ps.sess
+		title := indexer.SessionDisplayTitle(s, nil)
+		fmt.Fprintf(&b, "### %s\n\n", escapeMD(anon.Apply(title)))
+		fmt.Fprintf(&b, "_%s · %s · %d messages_\n\n", s.LastAt.Format("2006-01-02 15:04"), s.Provider, s.MessageCount)
+		var prompt, answer string
+		for _, m := range ps.msgs {
+			switch indexer.TurnKind(m) {
+			case indexer.TurnPrompt:
+				prompt, answer = m.Content, ""
+			case indexer.TurnAnswer:
+				if strings.TrimSpace(m.Content) != "" {
+					answer = m.Content
+				}
+			}
+		}
+		if prompt != "" {
+			b.WriteString("**Last request:** " + clipRunes(anon.Apply(oneLine(prompt)), packSummaryRunes) + "\n\n")
+		}
+		if answer != "" {
+			b.WriteString("**Outcome:** " + clipRunes(anon.Apply(oneLine(answer)), packSummaryRunes) + "\n\n")
+		}
+	}
+
+	var todos []string
+	for _, ps := range sel {
+		for _, t := range idx.Todos(ps.sess.ID) {
+			if t.Open() {
+				item := "- [ ] " + escapeMD(anon.Apply(t.Text))
+				if t.Status == "in_progress" {
+					item += " _(in progress)_"
+				}
+				todos = append(todos, item)
+			}
+		}
+	}
+	if len(todos) > 0 {
+		b.WriteString("## Open TODOs\n\n" + strings.Join(todos, "\n") + "\n\n")
+	}
+
+	var decisions []string
+	seen := make(map[string]bool)
+	for _, ps := range sel {
+		for i := len(ps.msgs) - 1; i >= 0 && len(decisions) < packMaxDecisions; i-- {
+			switch indexer.TurnKind(ps.msgs[i]) {
+			case indexer.TurnPrompt, indexer.TurnAnswer:
+			default:
+				continue
+			}
+			for _, d := range decisionSentences(ps.msgs[i].Content) {
+				if key := strings.ToLower(d); !seen[key] && len(decisions) < packMaxDecisions {
+					seen[key] = true
+					decisions = append(decisions, d)
+				}
+			}
+		}
+	}
+	if len(decisions) > 0 {
+		b.WriteString("## Recent decisions\n\n")
+		for _, d := range decisions {
+			b.WriteString("- " + escapeMD(anon.Apply(d)) + "\n")
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return len(sel), err
+}
+
+// decisionSentences returns the sentences of text containing a decision
+// marker, one line each. Code blocks are skipped.
+func decisionSentences(text string) []string {
+	var out []string
+	inFence := false
+	for _, line := range strings.Split(text, "\n") {
+		if t := strings.TrimSpace(line); strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		for _, sent := range splitSentences(line) {
+			lower := strings.ToLower(sent)
+			for _, mk := range decisionMarkers {
+				if strings.Contains(lower, mk) {
+					out = append(out, clipRunes(strings.TrimLeft(sent, "-*# "), packDecisionRunes))
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+// splitSentences breaks a line after ". ", "! ", "? ", and CJK full stops.
+func splitSentences(line string) []string {
+	var out []string
+	start := 0
+	rs := []rune(line)
+	for i, r := range rs {
+		end := false
+		switch r {
+		case '。', '！', '？':
+			end = true
+		case '.', '!', '?':
+			end = i+1 == len(rs) || rs[i+1] == ' '
+		}
+		if end {
+			if s := strings.TrimSpace(string(rs[start : i+1])); s != "" {
+				out = append(out, s)
+			}
+			start = i + 1
+		}
+	}
+	if s := strings.TrimSpace(string(rs[start:])); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// oneLine collapses whitespace runs, newlines included, to single spaces.
+func oneLine(s string) string { return strings.Join(strings.Fields(s), " ") }
+
+// clipRunes cuts s to at most n runes, marking the cut with an ellipsis.
+func clipRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
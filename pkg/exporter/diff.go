@@ -0,0 +1,221 @@
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ExportDoc is the comparable outline of an export file: for each session,
+// the keys of its messages in order. Message keys are message IDs when the
+// export has them (json/jsonl), otherwise a hash of role and text.
+type ExportDoc struct {
+	Sessions map[string][]string
+	Titles   map[string]string // session key -> title, for reports
+	order    []string
+}
+
+// SessionDiff counts message changes in a session present in both exports.
+type SessionDiff struct {
+	Session string `json:"session"`
+	Title   string `json:"title,omitempty"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+}
+
+// ExportDiff reports what changed between two exports of the same data.
+type ExportDiff struct {
+	AddedSessions   []SessionDiff `json:"added_sessions"`   // Added = message count
+	RemovedSessions []SessionDiff `json:"removed_sessions"` // Removed = message count
+	ChangedSessions []SessionDiff `json:"changed_sessions"`
+	AddedMessages   int           `json:"added_messages"`
+	RemovedMessages int           `json:"removed_messages"`
+}
+
+// ParseExport reads a session or directory export in any format this
+// package writes: a JSON array, JSONL, or Markdown. Markdown sessions are
+// keyed by their heading, so a renamed session shows up as removed + added.
+func ParseExport(r io.Reader) (ExportDoc, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ExportDoc{}, err
+	}
+	doc := ExportDoc{Sessions: make(map[string][]string), Titles: make(map[string]string)}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) == 0:
+		return doc, nil
+	case trimmed[0] == '[':
+		var msgs []map[string]any
+		if err := json.Unmarshal(trimmed, &msgs); err != nil {
+			return doc, fmt.Errorf("parse JSON export: %w", err)
+		}
+		for _, m := range msgs {
+			doc.addJSON(m)
+		}
+	case trimmed[0] == '{':
+		sc := bufio.NewScanner(bytes.NewReader(trimmed))
+		sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for sc.Scan() {
+			line := bytes.TrimSpace(sc.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var m map[string]any
+			if err := json.Unmarshal(line, &m); err != nil {
+				return doc, fmt.Errorf("parse JSONL export: %w", err)
+			}
+			doc.addJSON(m)
+		}
+		if err := sc.Err(); err != nil {
+			return doc, err
+		}
+	default:
+		doc.parseMarkdown(string(data))
+	}
+	return doc, nil
+}
+
+func (d *ExportDoc) add(session, title, key string) {
+	if _, ok := d.Sessions[session]; !ok {
+		d.order = append(d.order, session)
+		d.Titles[session] = title
+	}
+	d.Sessions[session] = append(d.Sessions[session], key)
+}
+
+func (d *ExportDoc) addJSON(m map[string]any) {
+	sid, _ := m["session_id"].(string)
+	key, _ := m["id"].(string)
+	if key == "" {
+		role, _ := m["role"].(string)
+		content, _ := m["content"].(string)
+		key = contentKey(role, content)
+	}
+	d.add(sid, sid, key)
+}
+
+// parseMarkdown splits on session headings (the "# " title of a session
+// export, "## " under a "# Export for" directory header) and upper-case
+// "### ROLE" message headings, ignoring anything inside code fences. This is
+// a heuristic; JSON and JSONL exports diff exactly.
+func (d *ExportDoc) parseMarkdown(s string) {
+	lines := strings.Split(s, "\n")
+	sessionLevel := "# "
+	for _, l := range lines {
+		if strings.HasPrefix(l, "# Export for ") {
+			sessionLevel = "## "
+			break
+		}
+	}
+	var session, role string
+	var body []string
+	inFence := false
+	flush := func() {
+		if session != "" && role != "" {
+			d.add(session, session, contentKey(role, strings.TrimSpace(strings.Join(body, "\n"))))
+		}
+		role, body = "", nil
+	}
+	for _, l := range lines {
+		if t := strings.TrimSpace(l); strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			inFence = !inFence
+		}
+		if !inFence {
+			heading := strings.TrimSpace(strings.TrimPrefix(l, "### "))
+			switch {
+			case strings.HasPrefix(l, sessionLevel) && (sessionLevel == "## " || session == ""):
+				flush()
+				session = strings.TrimSpace(strings.TrimPrefix(l, sessionLevel))
+				continue
+			case strings.HasPrefix(l, "### ") && heading != "" && heading == strings.ToUpper(heading):
+				flush()
+				role = heading
+				continue
+			}
+		}
+		if role != "" {
+			body = append(body, l)
+		}
+	}
+	flush()
+}
+
+func contentKey(role, content string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(role) + "\n" + content))
+	return hex.EncodeToString(sum[:10])
+}
+
+// DiffExports compares two parsed exports. Messages are matched by key as a
+// multiset, so reordering alone is not reported.
+func DiffExports(old, cur ExportDoc) ExportDiff {
+	var d ExportDiff
+	for _, s := range cur.order {
+		msgs := cur.Sessions[s]
+		prev, ok := old.Sessions[s]
+		if !ok {
+			d.AddedSessions = append(d.AddedSessions, SessionDiff{Session: s, Title: cur.Titles[s], Added: len(msgs)})
+			d.AddedMessages += len(msgs)
+			continue
+		}
+		counts := make(map[string]int, len(prev))
+		for _, k := range prev {
+			counts[k]++
+		}
+		added := 0
+		for _, k := range msgs {
+			if counts[k] > 0 {
+				counts[k]--
+			} else {
+				added++
+			}
+		}
+		removed := 0
+		for _, n := range counts {
+			removed += n
+		}
+		if added > 0 || removed > 0 {
+			d.ChangedSessions = append(d.ChangedSessions, SessionDiff{Session: s, Title: cur.Titles[s], Added: added, Removed: removed})
+			d.AddedMessages += added
+			d.RemovedMessages += removed
+		}
+	}
+	for _, s := range old.order {
+		if _, ok := cur.Sessions[s]; !ok {
+			n := len(old.Sessions[s])
+			d.RemovedSessions = append(d.RemovedSessions, SessionDiff{Session: s, Title: old.Titles[s], Removed: n})
+			d.RemovedMessages += n
+		}
+	}
+	sort.SliceStable(d.ChangedSessions, func(i, j int) bool { return d.ChangedSessions[i].Added > d.ChangedSessions[j].Added })
+	return d
+}
+
+// WriteDiffReport prints d as a short text summary or as JSON.
+func WriteDiffReport(w io.Writer, d ExportDiff, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d new sessions, %d changed, %d removed; +%d/-%d messages\n",
+		len(d.AddedSessions), len(d.ChangedSessions), len(d.RemovedSessions), d.AddedMessages, d.RemovedMessages)
+	for _, s := range d.AddedSessions {
+		fmt.Fprintf(&b, "+ %s (%d messages)\n", s.Title, s.Added)
+	}
+	for _, s := range d.ChangedSessions {
+		fmt.Fprintf(&b, "~ %s (+%d/-%d)\n", s.Title, s.Added, s.Removed)
+	}
+	for _, s := range d.RemovedSessions {
+		fmt.Fprintf(&b, "- %s (%d messages)\n", s.Title, s.Removed)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
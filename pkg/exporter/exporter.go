@@ -1,15 +1,21 @@
+// Package exporter renders the sessions of an indexer.Indexer as
+// Markdown, plain text, JSON, or JSONL, and the derived formats (journals,
+// context packs, flashcards, static sites) the daemon offers:
+//
+//	n, err := exporter.WriteSession(w, idx, sessionID, "md", exporter.Filters{})
 package exporter
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/url"
-	"sort"
 	"strings"
 	"time"
 
-	"codex-watcher/internal/indexer"
+	"codex-watcher/pkg/indexer"
 )
 
 // Filters control which messages are included in an export.
@@ -23,11 +29,55 @@ type Filters struct {
 	// Export policy toggles
 	ExcludeShellCalls  bool // drop Tool: shell invocations
 	ExcludeToolOutputs bool // drop all function_call_output
+	// Anonymize rewrites usernames, home paths, hostnames, and emails to stable placeholders
+	Anonymize bool
+	// MaxTokens keeps only the most recent turns whose estimated size fits the
+	// budget (0 = no limit), for pasting as context into another model.
+	MaxTokens int
+	// Turns limits a session export to these turns (empty = all).
+	Turns TurnRanges
+	// Meta prepends a metadata block (provider, models, dates, duration,
+	// counts, tags, sources) to md/txt exports.
+	Meta bool
+	// Todos appends the session's latest plan (TodoWrite/update_plan items)
+	// to md/txt exports.
+	Todos bool
+	// References appends the session's web search results, fetched pages,
+	// and citations as a link list to Markdown exports.
+	References bool
+	// Stats appends a footer summarizing the exported messages (counts by
+	// role, tool calls, duration, estimated tokens) to md/txt exports and
+	// site pages.
+	Stats bool
+	// Incremental is set for since_last directory exports: untimestamped
+	// messages take the time of the message before them, and sessions with
+	// nothing in the date window are left out, so appending successive
+	// exports to a journal repeats nothing.
+	Incremental bool
 }
 
-// WriteSession writes a single session export to w in the given format.
-// Supported formats: jsonl, json, md, txt.
-func WriteSession(w io.Writer, idx *indexer.Indexer, sessionID string, format string, f Filters) (int, error) {
+// ExportMessage is one message as a session export writes it.
+type ExportMessage struct {
+	ID        string    `json:"id,omitempty"`
+	SessionID string    `json:"session_id"`
+	Ts        time.Time `json:"ts,omitempty"`
+	Role      string    `json:"role,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	Content   string    `json:"content,omitempty"`
+	ToolName  string    `json:"tool_name,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	LineNo    int       `json:"line_no,omitempty"`
+	ExportSeq int       `json:"export_seq"`
+
+	tools []string // tools the message calls, for the stats footer
+}
+
+// selectSessionMessages applies f to a session's messages the way
+// WriteSession does, returning the (possibly anonymized) session, its real
+// cwd, the anonymizer, the messages to write, and how many earlier ones the
+// token budget dropped.
+func selectSessionMessages(idx *indexer.Indexer, sessionID string, f Filters) (indexer.Session, string, *Anonymizer, []ExportMessage, int) {
 	msgs := indexer.VisibleMessages(idx.Messages(sessionID, 0), 0)
 	// Obtain session metadata for title/cwd
 	var sess indexer.Session
@@ -37,25 +87,28 @@ func WriteSession(w io.Writer, idx *indexer.Indexer, sessionID string, format st
 			break
 		}
 	}
-	if view, ok := indexer.SessionView(sess, msgs); ok {
+	if view, ok := idx.SessionView(sess, msgs); ok {
 		sess = view
 	} else {
 		sess.Title = indexer.SessionDisplayTitle(sess, nil)
 	}
+	cwd := sess.CWD
+	var anon *Anonymizer
+	if f.Anonymize {
+		anon = NewAnonymizer()
+		sess = anon.Session(sess)
+	}
+
+	SortMessagesForExport(msgs)
+	// export_seq numbers messages in that order before any filtering, so a
+	// message keeps its number across exports with different options.
+	seq := make(map[*indexer.Message]int, len(msgs))
+	for i, m := range msgs {
+		seq[m] = i + 1
+	}
+	msgs = selectTurns(msgs, f.Turns)
 
 	// Filter and normalize
-	type outMsg struct {
-		ID        string    `json:"id,omitempty"`
-		SessionID string    `json:"session_id"`
-		Ts        time.Time `json:"ts,omitempty"`
-		Role      string    `json:"role,omitempty"`
-		Type      string    `json:"type,omitempty"`
-		Model     string    `json:"model,omitempty"`
-		Content   string    `json:"content,omitempty"`
-		ToolName  string    `json:"tool_name,omitempty"`
-		Source    string    `json:"source,omitempty"`
-		LineNo    int       `json:"line_no,omitempty"`
-	}
 
 	allowedRole := func(r string) bool {
 		if len(f.IncludeRoles) == 0 {
@@ -100,7 +153,7 @@ func WriteSession(w io.Writer, idx *indexer.Indexer, sessionID string, format st
 		return true
 	}
 
-	filtered := make([]outMsg, 0, len(msgs))
+	filtered := make([]ExportMessage, 0, len(msgs))
 	for _, m := range msgs {
 		if !inDate(m.Ts) {
 			continue
@@ -135,17 +188,21 @@ func WriteSession(w io.Writer, idx *indexer.Indexer, sessionID string, format st
 				continue
 			}
 		}
-		om := outMsg{
+		om := ExportMessage{
 			ID:        m.ID,
 			SessionID: m.SessionID,
 			Ts:        m.Ts,
 			Role:      m.Role,
 			Type:      normalizeType(m.Type),
 			Model:     m.Model,
-			Content:   m.Content,
-			ToolName:  m.ToolName,
-			Source:    m.Source,
+			Content:   anon.Apply(m.Content),
+			ToolName:  anon.Apply(m.ToolName),
+			Source:    anon.Apply(m.Source),
 			LineNo:    m.LineNo,
+			ExportSeq: seq[m],
+		}
+		if f.Stats {
+			om.tools = indexer.ToolCallNames(m)
 		}
 		filtered = append(filtered, om)
 		if f.MaxMessages > 0 && len(filtered) >= f.MaxMessages {
@@ -153,16 +210,28 @@ func WriteSession(w io.Writer, idx *indexer.Indexer, sessionID string, format st
 		}
 	}
 
-	// Order by timestamp asc (older first), fallback to line number
-	sort.SliceStable(filtered, func(i, j int) bool {
-		if !filtered[i].Ts.Equal(filtered[j].Ts) {
-			return filtered[i].Ts.Before(filtered[j].Ts)
-		}
-		if filtered[i].Source != filtered[j].Source {
-			return filtered[i].Source < filtered[j].Source
+	omitted := 0
+	if f.MaxTokens > 0 {
+		kept := trimToTokenBudget(filtered, f.MaxTokens,
+			func(m ExportMessage) string { return strings.ToLower(strings.TrimSpace(m.Role)) },
+			func(m ExportMessage) string { return m.Content })
+		omitted = len(filtered) - len(kept)
+		filtered = kept
+	}
+	return sess, cwd, anon, filtered, omitted
+}
+
+// WriteSession writes a single session export to w in the given format.
+// Supported formats: jsonl, json, md, txt.
+func WriteSession(w io.Writer, idx *indexer.Indexer, sessionID string, format string, f Filters) (int, error) {
+	sess, cwd, anon, filtered, omitted := selectSessionMessages(idx, sessionID, f)
+	exportTokens := func(ms []ExportMessage) int {
+		texts := make([]string, len(ms))
+		for i, m := range ms {
+			texts[i] = m.Content
 		}
-		return filtered[i].LineNo < filtered[j].LineNo
-	})
+		return estimateExportTokens(texts)
+	}
 
 	switch strings.ToLower(format) {
 	case "jsonl":
@@ -206,11 +275,41 @@ func WriteSession(w io.Writer, idx *indexer.Indexer, sessionID string, format st
 		if _, err := io.WriteString(w, "# "+escapeMD(title)+"\n\n"); err != nil {
 			return 0, err
 		}
+		if f.Meta {
+			var b strings.Builder
+			writeMetaMD(&b, metaFields(sess, len(filtered), exportTokens(filtered), anon))
+			if _, err := io.WriteString(w, b.String()); err != nil {
+				return 0, err
+			}
+		}
 		if strings.TrimSpace(sess.CWD) != "" {
 			if _, err := io.WriteString(w, "CWD: "+escapeMD(sess.CWD)+"\n\n"); err != nil {
 				return 0, err
 			}
 		}
+		if lines := projectLines(idx.DirInfo(cwd), anon); len(lines) > 0 {
+			for i := range lines {
+				lines[i] = escapeMD(lines[i])
+			}
+			if _, err := io.WriteString(w, strings.Join(lines, "  \n")+"\n\n"); err != nil {
+				return 0, err
+			}
+		}
+		if sess.ActiveDuration > 0 {
+			if _, err := io.WriteString(w, "Active: "+FormatActive(sess.ActiveDuration)+"\n\n"); err != nil {
+				return 0, err
+			}
+		}
+		if len(f.Turns) > 0 {
+			if _, err := fmt.Fprintf(w, "_Turns %s only._\n\n", f.Turns); err != nil {
+				return 0, err
+			}
+		}
+		if omitted > 0 {
+			if _, err := fmt.Fprintf(w, "_%d earlier messages omitted to fit ~%d tokens._\n\n", omitted, f.MaxTokens); err != nil {
+				return 0, err
+			}
+		}
 		for _, m := range filtered {
 			role := strings.ToUpper(strings.TrimSpace(m.Role))
 			if role == "" {
@@ -229,6 +328,28 @@ func WriteSession(w io.Writer, idx *indexer.Indexer, sessionID string, format st
 				}
 			}
 		}
+		if links := idx.Links(sessionID); f.References && len(links) > 0 {
+			var b strings.Builder
+			writeReferencesMD(&b, "## References", links, anon)
+			if _, err := io.WriteString(w, b.String()); err != nil {
+				return 0, err
+			}
+		}
+		if todos := idx.Todos(sessionID); f.Todos && len(todos) > 0 {
+			var b strings.Builder
+			writeTodosMD(&b, "## TODOs", todos, anon)
+			if _, err := io.WriteString(w, b.String()); err != nil {
+				return 0, err
+			}
+		}
+		if f.Stats {
+			var b strings.Builder
+			b.WriteString("## Stats\n\n")
+			writeMetaMD(&b, statsFields(filtered))
+			if _, err := io.WriteString(w, b.String()); err != nil {
+				return 0, err
+			}
+		}
 		return len(filtered), nil
 	case "txt":
 		title := sess.Title
@@ -238,11 +359,39 @@ func WriteSession(w io.Writer, idx *indexer.Indexer, sessionID string, format st
 		if _, err := io.WriteString(w, title+"\n"); err != nil {
 			return 0, err
 		}
+		if f.Meta {
+			var b strings.Builder
+			b.WriteString("\n")
+			writeMetaText(&b, metaFields(sess, len(filtered), exportTokens(filtered), anon))
+			if _, err := io.WriteString(w, b.String()); err != nil {
+				return 0, err
+			}
+		}
 		if strings.TrimSpace(sess.CWD) != "" {
 			if _, err := io.WriteString(w, "CWD: "+sess.CWD+"\n\n"); err != nil {
 				return 0, err
 			}
 		}
+		if lines := projectLines(idx.DirInfo(cwd), anon); len(lines) > 0 {
+			if _, err := io.WriteString(w, strings.Join(lines, "\n")+"\n\n"); err != nil {
+				return 0, err
+			}
+		}
+		if sess.ActiveDuration > 0 {
+			if _, err := io.WriteString(w, "Active: "+FormatActive(sess.ActiveDuration)+"\n\n"); err != nil {
+				return 0, err
+			}
+		}
+		if len(f.Turns) > 0 {
+			if _, err := fmt.Fprintf(w, "(turns %s only)\n\n", f.Turns); err != nil {
+				return 0, err
+			}
+		}
+		if omitted > 0 {
+			if _, err := fmt.Fprintf(w, "(%d earlier messages omitted to fit ~%d tokens)\n\n", omitted, f.MaxTokens); err != nil {
+				return 0, err
+			}
+		}
 		for _, m := range filtered {
 			role := strings.ToUpper(strings.TrimSpace(m.Role))
 			if role == "" {
@@ -260,6 +409,21 @@ func WriteSession(w io.Writer, idx *indexer.Indexer, sessionID string, format st
 				}
 			}
 		}
+		if todos := idx.Todos(sessionID); f.Todos && len(todos) > 0 {
+			var b strings.Builder
+			writeTodosText(&b, todos, anon)
+			if _, err := io.WriteString(w, b.String()); err != nil {
+				return 0, err
+			}
+		}
+		if f.Stats {
+			var b strings.Builder
+			b.WriteString("== STATS ==\n")
+			writeMetaText(&b, statsFields(filtered))
+			if _, err := io.WriteString(w, b.String()); err != nil {
+				return 0, err
+			}
+		}
 		return len(filtered), nil
 	default:
 		return 0, fmt.Errorf("unsupported format: %s", format)
@@ -273,8 +437,10 @@ func escapeMD(s string) string {
 	return r
 }
 
-// BuildAttachmentName builds a filename for Content-Disposition.
-func BuildAttachmentName(sess indexer.Session, format string) string {
+// BuildAttachmentName builds a filename for Content-Disposition. A non-empty
+// variant (see ExportVariant) is appended so exports of one session with
+// different options do not overwrite each other in a download folder.
+func BuildAttachmentName(sess indexer.Session, format, variant string) string {
 	base := strings.TrimSpace(sess.CWDBase)
 	if base == "" {
 		base = "session"
@@ -284,12 +450,13 @@ func BuildAttachmentName(sess indexer.Session, format string) string {
 		t = time.Now()
 	}
 	ts := t.UTC().Format("20060102_1504")
-	name := fmt.Sprintf("%s__%s__%s.%s", sanitize(base), sanitize(shorten(sess.Title, 40)), ts, strings.ToLower(format))
+	name := fmt.Sprintf("%s__%s__%s%s.%s", sanitize(base), sanitize(shorten(sess.Title, 40)), ts, variantSuffix(variant), strings.ToLower(format))
 	return url.PathEscape(name)
 }
 
-// BuildDirAttachmentName produces a filename for directory exports.
-func BuildDirAttachmentName(cwd string, mode string, format string) string {
+// BuildDirAttachmentName produces a filename for directory exports; variant
+// works as in BuildAttachmentName.
+func BuildDirAttachmentName(cwd string, mode string, format string, variant string) string {
 	base := strings.TrimSpace(cwd)
 	if base == "" {
 		base = "export"
@@ -299,10 +466,51 @@ func BuildDirAttachmentName(cwd string, mode string, format string) string {
 		base = base[i+1:]
 	}
 	ts := time.Now().UTC().Format("20060102_1504")
-	name := fmt.Sprintf("%s__%s__%s.%s", sanitize(base), sanitize(mode), ts, strings.ToLower(format))
+	name := fmt.Sprintf("%s__%s__%s%s.%s", sanitize(base), sanitize(mode), ts, variantSuffix(variant), strings.ToLower(format))
 	return url.PathEscape(name)
 }
 
+// ExportVariant hashes the options that shape an export's content into a
+// short suffix for its file name, so two exports made in the same minute
+// share a name only when they would have the same content.
+func ExportVariant(parts ...string) string {
+	h := sha1.Sum([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(h[:3])
+}
+
+func variantSuffix(variant string) string {
+	if variant == "" {
+		return ""
+	}
+	return "__" + sanitize(variant)
+}
+
+// AttachmentFilename turns a caller-chosen download name into a safe one:
+// directories are dropped, reserved characters become _, and the format's
+// extension is added when missing. It returns "" when nothing usable is
+// left.
+func AttachmentFilename(name, format string) string {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndexAny(name, "/\\"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		return ""
+	}
+	ext := "." + strings.ToLower(format)
+	if !strings.HasSuffix(strings.ToLower(name), ext) {
+		name += ext
+	}
+	return url.PathEscape(sanitize(name))
+}
+
 // WriteByDirFlat writes a flattened export for a single directory (cwd prefix).
 // Modes:
 // - user: array of strings (user texts)
@@ -315,27 +523,14 @@ func WriteByDirFlat(w io.Writer, idx *indexer.Indexer, cwdPrefix string, mode st
 	sel := make([]indexer.Session, 0)
 	for _, s := range sessions {
 		if cwdPrefix == "" || strings.HasPrefix(s.CWD, cwdPrefix) {
-			visibleMsgs := indexer.VisibleMessages(idx.Messages(s.ID, 0), 0)
-			if view, ok := indexer.SessionView(s, visibleMsgs); ok {
+			visibleMsgs := indexer.VisibleMessages(idx.PeekMessages(s.ID), 0)
+			if view, ok := idx.SessionView(s, visibleMsgs); ok {
 				sel = append(sel, view)
 			}
 		}
 	}
 	// Sort sessions by FirstAt asc (old -> new)
-	sort.SliceStable(sel, func(i, j int) bool {
-		ai := sel[i].FirstAt
-		aj := sel[j].FirstAt
-		if ai.IsZero() && aj.IsZero() {
-			return sel[i].ID < sel[j].ID
-		}
-		if ai.IsZero() {
-			return true
-		}
-		if aj.IsZero() {
-			return false
-		}
-		return ai.Before(aj)
-	})
+	sortSessionsForExport(sel)
 
 	// Helper filters
 	inDate := func(ts time.Time) bool {
@@ -362,19 +557,7 @@ func WriteByDirFlat(w io.Writer, idx *indexer.Indexer, cwdPrefix string, mode st
 	includeThinking := strings.ToLower(mode) == "dialog_with_thinking"
 
 	for _, s := range sel {
-		msgs := indexer.VisibleMessages(idx.Messages(s.ID, 0), 0)
-		// Sort messages by ts asc
-		sort.SliceStable(msgs, func(i, j int) bool {
-			ti := msgs[i].Ts
-			tj := msgs[j].Ts
-			if !ti.Equal(tj) {
-				return ti.Before(tj)
-			}
-			if msgs[i].Source != msgs[j].Source {
-				return msgs[i].Source < msgs[j].Source
-			}
-			return msgs[i].LineNo < msgs[j].LineNo
-		})
+		msgs := indexer.VisibleMessages(idx.PeekMessages(s.ID), 0)
 		for _, m := range msgs {
 			if !inDate(m.Ts) {
 				continue
@@ -496,26 +679,13 @@ func WriteByDirAllMarkdown(w io.Writer, idx *indexer.Indexer, cwdPrefix string,
 	sel := make([]indexer.Session, 0)
 	for _, s := range sessions {
 		if cwdPrefix == "" || strings.HasPrefix(s.CWD, cwdPrefix) {
-			visibleMsgs := indexer.VisibleMessages(idx.Messages(s.ID, 0), 0)
-			if view, ok := indexer.SessionView(s, visibleMsgs); ok {
+			visibleMsgs := indexer.VisibleMessages(idx.PeekMessages(s.ID), 0)
+			if view, ok := idx.SessionView(s, visibleMsgs); ok {
 				sel = append(sel, view)
 			}
 		}
 	}
-	sort.SliceStable(sel, func(i, j int) bool {
-		ai := sel[i].FirstAt
-		aj := sel[j].FirstAt
-		if ai.IsZero() && aj.IsZero() {
-			return sel[i].ID < sel[j].ID
-		}
-		if ai.IsZero() {
-			return true
-		}
-		if aj.IsZero() {
-			return false
-		}
-		return ai.Before(aj)
-	})
+	sortSessionsForExport(sel)
 	inDate := func(ts time.Time) bool {
 		if ts.IsZero() {
 			return true
@@ -528,42 +698,58 @@ func WriteByDirAllMarkdown(w io.Writer, idx *indexer.Indexer, cwdPrefix string,
 		}
 		return true
 	}
+	var anon *Anonymizer
+	if f.Anonymize {
+		anon = NewAnonymizer()
+	}
 	count := 0
 	// Optional overall header
 	if cwdPrefix != "" {
-		_, _ = io.WriteString(w, "# Export for "+cwdPrefix+"\n\n")
+		_, _ = io.WriteString(w, "# Export for "+anon.Apply(cwdPrefix)+"\n\n")
+		if lines := projectLines(idx.DirInfo(cwdPrefix), anon); len(lines) > 0 {
+			for i := range lines {
+				lines[i] = escapeMD(lines[i])
+			}
+			_, _ = io.WriteString(w, strings.Join(lines, "  \n")+"\n\n")
+		}
 	}
 	for _, s := range sel {
 		title := s.Title
 		if strings.TrimSpace(title) == "" {
 			title = s.ID
 		}
-		msgs := indexer.VisibleMessages(idx.Messages(s.ID, 0), 0)
+		title = anon.Apply(title)
+		msgs := indexer.VisibleMessages(idx.PeekMessages(s.ID), 0)
+		SortMessagesForExport(msgs)
+		if f.Incremental {
+			msgs = inheritTimestamps(msgs, inDate)
+		}
 		if len(msgs) == 0 {
 			continue
 		}
 		_, _ = io.WriteString(w, "## "+escapeMD(title)+"\n\n")
+		if f.Meta {
+			view, _ := idx.SessionView(s, msgs)
+			texts := make([]string, len(msgs))
+			for i, m := range msgs {
+				texts[i] = m.Content
+			}
+			var b strings.Builder
+			writeMetaMD(&b, metaFields(view, -1, estimateExportTokens(texts), anon))
+			_, _ = io.WriteString(w, b.String())
+		}
 		if strings.TrimSpace(s.CWD) != "" {
-			_, _ = io.WriteString(w, "CWD: "+escapeMD(s.CWD)+"\n\n")
+			_, _ = io.WriteString(w, "CWD: "+escapeMD(anon.Apply(s.CWD))+"\n\n")
 		}
-		sort.SliceStable(msgs, func(i, j int) bool {
-			ti := msgs[i].Ts
-			tj := msgs[j].Ts
-			if !ti.Equal(tj) {
-				return ti.Before(tj)
-			}
-			if msgs[i].Source != msgs[j].Source {
-				return msgs[i].Source < msgs[j].Source
-			}
-			return msgs[i].LineNo < msgs[j].LineNo
-		})
+		SortMessagesForExport(msgs)
+		var exported []ExportMessage
 		for _, m := range msgs {
 			if !inDate(m.Ts) {
 				continue
 			}
 			typ := strings.ToLower(strings.TrimSpace(m.Type))
 			role := strings.ToLower(strings.TrimSpace(m.Role))
-			text := strings.TrimSpace(m.Content)
+			text := anon.Apply(strings.TrimSpace(m.Content))
 			// Export policy controlled by filters
 			if f.ExcludeToolOutputs && typ == "function_call_output" {
 				continue
@@ -579,11 +765,15 @@ func WriteByDirAllMarkdown(w io.Writer, idx *indexer.Indexer, cwdPrefix string,
 					continue
 				}
 			}
+			if f.Stats {
+				exported = append(exported, ExportMessage{Ts: m.Ts, Role: m.Role, Type: typ, Content: m.Content, tools: indexer.ToolCallNames(m)})
+			}
 			switch typ {
 			case "function_call":
 				_, _ = io.WriteString(w, "### TOOLS\n\n")
 				// name / command / arguments
 				cmdLine, argsDump := parseFuncCall(m)
+				cmdLine, argsDump = anon.Apply(cmdLine), anon.Apply(argsDump)
 				if cmdLine != "" {
 					_, _ = io.WriteString(w, "~~~bash\n$ "+cmdLine+"\n~~~\n\n")
 				} else if argsDump != "" {
@@ -594,6 +784,7 @@ func WriteByDirAllMarkdown(w io.Writer, idx *indexer.Indexer, cwdPrefix string,
 			case "function_call_output":
 				_, _ = io.WriteString(w, "### TOOLS OUTPUT\n\n")
 				out, errText := parseFuncOutput(m)
+				out, errText = anon.Apply(out), anon.Apply(errText)
 				if out != "" {
 					_, _ = io.WriteString(w, "~~~\n"+out+"\n~~~\n\n")
 					count++
@@ -608,6 +799,12 @@ func WriteByDirAllMarkdown(w io.Writer, idx *indexer.Indexer, cwdPrefix string,
 					count++
 				}
 				continue
+			case indexer.NoteType:
+				if text != "" {
+					_, _ = io.WriteString(w, "### NOTE\n\n"+text+"\n\n")
+					count++
+				}
+				continue
 			}
 			// Normal messages by role
 			if role == "user" {
@@ -625,10 +822,46 @@ func WriteByDirAllMarkdown(w io.Writer, idx *indexer.Indexer, cwdPrefix string,
 				continue
 			}
 		}
+		if links := idx.Links(s.ID); f.References && len(links) > 0 {
+			var b strings.Builder
+			writeReferencesMD(&b, "### References", links, anon)
+			_, _ = io.WriteString(w, b.String())
+		}
+		if todos := idx.Todos(s.ID); f.Todos && len(todos) > 0 {
+			var b strings.Builder
+			writeTodosMD(&b, "### TODOs", todos, anon)
+			_, _ = io.WriteString(w, b.String())
+		}
+		if f.Stats && len(exported) > 0 {
+			var b strings.Builder
+			b.WriteString("### Stats\n\n")
+			writeMetaMD(&b, statsFields(exported))
+			_, _ = io.WriteString(w, b.String())
+		}
 	}
 	return count, nil
 }
 
+// inheritTimestamps keeps the messages of an export-ordered slice that fall
+// in the date window, dating each untimestamped message by the one before it
+// (or dropping it when none is dated yet).
+func inheritTimestamps(msgs []*indexer.Message, inDate func(time.Time) bool) []*indexer.Message {
+	out := msgs[:0:0]
+	var last time.Time
+	for _, m := range msgs {
+		ts := m.Ts
+		if ts.IsZero() {
+			ts = last
+		} else {
+			last = ts
+		}
+		if !ts.IsZero() && inDate(ts) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
 func parseFuncCall(m *indexer.Message) (cmdLine string, argsDump string) {
 	if m == nil || m.Raw == nil {
 		return "", ""
@@ -736,3 +969,28 @@ func shorten(s string, n int) string {
 	}
 	return s[:n-1] + "_"
 }
+
+// projectLines renders directory metadata as "Project:", "Description:", and
+// "Tags:" header lines, omitting empty ones.
+func projectLines(dm indexer.DirMeta, anon *Anonymizer) []string {
+	var lines []string
+	if dm.Name != "" {
+		lines = append(lines, "Project: "+anon.Apply(dm.Name))
+	}
+	if dm.Description != "" {
+		lines = append(lines, "Description: "+anon.Apply(dm.Description))
+	}
+	if len(dm.Tags) > 0 {
+		lines = append(lines, "Tags: "+anon.Apply(strings.Join(dm.Tags, ", ")))
+	}
+	return lines
+}
+
+// FormatActive renders an active duration for export headers: minutes
+// precision ("1h5m") once past a minute, seconds below.
+func FormatActive(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+}
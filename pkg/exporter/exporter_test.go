@@ -0,0 +1,691 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"codex-watcher/pkg/indexer"
+)
+
+func buildIdxForExport(t *testing.T) *indexer.Indexer {
+	t.Helper()
+	x := indexer.New([]string{"/tmp/.codex"}, "")
+	now := time.Now().Format(time.RFC3339)
+	// Normal messages
+	x.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "hello", "ts": now})
+	x.IngestForTest("s1", map[string]any{"id": "m2", "session_id": "s1", "role": "assistant", "content": "world", "ts": now})
+	// Tool: shell (should be excluded)
+	x.IngestForTest("s1", map[string]any{"id": "m3", "session_id": "s1", "type": "function_call", "name": "shell", "arguments": "{\"command\":[\"echo\",\"hi\"]}"})
+	// Tool output (should be excluded)
+	x.IngestForTest("s1", map[string]any{"id": "m4", "session_id": "s1", "type": "function_call_output", "output": "{\"output\":\"ok\"}"})
+	return x
+}
+
+func TestWriteSession_ExcludesShellAndOutputs(t *testing.T) {
+	idx := buildIdxForExport(t)
+	var buf bytes.Buffer
+	n, err := WriteSession(&buf, idx, "s1", "json", Filters{ExcludeShellCalls: true, ExcludeToolOutputs: true})
+	if err != nil {
+		t.Fatalf("WriteSession error: %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "function_call_output") || strings.Contains(out, "\"function_call\"") {
+		t.Fatalf("export should exclude tool outputs and shell calls: %s", out)
+	}
+	if n <= 0 {
+		t.Fatalf("expected some messages exported, got %d", n)
+	}
+}
+
+func TestWriteByDirAllMarkdown_ExcludesShellAndOutputs(t *testing.T) {
+	idx := buildIdxForExport(t)
+	var buf bytes.Buffer
+	n, err := WriteByDirAllMarkdown(&buf, idx, "", time.Time{}, time.Time{}, Filters{ExcludeShellCalls: true, ExcludeToolOutputs: true})
+	if err != nil {
+		t.Fatalf("WriteByDirAllMarkdown error: %v", err)
+	}
+	s := buf.String()
+	if strings.Contains(s, "TOOLS OUTPUT") || strings.Contains(s, "### TOOLS\n\n") {
+		t.Fatalf("markdown export should exclude tool outputs and shell calls: %s", s)
+	}
+	if n <= 0 {
+		t.Fatalf("expected some lines exported, got %d", n)
+	}
+}
+
+func TestWriteSession_ExcludesMemoryMessages(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	now := time.Date(2026, time.March, 18, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+
+	idx.IngestForTest("s1", map[string]any{"id": "mem-1", "session_id": "s1", "role": "assistant", "content": "MEMORY PROCESSING CONTINUED", "ts": now})
+	idx.IngestForTest("s1", map[string]any{"id": "msg-1", "session_id": "s1", "role": "assistant", "content": "Visible answer", "ts": now})
+
+	var buf bytes.Buffer
+	n, err := WriteSession(&buf, idx, "s1", "md", Filters{})
+	if err != nil {
+		t.Fatalf("WriteSession error: %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "MEMORY PROCESSING CONTINUED") {
+		t.Fatalf("export should exclude memory control messages: %s", out)
+	}
+	if !strings.Contains(out, "Visible answer") {
+		t.Fatalf("export should keep visible messages: %s", out)
+	}
+	if n != 1 {
+		t.Fatalf("expected exactly 1 exported message, got %d", n)
+	}
+}
+
+func TestAnonymizerStablePlaceholders(t *testing.T) {
+	a := NewAnonymizer()
+	in := "henry@henry-mbp:~/src$ cd /Users/henry/src/app; mail alice@corp.example.com; ssh build01.internal; echo henry"
+	got := a.Apply(in)
+	for _, leak := range []string{"henry", "alice@corp.example.com", "build01.internal", "henry-mbp"} {
+		if strings.Contains(got, leak) {
+			t.Fatalf("anonymized text still contains %q: %s", leak, got)
+		}
+	}
+	if !strings.Contains(got, "/Users/user") || !strings.Contains(got, "@example.com") {
+		t.Fatalf("expected placeholders in output: %s", got)
+	}
+	// same value maps to the same placeholder on later calls
+	if again := a.Apply("/home/henry"); !strings.HasPrefix(again, "/home/user") || a.Apply("/home/henry") != again {
+		t.Fatalf("placeholder not stable: %q", again)
+	}
+}
+
+func TestWriteSession_Anonymize(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "my file is /home/jdoe/notes.txt, mail jdoe@example.org", "cwd": "/home/jdoe/proj"})
+	var buf bytes.Buffer
+	if _, err := WriteSession(&buf, idx, "s1", "md", Filters{Anonymize: true}); err != nil {
+		t.Fatalf("WriteSession error: %v", err)
+	}
+	if out := buf.String(); strings.Contains(out, "jdoe") {
+		t.Fatalf("anonymized export leaks username: %s", out)
+	}
+	idx.IngestForTest("s1", map[string]any{"id": "m2", "session_id": "s1", "role": "assistant", "type": "function_call", "tool_name": "jdoe.deploy", "content": "deploying"})
+	buf.Reset()
+	if _, err := WriteSession(&buf, idx, "s1", "json", Filters{Anonymize: true}); err != nil {
+		t.Fatalf("WriteSession error: %v", err)
+	}
+	if out := buf.String(); strings.Contains(out, "jdoe") || !strings.Contains(out, `"tool_name"`) {
+		t.Fatalf("anonymized JSON export leaks username or drops the tool name: %s", out)
+	}
+}
+
+func TestWriteSession_MaxTokensKeepsRecentTurns(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	base := time.Date(2026, time.March, 18, 12, 0, 0, 0, time.UTC)
+	long := strings.Repeat("word ", 200)
+	for i, m := range []struct{ role, content string }{
+		{"user", "first question " + long},
+		{"assistant", "first answer " + long},
+		{"user", "second question"},
+		{"assistant", "second answer"},
+	} {
+		idx.IngestForTest("s1", map[string]any{
+			"id": "m" + string(rune('1'+i)), "session_id": "s1", "role": m.role, "content": m.content,
+			"ts": base.Add(time.Duration(i) * time.Minute).Format(time.RFC3339),
+		})
+	}
+	var buf bytes.Buffer
+	n, err := WriteSession(&buf, idx, "s1", "md", Filters{MaxTokens: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if n != 2 || strings.Contains(out, "first answer") || !strings.Contains(out, "second answer") {
+		t.Fatalf("expected only the last turn, got n=%d:\n%s", n, out)
+	}
+	if !strings.Contains(out, "2 earlier messages omitted") {
+		t.Fatalf("expected omission note:\n%s", out)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if got := EstimateTokens("hello world"); got < 2 || got > 4 {
+		t.Fatalf("ascii estimate = %d", got)
+	}
+	if got := EstimateTokens("你好世界"); got != 4 {
+		t.Fatalf("cjk estimate = %d", got)
+	}
+}
+
+func TestCollectFlashcardsPairsFinalAnswers(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	base := time.Date(2026, time.March, 18, 12, 0, 0, 0, time.UTC)
+	lines := []map[string]any{
+		{"id": "m1", "role": "user", "content": "<environment_context>cwd</environment_context>"},
+		{"id": "m2", "role": "user", "content": "How do I\nlist files?"},
+		{"id": "m3", "role": "assistant", "content": "Let me check."},
+		{"id": "m4", "type": "function_call", "name": "shell", "arguments": "{}"},
+		{"id": "m5", "role": "assistant", "content": "Use ls\tplease."},
+		{"id": "m6", "role": "user", "content": "Unanswered?"},
+	}
+	for i, raw := range lines {
+		raw["session_id"] = "s1"
+		raw["ts"] = base.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+		idx.IngestForTest("s1", raw)
+	}
+	cards := CollectFlashcards(idx, "s1", "", time.Time{}, time.Time{}, Filters{})
+	if len(cards) != 1 {
+		t.Fatalf("expected 1 card, got %+v", cards)
+	}
+	if cards[0].Question != "How do I\nlist files?" || cards[0].Answer != "Use ls\tplease." {
+		t.Fatalf("unexpected card: %+v", cards[0])
+	}
+	var buf bytes.Buffer
+	if _, err := WriteFlashcards(&buf, cards, "tsv"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "How do I<br>list files?\tUse ls    please.\tcodex-watcher codex\n") {
+		t.Fatalf("unexpected tsv:\n%s", buf.String())
+	}
+}
+
+func TestVaultSyncWritesFinishedSessionsOnly(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	now := time.Date(2026, time.March, 18, 12, 0, 0, 0, time.UTC)
+	idx.IngestForTest("old", map[string]any{"id": "m1", "session_id": "old", "role": "user", "content": "Plan the migration", "cwd": "/work/app", "ts": now.Add(-2 * time.Hour).Format(time.RFC3339)})
+	idx.IngestForTest("live", map[string]any{"id": "m2", "session_id": "live", "role": "user", "content": "Still typing", "ts": now.Add(-time.Minute).Format(time.RFC3339)})
+
+	dir := t.TempDir()
+	v := &VaultSync{Dir: dir, BaseURL: "http://localhost:7077", Idle: 30 * time.Minute}
+	n, err := v.SyncOnce(idx, now)
+	if err != nil || n != 1 {
+		t.Fatalf("SyncOnce = %d, %v", n, err)
+	}
+	file := v.entries["old"].File
+	b, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	note := string(b)
+	for _, want := range []string{"---\ntitle: \"Plan the migration\"\n", "session_id: \"old\"\n", "watcher: \"http://localhost:7077/?session=old\"\n", "Plan the migration\n"} {
+		if !strings.Contains(note, want) {
+			t.Fatalf("note missing %q:\n%s", want, note)
+		}
+	}
+	if n, _ := v.SyncOnce(idx, now); n != 0 {
+		t.Fatalf("unchanged session should not be rewritten, wrote %d", n)
+	}
+
+	// a fresh syncer picks up the stored index and keeps the file name
+	idx.IngestForTest("old", map[string]any{"id": "m3", "session_id": "old", "role": "assistant", "content": "Done", "ts": now.Add(-90 * time.Minute).Format(time.RFC3339)})
+	v2 := &VaultSync{Dir: dir, Idle: 30 * time.Minute}
+	if n, err := v2.SyncOnce(idx, now); err != nil || n != 1 || v2.entries["old"].File != file {
+		t.Fatalf("resync = %d, %v, file %q want %q", n, err, v2.entries["old"].File, file)
+	}
+}
+
+func TestWriteSiteRendersPagesAndSearchIndex(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	ts := time.Date(2026, time.March, 18, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "Explain <goroutine> leaks", "cwd": "/work/app", "ts": ts})
+	idx.IngestForTest("s2", map[string]any{"id": "m2", "session_id": "s2", "role": "user", "content": "Unrelated", "cwd": "/other", "ts": ts})
+
+	dir := t.TempDir()
+	n, err := WriteSite(idx, dir, SiteOptions{CWDPrefix: "/work", Filters: Filters{ExcludeShellCalls: true, ExcludeToolOutputs: true}})
+	if err != nil || n != 1 {
+		t.Fatalf("WriteSite = %d, %v", n, err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "search-index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var si siteIndex
+	if err := json.Unmarshal(b, &si); err != nil {
+		t.Fatal(err)
+	}
+	if len(si.Docs) != 1 || len(si.Terms["goroutine"]) != 1 || si.Terms["unrelated"] != nil {
+		t.Fatalf("unexpected index: %+v", si)
+	}
+	page, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(si.Docs[0].URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), "Explain &lt;goroutine&gt; leaks") {
+		t.Fatalf("session page not escaped/rendered:\n%s", page)
+	}
+	index, _ := os.ReadFile(filepath.Join(dir, "index.html"))
+	if !strings.Contains(string(index), `href="`+si.Docs[0].URL+`"`) {
+		t.Fatalf("index.html does not link the session page")
+	}
+}
+
+func TestWriteSiteAnonymizesSessionWithOneAnonymizer(t *testing.T) {
+	idx := indexer.New([]string{t.TempDir()}, "")
+	ts := time.Date(2026, time.March, 18, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "compare the notes", "cwd": "/work/app", "ts": ts})
+	idx.IngestForTest("s1", map[string]any{"id": "m2", "session_id": "s1", "role": "assistant", "content": "/home/bobby/notes and /home/carol/todo", "cwd": "/work/app", "ts": ts})
+	if err := idx.SetDirInfo("/work/app", "", "shared with /home/carol", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if n, err := WriteSite(idx, dir, SiteOptions{Filters: Filters{Anonymize: true}}); err != nil || n != 1 {
+		t.Fatalf("WriteSite = %d, %v", n, err)
+	}
+	var si siteIndex
+	if b, err := os.ReadFile(filepath.Join(dir, "search-index.json")); err != nil || json.Unmarshal(b, &si) != nil || len(si.Docs) != 1 {
+		t.Fatalf("search index: %v, %+v", err, si)
+	}
+	page, _ := os.ReadFile(filepath.Join(dir, filepath.FromSlash(si.Docs[0].URL)))
+	index, _ := os.ReadFile(filepath.Join(dir, "index.html"))
+	if strings.Contains(string(page), "carol") || strings.Contains(string(index), "carol") {
+		t.Fatal("site leaks a username")
+	}
+	m := regexp.MustCompile(`/home/(user\d+)/todo`).FindStringSubmatch(string(page))
+	if m == nil {
+		t.Fatalf("message not anonymized on the page:\n%s", page)
+	}
+	if want := "shared with /home/" + m[1] + "<"; !strings.Contains(string(index), want) {
+		t.Fatalf("directory description should name carol %s like the messages:\n%s", m[1], index)
+	}
+}
+
+func TestWriteSessionSelectsTurns(t *testing.T) {
+	x := indexer.New([]string{"/tmp/.codex"}, "")
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i, c := range []struct{ role, content string }{
+		{"user", "first question"}, {"assistant", "first answer"},
+		{"user", "second question"}, {"assistant", "second answer"},
+		{"user", "third question"}, {"assistant", "third answer"},
+	} {
+		x.IngestForTest("s1", map[string]any{"id": fmt.Sprintf("m%d", i), "role": c.role, "content": c.content, "ts": base.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)})
+	}
+	tr, err := ParseTurnRanges("2-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n, err := WriteSession(&buf, x, "s1", "md", Filters{Turns: tr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if n != 4 || strings.Contains(out, "first answer") || !strings.Contains(out, "second answer") || !strings.Contains(out, "third question") {
+		t.Fatalf("unexpected turn export (%d messages):\n%s", n, out)
+	}
+	for _, bad := range []string{"", "x", "5-3", "-2"} {
+		if _, err := ParseTurnRanges(bad); err == nil {
+			t.Fatalf("ParseTurnRanges(%q) should fail", bad)
+		}
+	}
+}
+
+func TestWriteSessionMetaBlock(t *testing.T) {
+	idx := buildIdxForExport(t)
+	var buf bytes.Buffer
+	if _, err := WriteSession(&buf, idx, "s1", "md", Filters{Meta: true, ExcludeShellCalls: true, ExcludeToolOutputs: true}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"- **Provider:** codex", "- **Messages:** 2 exported of 4", "- **Tokens:** ~", "- **Sources:** "} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("metadata block missing %q:\n%s", want, out)
+		}
+	}
+	buf.Reset()
+	if _, err := WriteSession(&buf, idx, "s1", "md", Filters{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "**Provider:**") {
+		t.Fatal("metadata block should be opt-in")
+	}
+}
+
+func TestWriteSessionStatsFooter(t *testing.T) {
+	idx := buildIdxForExport(t)
+	var buf bytes.Buffer
+	if _, err := WriteSession(&buf, idx, "s1", "md", Filters{Stats: true}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	i := strings.Index(out, "## Stats\n\n")
+	if i < 0 || i < strings.LastIndex(out, "### ") {
+		t.Fatalf("stats footer should follow the messages:\n%s", out)
+	}
+	for _, want := range []string{"- **Messages:** 4 (", "assistant 1", "- **Tool calls:** 1 (shell 1)", "- **Duration:** 0s", "- **Estimated tokens:** ~"} {
+		if !strings.Contains(out[i:], want) {
+			t.Fatalf("stats footer missing %q:\n%s", want, out[i:])
+		}
+	}
+	buf.Reset()
+	if _, err := WriteSession(&buf, idx, "s1", "txt", Filters{Stats: true, ExcludeShellCalls: true, ExcludeToolOutputs: true}); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "== STATS ==\nMessages: 2 (assistant 1, user 1)\nTool calls: 0\n") {
+		t.Fatalf("txt stats footer should count only exported messages:\n%s", out)
+	}
+}
+
+func TestWriteSessionDeterministicOrderAndExportSeq(t *testing.T) {
+	x := indexer.New([]string{"/tmp/.codex"}, "")
+	ts := "2024-01-01T10:00:00Z"
+	// Only the first line has a timestamp; the rest must keep file order.
+	x.IngestForTest("s1", map[string]any{"id": "a", "role": "user", "content": "one", "ts": ts})
+	x.IngestForTest("s1", map[string]any{"id": "b", "role": "assistant", "content": "two"})
+	x.IngestForTest("s1", map[string]any{"id": "c", "role": "user", "content": "three"})
+	x.IngestForTest("s1", map[string]any{"id": "d", "role": "assistant", "content": "four"})
+
+	export := func(f Filters) []map[string]any {
+		var buf bytes.Buffer
+		if _, err := WriteSession(&buf, x, "s1", "json", f); err != nil {
+			t.Fatal(err)
+		}
+		var out []map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	for run := 0; run < 5; run++ {
+		all := export(Filters{})
+		var ids []string
+		for i, m := range all {
+			ids = append(ids, m["id"].(string))
+			if seq := int(m["export_seq"].(float64)); seq != i+1 {
+				t.Fatalf("export_seq of %v = %d, want %d", m["id"], seq, i+1)
+			}
+		}
+		if strings.Join(ids, "") != "abcd" {
+			t.Fatalf("order = %v, want file order", ids)
+		}
+	}
+	// Filtering keeps each message's number.
+	users := export(Filters{IncludeRoles: []string{"user"}})
+	if len(users) != 2 || users[1]["id"] != "c" || users[1]["export_seq"].(float64) != 3 {
+		t.Fatalf("filtered export_seq not stable: %v", users)
+	}
+}
+
+func TestDiffExportsReportsNewSessionsAndMessages(t *testing.T) {
+	x := indexer.New([]string{"/tmp/.codex"}, "")
+	x.IngestForTest("s1", map[string]any{"id": "a", "role": "user", "content": "hello", "ts": "2024-01-01T10:00:00Z"})
+	export := func(id, format string) ExportDoc {
+		var buf bytes.Buffer
+		if _, err := WriteSession(&buf, x, id, format, Filters{}); err != nil {
+			t.Fatal(err)
+		}
+		doc, err := ParseExport(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+	for _, format := range []string{"json", "jsonl", "md"} {
+		old := export("s1", format)
+		x.IngestForTest("s1", map[string]any{"id": "b-" + format, "role": "assistant", "content": "reply " + format, "ts": "2024-01-01T10:01:00Z"})
+		cur := export("s1", format)
+		d := DiffExports(old, cur)
+		if d.AddedMessages != 1 || d.RemovedMessages != 0 || len(d.ChangedSessions) != 1 || len(d.AddedSessions) != 0 {
+			t.Fatalf("%s: unexpected diff %+v", format, d)
+		}
+		if d := DiffExports(cur, cur); d.AddedMessages+d.RemovedMessages+len(d.ChangedSessions) != 0 {
+			t.Fatalf("%s: identical exports should not differ: %+v", format, d)
+		}
+	}
+	d := DiffExports(ExportDoc{}, export("s1", "json"))
+	if len(d.AddedSessions) != 1 || d.AddedSessions[0].Added != 4 {
+		t.Fatalf("new session not reported: %+v", d)
+	}
+}
+
+func TestWriteClipDropsToolNoiseAndFitsBudget(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	base := time.Date(2026, time.March, 18, 12, 0, 0, 0, time.UTC)
+	for i, m := range []map[string]any{
+		{"role": "user", "content": "<environment_context>cwd</environment_context>"},
+		{"role": "user", "content": "old question " + strings.Repeat("word ", 200)},
+		{"role": "assistant", "content": "old answer"},
+		{"role": "user", "content": "fix the build"},
+		{"type": "function_call", "name": "shell", "arguments": `{"command":["go","build"]}`},
+		{"type": "function_call_output", "output": "ok"},
+		{"role": "assistant", "content": "The build passes now."},
+	} {
+		m["id"] = fmt.Sprintf("m%d", i)
+		m["session_id"] = "s1"
+		m["ts"] = base.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+		idx.IngestForTest("s1", m)
+	}
+	var buf bytes.Buffer
+	n, err := WriteClip(&buf, idx, "s1", ClipOptions{MaxChars: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if n != 2 || !strings.HasPrefix(out, "User: fix the build\n\nAssistant: The build passes now.\n\n") {
+		t.Fatalf("expected only the last prompt and reply, got n=%d:\n%s", n, out)
+	}
+	if strings.Contains(out, "go build") || strings.Contains(out, "environment_context") || len([]rune(out)) > 300 {
+		t.Fatalf("clip has noise or is over budget:\n%s", out)
+	}
+	if footer := out[strings.LastIndex(strings.TrimSuffix(out, "\n"), "\n")+1:]; !strings.Contains(footer, "last 2 of 4 messages") || !strings.Contains(footer, "2026-03-18") {
+		t.Fatalf("unexpected footer %q", footer)
+	}
+}
+
+func TestWriteContextPackSummarizesTodosAndDecisions(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	base := time.Date(2026, time.March, 18, 12, 0, 0, 0, time.UTC)
+	for i, m := range []map[string]any{
+		{"role": "user", "content": "add caching to the API"},
+		{"type": "function_call", "name": "update_plan", "arguments": `{"plan":[{"step":"add cache layer","status":"completed"},{"step":"write cache tests","status":"pending"}]}`},
+		{"role": "assistant", "content": "Added an LRU cache. We decided to use Redis instead of memcached. Tests come next."},
+	} {
+		m["id"] = fmt.Sprintf("m%d", i)
+		m["session_id"] = "s1"
+		m["cwd"] = "/work/api"
+		m["ts"] = base.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+		idx.IngestForTest("s1", m)
+	}
+	var buf bytes.Buffer
+	n, err := WriteContextPack(&buf, idx, "/work/api", ContextPackOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# Context pack: /work/api",
+		"**Last request:** add caching to the API",
+		"**Outcome:** Added an LRU cache.",
+		"- [ ] write cache tests",
+		"- We decided to use Redis instead of memcached.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	if n != 1 || strings.Contains(out, "add cache layer") {
+		t.Fatalf("completed item leaked or wrong count %d:\n%s", n, out)
+	}
+}
+
+func TestWriteSessionTodoAppendix(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "plan the work"})
+	idx.IngestForTest("s1", map[string]any{"id": "m2", "session_id": "s1", "type": "function_call", "name": "update_plan",
+		"arguments": `{"plan":[{"step":"read code","status":"completed"},{"step":"fix bug","status":"pending"}]}`})
+	var buf bytes.Buffer
+	if _, err := WriteSession(&buf, idx, "s1", "md", Filters{Todos: true}); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "## TODOs\n\n- [x] read code\n- [ ] fix bug\n") {
+		t.Fatalf("missing TODO appendix:\n%s", out)
+	}
+	buf.Reset()
+	if _, err := WriteSession(&buf, idx, "s1", "md", Filters{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "## TODOs") {
+		t.Fatal("appendix should be opt-in")
+	}
+}
+
+func TestWriteSessionReferencesSection(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "assistant",
+		"content": []any{map[string]any{"type": "output_text", "text": "Answer.", "annotations": []any{
+			map[string]any{"type": "url_citation", "url": "https://example.com/a", "title": "Example [A]"},
+		}}}})
+	var buf bytes.Buffer
+	if _, err := WriteSession(&buf, idx, "s1", "md", Filters{References: true}); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "## References\n\n- [Example \\[A\\]](https://example.com/a)\n") {
+		t.Fatalf("missing references section:\n%s", out)
+	}
+}
+
+func TestWriteJournalCollectsCommandsFilesAndTodos(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	base := time.Date(2026, time.October, 14, 9, 0, 0, 0, time.UTC) // a Wednesday
+	ingest := func(sid string, at time.Time, msgs ...map[string]any) {
+		for i, m := range msgs {
+			m["id"] = fmt.Sprintf("%s-%d", sid, i)
+			m["session_id"] = sid
+			m["cwd"] = "/work/api"
+			m["ts"] = at.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+			idx.IngestForTest(sid, m)
+		}
+	}
+	ingest("later", base.Add(24*time.Hour),
+		map[string]any{"role": "user", "content": "wire the cache into handlers"},
+		map[string]any{"type": "custom_tool_call", "name": "apply_patch", "input": "*** Begin Patch\n*** Update File: api/handlers.go\n@@\n*** End Patch"},
+		map[string]any{"role": "assistant", "content": "Handlers use the cache now."},
+	)
+	ingest("earlier", base,
+		map[string]any{"role": "user", "content": "add caching to the API"},
+		map[string]any{"type": "function_call", "name": "shell", "arguments": `{"command":["bash","-lc","go test ./..."]}`},
+		map[string]any{"type": "function_call", "name": "update_plan", "arguments": `{"plan":[{"step":"add cache layer","status":"completed"},{"step":"write cache tests","status":"pending"}]}`},
+		map[string]any{"role": "assistant", "content": "Added an LRU cache."},
+	)
+	ingest("old", base.AddDate(0, 0, -7), map[string]any{"role": "user", "content": "last week's work"})
+
+	week, err := ParseWeek("2026-W42", time.Time{}, time.UTC)
+	if err != nil || !week.Equal(time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("ParseWeek = %v, %v", week, err)
+	}
+	if d, _ := ParseWeek("2026-10-18", time.Time{}, time.UTC); !d.Equal(week) {
+		t.Fatalf("a Sunday should belong to the week before, got %v", d)
+	}
+	var buf bytes.Buffer
+	n, err := WriteJournal(&buf, idx, "/work/api", JournalOptions{Week: week})
+	if err != nil || n != 2 {
+		t.Fatalf("WriteJournal = %d, %v", n, err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# Journal: /work/api, week of 2026-10-12",
+		"**Request:** add caching to the API",
+		"**Outcome:** Added an LRU cache.",
+		"- `go test ./...`",
+		"- `api/handlers.go`",
+		"- [x] add cache layer",
+		"- [ ] write cache tests",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "add caching") > strings.Index(out, "wire the cache") || strings.Contains(out, "last week") {
+		t.Fatalf("sessions out of order or outside the week:\n%s", out)
+	}
+}
+
+func TestWriteCalendarEscapesAndFoldsEvents(t *testing.T) {
+	start := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+	sessions := []indexer.Session{
+		{ID: "s1", Title: "Fix tests; then, refactor", Provider: "codex", CWD: "/src/api", CWDBase: "api", FirstAt: start, LastAt: start.Add(90 * time.Minute), MessageCount: 12},
+		{ID: "s2", Title: strings.Repeat("ü", 60), Provider: "claude", FirstAt: start, LastAt: start},
+		{ID: "s3", Title: "no timestamps"},
+	}
+	var buf bytes.Buffer
+	n, err := WriteCalendar(&buf, sessions, CalendarOptions{BaseURL: "http://localhost:7077/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("events = %d, want 2", n)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:s1@codex-watcher\r\n",
+		"DTSTART:20261014T090000Z\r\nDTEND:20261014T103000Z\r\n",
+		`SUMMARY:Fix tests\; then\, refactor` + "\r\n",
+		"URL:http://localhost:7077/?session=s1\r\n",
+		`DESCRIPTION:codex · 12 messages\n/src/api\n`,
+		"CATEGORIES:api\r\n",
+		"DTEND:20261014T090100Z\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("line not folded: %q", line)
+		}
+	}
+	if strings.Contains(out, "no timestamps") {
+		t.Fatal("session without timestamps should be skipped")
+	}
+}
+
+func TestBuildTimesheetSplitsActiveTimeByDayAndDirectory(t *testing.T) {
+	x := indexer.New([]string{"/tmp/.codex"}, "")
+	at := func(s string) string { return "2025-06-" + s + "Z" }
+	// 10 active minutes on the 2nd (the 40-minute pause is idle), 3 on the 3rd
+	for i, ts := range []string{"02T09:00:00", "02T09:05:00", "02T09:10:00", "02T09:50:00", "03T10:00:00", "03T10:03:00"} {
+		x.IngestForTest("a", map[string]any{"id": fmt.Sprintf("a%d", i), "session_id": "a", "cwd": "/src/api", "role": "user", "content": "work", "ts": at(ts)})
+	}
+	for i, ts := range []string{"02T11:00:00", "02T11:05:00"} {
+		x.IngestForTest("b", map[string]any{"id": fmt.Sprintf("b%d", i), "session_id": "b", "cwd": "/src/web", "role": "user", "content": "work", "ts": at(ts)})
+	}
+	// outside the month
+	x.IngestForTest("c", map[string]any{"id": "c1", "session_id": "c", "cwd": "/src/api", "role": "user", "content": "work", "ts": "2025-07-01T09:00:00Z"})
+	x.IngestForTest("c", map[string]any{"id": "c2", "session_id": "c", "cwd": "/src/api", "role": "user", "content": "work", "ts": "2025-07-01T09:03:00Z"})
+
+	month, err := ParseMonth("2025-06", time.Now(), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := BuildTimesheet(x, "", month)
+	var got []string
+	for _, r := range ts.Rows {
+		got = append(got, fmt.Sprintf("%s %s %d %s", r.Date, r.Project, r.Sessions, r.ActiveDuration))
+	}
+	want := "2025-06-02 api 1 10m0s|2025-06-02 web 1 5m0s|2025-06-03 api 1 3m0s"
+	if strings.Join(got, "|") != want {
+		t.Fatalf("rows = %v", got)
+	}
+	if ts.ActiveDuration != 18*time.Minute || ts.Hours != 0.3 {
+		t.Fatalf("total = %s (%v h)", ts.ActiveDuration, ts.Hours)
+	}
+	if only := BuildTimesheet(x, "/src/web", month); len(only.Rows) != 1 {
+		t.Fatalf("cwd filter rows = %+v", only.Rows)
+	}
+	var buf bytes.Buffer
+	if err := WriteTimesheetCSV(&buf, ts); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 || lines[0] != "date,project,cwd,sessions,hours" || lines[1] != "2025-06-02,api,/src/api,1,0.17" || lines[4] != "total 2025-06,,,,0.30" {
+		t.Fatalf("csv = %q", buf.String())
+	}
+	if _, err := ParseMonth("June", time.Now(), time.UTC); err == nil {
+		t.Fatal("expected an invalid month error")
+	}
+}
@@ -0,0 +1,148 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// Flashcard pairs a user question with the assistant's final answer to it.
+type Flashcard struct {
+	Question  string
+	Answer    string
+	SessionID string
+	Tags      []string
+}
+
+// CollectFlashcards pairs each user question with the last assistant text
+// reply before the next user message, skipping reasoning, tool calls, tool
+// output, and injected context blocks. Sessions are limited to sessionID when
+// set, otherwise to those whose CWD starts with cwdPrefix (empty = all).
+func CollectFlashcards(idx *indexer.Indexer, sessionID, cwdPrefix string, after, before time.Time, f Filters) []Flashcard {
+	var sel []indexer.Session
+	for _, s := range idx.Sessions() {
+		if sessionID != "" && s.ID != sessionID {
+			continue
+		}
+		if sessionID == "" && cwdPrefix != "" && !strings.HasPrefix(s.CWD, cwdPrefix) {
+			continue
+		}
+		sel = append(sel, s)
+	}
+	sortSessionsForExport(sel)
+	var anon *Anonymizer
+	if f.Anonymize {
+		anon = NewAnonymizer()
+	}
+
+	var cards []Flashcard
+	for _, s := range sel {
+		msgs := indexer.VisibleMessages(idx.PeekMessages(s.ID), 0)
+		SortMessagesForExport(msgs)
+		tags := []string{"codex-watcher"}
+		if s.Provider != "" {
+			tags = append(tags, s.Provider)
+		}
+		if s.CWDBase != "" {
+			tags = append(tags, sanitize(anon.Apply(s.CWDBase)))
+		}
+
+		var question []string
+		answer := ""
+		flush := func() {
+			if len(question) > 0 && answer != "" {
+				cards = append(cards, Flashcard{
+					Question:  anon.Apply(strings.Join(question, "\n\n")),
+					Answer:    anon.Apply(answer),
+					SessionID: s.ID,
+					Tags:      tags,
+				})
+			}
+			question, answer = nil, ""
+		}
+		for _, m := range msgs {
+			if !m.Ts.IsZero() && ((!after.IsZero() && m.Ts.Before(after)) || (!before.IsZero() && m.Ts.After(before))) {
+				continue
+			}
+			switch strings.ToLower(strings.TrimSpace(m.Type)) {
+			case "", "message", "user", "assistant":
+			default:
+				continue
+			}
+			text := strings.TrimSpace(m.Content)
+			if text == "" || isInjectedContext(text) {
+				continue
+			}
+			switch strings.ToLower(strings.TrimSpace(m.Role)) {
+			case "user":
+				// consecutive user messages without a reply form one question
+				if answer != "" {
+					flush()
+				}
+				question = append(question, text)
+			case "assistant":
+				if len(question) > 0 {
+					answer = text
+				}
+			}
+		}
+		flush()
+	}
+	return cards
+}
+
+// isInjectedContext reports whether a user message is a context block the
+// agent injects (e.g. <environment_context>, <user_instructions>) rather than
+// something the user asked.
+func isInjectedContext(text string) bool {
+	return strings.HasPrefix(text, "<") && strings.HasSuffix(text, ">")
+}
+
+// WriteFlashcards writes cards for Anki import. Format "tsv" emits Anki's
+// plain-text import with header directives and HTML fields; "csv" emits a
+// question,answer,tags,session_id table with a header row.
+func WriteFlashcards(w io.Writer, cards []Flashcard, format string) (int, error) {
+	switch strings.ToLower(format) {
+	case "tsv", "":
+		if _, err := io.WriteString(w, "#separator:tab\n#html:true\n#tags column:3\n"); err != nil {
+			return 0, err
+		}
+		for _, c := range cards {
+			line := ankiField(c.Question) + "\t" + ankiField(c.Answer) + "\t" + strings.Join(c.Tags, " ") + "\n"
+			if _, err := io.WriteString(w, line); err != nil {
+				return 0, err
+			}
+		}
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"question", "answer", "tags", "session_id"}); err != nil {
+			return 0, err
+		}
+		for _, c := range cards {
+			if err := cw.Write([]string{c.Question, c.Answer, strings.Join(c.Tags, " "), c.SessionID}); err != nil {
+				return 0, err
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("unsupported format: %s", format)
+	}
+	return len(cards), nil
+}
+
+// ankiField escapes text for an HTML-enabled TSV field: tabs cannot appear
+// and newlines become <br>.
+func ankiField(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, "\t", "    ")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
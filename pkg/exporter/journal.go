@@ -0,0 +1,193 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// JournalOptions tunes WriteJournal.
+type JournalOptions struct {
+	Week      time.Time // any time in the week; the week starts on Monday in its location
+	Anonymize bool
+}
+
+const (
+	journalSummaryRunes = 400
+	journalCommandRunes = 160
+	journalMaxItems     = 25 // commands or files listed per session
+)
+
+// ParseWeek reads a week as an ISO week ("2026-W41") or any date in it
+// ("2026-10-14"), in loc, and returns its Monday at midnight. An empty
+// string is the week of now.
+func ParseWeek(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	var day time.Time
+	switch {
+	case s == "":
+		day = now.In(loc)
+	case strings.Contains(strings.ToUpper(s), "-W"):
+		year, week, _ := strings.Cut(strings.ToUpper(s), "-W")
+		y, err1 := strconv.Atoi(year)
+		w, err2 := strconv.Atoi(week)
+		if err1 != nil || err2 != nil || w < 1 || w > 53 {
+			return time.Time{}, fmt.Errorf("invalid week %q (want YYYY-Www or YYYY-MM-DD)", s)
+		}
+		// week 1 is the one holding January 4th
+		day = time.Date(y, time.January, 4, 0, 0, 0, 0, loc).AddDate(0, 0, 7*(w-1))
+	default:
+		d, err := time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid week %q (want YYYY-Www or YYYY-MM-DD)", s)
+		}
+		day = d
+	}
+	offset := (int(day.Weekday()) + 6) % 7 // days since Monday
+	return time.Date(day.Year(), day.Month(), day.Day()-offset, 0, 0, 0, 0, loc), nil
+}
+
+// WriteJournal writes a Markdown journal of one week of work in a directory:
+// every session with messages that week, in the order they started, with its
+// title, request and outcome, the commands it ran, the files it touched, and
+// its plan items. It returns the number of sessions written.
+func WriteJournal(w io.Writer, idx *indexer.Indexer, cwdPrefix string, opt JournalOptions) (int, error) {
+	start := opt.Week
+	end := start.AddDate(0, 0, 7)
+	var anon *Anonymizer
+	if opt.Anonymize {
+		anon = NewAnonymizer()
+	}
+
+	type journalSession struct {
+		sess indexer.Session // viewed over the week's messages
+		msgs []*indexer.Message
+	}
+	var sel []journalSession
+	for _, s := range idx.Sessions() {
+		if cwdPrefix != "" && !strings.HasPrefix(s.CWD, cwdPrefix) {
+			continue
+		}
+		if s.LastAt.Before(start) || !s.FirstAt.Before(end) {
+			continue
+		}
+		all := indexer.VisibleMessages(idx.PeekMessages(s.ID), 0)
+		var msgs []*indexer.Message
+		for _, m := range all {
+			if !m.Ts.IsZero() && !m.Ts.Before(start) && m.Ts.Before(end) {
+				msgs = append(msgs, m)
+			}
+		}
+		view, ok := idx.SessionView(s, msgs)
+		if !ok {
+			continue
+		}
+		SortMessagesForExport(msgs)
+		sel = append(sel, journalSession{view, msgs})
+	}
+	sort.SliceStable(sel, func(i, j int) bool {
+		if !sel[i].sess.FirstAt.Equal(sel[j].sess.FirstAt) {
+			return sel[i].sess.FirstAt.Before(sel[j].sess.FirstAt)
+		}
+		return sel[i].sess.ID < sel[j].sess.ID
+	})
+
+	var b strings.Builder
+	name := cwdPrefix
+	if dm := idx.DirInfo(cwdPrefix); dm.Name != "" {
+		name = dm.Name
+	}
+	if name == "" {
+		name = "all directories"
+	}
+	fmt.Fprintf(&b, "# Journal: %s, week of %s\n\n", escapeMD(anon.Apply(name)), start.Format("2006-01-02"))
+	messages := 0
+	for _, js := range sel {
+		messages += js.sess.MessageCount
+	}
+	fmt.Fprintf(&b, "_%s to %s · %d sessions · %d messages_\n\n", start.Format("Mon 2006-01-02"), end.AddDate(0, 0, -1).Format("Mon 2006-01-02"), len(sel), messages)
+	if len(sel) == 0 {
+		b.WriteString("_No sessions this week._\n")
+		_, err := io.WriteString(w, b.String())
+		return 0, err
+	}
+
+	for _, js := range sel {
+		s := js.sess
+		loc := start.Location()
+		fmt.Fprintf(&b, "## %s\n\n", escapeMD(anon.Apply(indexer.SessionDisplayTitle(s, nil))))
+		fmt.Fprintf(&b, "_%s–%s · %s · %d messages_\n\n", s.FirstAt.In(loc).Format("Mon 2006-01-02 15:04"), s.LastAt.In(loc).Format("15:04"), s.Provider, s.MessageCount)
+
+		var prompt, answer string
+		var commands, files []string
+		seenCmd, seenFile := make(map[string]bool), make(map[string]bool)
+		for _, m := range js.msgs {
+			switch indexer.TurnKind(m) {
+			case indexer.TurnPrompt:
+				if prompt == "" {
+					prompt = m.Content
+				}
+			case indexer.TurnAnswer:
+				if strings.TrimSpace(m.Content) != "" {
+					answer = m.Content
+				}
+			}
+			for _, c := range indexer.ToolCommands(m) {
+				c = clipRunes(oneLine(c), journalCommandRunes)
+				if !seenCmd[c] {
+					seenCmd[c] = true
+					commands = append(commands, c)
+				}
+			}
+			for _, f := range indexer.FilesTouched(m) {
+				if !seenFile[f] {
+					seenFile[f] = true
+					files = append(files, f)
+				}
+			}
+		}
+		if prompt != "" {
+			b.WriteString("**Request:** " + clipRunes(escapeMD(anon.Apply(oneLine(prompt))), journalSummaryRunes) + "\n\n")
+		}
+		if answer != "" {
+			b.WriteString("**Outcome:** " + clipRunes(escapeMD(anon.Apply(oneLine(answer))), journalSummaryRunes) + "\n\n")
+		}
+		writeJournalList(&b, "Commands run", commands, func(c string) string { return "`" + strings.ReplaceAll(anon.Apply(c), "`", "'") + "`" })
+		sort.Strings(files)
+		writeJournalList(&b, "Files touched", files, func(f string) string { return "`" + anon.Apply(f) + "`" })
+		if todos := idx.Todos(s.ID); len(todos) > 0 {
+			b.WriteString("**TODOs:**\n\n")
+			for _, t := range todos {
+				box := "[x]"
+				if t.Open() {
+					box = "[ ]"
+				}
+				b.WriteString("- " + box + " " + escapeMD(anon.Apply(t.Text)) + "\n")
+			}
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return len(sel), err
+}
+
+// writeJournalList writes a bold heading and up to journalMaxItems items.
+func writeJournalList(b *strings.Builder, heading string, items []string, format func(string) string) {
+	if len(items) == 0 {
+		return
+	}
+	b.WriteString("**" + heading + ":**\n\n")
+	for i, it := range items {
+		if i == journalMaxItems {
+			fmt.Fprintf(b, "- … and %d more\n", len(items)-i)
+			break
+		}
+		b.WriteString("- " + format(it) + "\n")
+	}
+	b.WriteString("\n")
+}
@@ -0,0 +1,83 @@
+package exporter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// metaField is one key/value row of the optional export metadata block.
+type metaField struct {
+	Key, Value string
+}
+
+// metaFields describes a session for the metadata block (Filters.Meta):
+// provider, models, date range, active duration, counts, tags, and source
+// files. messages is how many of them the export contains (-1 if unknown);
+// tokens estimates the exported text.
+func metaFields(s indexer.Session, messages, tokens int, anon *Anonymizer) []metaField {
+	var out []metaField
+	add := func(k, v string) {
+		if strings.TrimSpace(v) != "" {
+			out = append(out, metaField{k, v})
+		}
+	}
+	add("Session", s.ID)
+	add("Provider", s.Provider)
+	if len(s.Models) > 0 {
+		models := make([]string, 0, len(s.Models))
+		for m := range s.Models {
+			models = append(models, m)
+		}
+		sort.Strings(models)
+		add("Models", strings.Join(models, ", "))
+	}
+	if !s.FirstAt.IsZero() {
+		add("Dates", s.FirstAt.UTC().Format(time.RFC3339)+" – "+s.LastAt.UTC().Format(time.RFC3339))
+	}
+	if s.ActiveDuration > 0 {
+		add("Active", FormatActive(s.ActiveDuration))
+	}
+	if messages >= 0 {
+		add("Messages", fmt.Sprintf("%d exported of %d", messages, s.MessageCount))
+	} else {
+		add("Messages", fmt.Sprint(s.MessageCount))
+	}
+	add("Tokens", fmt.Sprintf("~%d (estimated)", tokens))
+	add("Tags", strings.Join(s.Tags, ", "))
+	sources := make([]string, 0, len(s.Sources))
+	for _, src := range s.Sources {
+		sources = append(sources, anon.Apply(src))
+	}
+	add("Sources", strings.Join(sources, ", "))
+	return out
+}
+
+// estimateExportTokens sums EstimateTokens over message texts plus the
+// per-message overhead.
+func estimateExportTokens(texts []string) int {
+	n := 0
+	for _, t := range texts {
+		n += EstimateTokens(t) + perMessageTokens
+	}
+	return n
+}
+
+// writeMetaMD renders the block as a Markdown list.
+func writeMetaMD(b *strings.Builder, fields []metaField) {
+	for _, f := range fields {
+		b.WriteString("- **" + f.Key + ":** " + escapeMD(f.Value) + "\n")
+	}
+	b.WriteString("\n")
+}
+
+// writeMetaText renders the block as "Key: value" lines.
+func writeMetaText(b *strings.Builder, fields []metaField) {
+	for _, f := range fields {
+		b.WriteString(f.Key + ": " + f.Value + "\n")
+	}
+	b.WriteString("\n")
+}
@@ -0,0 +1,48 @@
+package exporter
+
+import (
+	"sort"
+	"time"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// SortMessagesForExport puts a session's messages in a deterministic order:
+// file order, then line number. Many Codex lines carry no timestamp, so
+// sorting by time would float them to the top or interleave files
+// arbitrarily; files themselves are ordered by their earliest timestamp,
+// then by name.
+func SortMessagesForExport(msgs []*indexer.Message) {
+	first := make(map[string]time.Time)
+	for _, m := range msgs {
+		if m.Ts.IsZero() {
+			continue
+		}
+		if t, ok := first[m.Source]; !ok || m.Ts.Before(t) {
+			first[m.Source] = m.Ts
+		}
+	}
+	sort.SliceStable(msgs, func(i, j int) bool {
+		a, b := msgs[i], msgs[j]
+		if a.Source != b.Source {
+			ta, tb := first[a.Source], first[b.Source]
+			if !ta.Equal(tb) && !ta.IsZero() && !tb.IsZero() {
+				return ta.Before(tb)
+			}
+			return a.Source < b.Source
+		}
+		return a.LineNo < b.LineNo
+	})
+}
+
+// sortSessionsForExport orders sessions by first message time, untimed
+// sessions first, with the ID breaking ties.
+func sortSessionsForExport(sel []indexer.Session) {
+	sort.SliceStable(sel, func(i, j int) bool {
+		ai, aj := sel[i].FirstAt, sel[j].FirstAt
+		if !ai.Equal(aj) {
+			return ai.Before(aj)
+		}
+		return sel[i].ID < sel[j].ID
+	})
+}
@@ -0,0 +1,29 @@
+package exporter
+
+import "codex-watcher/pkg/indexer"
+
+// Preview is what a session export with the same filters would contain.
+type Preview struct {
+	Total    int             `json:"total"`             // messages the export would write
+	Omitted  int             `json:"omitted,omitempty"` // earlier messages dropped by MaxTokens
+	Tokens   int             `json:"tokens"`            // estimated size of all Total messages
+	Messages []ExportMessage `json:"messages"`          // the first limit of them
+}
+
+// PreviewSession applies f like WriteSession and returns the first limit
+// messages it would write (all with limit <= 0) and how many there are.
+func PreviewSession(idx *indexer.Indexer, sessionID string, f Filters, limit int) Preview {
+	_, _, _, msgs, omitted := selectSessionMessages(idx, sessionID, f)
+	texts := make([]string, len(msgs))
+	for i, m := range msgs {
+		texts[i] = m.Content
+	}
+	p := Preview{Total: len(msgs), Omitted: omitted, Tokens: estimateExportTokens(texts), Messages: msgs}
+	if limit > 0 && len(msgs) > limit {
+		p.Messages = msgs[:limit]
+	}
+	if p.Messages == nil {
+		p.Messages = []ExportMessage{}
+	}
+	return p
+}
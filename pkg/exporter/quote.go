@@ -0,0 +1,74 @@
+package exporter
+
+import (
+	"strings"
+	"time"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// MessageMarkdown renders one message the way the UI's copy button does: its
+// text, a tool call's command or arguments, or a tool's stdout and stderr.
+func MessageMarkdown(m *indexer.Message) string {
+	switch strings.ToLower(strings.TrimSpace(m.Type)) {
+	case "function_call":
+		name := "tool"
+		if names := indexer.ToolCallNames(m); len(names) > 0 {
+			name = names[0]
+		}
+		cmdLine, argsDump := parseFuncCall(m)
+		if cmdLine != "" {
+			return "**" + name + " command**\n\n~~~bash\n$ " + cmdLine + "\n~~~"
+		}
+		return "**" + name + " arguments**\n\n~~~json\n" + argsDump + "\n~~~"
+	case "function_call_output":
+		out, errText := parseFuncOutput(m)
+		var parts []string
+		if out != "" {
+			parts = append(parts, "**stdout**\n\n~~~text\n"+out+"\n~~~")
+		}
+		if errText != "" {
+			parts = append(parts, "**stderr**\n\n~~~text\n"+errText+"\n~~~")
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	if strings.TrimSpace(m.Content) == "" {
+		return strings.TrimSpace(m.Thinking)
+	}
+	return m.Content
+}
+
+// QuoteMessage renders a message as a Markdown blockquote followed by a
+// provenance line: who said it, in which session, when, and link (the
+// watcher deep link) when set, for pasting into docs with context.
+func QuoteMessage(m *indexer.Message, sess indexer.Session, link string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(MessageMarkdown(m), "\n"), "\n") {
+		if line == "" {
+			b.WriteString(">\n")
+		} else {
+			b.WriteString("> " + line + "\n")
+		}
+	}
+	who := strings.TrimSpace(m.Role)
+	if who == "" {
+		who = "tool"
+	}
+	title := strings.TrimSpace(sess.Title)
+	if title == "" {
+		title = sess.ID
+	}
+	b.WriteString("\n— " + strings.ToUpper(who[:1]) + who[1:] + " in *" + escapeMD(title) + "*")
+	ts := m.Ts
+	if ts.IsZero() {
+		ts = sess.FirstAt
+	}
+	if !ts.IsZero() {
+		b.WriteString(", " + ts.UTC().Format(time.DateOnly))
+	}
+	if link != "" {
+		b.WriteString(" · [open](" + link + ")")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,32 @@
+package exporter
+
+import (
+	"strings"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// writeReferencesMD renders a session's web references as a Markdown link
+// list under the given heading, citations first.
+func writeReferencesMD(b *strings.Builder, heading string, links []indexer.Link, anon *Anonymizer) {
+	b.WriteString(heading + "\n\n")
+	for _, kind := range []string{"citation", "search", "fetch"} {
+		for _, l := range links {
+			if l.Kind != kind {
+				continue
+			}
+			title := l.Title
+			if title == "" {
+				title = l.URL
+			}
+			title = strings.NewReplacer("[", "\\[", "]", "\\]").Replace(anon.Apply(title))
+			url := strings.NewReplacer("(", "%28", ")", "%29", " ", "%20").Replace(l.URL)
+			b.WriteString("- [" + title + "](" + url + ")")
+			if l.Kind == "fetch" {
+				b.WriteString(" _(fetched)_")
+			}
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("\n")
+}
@@ -0,0 +1,297 @@
+package exporter
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// SiteOptions selects what WriteSite renders.
+type SiteOptions struct {
+	Title     string // page heading (default "Codex sessions")
+	CWDPrefix string // only sessions whose cwd starts with this
+	Provider  string // codex|claude, empty for both
+	Filters   Filters
+}
+
+// siteIndex is the prebuilt search index the static site loads from
+// search-index.json: documents plus an inverted index of term -> [[doc, weight]].
+type siteIndex struct {
+	Version int                 `json:"version"`
+	Docs    []siteDoc           `json:"docs"`
+	Terms   map[string][][2]int `json:"terms"`
+}
+
+type siteDoc struct {
+	Title    string `json:"t"`
+	URL      string `json:"u"`
+	CWD      string `json:"c,omitempty"`
+	Date     string `json:"d,omitempty"`
+	Provider string `json:"p,omitempty"`
+}
+
+type siteMessage struct {
+	Ts       time.Time `json:"ts"`
+	Role     string    `json:"role"`
+	Type     string    `json:"type"`
+	Model    string    `json:"model"`
+	Content  string    `json:"content"`
+	ToolName string    `json:"tool_name"`
+}
+
+type siteSession struct {
+	indexer.Session
+	File     string
+	DirDesc  string
+	Meta     []metaField // with Filters.Meta
+	Stats    []metaField // with Filters.Stats
+	Messages []siteMessage
+}
+
+type siteGroup struct {
+	CWD         string
+	Name        string // directory display name, empty for the base name
+	Description string
+	Sessions    []siteSession
+}
+
+// siteTitleWeight boosts terms found in a session title over body terms.
+const siteTitleWeight = 5
+
+// WriteSite renders the selected sessions into dir as a static HTML site:
+// index.html (sessions grouped by directory, with client-side search),
+// search-index.json, and one page per session under s/. It returns the
+// number of session pages written.
+func WriteSite(idx *indexer.Indexer, dir string, o SiteOptions) (int, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "s"), 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create site folder %s: %w", dir, err)
+	}
+	if o.Title == "" {
+		o.Title = "Codex sessions"
+	}
+	si := siteIndex{Version: 1, Terms: make(map[string][][2]int)}
+	byCWD := make(map[string][]siteSession)
+	written := 0
+	for _, s := range idx.Sessions() {
+		if o.Provider != "" && !strings.EqualFold(s.Provider, o.Provider) {
+			continue
+		}
+		if o.CWDPrefix != "" && !strings.HasPrefix(s.CWD, o.CWDPrefix) {
+			continue
+		}
+		// one anonymizer per session, so a name gets the same placeholder in
+		// the title, the directory, and the messages
+		view, _, anon, msgs, _ := selectSessionMessages(idx, s.ID, o.Filters)
+		if len(msgs) == 0 {
+			continue
+		}
+		ss := siteSession{Session: view, File: "s/" + sitePageName(view), DirDesc: anon.Apply(idx.DirInfo(s.CWD).Description)}
+		ss.Messages = make([]siteMessage, len(msgs))
+		texts := make([]string, len(msgs))
+		for i, m := range msgs {
+			ss.Messages[i] = siteMessage{Ts: m.Ts, Role: m.Role, Type: m.Type, Model: m.Model, Content: m.Content, ToolName: m.ToolName}
+			texts[i] = m.Content
+		}
+		if o.Filters.Meta {
+			ss.Meta = metaFields(view, len(msgs), estimateExportTokens(texts), anon)
+		}
+		if o.Filters.Stats {
+			ss.Stats = statsFields(msgs)
+		}
+		var page bytes.Buffer
+		if err := siteSessionTmpl.Execute(&page, map[string]any{"Site": o.Title, "S": ss}); err != nil {
+			return written, err
+		}
+		if err := writeFileAtomic(filepath.Join(dir, filepath.FromSlash(ss.File)), page.Bytes()); err != nil {
+			return written, err
+		}
+		written++
+
+		doc := len(si.Docs)
+		si.Docs = append(si.Docs, siteDoc{Title: ss.Title, URL: ss.File, CWD: ss.CWD, Date: siteDate(ss.FirstAt), Provider: ss.Provider})
+		weights := make(map[string]int)
+		for _, t := range siteTerms(ss.Title) {
+			weights[t] += siteTitleWeight
+		}
+		for _, m := range ss.Messages {
+			for _, t := range siteTerms(m.Content) {
+				weights[t]++
+			}
+		}
+		for t, w := range weights {
+			si.Terms[t] = append(si.Terms[t], [2]int{doc, w})
+		}
+		ss.Messages = nil
+		byCWD[ss.CWD] = append(byCWD[ss.CWD], ss)
+	}
+
+	groups := make([]siteGroup, 0, len(byCWD))
+	for cwd, list := range byCWD {
+		sort.Slice(list, func(i, j int) bool { return list[i].LastAt.After(list[j].LastAt) })
+		groups = append(groups, siteGroup{CWD: cwd, Name: list[0].DirName, Description: list[0].DirDesc, Sessions: list})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Sessions[0].LastAt.After(groups[j].Sessions[0].LastAt)
+	})
+	var page bytes.Buffer
+	if err := siteIndexTmpl.Execute(&page, map[string]any{"Site": o.Title, "Groups": groups, "Count": written, "Generated": time.Now().UTC().Format(time.RFC3339)}); err != nil {
+		return written, err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "index.html"), page.Bytes()); err != nil {
+		return written, err
+	}
+	b, err := json.Marshal(si)
+	if err != nil {
+		return written, err
+	}
+	return written, writeFileAtomic(filepath.Join(dir, "search-index.json"), b)
+}
+
+// sitePageName is "<date>-<hash>.html": stable across runs, URL-safe, and
+// unique per session ID.
+func sitePageName(s indexer.Session) string {
+	sum := sha1.Sum([]byte(s.ID))
+	date := siteDate(s.FirstAt)
+	if date == "" {
+		date = "undated"
+	}
+	return date + "-" + hex.EncodeToString(sum[:5]) + ".html"
+}
+
+func siteDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format("2006-01-02")
+}
+
+// siteTerms lowercases s and splits it into letter/digit runs of at least two
+// characters; the browser applies the same rule to queries.
+func siteTerms(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) >= 2 && len(f) <= 64 {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+var siteFuncs = template.FuncMap{
+	"date":   siteDate,
+	"active": FormatActive,
+	"ts": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Local().Format("2006-01-02 15:04")
+	},
+	"base": func(p string) string {
+		if p == "" {
+			return "(unknown directory)"
+		}
+		return filepath.Base(p)
+	},
+}
+
+const siteCSS = `body{font-family:ui-sans-serif,system-ui,-apple-system,Segoe UI,Roboto,sans-serif;margin:0;color:#333;background:#f2f2f2}
+header{background:#fff;border-bottom:1px solid #eee;padding:12px 24px;display:flex;gap:16px;align-items:center}
+main{max-width:960px;margin:0 auto;padding:16px 24px}
+a{color:#1d4ed8;text-decoration:none}a:hover{text-decoration:underline}
+.meta{color:#666;font-size:12px}
+.group{background:#fff;border:1px solid #eee;margin:12px 0;padding:8px 16px}
+.group h2{font-size:15px;margin:8px 0}
+.group li{margin:4px 0}
+ul{list-style:none;padding:0;margin:0}
+input{flex:1;max-width:480px;padding:6px 8px;border:1px solid #ccc}
+.msg{background:#fff;border:1px solid #eee;margin:10px 0;padding:8px 12px}
+.msg pre{white-space:pre-wrap;word-wrap:break-word;font-family:ui-monospace,Menlo,monospace;font-size:13px;margin:6px 0 0}
+.pill{display:inline-block;background:#efefef;border-radius:8px;padding:0 6px;font-size:12px}
+.user .pill{background:#e0f2fe}.assistant .pill{background:#e9d5ff}
+.metablock{display:grid;grid-template-columns:max-content 1fr;gap:2px 12px;background:#fff;border:1px solid #eee;padding:8px 12px;font-size:13px}
+.metablock dt{color:#666}.metablock dd{margin:0}
+.hidden{display:none}`
+
+var siteIndexTmpl = template.Must(template.New("site-index").Funcs(siteFuncs).Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>{{.Site}}</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>` + siteCSS + `</style></head>
+<body>
+<header><strong>{{.Site}}</strong><span class="meta">{{.Count}} sessions · generated {{.Generated}}</span>
+<input id="q" type="search" placeholder="Search sessions…" autofocus></header>
+<main>
+<ul id="results" class="hidden"></ul>
+<div id="groups">
+{{range .Groups}}<section class="group"><h2 title="{{.CWD}}">{{if .Name}}{{.Name}}{{else}}{{base .CWD}}{{end}} <span class="meta">{{.CWD}}</span></h2>{{if .Description}}<p class="meta">{{.Description}}</p>{{end}}<ul>
+{{range .Sessions}}<li><a href="{{.File}}">{{.Title}}</a> <span class="meta">{{date .FirstAt}} · {{.MessageCount}} messages · {{.Provider}}</span></li>
+{{end}}</ul></section>
+{{end}}</div>
+</main>
+<script>
+(function(){
+  var idx = null, input = document.getElementById('q'), results = document.getElementById('results'), groups = document.getElementById('groups');
+  function terms(s){ return (s.toLowerCase().match(/[\p{L}\p{N}]+/gu) || []).filter(function(t){ return t.length >= 2; }); }
+  function search(q){
+    var qt = terms(q), scores = null;
+    qt.forEach(function(t){
+      var hit = {};
+      for (var k in idx.terms) {
+        if (k.indexOf(t) !== 0) continue;
+        idx.terms[k].forEach(function(p){ hit[p[0]] = (hit[p[0]] || 0) + p[1] * (k === t ? 2 : 1); });
+      }
+      if (scores === null) { scores = hit; return; }
+      for (var d in scores) { if (!(d in hit)) delete scores[d]; else scores[d] += hit[d]; }
+    });
+    return Object.keys(scores || {}).map(function(d){ return [+d, scores[d]]; }).sort(function(a,b){ return b[1]-a[1]; }).slice(0, 100);
+  }
+  function render(q){
+    if (!q.trim()) { results.classList.add('hidden'); groups.classList.remove('hidden'); return; }
+    results.innerHTML = '';
+    search(q).forEach(function(h){
+      var doc = idx.docs[h[0]], li = document.createElement('li'), a = document.createElement('a'), meta = document.createElement('span');
+      a.href = doc.u; a.textContent = doc.t; meta.className = 'meta'; meta.textContent = ' ' + [doc.d, doc.c].filter(Boolean).join(' · ');
+      li.appendChild(a); li.appendChild(meta); results.appendChild(li);
+    });
+    if (!results.children.length) results.textContent = 'No matches.';
+    results.classList.remove('hidden'); groups.classList.add('hidden');
+  }
+  input.addEventListener('input', function(){
+    if (idx) { render(input.value); return; }
+    fetch('search-index.json').then(function(r){ return r.json(); }).then(function(j){ idx = j; render(input.value); })
+      .catch(function(){ results.textContent = 'Search needs the site to be served over HTTP.'; results.classList.remove('hidden'); });
+  });
+})();
+</script>
+</body></html>
+`))
+
+var siteSessionTmpl = template.Must(template.New("site-session").Funcs(siteFuncs).Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>{{.S.Title}} — {{.Site}}</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>` + siteCSS + `</style></head>
+<body>
+<header><a href="../index.html">← {{.Site}}</a></header>
+<main>
+<h1>{{.S.Title}}</h1>
+<p class="meta">{{.S.CWD}} · {{ts .S.FirstAt}} – {{ts .S.LastAt}}{{if .S.ActiveDuration}} · {{active .S.ActiveDuration}} active{{end}} · {{.S.Provider}} · {{.S.ID}}</p>
+{{if .S.Meta}}<dl class="metablock">{{range .S.Meta}}<dt>{{.Key}}</dt><dd>{{.Value}}</dd>{{end}}</dl>
+{{end}}{{range .S.Messages}}<div class="msg {{.Role}}"><span class="pill">{{if .Role}}{{.Role}}{{else}}{{.Type}}{{end}}</span>{{if .ToolName}} <span class="meta">{{.ToolName}}</span>{{end}} <span class="meta">{{ts .Ts}}{{if .Model}} · {{.Model}}{{end}}</span>
+<pre>{{.Content}}</pre></div>
+{{end}}{{if .S.Stats}}<h2>Stats</h2><dl class="metablock">{{range .S.Stats}}<dt>{{.Key}}</dt><dd>{{.Value}}</dd>{{end}}</dl>
+{{end}}</main>
+</body></html>
+`))
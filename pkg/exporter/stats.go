@@ -0,0 +1,78 @@
+package exporter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// statsFields summarizes the exported messages for the stats footer
+// (Filters.Stats): message counts by role, tool calls by tool, the time from
+// the first to the last timestamped message, and estimated tokens by role.
+// Messages without a role count under their type; tool calls are the ones
+// selectSessionMessages recorded.
+func statsFields(msgs []ExportMessage) []metaField {
+	roles := make(map[string]int)
+	tokens := make(map[string]int)
+	tools := make(map[string]int)
+	calls, total := 0, 0
+	var first, last time.Time
+	for _, m := range msgs {
+		role := strings.ToLower(strings.TrimSpace(m.Role))
+		if role == "" {
+			role = m.Type
+		}
+		if role == "" {
+			role = "message"
+		}
+		roles[role]++
+		n := EstimateTokens(m.Content) + perMessageTokens
+		tokens[role] += n
+		total += n
+		for _, name := range m.tools {
+			calls++
+			tools[name]++
+		}
+		if !m.Ts.IsZero() {
+			if first.IsZero() || m.Ts.Before(first) {
+				first = m.Ts
+			}
+			if m.Ts.After(last) {
+				last = m.Ts
+			}
+		}
+	}
+	out := []metaField{
+		{"Messages", countList(len(msgs), roles)},
+		{"Tool calls", countList(calls, tools)},
+	}
+	if !first.IsZero() {
+		out = append(out, metaField{"Duration", FormatActive(last.Sub(first))})
+	}
+	out = append(out, metaField{"Estimated tokens", "~" + countList(total, tokens)})
+	return out
+}
+
+// countList renders a total with its breakdown, "4 (a 3, b 1)", largest
+// first.
+func countList(total int, counts map[string]int) string {
+	if len(counts) == 0 {
+		return fmt.Sprint(total)
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s %d", k, counts[k])
+	}
+	return fmt.Sprintf("%d (%s)", total, strings.Join(parts, ", "))
+}
@@ -0,0 +1,116 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// TimesheetRow is the active time spent in one directory on one day.
+type TimesheetRow struct {
+	Date           string        `json:"date"` // YYYY-MM-DD
+	CWD            string        `json:"cwd"`
+	Project        string        `json:"project"` // directory display name, else its base name
+	Sessions       int           `json:"sessions"`
+	ActiveDuration time.Duration `json:"active_duration"`
+	Hours          float64       `json:"hours"` // ActiveDuration rounded to 0.01 h
+}
+
+// Timesheet is a month of active time per day and directory.
+type Timesheet struct {
+	Month          string         `json:"month"` // YYYY-MM
+	Rows           []TimesheetRow `json:"rows"`
+	ActiveDuration time.Duration  `json:"active_duration"`
+	Hours          float64        `json:"hours"`
+}
+
+// ParseMonth reads "2025-06" in loc as the first instant of that month; an
+// empty string is the month of now.
+func ParseMonth(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		now = now.In(loc)
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc), nil
+	}
+	t, err := time.ParseInLocation("2006-01", s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid month %q (want YYYY-MM)", s)
+	}
+	return t, nil
+}
+
+// BuildTimesheet totals active time (see indexer.ActiveDuration) per day and
+// session directory for the month starting at month, over sessions whose
+// directory starts with cwdPrefix. Days are calendar days in month's
+// location; rows are sorted by day, then directory.
+func BuildTimesheet(idx *indexer.Indexer, cwdPrefix string, month time.Time) Timesheet {
+	loc := month.Location()
+	end := month.AddDate(0, 1, 0)
+	type key struct{ date, cwd string }
+	rows := make(map[key]*TimesheetRow)
+	for _, s := range idx.Sessions() {
+		if cwdPrefix != "" && !strings.HasPrefix(s.CWD, cwdPrefix) {
+			continue
+		}
+		if s.LastAt.Before(month) || !s.FirstAt.Before(end) {
+			continue
+		}
+		var msgs []*indexer.Message
+		for _, m := range indexer.VisibleMessages(idx.PeekMessages(s.ID), 0) {
+			if !m.Ts.IsZero() && !m.Ts.Before(month) && m.Ts.Before(end) {
+				msgs = append(msgs, m)
+			}
+		}
+		for day, d := range idx.ActiveByDay(msgs, loc) {
+			k := key{day, s.CWD}
+			r := rows[k]
+			if r == nil {
+				project := s.DirName
+				if project == "" {
+					project = s.CWDBase
+				}
+				r = &TimesheetRow{Date: day, CWD: s.CWD, Project: project}
+				rows[k] = r
+			}
+			r.Sessions++
+			r.ActiveDuration += d
+		}
+	}
+	ts := Timesheet{Month: month.Format("2006-01"), Rows: make([]TimesheetRow, 0, len(rows))}
+	for _, r := range rows {
+		r.Hours = hours(r.ActiveDuration)
+		ts.Rows = append(ts.Rows, *r)
+		ts.ActiveDuration += r.ActiveDuration
+	}
+	sort.Slice(ts.Rows, func(i, j int) bool {
+		if ts.Rows[i].Date != ts.Rows[j].Date {
+			return ts.Rows[i].Date < ts.Rows[j].Date
+		}
+		return ts.Rows[i].CWD < ts.Rows[j].CWD
+	})
+	ts.Hours = hours(ts.ActiveDuration)
+	return ts
+}
+
+// WriteTimesheetCSV writes ts as CSV with a header and a closing total row.
+func WriteTimesheetCSV(w io.Writer, ts Timesheet) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"date", "project", "cwd", "sessions", "hours"})
+	for _, r := range ts.Rows {
+		_ = cw.Write([]string{r.Date, r.Project, r.CWD, strconv.Itoa(r.Sessions), strconv.FormatFloat(r.Hours, 'f', 2, 64)})
+	}
+	_ = cw.Write([]string{"total " + ts.Month, "", "", "", strconv.FormatFloat(ts.Hours, 'f', 2, 64)})
+	cw.Flush()
+	return cw.Error()
+}
+
+func hours(d time.Duration) float64 {
+	return math.Round(d.Hours()*100) / 100
+}
@@ -0,0 +1,42 @@
+package exporter
+
+import (
+	"strings"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// writeTodosMD renders a session's latest plan as a Markdown task list
+// under the given heading.
+func writeTodosMD(b *strings.Builder, heading string, todos []indexer.Todo, anon *Anonymizer) {
+	b.WriteString(heading + "\n\n")
+	for _, t := range todos {
+		box := "[ ]"
+		if !t.Open() {
+			box = "[x]"
+		}
+		b.WriteString("- " + box + " " + escapeMD(anon.Apply(t.Text)))
+		if t.Status == "in_progress" {
+			b.WriteString(" _(in progress)_")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+}
+
+// writeTodosText is the plain-text form of writeTodosMD.
+func writeTodosText(b *strings.Builder, todos []indexer.Todo, anon *Anonymizer) {
+	b.WriteString("== TODOS ==\n")
+	for _, t := range todos {
+		box := "[ ]"
+		if !t.Open() {
+			box = "[x]"
+		}
+		b.WriteString(box + " " + anon.Apply(t.Text))
+		if t.Status == "in_progress" {
+			b.WriteString(" (in progress)")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+}
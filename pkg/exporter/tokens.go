@@ -0,0 +1,53 @@
+package exporter
+
+import "codex-watcher/pkg/indexer"
+
+// perMessageTokens approximates the role header and separators a chat model
+// spends on each message in addition to its text.
+const perMessageTokens = 4
+
+// EstimateTokens is indexer.EstimateTokens, kept here for export callers.
+func EstimateTokens(s string) int { return indexer.EstimateTokens(s) }
+
+// trimToTokenBudget returns the suffix of msgs that fits within budget tokens,
+// keeping whole turns (a user message plus everything after it up to the next
+// user message) where possible. If even the newest turn is too large, its most
+// recent messages that fit are kept; the newest message is always kept.
+func trimToTokenBudget[T any](msgs []T, budget int, role func(T) string, text func(T) string) []T {
+	if budget <= 0 || len(msgs) == 0 {
+		return msgs
+	}
+	cost := func(m T) int { return EstimateTokens(text(m)) + perMessageTokens }
+
+	start := len(msgs)
+	used := 0
+	for start > 0 {
+		// find the beginning of the turn that ends at start-1
+		turnStart := start - 1
+		for turnStart > 0 && role(msgs[turnStart]) != "user" {
+			turnStart--
+		}
+		turnCost := 0
+		for _, m := range msgs[turnStart:start] {
+			turnCost += cost(m)
+		}
+		if used+turnCost <= budget {
+			used += turnCost
+			start = turnStart
+			continue
+		}
+		if start == len(msgs) {
+			// newest turn alone is over budget: keep its tail
+			for start > turnStart {
+				c := cost(msgs[start-1])
+				if used+c > budget && start < len(msgs) {
+					break
+				}
+				used += c
+				start--
+			}
+		}
+		break
+	}
+	return msgs[start:]
+}
@@ -0,0 +1,102 @@
+package exporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// TurnRanges selects turns by number (see indexer.GroupTurns): each entry is
+// an inclusive [from, to] pair, with to = 0 meaning "through the last turn".
+// An empty TurnRanges selects everything.
+type TurnRanges [][2]int
+
+// ParseTurnRanges parses a selection such as "3-7", "2,5,9-", or "4".
+func ParseTurnRanges(spec string) (TurnRanges, error) {
+	var out TurnRanges
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil || from < 0 {
+			return nil, fmt.Errorf("invalid turn range %q", part)
+		}
+		to := from
+		if isRange {
+			to = 0
+			if hi = strings.TrimSpace(hi); hi != "" {
+				if to, err = strconv.Atoi(hi); err != nil || to < from {
+					return nil, fmt.Errorf("invalid turn range %q", part)
+				}
+			}
+		}
+		out = append(out, [2]int{from, to})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("empty turn selection")
+	}
+	return out, nil
+}
+
+// Has reports whether turn n is selected.
+func (tr TurnRanges) Has(n int) bool {
+	if len(tr) == 0 {
+		return true
+	}
+	for _, r := range tr {
+		if n >= r[0] && (r[1] == 0 || n <= r[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the selection back in ParseTurnRanges syntax.
+func (tr TurnRanges) String() string {
+	parts := make([]string, 0, len(tr))
+	for _, r := range tr {
+		switch {
+		case r[1] == 0:
+			parts = append(parts, strconv.Itoa(r[0])+"-")
+		case r[0] == r[1]:
+			parts = append(parts, strconv.Itoa(r[0]))
+		default:
+			parts = append(parts, strconv.Itoa(r[0])+"-"+strconv.Itoa(r[1]))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// selectTurns keeps the messages belonging to the selected turns, in their
+// original order.
+func selectTurns(msgs []*indexer.Message, tr TurnRanges) []*indexer.Message {
+	if len(tr) == 0 {
+		return msgs
+	}
+	keep := make(map[*indexer.Message]bool, len(msgs))
+	for _, t := range indexer.GroupTurns(msgs) {
+		if !tr.Has(t.Index) {
+			continue
+		}
+		if t.Prompt != nil {
+			keep[t.Prompt] = true
+		}
+		for _, group := range [][]*indexer.Message{t.Reasoning, t.Tools, t.Answer, t.Other} {
+			for _, m := range group {
+				keep[m] = true
+			}
+		}
+	}
+	out := make([]*indexer.Message, 0, len(keep))
+	for _, m := range msgs {
+		if keep[m] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
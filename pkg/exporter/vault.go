@@ -0,0 +1,189 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// vaultIndexFile remembers which note belongs to which session, so notes keep
+// their file name when a session title changes later.
+const vaultIndexFile = ".codex-watcher-sync.json"
+
+// VaultSync mirrors finished sessions into an Obsidian/Logseq vault folder as
+// Markdown notes with YAML frontmatter. It only creates and updates notes;
+// nothing in the vault is ever deleted.
+type VaultSync struct {
+	Dir     string        // vault folder notes are written to
+	BaseURL string        // watcher origin for deep links, e.g. http://localhost:7077
+	Idle    time.Duration // a session is finished once idle this long
+
+	entries map[string]vaultEntry // by session id
+	loaded  bool
+}
+
+type vaultEntry struct {
+	File   string    `json:"file"`
+	LastAt time.Time `json:"last_at"`
+}
+
+// Run syncs every interval until done is closed.
+func (v *VaultSync) Run(idx *indexer.Indexer, interval time.Duration, done <-chan struct{}) {
+	_, _ = v.SyncOnce(idx, time.Now())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			_, _ = v.SyncOnce(idx, time.Now())
+		}
+	}
+}
+
+// SyncOnce writes notes for sessions that are idle as of now and have changed
+// since they were last synced. It returns the number of notes written.
+func (v *VaultSync) SyncOnce(idx *indexer.Indexer, now time.Time) (int, error) {
+	if err := os.MkdirAll(v.Dir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create vault folder %s: %w", v.Dir, err)
+	}
+	if !v.loaded {
+		v.entries = make(map[string]vaultEntry)
+		if b, err := os.ReadFile(filepath.Join(v.Dir, vaultIndexFile)); err == nil {
+			_ = json.Unmarshal(b, &v.entries)
+		}
+		v.loaded = true
+	}
+
+	written := 0
+	var firstErr error
+	for _, s := range idx.Sessions() {
+		view, ok := idx.SessionView(s, indexer.VisibleMessages(idx.PeekMessages(s.ID), 0))
+		if !ok || view.LastAt.IsZero() || now.Sub(view.LastAt) < v.Idle {
+			continue
+		}
+		entry, seen := v.entries[s.ID]
+		if seen && !view.LastAt.After(entry.LastAt) {
+			continue
+		}
+		if !seen {
+			entry.File = v.noteName(view)
+		}
+		var buf bytes.Buffer
+		v.writeFrontmatter(&buf, view)
+		if _, err := WriteSession(&buf, idx, s.ID, "md", Filters{ExcludeShellCalls: true, ExcludeToolOutputs: true}); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		path := filepath.Join(v.Dir, entry.File)
+		if old, err := os.ReadFile(path); err != nil || !bytes.Equal(old, buf.Bytes()) {
+			if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			written++
+		}
+		entry.LastAt = view.LastAt
+		v.entries[s.ID] = entry
+	}
+	b, err := json.MarshalIndent(v.entries, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(v.Dir, vaultIndexFile), b)
+	}
+	if err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return written, firstErr
+}
+
+// noteName picks "<date> <title>.md", adding a numeric suffix if another
+// session already uses the name.
+func (v *VaultSync) noteName(s indexer.Session) string {
+	title := strings.TrimSpace(shorten(s.Title, 60))
+	if title == "" {
+		title = s.ID
+	}
+	base := s.FirstAt.Local().Format("2006-01-02") + " " + strings.ReplaceAll(sanitize(title), "_", " ")
+	taken := make(map[string]bool, len(v.entries))
+	for _, e := range v.entries {
+		taken[e.File] = true
+	}
+	name := base + ".md"
+	for n := 2; taken[name] || fileExists(filepath.Join(v.Dir, name)); n++ {
+		name = base + " " + strconv.Itoa(n) + ".md"
+	}
+	return name
+}
+
+func (v *VaultSync) writeFrontmatter(buf *bytes.Buffer, s indexer.Session) {
+	buf.WriteString("---\n")
+	fmt.Fprintf(buf, "title: %s\n", yamlString(s.Title))
+	fmt.Fprintf(buf, "session_id: %s\n", yamlString(s.ID))
+	if s.Provider != "" {
+		fmt.Fprintf(buf, "provider: %s\n", s.Provider)
+	}
+	if s.CWD != "" {
+		fmt.Fprintf(buf, "cwd: %s\n", yamlString(s.CWD))
+	}
+	if !s.FirstAt.IsZero() {
+		fmt.Fprintf(buf, "created: %s\n", s.FirstAt.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(buf, "updated: %s\n", s.LastAt.UTC().Format(time.RFC3339))
+	if s.ActiveDuration > 0 {
+		fmt.Fprintf(buf, "active_minutes: %d\n", int(s.ActiveDuration.Round(time.Minute)/time.Minute))
+	}
+	if len(s.Models) > 0 {
+		models := make([]string, 0, len(s.Models))
+		for m := range s.Models {
+			models = append(models, yamlString(m))
+		}
+		sort.Strings(models)
+		fmt.Fprintf(buf, "models: [%s]\n", strings.Join(models, ", "))
+	}
+	if v.BaseURL != "" {
+		fmt.Fprintf(buf, "watcher: %s\n", yamlString(strings.TrimRight(v.BaseURL, "/")+"/?session="+url.QueryEscape(s.ID)))
+	}
+	tags := []string{"codex-watcher"}
+	if s.CWDBase != "" {
+		tags = append(tags, yamlString(sanitize(s.CWDBase)))
+	}
+	fmt.Fprintf(buf, "tags: [%s]\n", strings.Join(tags, ", "))
+	buf.WriteString("---\n\n")
+}
+
+// yamlString quotes s as a YAML double-quoted scalar (JSON strings are valid YAML).
+func yamlString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package indexer
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// patchFileMarkers start the lines of an apply_patch body that name a file.
+var patchFileMarkers = []string{"*** Add File: ", "*** Update File: ", "*** Delete File: ", "*** Move to: "}
+
+// ToolCommands lists the shell commands a message runs: the command of a
+// Codex shell, exec_command, or local_shell call, or the Bash tool_use parts
+// of a Claude message. A "bash -lc <script>" wrapper is dropped.
+func ToolCommands(m *Message) []string {
+	var out []string
+	for _, call := range toolCalls(m) {
+		switch call.name {
+		case "shell", "container.exec", "local_shell", "exec_command", "shell_command", "bash":
+			for _, k := range []string{"command", "cmd"} {
+				if c := commandLine(call.args[k]); c != "" {
+					out = append(out, c)
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+// FilesTouched lists the files a message edits: the paths in an apply_patch
+// body (as its own tool or a shell heredoc) and the file_path of Claude's
+// Edit, MultiEdit, Write, and NotebookEdit tools.
+func FilesTouched(m *Message) []string {
+	var out []string
+	for _, call := range toolCalls(m) {
+		switch call.name {
+		case "edit", "multiedit", "write", "notebookedit":
+			for _, k := range []string{"file_path", "notebook_path"} {
+				if p := strings.TrimSpace(stringOr(call.args[k])); p != "" {
+					out = append(out, p)
+					break
+				}
+			}
+		default:
+			patch := stringOr(call.args["input"])
+			if patch == "" {
+				patch = commandLine(call.args["command"])
+			}
+			out = append(out, patchFiles(patch)...)
+		}
+	}
+	return out
+}
+
+// toolCall is one tool invocation with its lower-cased name and arguments;
+// a raw string argument (Codex's custom tools) is kept under "input".
+type toolCall struct {
+	name string
+	args map[string]any
+}
+
+func toolCalls(m *Message) []toolCall {
+	data := MessageData(m)
+	if data == nil {
+		return nil
+	}
+	switch strings.ToLower(m.Type) {
+	case "function_call", "custom_tool_call":
+		call := toolCall{name: strings.ToLower(stringOr(data["name"]))}
+		switch a := data["arguments"].(type) {
+		case map[string]any:
+			call.args = a
+		case string:
+			if json.Unmarshal([]byte(a), &call.args) != nil {
+				call.args = map[string]any{"input": a}
+			}
+		}
+		if in, ok := data["input"].(string); ok && call.args == nil {
+			call.args = map[string]any{"input": in}
+		}
+		return []toolCall{call}
+	case "local_shell_call":
+		action, _ := data["action"].(map[string]any)
+		return []toolCall{{name: "local_shell", args: action}}
+	}
+	mobj, ok := data["message"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	parts, _ := mobj["content"].([]any)
+	var out []toolCall
+	for _, p := range parts {
+		part, _ := p.(map[string]any)
+		if t, _ := part["type"].(string); t != "tool_use" {
+			continue
+		}
+		input, _ := part["input"].(map[string]any)
+		out = append(out, toolCall{name: strings.ToLower(stringOr(part["name"])), args: input})
+	}
+	return out
+}
+
+// commandLine renders a command given as a string or an argv list, without
+// a leading "bash -lc" (or sh -c) wrapper.
+func commandLine(v any) string {
+	switch c := v.(type) {
+	case string:
+		return strings.TrimSpace(c)
+	case []any:
+		argv := make([]string, 0, len(c))
+		for _, el := range c {
+			if s, ok := el.(string); ok {
+				argv = append(argv, s)
+			}
+		}
+		if len(argv) == 3 && (argv[0] == "bash" || argv[0] == "sh" || argv[0] == "zsh") && strings.HasPrefix(argv[1], "-") && strings.HasSuffix(argv[1], "c") {
+			return strings.TrimSpace(argv[2])
+		}
+		return strings.TrimSpace(strings.Join(argv, " "))
+	}
+	return ""
+}
+
+// patchFiles returns the file paths named in an apply_patch body.
+func patchFiles(patch string) []string {
+	if !strings.Contains(patch, "*** ") {
+		return nil
+	}
+	var out []string
+	for _, line := range strings.Split(patch, "\n") {
+		for _, marker := range patchFileMarkers {
+			if p, ok := strings.CutPrefix(strings.TrimSpace(line), marker); ok && strings.TrimSpace(p) != "" {
+				out = append(out, strings.TrimSpace(p))
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,260 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Attachment is an image or file a message carries: inline (base64 data,
+// written to AttachmentDir and served by ID) or referenced by URL or local
+// path.
+type Attachment struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"` // image|file
+	MediaType string `json:"media_type,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	URL       string `json:"url,omitempty"`    // remote reference, not downloaded
+	Path      string `json:"path,omitempty"`   // local file the log refers to
+	Cached    bool   `json:"cached,omitempty"` // the bytes are in AttachmentDir
+}
+
+// AttachmentDir is where attachment blobs are written, named by content
+// hash; "" records attachments without keeping their bytes. Local images a
+// log refers to are copied too, so screenshots outlive their temp files.
+// Blobs over MaxAttachmentSize are left out.
+//
+// Deprecated: set Options.AttachmentDir and Options.MaxAttachmentSize;
+// these are only their defaults.
+var (
+	AttachmentDir     string
+	MaxAttachmentSize int64 = 20 << 20
+)
+
+// blobCache is where an indexer keeps attachment bytes.
+type blobCache struct {
+	dir string
+	max int64
+}
+
+func (x *Indexer) blobs() blobCache {
+	return blobCache{dir: x.opts.AttachmentDir, max: x.opts.MaxAttachmentSize}
+}
+
+var attachmentIDRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// imageExts are the local files copied into AttachmentDir.
+var imageExts = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".bmp": true}
+
+// extractAttachments finds the attachments of a raw line: Claude image and
+// document parts ({"type":"image","source":{"type":"base64",...}}, also
+// inside tool results) and Codex input_image parts (image_url as a data
+// URL or link) and local_image parts (a path). Inline data is written to
+// the cache directory.
+func (c blobCache) extractAttachments(raw map[string]any) []Attachment {
+	var out []Attachment
+	seen := make(map[string]bool)
+	add := func(a Attachment) {
+		if a.ID != "" && !seen[a.ID] {
+			seen[a.ID] = true
+			out = append(out, a)
+		}
+	}
+	var walk func(v any, depth int)
+	walk = func(v any, depth int) {
+		if depth > 8 {
+			return
+		}
+		switch t := v.(type) {
+		case []any:
+			for _, el := range t {
+				walk(el, depth+1)
+			}
+		case map[string]any:
+			if a, ok := c.attachmentPart(t); ok {
+				add(a)
+				return
+			}
+			for _, k := range []string{"message", "payload", "content", "toolUseResult"} {
+				if c, ok := t[k]; ok {
+					walk(c, depth+1)
+				}
+			}
+		}
+	}
+	walk(raw, 0)
+	return out
+}
+
+// attachmentPart reads one content part as an attachment.
+func (c blobCache) attachmentPart(p map[string]any) (Attachment, bool) {
+	typ := stringOr(p["type"])
+	switch typ {
+	case "image", "document", "file":
+		kind := "file"
+		if typ == "image" {
+			kind = "image"
+		}
+		src, _ := p["source"].(map[string]any)
+		if src == nil {
+			return Attachment{}, false
+		}
+		name := stringOr(p["title"])
+		switch stringOr(src["type"]) {
+		case "base64":
+			return c.inlineAttachment(kind, stringOr(src["media_type"]), name, stringOr(src["data"]))
+		case "url":
+			return refAttachment(kind, name, stringOr(src["url"]), "")
+		case "file":
+			return refAttachment(kind, name, "", stringOr(src["file_id"]))
+		}
+	case "input_image":
+		u := stringOr(p["image_url"])
+		if m, ok := p["image_url"].(map[string]any); ok {
+			u = stringOr(m["url"])
+		}
+		if rest, ok := strings.CutPrefix(u, "data:"); ok {
+			meta, data, _ := strings.Cut(rest, ",")
+			mediaType, enc, _ := strings.Cut(meta, ";")
+			if enc != "base64" {
+				return Attachment{}, false
+			}
+			return c.inlineAttachment("image", mediaType, "", data)
+		}
+		return refAttachment("image", "", u, "")
+	case "local_image", "localImage":
+		return c.localAttachment(stringOr(p["path"]))
+	}
+	return Attachment{}, false
+}
+
+// inlineAttachment decodes base64 data and caches the bytes.
+func (c blobCache) inlineAttachment(kind, mediaType, name, data string) (Attachment, bool) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil || len(b) == 0 {
+		return Attachment{}, false
+	}
+	if mediaType == "" {
+		mediaType = http.DetectContentType(b)
+	}
+	a := Attachment{ID: blobID(b), Kind: kind, MediaType: mediaType, Name: name, Size: int64(len(b))}
+	a.Cached = c.cacheBlob(a.ID, mediaType, b)
+	return a, true
+}
+
+// refAttachment records an attachment by reference (a URL or an upload's
+// file ID) without its bytes.
+func refAttachment(kind, name, url, fileID string) (Attachment, bool) {
+	ref := url
+	if ref == "" {
+		ref = fileID
+		name = strings.TrimSpace(name + " " + fileID)
+	}
+	if ref == "" {
+		return Attachment{}, false
+	}
+	return Attachment{ID: blobID([]byte(ref)), Kind: kind, Name: name, URL: url}, true
+}
+
+// localAttachment records an image file the log refers to, copying it
+// into the cache directory while it still exists.
+func (c blobCache) localAttachment(path string) (Attachment, bool) {
+	if path == "" {
+		return Attachment{}, false
+	}
+	a := Attachment{Kind: "image", Name: filepath.Base(path), Path: path, MediaType: mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))}
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() > c.max || !imageExts[strings.ToLower(filepath.Ext(path))] {
+		a.ID = blobID([]byte(path))
+		return a, true
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		a.ID = blobID([]byte(path))
+		return a, true
+	}
+	a.ID, a.Size = blobID(b), int64(len(b))
+	a.Cached = c.cacheBlob(a.ID, a.MediaType, b)
+	return a, true
+}
+
+func blobID(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:16])
+}
+
+// cacheBlob writes b to the cache directory as <id><ext> unless it is
+// there already, and reports whether it is.
+func (c blobCache) cacheBlob(id, mediaType string, b []byte) bool {
+	if c.dir == "" || int64(len(b)) > c.max {
+		return false
+	}
+	path := filepath.Join(c.dir, id+blobExt(mediaType))
+	if _, err := os.Stat(path); err == nil {
+		return true
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return false
+	}
+	tmp, err := writeTemp(path, b)
+	if err != nil {
+		return false
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return false
+	}
+	return true
+}
+
+func blobExt(mediaType string) string {
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+	switch mediaType {
+	case "image/jpeg":
+		return ".jpg" // not .jfif, which the table may list first
+	case "":
+		return ".bin"
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
+
+// AttachmentFile returns the cached blob of an attachment ID in
+// AttachmentDir and its media type; ok is false for unknown IDs and when no
+// AttachmentDir is set.
+//
+// Deprecated: use the Indexer method, which looks in Options.AttachmentDir.
+func AttachmentFile(id string) (path, mediaType string, ok bool) {
+	return blobCache{dir: AttachmentDir}.file(id)
+}
+
+// AttachmentFile returns the cached blob of an attachment ID and its media
+// type; ok is false for unknown IDs and when no Options.AttachmentDir is
+// set.
+func (x *Indexer) AttachmentFile(id string) (path, mediaType string, ok bool) {
+	return x.blobs().file(id)
+}
+
+func (c blobCache) file(id string) (path, mediaType string, ok bool) {
+	if c.dir == "" || !attachmentIDRe.MatchString(id) {
+		return "", "", false
+	}
+	matches, _ := filepath.Glob(filepath.Join(c.dir, id+".*"))
+	if len(matches) == 0 {
+		return "", "", false
+	}
+	path = matches[0]
+	if mediaType = mime.TypeByExtension(filepath.Ext(path)); mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	return path, mediaType, true
+}
@@ -0,0 +1,231 @@
+package indexer
+
+import (
+	"strings"
+	"time"
+)
+
+// Branch is one of the alternative continuations of a Fork: an edited prompt
+// with what followed it, or one more answer to the same prompt.
+type Branch struct {
+	StartID   string    `json:"start_id"`            // first message of the branch
+	PromptID  string    `json:"prompt_id,omitempty"` // the branch's own prompt, for edited prompts
+	Prompt    string    `json:"prompt,omitempty"`
+	AnswerIDs []string  `json:"answer_ids"`
+	Answer    string    `json:"answer"` // assistant replies, blank-line separated
+	Model     string    `json:"model,omitempty"`
+	StartAt   time.Time `json:"start_at,omitempty"`
+	Current   bool      `json:"current,omitempty"` // the branch the conversation went on from
+}
+
+// Fork is a point where a conversation was continued more than once: a
+// prompt edited and sent again, or an answer retried. Only Claude logs record
+// this, through each line's parentUuid.
+type Fork struct {
+	ParentID string     `json:"parent_id"`        // message the branches continue
+	PromptID string     `json:"prompt_id"`        // prompt shared by retried answers
+	Prompt   string     `json:"prompt,omitempty"` // ... and its text
+	Edited   bool       `json:"edited"`           // the branches start with different prompts
+	Branches []Branch   `json:"branches"`         // in the order written
+	Diffs    [][]DiffOp `json:"diffs,omitempty"`  // Diffs[i] turns branch i's answer into branch i+1's
+}
+
+// DiffOp is one line of a line diff: Op is "=" (both), "-" (only the old
+// text) or "+" (only the new text).
+type DiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// branchGroup tells which children of a message are alternatives of each
+// other: prompts compete with prompts and assistant lines with assistant
+// lines. Tool outputs do not branch (Claude links parallel tool results to
+// their own tool call).
+func branchGroup(m *Message) string {
+	switch TurnKind(m) {
+	case TurnPrompt:
+		return TurnPrompt
+	case TurnReasoning, TurnToolCall, TurnAnswer:
+		return "assistant"
+	}
+	return ""
+}
+
+// Forks finds the forks of a session's messages (in file order) and diffs
+// the answers of consecutive branches. The last branch written is the one
+// the conversation went on from; inside a branch, nested forks are followed
+// along their last branch too, and are reported on their own.
+func Forks(msgs []*Message) []Fork {
+	pos := make(map[string]int, len(msgs))
+	byID := make(map[string]*Message, len(msgs))
+	children := make(map[string][]*Message)
+	for i, m := range msgs {
+		id := stringOr(m.Raw["uuid"])
+		if id == "" {
+			continue
+		}
+		pos[id], byID[id] = i, m
+		if p := stringOr(m.Raw["parentUuid"]); p != "" {
+			children[p] = append(children[p], m)
+		}
+	}
+	// forks[parent] = the competing children, in file order
+	forks := make(map[string][]*Message)
+	var order []string
+	for _, m := range msgs {
+		parent := stringOr(m.Raw["parentUuid"])
+		if parent == "" || forks[parent] != nil {
+			continue
+		}
+		groups := make(map[string][]*Message)
+		for _, c := range children[parent] {
+			if g := branchGroup(c); g != "" {
+				groups[g] = append(groups[g], c)
+			}
+		}
+		for _, g := range []string{TurnPrompt, "assistant"} {
+			if len(groups[g]) > 1 {
+				forks[parent] = groups[g]
+				order = append(order, parent)
+				break
+			}
+		}
+	}
+
+	var out []Fork
+	for _, parent := range order {
+		alts := forks[parent]
+		f := Fork{ParentID: parent, Edited: branchGroup(alts[0]) == TurnPrompt}
+		if !f.Edited {
+			if p := promptBefore(byID, parent); p != nil {
+				f.PromptID, f.Prompt = stringOr(p.Raw["uuid"]), p.Content
+			}
+		}
+		for i, start := range alts {
+			b := Branch{StartID: stringOr(start.Raw["uuid"]), StartAt: start.Ts, Current: i == len(alts)-1, AnswerIDs: []string{}}
+			if f.Edited {
+				b.PromptID, b.Prompt = b.StartID, start.Content
+			}
+			var answer []*Message
+			walkBranch(start, children, forks, func(m *Message) {
+				if TurnKind(m) == TurnAnswer && strings.TrimSpace(m.Content) != "" {
+					answer = append(answer, m)
+				}
+			})
+			sortByPos(answer, pos)
+			var parts []string
+			for _, m := range answer {
+				b.AnswerIDs = append(b.AnswerIDs, stringOr(m.Raw["uuid"]))
+				parts = append(parts, strings.TrimSpace(m.Content))
+				if m.Model != "" {
+					b.Model = m.Model
+				}
+			}
+			b.Answer = strings.Join(parts, "\n\n")
+			f.Branches = append(f.Branches, b)
+		}
+		for i := 1; i < len(f.Branches); i++ {
+			f.Diffs = append(f.Diffs, DiffLines(f.Branches[i-1].Answer, f.Branches[i].Answer))
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// promptBefore walks up from id to the nearest prompt.
+func promptBefore(byID map[string]*Message, id string) *Message {
+	seen := make(map[string]bool)
+	for id != "" && !seen[id] {
+		seen[id] = true
+		m := byID[id]
+		if m == nil {
+			return nil
+		}
+		if TurnKind(m) == TurnPrompt {
+			return m
+		}
+		id = stringOr(m.Raw["parentUuid"])
+	}
+	return nil
+}
+
+// walkBranch visits start and what follows it up to the next prompt,
+// taking only the last branch of nested forks.
+func walkBranch(start *Message, children map[string][]*Message, forks map[string][]*Message, visit func(*Message)) {
+	seen := make(map[*Message]bool)
+	stack := []*Message{start}
+	for len(stack) > 0 {
+		m := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[m] || (m != start && TurnKind(m) == TurnPrompt) {
+			continue
+		}
+		seen[m] = true
+		visit(m)
+		id := stringOr(m.Raw["uuid"])
+		alts := forks[id]
+		for _, c := range children[id] {
+			if len(alts) > 0 && branchGroup(c) == branchGroup(alts[0]) && c != alts[len(alts)-1] {
+				continue
+			}
+			stack = append(stack, c)
+		}
+	}
+}
+
+func sortByPos(msgs []*Message, pos map[string]int) {
+	for i := 1; i < len(msgs); i++ {
+		for j := i; j > 0 && pos[stringOr(msgs[j].Raw["uuid"])] < pos[stringOr(msgs[j-1].Raw["uuid"])]; j-- {
+			msgs[j], msgs[j-1] = msgs[j-1], msgs[j]
+		}
+	}
+}
+
+// DiffLines is a line diff of a against b (longest common subsequence).
+func DiffLines(a, b string) []DiffOp {
+	x, y := splitLines(a), splitLines(b)
+	// lcs[i][j] is the common length of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	ops := []DiffOp{}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			ops = append(ops, DiffOp{"=", x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, DiffOp{"-", x[i]})
+			i++
+		default:
+			ops = append(ops, DiffOp{"+", y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		ops = append(ops, DiffOp{"-", x[i]})
+	}
+	for ; j < len(y); j++ {
+		ops = append(ops, DiffOp{"+", y[j]})
+	}
+	return ops
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(s, "\n"), "\n")
+}
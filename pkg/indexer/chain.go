@@ -0,0 +1,133 @@
+package indexer
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ContinuationWindow bounds how long before a continued session starts the
+// session it continues may have ended, when the logs do not name it.
+var ContinuationWindow = 12 * time.Hour
+
+// continuationSlack lets the earlier session's last line land slightly after
+// the continuation's first one (the handoff is written while it closes).
+const continuationSlack = time.Minute
+
+// parentKeys name the session a Codex session_meta continues.
+var parentKeys = []string{"forked_from_id", "forked_from", "parent_session_id", "parent_id", "resumed_from", "resumed_from_id", "previous_session_id", "continued_from"}
+
+// continuationPrefixes open the summary a compacted conversation restarts
+// from: Codex's compaction handoff and Claude's continuation summary.
+var continuationPrefixes = []string{
+	"Another language model started to solve this problem and produced a summary of its thinking process.",
+	"This session is being continued from a previous conversation",
+}
+
+// continuationOf reports whether a line marks its session as continuing an
+// earlier one, and that session's id when the line names it. Summaries only
+// count before the session has any content of its own; a compaction in the
+// middle of a session continues that same session.
+func continuationOf(raw map[string]any, msg *Message, hasContent bool) (string, bool) {
+	if stringOr(raw["type"]) == "session_meta" {
+		if p := firstString(mapOr(raw["payload"]), parentKeys...); p != "" {
+			return p, true
+		}
+		return "", false
+	}
+	if hasContent {
+		return "", false
+	}
+	if stringOr(raw["type"]) == "compacted" || raw["isCompactSummary"] == true {
+		return "", true
+	}
+	if msg.Role == "user" {
+		text := strings.TrimSpace(msg.Content)
+		for _, p := range continuationPrefixes {
+			if strings.HasPrefix(text, p) {
+				return "", true
+			}
+		}
+	}
+	return "", false
+}
+
+// noteContinuation records that s continues parent, or some earlier session
+// Sessions resolves when parent is "". The first named parent wins.
+func (s *Session) noteContinuation(parent string) {
+	if parent == s.ID {
+		return
+	}
+	if parent == "" {
+		s.continued = true
+		return
+	}
+	if s.ParentID == "" {
+		s.ParentID = parent
+	}
+}
+
+// linkChains fills ParentID for continued sessions that do not name their
+// parent (the latest session of the same provider and directory that ended
+// before it began, within ContinuationWindow), then ChildIDs and ThreadID.
+func linkChains(out []Session) {
+	byID := make(map[string]int, len(out))
+	for i := range out {
+		byID[out[i].ID] = i
+		out[i].ChildIDs = nil
+		out[i].ThreadID = ""
+	}
+	for i := range out {
+		s := &out[i]
+		if s.ParentID != "" || !s.continued || s.CWD == "" || s.FirstAt.IsZero() {
+			continue
+		}
+		best := -1
+		for j := range out {
+			p := &out[j]
+			if j == i || p.Provider != s.Provider || p.CWD != s.CWD || p.LastAt.IsZero() || !p.FirstAt.Before(s.FirstAt) {
+				continue
+			}
+			if p.LastAt.After(s.FirstAt.Add(continuationSlack)) || s.FirstAt.Sub(p.LastAt) > ContinuationWindow {
+				continue
+			}
+			if best < 0 || p.LastAt.After(out[best].LastAt) {
+				best = j
+			}
+		}
+		if best >= 0 {
+			s.ParentID = out[best].ID
+		}
+	}
+	for i := range out {
+		if j, ok := byID[out[i].ParentID]; ok && j != i {
+			out[j].ChildIDs = append(out[j].ChildIDs, out[i].ID)
+		}
+	}
+	for i := range out {
+		if len(out[i].ChildIDs) > 1 {
+			kids := out[i].ChildIDs
+			sort.Slice(kids, func(a, b int) bool {
+				return out[byID[kids[a]]].FirstAt.Before(out[byID[kids[b]]].FirstAt)
+			})
+		}
+	}
+	for i := range out {
+		_, hasParent := byID[out[i].ParentID]
+		if !hasParent && len(out[i].ChildIDs) == 0 {
+			continue
+		}
+		// walk up to the root; a cycle ends at the first repeat
+		root := i
+		seen := map[int]bool{i: true}
+		for {
+			j, ok := byID[out[root].ParentID]
+			if !ok || seen[j] {
+				break
+			}
+			seen[j] = true
+			root = j
+		}
+		out[i].ThreadID = out[root].ID
+	}
+}
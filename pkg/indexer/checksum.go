@@ -0,0 +1,106 @@
+package indexer
+
+import (
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+// After each tail the indexer keeps a CRC of the part of the file it has
+// read, and before the next one checks that part again: a file changed
+// behind the read offset (an edit by hand, a sync conflict copy written over
+// it) is read again from the start, like a truncated one. The CRC rolls
+// forward with the offset, over the bytes tailFile reads; the check reads
+// the whole part again, but only for files whose size or mod time changed.
+const maxEdits = 20 // ExternalEdit warnings kept for Stats
+
+// fileSum is the CRC of a file's first n bytes, taken when the file
+// had the given size and mod time.
+type fileSum struct {
+	n     int64
+	crc   uint32
+	size  int64
+	modAt time.Time
+}
+
+// ExternalEdit is a file found changed in a part the indexer had already
+// read; its sessions were rebuilt from the file.
+type ExternalEdit struct {
+	Path       string    `json:"path"`
+	SessionID  string    `json:"session_id"`
+	ReadBytes  int64     `json:"read_bytes"` // the offset the changed part lies before
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// readSum computes the CRC of the first n bytes of f.
+func readSum(f io.ReaderAt, n int64) (uint32, error) {
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, max(n, 0))); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+// noteSum records the CRC of the first n bytes of the open file f.
+// Callers hold scanMu.
+func (x *Indexer) noteSum(path string, f *os.File, n int64) {
+	crc, err := readSum(f, n)
+	if err != nil {
+		return
+	}
+	x.setSum(path, f, n, crc)
+}
+
+// setSum records crc as the CRC of the first n bytes of the open file f,
+// unless path was tailed past n or rewritten meanwhile. Callers hold scanMu.
+func (x *Indexer) setSum(path string, f *os.File, n int64, crc uint32) {
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	x.mu.Lock()
+	if x.positions[path] == n {
+		if x.sums == nil {
+			x.sums = make(map[string]fileSum)
+		}
+		x.sums[path] = fileSum{n: n, crc: crc, size: fi.Size(), modAt: fi.ModTime()}
+	}
+	x.mu.Unlock()
+}
+
+// checkSum reports whether path changed in the part read by its last tail, and if so forgets it, so the caller reads it from the start.
+// Files unchanged since then are not read. Callers hold scanMu and streamMu.
+func (x *Indexer) checkSum(path, sessionID string) bool {
+	x.mu.RLock()
+	sum, ok := x.sums[path]
+	x.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.Size() < sum.n || (fi.Size() == sum.size && fi.ModTime().Equal(sum.modAt)) {
+		return false // shrunk files are resetIfReplaced's
+	}
+	crc, err := readSum(f, sum.n)
+	if err != nil || crc == sum.crc {
+		return false
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if cur, ok := x.sums[path]; !ok || cur != sum {
+		return false // rewritten by the indexer meanwhile
+	}
+	x.forgetFileLocked(path)
+	x.stats.ExternalEdits++
+	x.edits = append(x.edits, ExternalEdit{Path: path, SessionID: sessionID, ReadBytes: sum.n, DetectedAt: time.Now().UTC()})
+	if len(x.edits) > maxEdits {
+		x.edits = x.edits[len(x.edits)-maxEdits:]
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package indexer
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ColdAfter is how long a session may go without being read or written
+// before its messages are compressed in memory (0 = never). Long-lived
+// daemons hold every message ever seen; most are never looked at again.
+//
+// Cold sessions are stored as zstd-compressed JSON and decompressed
+// transparently the next time anything asks for their messages. Session
+// metadata, stats, links, and todos are not compressed.
+//
+// Deprecated: set Options.ColdAfter; this is only its default.
+var ColdAfter time.Duration
+
+// The codecs only run EncodeAll and DecodeAll, which are safe to call
+// concurrently and start no goroutines of their own.
+var (
+	coldEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	coldDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+)
+
+// coldSession is the compressed form of one session's messages.
+type coldSession struct {
+	data     []byte
+	messages int
+	rawBytes int // uncompressed JSON size
+}
+
+// ColdStats describes the compressed part of the index.
+type ColdStats struct {
+	Sessions int `json:"sessions"`
+	Messages int `json:"messages"`
+	Bytes    int `json:"bytes"`     // compressed
+	RawBytes int `json:"raw_bytes"` // as JSON before compression
+}
+
+// touchLocked records that a session's messages were used. Callers hold
+// x.mu for writing.
+func (x *Indexer) touchLocked(sessionID string, now time.Time) {
+	if x.opts.ColdAfter <= 0 {
+		return
+	}
+	if x.touched == nil {
+		x.touched = make(map[string]time.Time)
+	}
+	x.touched[sessionID] = now
+}
+
+// thawLocked moves a cold session's messages back into x.messages. Callers
+// hold x.mu for writing.
+func (x *Indexer) thawLocked(sessionID string) {
+	c, ok := x.cold[sessionID]
+	if !ok {
+		return
+	}
+	delete(x.cold, sessionID)
+	x.messages[sessionID] = decodeCold(c)
+}
+
+// messagesLocked returns a session's messages without thawing it; cold
+// sessions are decoded into a throwaway copy. Callers hold x.mu.
+func (x *Indexer) messagesLocked(sessionID string) []*Message {
+	if c, ok := x.cold[sessionID]; ok {
+		return decodeCold(c)
+	}
+	return x.messages[sessionID]
+}
+
+func decodeCold(c *coldSession) []*Message {
+	var msgs []*Message
+	// the data was written by compressCold, so errors mean a bug; an
+	// empty session is the safest answer
+	if raw, err := coldDecoder.DecodeAll(c.data, make([]byte, 0, c.rawBytes)); err == nil {
+		_ = json.Unmarshal(raw, &msgs)
+	}
+	return msgs
+}
+
+// compressCold compresses the messages of every session untouched since
+// Options.ColdAfter before now. Run calls it on each rescan.
+func (x *Indexer) compressCold(now time.Time) {
+	if x.opts.ColdAfter <= 0 {
+		return
+	}
+	x.mu.RLock()
+	var ids []string
+	for id := range x.messages {
+		if t, ok := x.touched[id]; !ok || now.Sub(t) >= x.opts.ColdAfter {
+			ids = append(ids, id)
+		}
+	}
+	x.mu.RUnlock()
+	for _, id := range ids {
+		x.mu.Lock()
+		msgs, ok := x.messages[id]
+		t, seen := x.touched[id]
+		if !ok || len(msgs) == 0 || (seen && now.Sub(t) < x.opts.ColdAfter) {
+			x.mu.Unlock()
+			continue
+		}
+		// compress under the lock: an ingest or edit in between would be lost
+		raw, err := json.Marshal(msgs)
+		if err == nil {
+			if x.cold == nil {
+				x.cold = make(map[string]*coldSession)
+			}
+			x.cold[id] = &coldSession{data: coldEncoder.EncodeAll(raw, nil), messages: len(msgs), rawBytes: len(raw)}
+			delete(x.messages, id)
+			delete(x.touched, id)
+		}
+		x.mu.Unlock()
+	}
+}
+
+// coldStatsLocked totals the cold sessions. Callers hold x.mu.
+func (x *Indexer) coldStatsLocked() *ColdStats {
+	if len(x.cold) == 0 {
+		return nil
+	}
+	st := &ColdStats{Sessions: len(x.cold)}
+	for _, c := range x.cold {
+		st.Messages += c.messages
+		st.Bytes += len(c.data)
+		st.RawBytes += c.rawBytes
+	}
+	return st
+}
@@ -0,0 +1,156 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tokenPair is the input and output tokens of one model in a session.
+type tokenPair struct{ in, out int }
+
+// Cost is the price of in input and out output tokens in USD.
+func (p ModelPrice) Cost(in, out int) float64 {
+	return float64(in)/1000*p.InputPer1K + float64(out)/1000*p.OutputPer1K
+}
+
+// estimateCost prices the session's tokens with the prices of models.
+// Tokens read before any model was named are priced as the session's most
+// used model; tokens of models without a price are returned as unpriced.
+func (s Session) estimateCost(models ModelConfig) (cost float64, unpriced int) {
+	fallback, most := "", 0
+	for m, n := range s.Models {
+		if n > most || (n == most && m < fallback) {
+			fallback, most = m, n
+		}
+	}
+	for model, t := range s.modelTokens {
+		if model == "" {
+			model = fallback
+		}
+		p, ok := models.Price(model)
+		if !ok {
+			unpriced += t.in + t.out
+			continue
+		}
+		cost += p.Cost(t.in, t.out)
+	}
+	return cost, unpriced
+}
+
+// LoadPricing reads a pricing file mapping model names to ModelPrice, as
+// JSON ({"gpt-5": {"input_per_1k": 0.00125, "output_per_1k": 0.01}}) or,
+// for a .toml file, one table per model:
+//
+//	["gpt-5"]
+//	input_per_1k = 0.00125
+//	output_per_1k = 0.01
+//
+// Names are matched like ModelConfig.Prices keys.
+func LoadPricing(path string) (map[string]ModelPrice, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var prices map[string]ModelPrice
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		prices, err = parsePricingTOML(b)
+	} else {
+		err = json.Unmarshal(b, &prices)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	out := make(map[string]ModelPrice, len(prices))
+	for name, p := range prices {
+		if p.InputPer1K < 0 || p.OutputPer1K < 0 || p.CachedInputPer1K < 0 {
+			return nil, fmt.Errorf("%s: negative price for %q", path, name)
+		}
+		out[strings.ToLower(strings.TrimSpace(name))] = p
+	}
+	return out, nil
+}
+
+// parsePricingTOML reads the subset of TOML a pricing file needs: comments,
+// [model] or [prices.model] tables with quoted or bare names, and numeric
+// price keys.
+func parsePricingTOML(b []byte) (map[string]ModelPrice, error) {
+	prices := make(map[string]ModelPrice)
+	model := ""
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.Index(line, "#"); i >= 0 && !strings.Contains(line[:i], `"`) {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated table header", n)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if rest, ok := strings.CutPrefix(name, "prices."); ok {
+				name = rest
+			}
+			if unq, err := strconv.Unquote(name); err == nil {
+				name = unq
+			}
+			if name == "" {
+				return nil, fmt.Errorf("line %d: empty model name", n)
+			}
+			model = name
+			prices[model] = ModelPrice{}
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok || model == "" {
+			return nil, fmt.Errorf("line %d: expected key = value inside a [model] table", n)
+		}
+		f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(val), "_", ""), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		p := prices[model]
+		switch strings.TrimSpace(key) {
+		case "input_per_1k":
+			p.InputPer1K = f
+		case "cached_input_per_1k":
+			p.CachedInputPer1K = f
+		case "output_per_1k":
+			p.OutputPer1K = f
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %q", n, strings.TrimSpace(key))
+		}
+		prices[model] = p
+	}
+	return prices, sc.Err()
+}
+
+// SetPrices adds prices to the default Models config, replacing entries of
+// the same name. Indexers created afterwards use them.
+//
+// Deprecated: set Options.Models to Models.WithPrices(prices).
+func SetPrices(prices map[string]ModelPrice) {
+	Models = Models.WithPrices(prices)
+}
+
+// WithPrices returns a copy of c with prices added, replacing entries of
+// the same name.
+func (c ModelConfig) WithPrices(prices map[string]ModelPrice) ModelConfig {
+	merged := make(map[string]ModelPrice, len(c.Prices)+len(prices))
+	for k, v := range c.Prices {
+		merged[k] = v
+	}
+	for k, v := range prices {
+		merged[k] = v
+	}
+	c.Prices = merged
+	return c
+}
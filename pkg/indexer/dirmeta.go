@@ -0,0 +1,200 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dirsFile is the central registry of per-directory metadata keyed by cwd,
+// kept in the Codex directory.
+const dirsFile = "codex-watcher-dirs.json"
+
+// ProjectMetaFile is an optional file inside a project directory that ships
+// its metadata with the repo. Registry entries override its fields.
+const ProjectMetaFile = ".codex-watcher.json"
+
+// DirMeta is metadata attached to a working directory rather than a session.
+type DirMeta struct {
+	Name        string   `json:"name,omitempty"`        // display name for grouping headers
+	Description string   `json:"description,omitempty"` // shown under the name and in exports
+	Tags        []string `json:"tags,omitempty"`        // default tags for sessions in the directory
+	Color       string   `json:"color,omitempty"`       // color label name or #hex
+	Hidden      bool     `json:"hidden,omitempty"`      // left out of default listings
+	// ExportedThrough is the since_last watermark of /api/export/by_dir:
+	// messages at or before it were already exported for this cwd.
+	ExportedThrough time.Time `json:"exported_through,omitempty"`
+}
+
+func (m DirMeta) empty() bool {
+	return m.Name == "" && m.Description == "" && len(m.Tags) == 0 && m.Color == "" && !m.Hidden && m.ExportedThrough.IsZero()
+}
+
+// merge returns m with every non-empty field of over applied on top. Hidden
+// and ExportedThrough are taken from over alone: they live only in the
+// registry.
+func (m DirMeta) merge(over DirMeta) DirMeta {
+	if over.Name != "" {
+		m.Name = over.Name
+	}
+	if over.Description != "" {
+		m.Description = over.Description
+	}
+	if len(over.Tags) > 0 {
+		m.Tags = over.Tags
+	}
+	if over.Color != "" {
+		m.Color = over.Color
+	}
+	m.Hidden = over.Hidden
+	m.ExportedThrough = over.ExportedThrough
+	return m
+}
+
+// loadDirsLocked reads the directory registry once. The caller holds x.mu.
+func (x *Indexer) loadDirsLocked() {
+	if x.dirs != nil {
+		return
+	}
+	x.dirs = make(map[string]DirMeta)
+	if b, err := os.ReadFile(filepath.Join(x.codexDir, dirsFile)); err == nil {
+		_ = json.Unmarshal(b, &x.dirs)
+	}
+}
+
+// loadProjectMetaLocked reads <cwd>/.codex-watcher.json for every session
+// directory not seen yet. Reindex forgets them so edits are picked up. The
+// caller holds x.mu.
+func (x *Indexer) loadProjectMetaLocked() {
+	if x.projectDirs == nil {
+		x.projectDirs = make(map[string]DirMeta)
+	}
+	for _, s := range x.sessions {
+		if s.CWD == "" {
+			continue
+		}
+		if _, seen := x.projectDirs[s.CWD]; seen {
+			continue
+		}
+		var m DirMeta
+		if b, err := os.ReadFile(filepath.Join(s.CWD, ProjectMetaFile)); err == nil {
+			_ = json.Unmarshal(b, &m)
+		}
+		x.projectDirs[s.CWD] = m
+	}
+}
+
+// dirInfoLocked merges the project file and registry entry for cwd. The
+// caller holds x.mu (read or write).
+func (x *Indexer) dirInfoLocked(cwd string) DirMeta {
+	return x.projectDirs[cwd].merge(x.dirs[cwd])
+}
+
+// DirInfo returns the merged metadata for a directory.
+func (x *Indexer) DirInfo(cwd string) DirMeta {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.dirInfoLocked(cwd)
+}
+
+// DirMetas returns the merged metadata of every directory that has any.
+func (x *Indexer) DirMetas() map[string]DirMeta {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.loadDirsLocked()
+	out := make(map[string]DirMeta)
+	for cwd := range x.projectDirs {
+		if m := x.dirInfoLocked(cwd); !m.empty() {
+			out[cwd] = m
+		}
+	}
+	for cwd := range x.dirs {
+		if m := x.dirInfoLocked(cwd); !m.empty() {
+			out[cwd] = m
+		}
+	}
+	return out
+}
+
+// SetDirInfo replaces the registry's name, description, and default tags for
+// a directory, keeping its color. Empty values fall back to the project file.
+func (x *Indexer) SetDirInfo(cwd, name, description string, tags []string) error {
+	return x.updateDirMeta(cwd, func(m *DirMeta) {
+		m.Name = strings.TrimSpace(name)
+		m.Description = strings.TrimSpace(description)
+		m.Tags = nil
+		for _, t := range tags {
+			if t = strings.TrimSpace(t); t != "" {
+				m.Tags = append(m.Tags, t)
+			}
+		}
+	})
+}
+
+// SetDirHidden hides a directory's sessions from default listings, or shows
+// them again. Nothing is deleted.
+func (x *Indexer) SetDirHidden(cwd string, hidden bool) error {
+	return x.updateDirMeta(cwd, func(m *DirMeta) { m.Hidden = hidden })
+}
+
+// SetDirExportWatermark records that cwd has been exported through t.
+func (x *Indexer) SetDirExportWatermark(cwd string, t time.Time) error {
+	return x.updateDirMeta(cwd, func(m *DirMeta) { m.ExportedThrough = t.UTC() })
+}
+
+// updateDirMeta applies fn to the registry entry for cwd and saves the registry.
+func (x *Indexer) updateDirMeta(cwd string, fn func(*DirMeta)) error {
+	cwd = strings.TrimSpace(cwd)
+	if cwd == "" {
+		return fmt.Errorf("missing cwd")
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.loadDirsLocked()
+	m := x.dirs[cwd]
+	fn(&m)
+	x.revision++ // hidden directories drop out of the visible stats
+	if m.empty() {
+		delete(x.dirs, cwd)
+	} else {
+		x.dirs[cwd] = m
+	}
+	data, err := json.MarshalIndent(x.dirs, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(x.codexDir, dirsFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// mergeTags appends the tags of extra missing from tags.
+func mergeTags(tags, extra []string) []string {
+	if len(extra) == 0 {
+		return tags
+	}
+	out := append([]string(nil), tags...)
+	for _, t := range extra {
+		found := false
+		for _, have := range out {
+			if strings.EqualFold(have, t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, t)
+		}
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package indexer
+
+import "sort"
+
+// DiskUsage is how much space the session files of a set of sessions take,
+// per working directory, largest first.
+type DiskUsage struct {
+	Bytes    int64         `json:"bytes"`
+	Files    int           `json:"files"`
+	Sessions int           `json:"sessions"`
+	Projects []ProjectDisk `json:"projects"`
+}
+
+// ProjectDisk is the disk usage of the sessions of one working directory.
+// A file feeding several sessions counts once.
+type ProjectDisk struct {
+	CWD      string        `json:"cwd"`
+	Name     string        `json:"name,omitempty"` // directory metadata display name
+	Bytes    int64         `json:"bytes"`
+	Files    int           `json:"files"`
+	Sessions int           `json:"sessions"`
+	Largest  []SessionDisk `json:"largest"` // up to diskLargest sessions, largest first
+}
+
+// SessionDisk names one of a project's largest sessions.
+type SessionDisk struct {
+	ID    string `json:"id"`
+	Title string `json:"title,omitempty"`
+	Bytes int64  `json:"bytes"`
+}
+
+const diskLargest = 5
+
+// noteSizeLocked records the size of a tailed file. Callers hold x.mu for
+// writing.
+func (x *Indexer) noteSizeLocked(path string, size int64) {
+	if x.sizes == nil {
+		x.sizes = make(map[string]int64)
+	}
+	x.sizes[path] = size
+}
+
+// DiskUsage totals the sizes of the files behind sessions (as returned by
+// Sessions) per working directory. Sizes are as of the last time each file
+// was read.
+func (x *Indexer) DiskUsage(sessions []Session) DiskUsage {
+	x.mu.RLock()
+	sizes := make(map[string]int64)
+	for _, s := range sessions {
+		for _, p := range s.Paths {
+			sizes[p] = x.sizes[p]
+		}
+	}
+	x.mu.RUnlock()
+
+	byCWD := make(map[string]*ProjectDisk)
+	seen := make(map[string]map[string]bool) // cwd -> counted paths
+	counted := make(map[string]bool)
+	var out DiskUsage
+	for _, s := range sessions {
+		p := byCWD[s.CWD]
+		if p == nil {
+			p = &ProjectDisk{CWD: s.CWD, Name: s.DirName, Largest: []SessionDisk{}}
+			byCWD[s.CWD] = p
+			seen[s.CWD] = make(map[string]bool)
+		}
+		p.Sessions++
+		out.Sessions++
+		for _, path := range s.Paths {
+			if !seen[s.CWD][path] {
+				seen[s.CWD][path] = true
+				p.Files++
+				p.Bytes += sizes[path]
+			}
+			if !counted[path] {
+				counted[path] = true
+				out.Files++
+				out.Bytes += sizes[path]
+			}
+		}
+		p.Largest = append(p.Largest, SessionDisk{ID: s.ID, Title: s.Title, Bytes: s.DiskBytes})
+	}
+	out.Projects = make([]ProjectDisk, 0, len(byCWD))
+	for _, p := range byCWD {
+		sort.SliceStable(p.Largest, func(i, j int) bool {
+			if p.Largest[i].Bytes != p.Largest[j].Bytes {
+				return p.Largest[i].Bytes > p.Largest[j].Bytes
+			}
+			return p.Largest[i].ID < p.Largest[j].ID
+		})
+		if len(p.Largest) > diskLargest {
+			p.Largest = p.Largest[:diskLargest]
+		}
+		out.Projects = append(out.Projects, *p)
+	}
+	sort.Slice(out.Projects, func(i, j int) bool {
+		if out.Projects[i].Bytes != out.Projects[j].Bytes {
+			return out.Projects[i].Bytes > out.Projects[j].Bytes
+		}
+		return out.Projects[i].CWD < out.Projects[j].CWD
+	})
+	return out
+}
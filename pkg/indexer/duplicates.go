@@ -0,0 +1,209 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// DuplicateFile is one copy inside a DuplicateGroup.
+type DuplicateFile struct {
+	Path      string    `json:"path"`
+	Source    string    `json:"source"`
+	SessionID string    `json:"session_id,omitempty"`
+	Provider  string    `json:"provider,omitempty"`
+	ModAt     time.Time `json:"mod_at"`
+	Keep      bool      `json:"keep"`
+}
+
+// DuplicateGroup lists session files with byte-identical content.
+type DuplicateGroup struct {
+	Hash  string          `json:"hash"`
+	Size  int64           `json:"size"`
+	Files []DuplicateFile `json:"files"`
+}
+
+// FindDuplicates hashes indexed session files whose sizes collide and returns
+// groups of identical files. The first file of each group (oldest mtime) is
+// marked Keep.
+func (x *Indexer) FindDuplicates() ([]DuplicateGroup, error) {
+	x.mu.RLock()
+	paths := make([]string, 0, len(x.positions))
+	for p := range x.positions {
+		paths = append(paths, p)
+	}
+	owner := make(map[string]*Session)
+	for _, s := range x.sessions {
+		for _, src := range s.Sources {
+			owner[x.sourcePath(&Message{Source: src, Provider: s.Provider})] = s
+		}
+	}
+	x.mu.RUnlock()
+
+	bySize := make(map[int64][]string)
+	mod := make(map[string]time.Time)
+	for _, p := range paths {
+		if s := owner[p]; s != nil && readOnly(s) != nil {
+			continue
+		}
+		fi, err := os.Stat(p)
+		if err != nil || fi.Size() == 0 {
+			continue
+		}
+		bySize[fi.Size()] = append(bySize[fi.Size()], p)
+		mod[p] = fi.ModTime()
+	}
+
+	var groups []DuplicateGroup
+	for size, candidates := range bySize {
+		if len(candidates) < 2 {
+			continue
+		}
+		byHash := make(map[string][]string)
+		for _, p := range candidates {
+			h, err := hashFile(p)
+			if err != nil {
+				continue
+			}
+			byHash[h] = append(byHash[h], p)
+		}
+		for h, same := range byHash {
+			if len(same) < 2 {
+				continue
+			}
+			sort.Slice(same, func(i, j int) bool {
+				if !mod[same[i]].Equal(mod[same[j]]) {
+					return mod[same[i]].Before(mod[same[j]])
+				}
+				return same[i] < same[j]
+			})
+			g := DuplicateGroup{Hash: h, Size: size}
+			for i, p := range same {
+				df := DuplicateFile{Path: p, ModAt: mod[p], Keep: i == 0}
+				if s := owner[p]; s != nil {
+					df.SessionID = s.ID
+					df.Provider = s.Provider
+					df.Source = x.relSource(p, s.Provider)
+				} else {
+					df.Source = p
+				}
+				g.Files = append(g.Files, df)
+			}
+			groups = append(groups, g)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Size != groups[j].Size {
+			return groups[i].Size > groups[j].Size
+		}
+		return groups[i].Hash < groups[j].Hash
+	})
+	return groups, nil
+}
+
+// Dedupe moves every non-kept copy of each duplicate group into the trash and
+// drops what those copies added to the index (identical files often merged
+// into one session with doubled messages); sessions they fed are read again
+// from the files left. If hash is non-empty only that group is deduplicated.
+func (x *Indexer) Dedupe(hash string) ([]string, error) {
+	x.scanMu.Lock()
+	defer x.scanMu.Unlock()
+	x.streamMu.Lock()
+	defer x.streamMu.Unlock()
+
+	groups, err := x.FindDuplicates()
+	if err != nil {
+		return nil, err
+	}
+	var trashed, paths []string
+	for _, g := range groups {
+		if hash != "" && g.Hash != hash {
+			continue
+		}
+		for _, f := range g.Files {
+			if f.Keep {
+				continue
+			}
+			if _, err := x.trashFile(f.Path, TrashEntry{Kind: TrashDuplicate, SessionID: f.SessionID}); err != nil {
+				return trashed, errors.Join(err, x.forgetTrashed(paths))
+			}
+			trashed = append(trashed, f.Source)
+			paths = append(paths, f.Path)
+		}
+	}
+	if len(trashed) == 0 {
+		return nil, nil
+	}
+	return trashed, x.forgetTrashed(paths)
+}
+
+// forgetTrashed drops the sessions of the trashed files at paths and reads
+// the other files that fed them again from the start. Callers hold scanMu
+// and streamMu.
+func (x *Indexer) forgetTrashed(paths []string) error {
+	x.mu.Lock()
+	tailed := make(map[string]bool, len(x.positions))
+	for p := range x.positions {
+		tailed[p] = true
+	}
+	for _, p := range paths {
+		x.forgetFileLocked(p)
+		// the record tailFile made for the copy itself, left empty
+		if _, _, id, ok := x.fileIdentity(p); ok {
+			if s := x.sessions[id]; s != nil && len(s.Sources) == 0 {
+				x.forgetSessionLocked(id, p)
+			}
+		}
+		delete(x.inodes, p)
+		delete(tailed, p)
+	}
+	var reread []string
+	for p := range tailed {
+		if _, ok := x.positions[p]; !ok {
+			reread = append(reread, p)
+		}
+	}
+	x.mu.Unlock()
+	sort.Strings(reread)
+	var errs []error
+	for _, p := range reread {
+		if provider, project, sessionID, ok := x.fileIdentity(p); ok {
+			errs = append(errs, x.tailFile(provider, project, sessionID, p))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
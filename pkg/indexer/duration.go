@@ -0,0 +1,64 @@
+package indexer
+
+import (
+	"sort"
+	"time"
+)
+
+// IdleGap is the longest pause between consecutive messages still counted as
+// active time; longer gaps are treated as the user being away.
+//
+// Deprecated: set Options.IdleGap; this is only its default.
+var IdleGap = 5 * time.Minute
+
+// ActiveDuration sums the gaps between consecutive message timestamps,
+// skipping gaps longer than IdleGap. Messages without a timestamp are ignored.
+func ActiveDuration(msgs []*Message) time.Duration {
+	return activeDuration(msgs, IdleGap)
+}
+
+func activeDuration(msgs []*Message, idle time.Duration) time.Duration {
+	ts := sortedTimes(msgs)
+	var d time.Duration
+	for i := 1; i < len(ts); i++ {
+		if gap := ts[i].Sub(ts[i-1]); gap <= idle {
+			d += gap
+		}
+	}
+	return d
+}
+
+// ActiveByDay splits ActiveDuration by calendar day in loc, counting each
+// gap on the day of the message that ends it.
+func ActiveByDay(msgs []*Message, loc *time.Location) map[string]time.Duration {
+	return activeByDay(msgs, loc, IdleGap)
+}
+
+// ActiveByDay is the package ActiveByDay with the indexer's Options.IdleGap.
+func (x *Indexer) ActiveByDay(msgs []*Message, loc *time.Location) map[string]time.Duration {
+	return activeByDay(msgs, loc, x.opts.IdleGap)
+}
+
+func activeByDay(msgs []*Message, loc *time.Location, idle time.Duration) map[string]time.Duration {
+	ts := sortedTimes(msgs)
+	days := make(map[string]time.Duration)
+	for i := 1; i < len(ts); i++ {
+		if gap := ts[i].Sub(ts[i-1]); gap <= idle {
+			days[ts[i].In(loc).Format("2006-01-02")] += gap
+		}
+	}
+	return days
+}
+
+// sortedTimes returns the timestamps of msgs in order, leaving out messages
+// without one.
+func sortedTimes(msgs []*Message) []time.Time {
+	ts := make([]time.Time, 0, len(msgs))
+	for _, m := range msgs {
+		if m != nil && !m.Ts.IsZero() {
+			ts = append(ts, m.Ts)
+		}
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Before(ts[j]) })
+	return ts
+}
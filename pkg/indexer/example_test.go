@@ -0,0 +1,46 @@
+package indexer_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"codex-watcher/pkg/exporter"
+	"codex-watcher/pkg/indexer"
+	"codex-watcher/pkg/search"
+)
+
+// An embedded index: read a Codex directory once, list its sessions,
+// search them, and export one, without the HTTP daemon.
+func Example() {
+	dir, _ := os.MkdirTemp("", "codex")
+	defer os.RemoveAll(dir)
+	sessions := filepath.Join(dir, "sessions")
+	_ = os.MkdirAll(sessions, 0o755)
+	_ = os.WriteFile(filepath.Join(sessions, "s1.jsonl"), []byte(
+		`{"id":"m1","role":"user","content":"why is the build flaky?","timestamp":"2024-01-01T09:00:00Z"}`+"\n"+
+			`{"id":"m2","role":"assistant","content":"A race in the cache test.","timestamp":"2024-01-01T09:01:00Z"}`+"\n"), 0o644)
+
+	opts := indexer.DefaultOptions()
+	opts.ScanWorkers = 1
+	idx := indexer.New([]string{dir}, "", opts)
+	if err := idx.Reindex(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, s := range idx.Sessions() {
+		fmt.Println(s.ID, s.MessageCount, s.Title)
+	}
+	res := search.New(idx, search.CurrentOptions()).Exec(search.Parse("race", "all"), 10, 0)
+	fmt.Println(res.Total, res.Hits[0].MessageID)
+	var b strings.Builder
+	if _, err := exporter.WriteSession(&b, idx, "s1", "txt", exporter.Filters{}); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(strings.Contains(b.String(), "A race in the cache test."))
+	// Output:
+	// s1 2 why is the build flaky?
+	// 1 m2
+	// true
+}
@@ -0,0 +1,73 @@
+package indexer
+
+import "strings"
+
+// GitInfo is the git metadata a line carries.
+type GitInfo struct {
+	Branch string
+	Repo   string // remote URL
+	Commit string
+}
+
+// extractGit reads git metadata from a line: Codex's session_meta has
+// payload.git {branch, repository_url, commit_hash}, Claude lines carry a
+// top-level gitBranch. Either shape may appear at the top level or in the
+// payload.
+func extractGit(raw map[string]any) GitInfo {
+	var g GitInfo
+	for _, data := range []map[string]any{raw, mapOr(raw["payload"])} {
+		if data == nil {
+			continue
+		}
+		if g.Branch == "" {
+			g.Branch = firstString(data, "gitBranch", "git_branch")
+		}
+		obj := mapOr(data["git"])
+		if obj == nil {
+			continue
+		}
+		if g.Branch == "" {
+			g.Branch = firstString(obj, "branch")
+		}
+		if g.Repo == "" {
+			g.Repo = firstString(obj, "repository_url", "remote_url", "remote", "repo")
+		}
+		if g.Commit == "" {
+			g.Commit = firstString(obj, "commit_hash", "commit", "sha")
+		}
+	}
+	// a detached HEAD is not a branch
+	if g.Branch == "HEAD" {
+		g.Branch = ""
+	}
+	return g
+}
+
+// noteGit records a line's git metadata on the session: the branch and
+// remote as last seen (both can change mid-session), the commit the session
+// started from.
+func (s *Session) noteGit(g GitInfo) {
+	if g.Branch != "" {
+		s.GitBranch = g.Branch
+	}
+	if g.Repo != "" {
+		s.GitRepo = g.Repo
+	}
+	if g.Commit != "" && s.GitCommit == "" {
+		s.GitCommit = g.Commit
+	}
+}
+
+func mapOr(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+func firstString(m map[string]any, keys ...string) string {
+	for _, k := range keys {
+		if v := strings.TrimSpace(stringOr(m[k])); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ProviderHistory reads what Codex keeps besides sessions in each Codex
+// directory: the prompt history (history.jsonl, one line per prompt sent)
+// and the prompt library (prompts/*.md, one reusable prompt per file).
+const ProviderHistory = "history"
+
+const (
+	historyFile      = "history.jsonl"
+	historyPrompts   = "prompts"
+	historySessionID = ProviderHistory + ":codex"   // all of history.jsonl
+	promptSessionPre = ProviderHistory + ":prompt:" // + file name without .md
+	promptType       = "prompt"                     // Message.Type of a library prompt
+	historyTitle     = "Codex prompt history"       // title of historySessionID
+	historyLineType  = "history"                    // Message.Type of a history.jsonl line
+	promptFileExt    = ".md"
+)
+
+// ErrReadOnly is returned for edits to sessions whose files the watcher does
+// not rewrite: Codex's prompt history and prompt files.
+var ErrReadOnly = errors.New("session is read-only")
+
+// readOnly returns ErrReadOnly for sessions of read-only providers.
+func readOnly(sess *Session) error {
+	if sess != nil && sess.Provider == ProviderHistory {
+		return fmt.Errorf("%w: %s", ErrReadOnly, sess.ID)
+	}
+	return nil
+}
+
+// documentProvider is implemented by providers some of whose files are
+// whole documents rather than JSONL logs. tailFile reads such a file as the
+// single line Document returns, and again in full whenever it changes.
+type documentProvider interface {
+	IsDocument(path string) bool
+	Document(path string, data []byte, modTime time.Time) map[string]any
+}
+
+// sessionTitler is implemented by providers whose sessions have a fixed
+// title rather than one taken from their first prompt.
+type sessionTitler interface {
+	SessionTitle(sessionID string) string
+}
+
+// historyProvider reads <root>/history.jsonl and <root>/prompts/*.md of
+// every Codex directory. The whole history is one session, each prompt file
+// one more; both are read-only.
+type historyProvider struct{}
+
+func (historyProvider) Name() string { return ProviderHistory }
+
+// SessionDir is the prompt library; watch mode picks up history.jsonl with
+// the periodic rescan.
+func (historyProvider) SessionDir(root string) string { return filepath.Join(root, historyPrompts) }
+
+func (p historyProvider) Discover(root string, fn func(path string)) {
+	if fi, err := os.Stat(filepath.Join(root, historyFile)); err == nil && fi.Mode().IsRegular() {
+		fn(filepath.Join(root, historyFile))
+	}
+	entries, _ := os.ReadDir(p.SessionDir(root))
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.EqualFold(filepath.Ext(e.Name()), promptFileExt) {
+			fn(filepath.Join(p.SessionDir(root), e.Name()))
+		}
+	}
+}
+
+func (p historyProvider) SessionIDFor(root, path string) (string, string, bool) {
+	if path == filepath.Join(root, historyFile) {
+		return "", historySessionID, true
+	}
+	name := filepath.Base(path)
+	if filepath.Dir(path) != p.SessionDir(root) || !strings.EqualFold(filepath.Ext(name), promptFileExt) {
+		return "", "", false
+	}
+	return "", promptSessionPre + strings.TrimSuffix(name, filepath.Ext(name)), true
+}
+
+// ParseLine reads a history line ({"session_id":...,"ts":<unix>,"text":...})
+// or a prompt file's document as a user prompt. History prompts stay in the
+// history session; raw keeps the Codex session they were sent in.
+func (historyProvider) ParseLine(_ string, raw map[string]any) (*Message, string) {
+	if stringOr(raw["type"]) == promptType {
+		return &Message{ID: promptType + ":" + stringOr(raw["name"]), Role: "user", Type: promptType, Content: stringOr(raw["content"])}, ""
+	}
+	return &Message{Role: "user", Type: historyLineType, Content: strings.TrimSpace(stringOr(raw["text"]))}, ""
+}
+
+func (historyProvider) IsDocument(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), promptFileExt)
+}
+
+// Document is the line a prompt file reads as, dated by its mod time.
+func (historyProvider) Document(path string, data []byte, modTime time.Time) map[string]any {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	raw := map[string]any{"type": promptType, "name": name, "content": string(data)}
+	if !modTime.IsZero() {
+		raw["timestamp"] = modTime.UTC().Format(time.RFC3339Nano)
+	}
+	return raw
+}
+
+func (historyProvider) SessionTitle(sessionID string) string {
+	if name, ok := strings.CutPrefix(sessionID, promptSessionPre); ok {
+		return "/" + name
+	}
+	return historyTitle
+}
+
+// tailDocument reads a whole-document file as one line, forgetting what an
+// earlier version of it contributed. Unchanged files are skipped.
+func (x *Indexer) tailDocument(d documentProvider, provider, project, sessionID, path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	x.mu.Lock()
+	pos, seen := x.positions[path]
+	s := x.sessions[sessionID]
+	if seen && pos == fi.Size() && s != nil && !fi.ModTime().After(s.FileModAt) {
+		x.mu.Unlock()
+		return nil
+	}
+	if seen {
+		x.forgetFileLocked(path)
+	}
+	x.mu.Unlock()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(d.Document(path, data, fi.ModTime()))
+	if err != nil {
+		return err
+	}
+	x.ingestLine(provider, project, sessionID, path, string(line))
+	x.mu.Lock()
+	x.positions[path] = int64(len(data))
+	x.noteSizeLocked(path, int64(len(data)))
+	x.mu.Unlock()
+	x.touchSessionFile(provider, project, sessionID, path, fi.ModTime(), int64(len(data)))
+	return nil
+}
@@ -0,0 +1,77 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Scan limits. A file matching one of IgnorePatterns, last modified more
+// than MaxFileAge ago, or larger than MaxFileSize bytes is not read; what
+// was read from it before stays indexed. Zero values turn a limit off.
+//
+// A pattern without a slash is matched (filepath.Match) against the file
+// name and each directory name under its root, e.g. "*.tmp.jsonl" or
+// "subagents"; one with a slash against the path relative to the root, or
+// the absolute path when it starts with one.
+//
+// Deprecated: set the Options fields of the same names; these are only
+// their defaults.
+var (
+	IgnorePatterns []string
+	MaxFileAge     time.Duration
+	MaxFileSize    int64
+)
+
+// skipFile reports whether the scan limits leave path out.
+func (x *Indexer) skipFile(provider, path string) bool {
+	o := &x.opts
+	if ignoredPath(o.IgnorePatterns, x.rootOf(path, provider), path) {
+		return true
+	}
+	if o.MaxFileAge <= 0 && o.MaxFileSize <= 0 {
+		return false
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false // the scan reports it
+	}
+	if o.MaxFileAge > 0 && time.Since(fi.ModTime()) > o.MaxFileAge {
+		return true
+	}
+	return o.MaxFileSize > 0 && fi.Size() > o.MaxFileSize
+}
+
+// ignoredPath matches path, found under root, against patterns.
+func ignoredPath(patterns []string, root, path string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(path)
+	}
+	rel = filepath.ToSlash(rel)
+	for _, p := range patterns {
+		p = filepath.ToSlash(strings.TrimSpace(p))
+		switch {
+		case p == "":
+		case strings.HasPrefix(p, "/"):
+			if ok, _ := filepath.Match(p, filepath.ToSlash(path)); ok {
+				return true
+			}
+		case strings.Contains(p, "/"):
+			if ok, _ := filepath.Match(p, rel); ok {
+				return true
+			}
+		default:
+			for _, name := range strings.Split(rel, "/") {
+				if ok, _ := filepath.Match(p, name); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
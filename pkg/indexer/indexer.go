@@ -0,0 +1,1882 @@
+// Package indexer reads Codex and Claude session logs (JSONL) into an
+// in-memory index of sessions and messages and keeps it current as the
+// files grow. The codex-watcher daemon serves it over HTTP; other programs
+// can embed it directly:
+//
+//	idx := indexer.New([]string{codexDir}, claudeDir)
+//	go idx.Run(ctx.Done()) // or idx.Reindex() to read everything once
+//	for _, s := range idx.Sessions() {
+//		msgs := idx.Messages(s.ID, 0)
+//		...
+//	}
+//
+// Revision grows whenever the index changes, so a front end can poll it
+// cheaply to know when to redraw. Settings of one indexer are given to New
+// as Options; the package variables of the same names are only their
+// defaults.
+package indexer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants for indexer configuration and limits
+const (
+	maxTitleLen   = 80         // Maximum length for session titles before truncation
+	uuidLen       = 36         // Standard UUID string length (8-4-4-4-12 format)
+	uuidDashCount = 4          // Number of dashes in a UUID
+	rolloutPrefix = "rollout-" // Prefix for Codex rollout session files
+
+	// Provider identifiers
+	ProviderCodex  = "codex"
+	ProviderClaude = "claude"
+)
+
+// Message represents a single JSONL event/message extracted from Codex logs.
+type Message struct {
+	ID           string         `json:"id,omitempty"`
+	SessionID    string         `json:"session_id,omitempty"`
+	Ts           time.Time      `json:"ts,omitempty"`
+	Role         string         `json:"role,omitempty"`
+	Content      string         `json:"content,omitempty"`
+	Thinking     string         `json:"thinking,omitempty"`
+	Model        string         `json:"model,omitempty"`
+	Type         string         `json:"type,omitempty"`
+	ToolName     string         `json:"tool_name,omitempty"`
+	ToolKind     string         `json:"tool_kind,omitempty"` // shell|mcp|builtin for tool calls, set at ingest
+	Raw          map[string]any `json:"raw,omitempty"`
+	Source       string         `json:"source"`   // relative file path
+	Provider     string         `json:"provider"` // codex|claude
+	LineNo       int            `json:"line_no"`
+	RawTruncated bool           `json:"raw_truncated,omitempty"` // Raw has long strings cut; see FullRaw
+	TokenCount   int            `json:"token_count,omitempty"`   // EstimateTokens of Content and Thinking, set at ingest
+	TsEstimated  bool           `json:"ts_estimated,omitempty"`  // the line has no timestamp; Ts is a neighbour's or the file's mod time
+	Attachments  []Attachment   `json:"attachments,omitempty"`   // images and files in the content, set at ingest
+}
+
+// Session aggregates messages by session id or file.
+type Session struct {
+	ID              string               `json:"id"`
+	Title           string               `json:"title,omitempty"`
+	FirstAt         time.Time            `json:"first_at,omitempty"`
+	LastAt          time.Time            `json:"last_at,omitempty"`
+	ActiveDuration  time.Duration        `json:"active_duration,omitempty"` // span minus gaps over Options.IdleGap; ns on the wire
+	FileModAt       time.Time            `json:"file_mod_at,omitempty"`
+	MessageCount    int                  `json:"message_count"`
+	TextCount       int                  `json:"text_count"`
+	InputTokens     int                  `json:"input_tokens"`              // TokenCount of prompts, context and tool outputs
+	OutputTokens    int                  `json:"output_tokens"`             // TokenCount of replies, reasoning and tool calls
+	Cost            float64              `json:"cost,omitempty"`            // estimated USD at Models prices, filled by Sessions
+	UnpricedTokens  int                  `json:"unpriced_tokens,omitempty"` // tokens of models without a price, not in Cost
+	CWD             string               `json:"cwd,omitempty"`
+	CWDBase         string               `json:"cwd_base,omitempty"`
+	GitBranch       string               `json:"git_branch,omitempty"` // latest branch the logs name
+	GitRepo         string               `json:"git_repo,omitempty"`   // remote URL
+	GitCommit       string               `json:"git_commit,omitempty"` // commit the session started from
+	Models          map[string]int       `json:"models,omitempty"`
+	Roles           map[string]int       `json:"roles,omitempty"`
+	Tags            []string             `json:"tags,omitempty"`
+	Sources         []string             `json:"sources,omitempty"`
+	Provider        string               `json:"provider,omitempty"`          // codex|claude
+	Project         string               `json:"project,omitempty"`           // for claude
+	Root            string               `json:"root,omitempty"`              // the Codex or Claude directory its file is under
+	Paths           []string             `json:"paths,omitempty"`             // absolute paths of Sources, filled by Sessions
+	DiskBytes       int64                `json:"disk_bytes,omitempty"`        // total size of Paths when last read, filled by Sessions
+	Pinned          bool                 `json:"pinned,omitempty"`            // from .meta.json; listed first
+	Color           string               `json:"color,omitempty"`             // own label, else the directory's
+	Archived        bool                 `json:"archived,omitempty"`          // from .meta.json
+	Summary         string               `json:"summary,omitempty"`           // from .meta.json, written by a person or tool
+	Notes           string               `json:"notes,omitempty"`             // from .meta.json
+	DirName         string               `json:"dir_name,omitempty"`          // display name from directory metadata
+	DirHidden       bool                 `json:"dir_hidden,omitempty"`        // directory is on the ignore list
+	MCPTools        map[string]int       `json:"mcp_tools,omitempty"`         // MCP tool calls per "server/tool"
+	Languages       map[string]int       `json:"languages,omitempty"`         // fenced code blocks per language
+	ToolCounts      map[string]int       `json:"tool_counts,omitempty"`       // tool calls per tool name
+	OpenTodos       int                  `json:"open_todos,omitempty"`        // unfinished items of the latest plan
+	FailureReasons  []string             `json:"failure_reasons,omitempty"`   // why the session is tagged FailedTag
+	ParentID        string               `json:"parent_id,omitempty"`         // session this one resumes or continues after a compaction
+	ChildIDs        []string             `json:"child_ids,omitempty"`         // sessions continuing this one, filled by Sessions
+	ThreadID        string               `json:"thread_id,omitempty"`         // first session of its chain, filled by Sessions
+	ParentSessionID string               `json:"parent_session_id,omitempty"` // conversation that spawned this Claude subagent run
+	AgentID         string               `json:"agent_id,omitempty"`          // the subagent's id
+	todos           []Todo               `json:"-"`                           // latest TodoWrite/update_plan list
+	links           []Link               `json:"-"`                           // web references, see MessageLinks
+	modelTokens     map[string]tokenPair `json:"-"`                           // Input/OutputTokens by raw model name
+	lastModel       string               `json:"-"`                           // model of the latest message naming one
+	outcome         outcomeState         `json:"-"`                           // evidence for FailureReasons
+	continued       bool                 `json:"-"`                           // starts from a summary of an unnamed session
+	hasSummary      bool                 `json:"-"`
+	metaTags        []string             `json:"-"` // tags from .meta.json, merged into Tags by Sessions
+	hasContent      bool                 `json:"-"`
+	genIDs          map[string]int       `json:"-"` // IDs made by stableMessageID, with their count
+}
+
+// Indexer tails JSONL files under ~/.codex and builds an in-memory index.
+type Indexer struct {
+	codexDirs []string // every Codex directory watched, see New
+	codexDir  string   // the first; holds the watcher's own registries
+	claudeDir string
+	roots     map[string][]string // by provider, see AddRoots
+
+	scanMu      sync.Mutex   // serializes scans and file rewrites that reset tail state
+	streamMu    sync.RWMutex // exclusive for scans and rewrites, shared by ingest workers per batch
+	mu          sync.RWMutex
+	sessions    map[string]*Session
+	messages    map[string][]*Message // by session id
+	stats       Stats
+	progress    IndexProgress            // initial/full scan progress, reset by Reindex
+	dirs        map[string]DirMeta       // per-cwd metadata, loaded on first use
+	projectDirs map[string]DirMeta       // <cwd>/.codex-watcher.json contents, reset by Reindex
+	positions   map[string]int64         // file path -> byte offset (tail)
+	revision    uint64                   // bumped whenever Stats() may change; see Revision
+	lag         map[string]IngestLag     // by provider, see IngestLag
+	streams     map[string]*FileProgress // ingest queue by path, see queueLargeFile
+	streamSlots chan struct{}            // bounds the ingest workers
+	lineNos     map[string]int           // file path -> last line number processed
+	cold        map[string]*coldSession  // compressed messages by session id, see Options.ColdAfter
+	touched     map[string]time.Time     // last read or write of a session's messages
+	gens        map[string]uint64        // file path -> in-place rewrite count, see FileState
+	inodes      map[string]uint64        // file path -> inode when last tailed, see resetIfReplaced
+	sums        map[string]fileSum       // file path -> checksum of the part read, see checkSum
+	sizes       map[string]int64         // file path -> size when last tailed, see Session.DiskBytes
+	fileTs      map[string]time.Time     // file path -> latest timestamp read from it, see estimateTsLocked
+	untimed     map[string][]*Message    // file path -> messages read before its first timestamp
+	counts      map[string]*fileCounts   // file path -> counters its lines added, see dropFileCountsLocked
+	edits       []ExternalEdit           // latest files found edited behind the offset
+	epoch       uint64                   // bumped by Reindex, see Epoch
+
+	// control
+	pollInterval time.Duration // under mu; Run picks up changes on its next tick
+	watch        bool          // under mu; see SetWatch
+	watchMode    string        // under mu; how Run is following files: watch|poll
+	statePath    string        // optional tail-state checkpoint file
+	trashKeep    time.Duration // see SetTrashRetention; 0 is the default, negative keeps forever
+	resumeState  bool          // restore checkpoints from statePath before the first scan
+	restored     bool          // a store restored files with RestoreFile, see Run
+	opts         Options       // fixed by New
+}
+
+type Stats struct {
+	TotalMessages int            `json:"total_messages"`
+	TotalSessions int            `json:"total_sessions"`
+	ByRole        map[string]int `json:"by_role,omitempty"`
+	ByModel       map[string]int `json:"by_model,omitempty"`
+	ByMCPServer   map[string]int `json:"by_mcp_server,omitempty"` // MCP tool calls per server
+	ByMCPTool     map[string]int `json:"by_mcp_tool,omitempty"`   // MCP tool calls per "server/tool"
+	ByLanguage    map[string]int `json:"by_language,omitempty"`   // fenced code blocks per language
+	ByTool        map[string]int `json:"by_tool,omitempty"`       // tool calls per tool name
+	Fields        map[string]int `json:"fields,omitempty"`        // observed top-level JSON keys
+	// Revision increases whenever the counters or the scan progress change;
+	// scan timing alone (files_scanned, last_scan_ms) does not bump it.
+	Revision uint64 `json:"revision"`
+	// observability
+	BadLines     int `json:"bad_lines,omitempty"`
+	FilesScanned int `json:"files_scanned,omitempty"`
+	SkippedFiles int `json:"skipped_files,omitempty"` // left out of the last scan by IgnorePatterns, MaxFileAge, or MaxFileSize
+	LastScanMs   int `json:"last_scan_ms,omitempty"`
+	ScanErrors   int `json:"scan_errors,omitempty"`   // file-level errors during scanning
+	FileResets   int `json:"file_resets,omitempty"`   // files re-read after truncation or replacement
+	FilesRemoved int `json:"files_removed,omitempty"` // files deleted outside the watcher, sessions dropped
+	// ExternalEdits counts files found changed in a part already read and
+	// read again; RecentEdits lists the latest ones.
+	ExternalEdits int            `json:"external_edits,omitempty"`
+	RecentEdits   []ExternalEdit `json:"recent_edits,omitempty"`
+	// InputTokens, OutputTokens, and Cost total the Session fields of the
+	// same name.
+	InputTokens    int     `json:"input_tokens"`
+	OutputTokens   int     `json:"output_tokens"`
+	Cost           float64 `json:"cost,omitempty"`
+	UnpricedTokens int     `json:"unpriced_tokens,omitempty"`
+	// ActiveDuration totals Session.ActiveDuration over all sessions.
+	ActiveDuration time.Duration `json:"active_duration,omitempty"`
+	// ByProvider breaks the totals down per provider (codex|claude).
+	ByProvider map[string]ProviderStats `json:"by_provider,omitempty"`
+	// Indexing is filled by Stats() from the scan progress.
+	Indexing IndexProgress `json:"indexing"`
+	// IngestQueue lists large files streaming in the background.
+	IngestQueue []FileProgress `json:"ingest_queue,omitempty"`
+	// Cold describes sessions whose messages are compressed; see
+	// Options.ColdAfter.
+	Cold *ColdStats `json:"cold,omitempty"`
+	// WatchMode is how Run follows files: "watch" (file system events) or
+	// "poll"; empty before Run starts.
+	WatchMode string `json:"watch_mode,omitempty"`
+
+	badLinesByProvider map[string]int
+}
+
+// Options are the settings of one Indexer. Start from DefaultOptions and
+// change what differs: a zero ColdAfter or an empty MetaStorePath is a
+// setting of its own, not a request for the default.
+type Options struct {
+	ScanWorkers   int           // files a scan tails at once; 1 scans sequentially
+	ColdAfter     time.Duration // compress messages of sessions idle this long; 0 = never
+	IdleGap       time.Duration // longest pause still counted as active time
+	Models        ModelConfig   // model aliases, role names, and prices
+	MetaStorePath string        // central metadata store; "" keeps sidecars
+
+	// Scan limits; see IgnorePatterns. Zero values turn a limit off.
+	IgnorePatterns []string
+	MaxFileAge     time.Duration
+	MaxFileSize    int64
+
+	AttachmentDir     string // attachment blobs; "" keeps none
+	MaxAttachmentSize int64  // larger blobs are not kept
+
+	ColorLabels map[string]string // palette of named color labels
+
+	StreamThreshold int64         // unread bytes past which a file streams in the background
+	StreamWorkers   int           // background streaming workers
+	WatchRescan     time.Duration // full walk interval while file events drive ingest
+}
+
+// DefaultOptions returns the options New uses when given none, taken from
+// the deprecated package variables of the same names.
+func DefaultOptions() Options {
+	return Options{
+		ScanWorkers:   ScanWorkers,
+		ColdAfter:     ColdAfter,
+		IdleGap:       IdleGap,
+		Models:        Models,
+		MetaStorePath: MetaStorePath,
+
+		IgnorePatterns: IgnorePatterns,
+		MaxFileAge:     MaxFileAge,
+		MaxFileSize:    MaxFileSize,
+
+		AttachmentDir:     AttachmentDir,
+		MaxAttachmentSize: MaxAttachmentSize,
+
+		ColorLabels: ColorLabels,
+
+		StreamThreshold: StreamThreshold,
+		StreamWorkers:   StreamWorkers,
+		WatchRescan:     WatchRescan,
+	}
+}
+
+// New returns an indexer over one or more Codex directories (e.g. several
+// HOME profiles or container mounts) and an optional Claude projects
+// directory. The first Codex directory also holds the watcher's own files:
+// the directory registry, the trash, and the models config. The indexer
+// keeps the first opts given, or DefaultOptions at the time of the call.
+func New(codexDirs []string, claudeDir string, opts ...Options) *Indexer {
+	o := DefaultOptions()
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	var dirs []string
+	for _, d := range codexDirs {
+		if strings.TrimSpace(d) != "" && !contains(dirs, d) {
+			dirs = append(dirs, d)
+		}
+	}
+	primary := ""
+	if len(dirs) > 0 {
+		primary = dirs[0]
+	}
+	roots := map[string][]string{ProviderCodex: dirs, ProviderHistory: dirs}
+	if strings.TrimSpace(claudeDir) != "" {
+		roots[ProviderClaude] = []string{claudeDir}
+	}
+	return &Indexer{
+		roots:        roots,
+		codexDirs:    dirs,
+		codexDir:     primary,
+		claudeDir:    claudeDir,
+		sessions:     make(map[string]*Session),
+		messages:     make(map[string][]*Message),
+		positions:    make(map[string]int64),
+		lineNos:      make(map[string]int),
+		pollInterval: 1500 * time.Millisecond,
+		streams:      make(map[string]*FileProgress),
+		streamSlots:  make(chan struct{}, max(o.StreamWorkers, 1)),
+		opts:         o,
+		stats: Stats{
+			ByRole:      make(map[string]int),
+			ByModel:     make(map[string]int),
+			ByMCPServer: make(map[string]int),
+			ByMCPTool:   make(map[string]int),
+			ByLanguage:  make(map[string]int),
+			ByTool:      make(map[string]int),
+			Fields:      make(map[string]int),
+
+			badLinesByProvider: make(map[string]int),
+		},
+	}
+}
+
+// Options returns the options the indexer was created with.
+func (x *Indexer) Options() Options {
+	return x.opts
+}
+
+// Run starts a loop to scan and tail JSONL files: on file system events
+// when SetWatch is on and the platform supports it, else by polling.
+func (x *Indexer) Run(ctxDone <-chan struct{}) {
+	x.mu.RLock()
+	resume := x.resumeState && x.restored
+	x.mu.RUnlock()
+	if resume {
+		// an unreadable state file just means a full re-read
+		_, _ = x.restoreState()
+	}
+	// Watch before the initial scan so lines written during it are not
+	// missed; the events wait in the queue.
+	var w *fileWatcher
+	x.mu.RLock()
+	watch := x.watch
+	x.mu.RUnlock()
+	if watch {
+		// without a watcher (unsupported platform, watch limits) Run polls;
+		// Stats reports which
+		var err error
+		if w, err = newFileWatcher(x.watchRoots()); err == nil {
+			defer w.Close()
+		}
+	}
+	var events <-chan string
+	if w != nil {
+		events = w.Events
+		x.setWatchMode("watch")
+	} else {
+		x.setWatchMode("poll")
+	}
+	// Initial scan
+	_ = x.scanAll()
+	x.PurgeTrash(time.Now())
+
+	rescanInterval := func() time.Duration {
+		if events != nil {
+			return max(x.PollInterval(), x.opts.WatchRescan)
+		}
+		return x.PollInterval()
+	}
+	interval := rescanInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastSave, lastPurge := time.Now(), time.Now()
+	var (
+		batch watchBatch
+		flush <-chan time.Time
+	)
+
+	for {
+		select {
+		case <-ctxDone:
+			_ = x.SaveState()
+			return
+		case path, ok := <-events:
+			if !ok {
+				events = nil
+				x.setWatchMode("poll")
+				batch.full = true
+				flush = time.After(0)
+				break
+			}
+			batch.add(path)
+			if flush == nil {
+				flush = time.After(watchDebounce)
+			}
+		case <-flush:
+			flush = nil
+			batch.flush(x)
+		case <-ticker.C:
+			if w != nil && events != nil {
+				w.Refresh()
+			}
+			_ = x.scanAll()
+			x.compressCold(time.Now())
+			if x.statePath != "" && time.Since(lastSave) >= stateSaveInterval {
+				_ = x.SaveState()
+				lastSave = time.Now()
+			}
+			if time.Since(lastPurge) >= trashPurgeInterval {
+				x.PurgeTrash(time.Now())
+				lastPurge = time.Now()
+			}
+		}
+		if d := rescanInterval(); d != interval {
+			interval = d
+			ticker.Reset(d)
+		}
+	}
+}
+
+// PollInterval returns how often Run rescans for new lines.
+func (x *Indexer) PollInterval() time.Duration {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.pollInterval
+}
+
+// SetPollInterval changes how often Run rescans. It takes effect after the
+// next scan; non-positive values are ignored.
+func (x *Indexer) SetPollInterval(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	x.mu.Lock()
+	x.pollInterval = d
+	x.mu.Unlock()
+}
+
+// scanAll locates known files and tails new lines.
+func (x *Indexer) scanAll() error {
+	x.scanMu.Lock()
+	defer x.scanMu.Unlock()
+	x.streamMu.Lock()
+	defer x.streamMu.Unlock()
+	start := time.Now()
+	var queue []scanFile
+	skipped := 0
+	x.discoverFiles(func(provider, project, sessionID, path string) {
+		if x.skipFile(provider, path) {
+			skipped++
+			return
+		}
+		queue = append(queue, scanFile{provider, project, sessionID, path, 0})
+	})
+	full := false
+	if !x.Ready() {
+		for i := range queue {
+			queue[i].size = fileSize(queue[i].path)
+		}
+		full = x.beginFullScan(queue)
+	}
+	// resets forget whole sessions and the tail state of their other files,
+	// so they all happen before any of those files is read
+	for _, f := range queue {
+		if !x.resetIfReplaced(f.path) {
+			x.checkSum(f.path, f.sessionID)
+		}
+	}
+	x.tailQueue(queue, full)
+	if full {
+		x.endFullScan()
+	}
+	// skipped files are not in the queue, but they still exist, so
+	// forgetMissing keeps what was read from them
+	seen := make(map[string]bool, len(queue))
+	for _, f := range queue {
+		seen[f.path] = true
+	}
+	x.mu.RLock()
+	var gone []string
+	for path := range x.positions {
+		if !seen[path] {
+			gone = append(gone, path)
+		}
+	}
+	x.mu.RUnlock()
+	x.forgetMissing(gone)
+	// update observability metrics
+	x.mu.Lock()
+	x.loadDirsLocked()
+	x.loadProjectMetaLocked()
+	x.stats.FilesScanned = len(queue)
+	x.stats.SkippedFiles = skipped
+	x.stats.LastScanMs = int(time.Since(start).Milliseconds())
+	x.mu.Unlock()
+	return nil
+}
+
+// forgetMissing drops the sessions of files that no longer exist, e.g.
+// deleted outside the watcher. Callers hold scanMu and streamMu.
+func (x *Indexer) forgetMissing(paths []string) {
+	for _, path := range paths {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			continue
+		}
+		x.mu.Lock()
+		if _, ok := x.positions[path]; ok {
+			x.forgetFileLocked(path)
+			delete(x.inodes, path)
+			x.stats.FilesRemoved++
+		}
+		x.mu.Unlock()
+	}
+}
+
+// discoverFiles walks every provider root and calls fn for every session
+// JSONL file with the provider, project, and file-derived session ID.
+func (x *Indexer) discoverFiles(fn func(provider, project, sessionID, path string)) {
+	x.providerRoots(func(p Provider, root string) {
+		p.Discover(root, func(path string) {
+			if project, id, ok := p.SessionIDFor(root, path); ok {
+				fn(p.Name(), project, id, path)
+			}
+		})
+	})
+}
+
+func (x *Indexer) tailFile(provider, project, sessionID, path string) error {
+	if d, ok := providerFor(provider).(documentProvider); ok && d.IsDocument(path) {
+		return x.tailDocument(d, provider, project, sessionID, path)
+	}
+	// stat file to capture mod time
+	var modTime time.Time
+	var size int64
+	if fi, err := os.Stat(path); err == nil {
+		modTime, size = fi.ModTime(), fi.Size()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// seek to last position; tail state is shared with the other scan
+	// workers, so it is only touched under x.mu
+	x.mu.RLock()
+	pos := x.positions[path]
+	sum, summed := x.sums[path]
+	x.mu.RUnlock()
+	// the CRC of what was read so far carries on over the new bytes
+	var crc uint32
+	rolling := pos == 0
+	if summed && sum.n == pos {
+		crc, rolling = sum.crc, true
+	}
+	if pos > 0 {
+		if _, err := f.Seek(pos, io.SeekStart); err != nil {
+			rolling = false
+			// if seek fails (e.g., truncated), reset
+			x.mu.Lock()
+			x.positions[path] = 0
+			x.lineNos[path] = 0
+			x.dropFileCountsLocked(path)
+			x.rewroteLocked(path)
+			x.mu.Unlock()
+			_, _ = f.Seek(0, io.SeekStart)
+		}
+	}
+
+	reader := bufio.NewReader(f)
+	var nBytes int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		nBytes += int64(len(line))
+		crc = crc32.Update(crc, crc32.IEEETable, line)
+		if len(strings.TrimSpace(string(line))) > 0 {
+			x.ingestLine(provider, project, sessionID, path, string(line))
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			break
+		}
+	}
+	// record new position
+	x.mu.Lock()
+	if pos == 0 {
+		// if starting at 0, we need current size
+		if off, err := f.Seek(0, io.SeekCurrent); err == nil {
+			x.positions[path] = off
+		}
+	} else {
+		x.positions[path] = pos + nBytes
+	}
+	end := x.positions[path]
+	_, summed = x.sums[path]
+	x.noteSizeLocked(path, max(size, end))
+	x.mu.Unlock()
+	switch {
+	case rolling && end == pos+nBytes && (nBytes > 0 || !summed):
+		x.setSum(path, f, end, crc)
+	case nBytes > 0 || !summed:
+		x.noteSum(path, f, end)
+	}
+	x.touchSessionFile(provider, project, sessionID, path, modTime, nBytes)
+	return nil
+}
+
+// touchSessionFile records a tailed file's mod time on its session, creating
+// the session record if needed, and samples the ingest lag when nBytes new
+// bytes were read.
+func (x *Indexer) touchSessionFile(provider, project, sessionID, path string, modTime time.Time, nBytes int64) {
+	if !modTime.IsZero() {
+		root := x.rootOf(path, provider)
+		x.mu.Lock()
+		s := x.sessions[sessionID]
+		if s == nil {
+			s = &Session{ID: sessionID, Models: map[string]int{}, Roles: map[string]int{}, Provider: provider, Project: project, Root: root}
+			x.sessions[sessionID] = s
+		}
+		if modTime.After(s.FileModAt) {
+			s.FileModAt = modTime
+		}
+		x.settleTsLocked(path, modTime)
+		if nBytes > 0 {
+			x.recordLagLocked(provider, modTime, time.Now())
+		}
+		x.mu.Unlock()
+		// Load custom metadata (title, etc.) after session is created
+		x.loadSessionMetadata(sessionID, provider, root)
+	}
+}
+
+func (x *Indexer) ingestLine(provider, project, sessionID, path, line string) {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &raw); err != nil {
+		// ignore bad line but record count; it still occupies a line number
+		x.mu.Lock()
+		x.stats.BadLines++
+		x.stats.badLinesByProvider[provider]++
+		x.fileCountsLocked(path, provider).badLines++
+		x.revision++
+		x.lineNos[path]++
+		x.mu.Unlock()
+		return
+	}
+
+	if shouldSkipEventMessage(raw) {
+		// keep line numbers aligned with the file so rewrites hit the right line
+		x.mu.Lock()
+		x.lineNos[path]++
+		x.mu.Unlock()
+		return
+	}
+
+	msg, title := providerFor(provider).ParseLine(project, raw)
+	if msg.SessionID == "" {
+		msg.SessionID = sessionID
+	}
+	// Claude subagent transcripts live in files of their own but name the
+	// spawning conversation as their sessionId; they stay a session of
+	// their own, linked to it
+	var spawnedBy string
+	if provider == ProviderClaude && raw["isSidechain"] == true && sessionID != "" && msg.SessionID != sessionID {
+		spawnedBy, msg.SessionID = msg.SessionID, sessionID
+	}
+	msg.Raw, msg.Source, msg.Provider = raw, x.relSource(path, provider), provider
+	setToolKind(msg)
+	msg.Role = x.opts.Models.CanonicalRole(msg.Role)
+	if msg.Ts.IsZero() {
+		if ts, ok := parseTime(raw["timestamp"], raw["ts"], raw["created_at"]); ok {
+			msg.Ts = ts
+		}
+	}
+	// a summary line titles its session unless real content came first
+	if title != "" {
+		x.mu.Lock()
+		if sess := x.sessions[msg.SessionID]; sess != nil {
+			if !sess.hasContent && !sess.hasSummary && strings.TrimSpace(sess.Title) == "" {
+				sess.Title = trimTitle(title)
+				sess.hasSummary = true
+			}
+		}
+		x.mu.Unlock()
+	}
+
+	msg.TokenCount = EstimateTokens(msg.Content) + EstimateTokens(msg.Thinking)
+	msg.Attachments = x.blobs().extractAttachments(raw)
+
+	// Oversized lines keep a slimmed Raw; ingest-time extraction below still
+	// sees the full map, which is dropped once this call returns.
+	var slim map[string]any
+	if OversizeLine > 0 && len(line) > OversizeLine {
+		slim, _ = slimRaw(raw).(map[string]any)
+	}
+
+	x.mu.Lock()
+
+	// increment line number per file
+	x.lineNos[path]++
+	msg.LineNo = x.lineNos[path]
+
+	// ensure session exists
+	sID := msg.SessionID
+	if sID == "" {
+		sID = sessionID
+		msg.SessionID = sID
+	}
+	s := x.sessions[sID]
+	isNewSession := (s == nil)
+	if s == nil {
+		s = &Session{ID: sID, Models: map[string]int{}, Roles: map[string]int{}, Provider: provider, Project: project, Root: x.rootOf(path, provider)}
+		x.sessions[sID] = s
+	}
+	// Codex lines often carry no id; deletes and deep links need one that
+	// does not move with the line
+	if msg.ID == "" {
+		msg.ID = stableMessageID(s, msg.Ts, msg.Content, strings.TrimSpace(line))
+	}
+	x.estimateTsLocked(path, msg)
+	// detect and set CWD the first time we see it
+	if s.CWD == "" {
+		cwd := extractCWD(raw)
+
+		// For Codex, also try to extract CWD from the message content
+		if cwd == "" && provider == ProviderCodex && msg.Content != "" {
+			// Look for <cwd>...</cwd> in the content text
+			if cwdTag := between(msg.Content, "<cwd>", "</cwd>"); cwdTag != "" {
+				cwd = cwdTag
+			}
+		}
+
+		if strings.TrimSpace(cwd) != "" {
+			s.CWD = cwd
+			// compute base directory name
+			base := strings.TrimRight(cwd, "/")
+			if base != "" {
+				s.CWDBase = filepath.Base(base)
+			}
+		}
+	}
+	s.noteGit(extractGit(raw))
+	if spawnedBy != "" && s.ParentSessionID == "" {
+		s.ParentSessionID, s.AgentID = spawnedBy, stringOr(raw["agentId"])
+	}
+	if parent, ok := continuationOf(raw, msg, s.hasContent); ok {
+		s.noteContinuation(parent)
+	}
+	// a rollout replaying another session's meta continues that session
+	if sID != sessionID && sessionID != "" && provider == ProviderCodex && stringOr(raw["type"]) == "session_meta" {
+		fs := x.sessions[sessionID]
+		if fs == nil {
+			fs = &Session{ID: sessionID, Models: map[string]int{}, Roles: map[string]int{}, Provider: provider, Project: project, Root: x.rootOf(path, provider)}
+			x.sessions[sessionID] = fs
+		}
+		fs.noteContinuation(sID)
+	}
+	// track if we have seen actual user/assistant content
+	if !strings.EqualFold(msg.Type, "summary") && (msg.Role == "user" || msg.Role == "assistant") {
+		s.hasContent = true
+	}
+	// derive a human-friendly session title if missing
+	// Priority: custom title (from .meta.json) > Claude summary > explicit title > first message
+	// Note: custom titles are loaded via loadSessionMetadata and have highest priority
+	if t, ok := providerFor(provider).(sessionTitler); ok && s.Title == "" {
+		s.Title = t.SessionTitle(sID)
+	}
+	currentFallbackTitle := ""
+	if fallback := fallbackTitleFromSession(s); fallback != "" {
+		currentFallbackTitle = trimTitle(fallback)
+	}
+	if s.Title == "" || (currentFallbackTitle != "" && strings.TrimSpace(s.Title) == currentFallbackTitle) {
+		if t := normalizeTitleCandidate(stringOr(raw["title"]), s); t != "" {
+			s.Title = t
+		} else if t := normalizeTitleCandidate(msg.Content, s); t != "" {
+			s.Title = t
+		} else if s.Title == "" {
+			if fallback := fallbackTitleFromSession(s); fallback != "" {
+				s.Title = trimTitle(fallback)
+			}
+		}
+	}
+	if s.Title == "" {
+		if fallback := fallbackTitleFromSession(s); fallback != "" {
+			s.Title = trimTitle(fallback)
+		}
+	}
+	// update session aggregates
+	s.MessageCount++
+	s.addTokens(msg)
+	s.noteOutcome(msg)
+	if strings.TrimSpace(msg.Content) != "" {
+		s.TextCount++
+	}
+	if !msg.Ts.IsZero() {
+		if s.FirstAt.IsZero() || msg.Ts.Before(s.FirstAt) {
+			s.FirstAt = msg.Ts
+		}
+		if msg.Ts.After(s.LastAt) {
+			// Incremental: assumes messages arrive in time order, which
+			// they do within a file; SessionView recomputes exactly.
+			if gap := msg.Ts.Sub(s.LastAt); !s.LastAt.IsZero() && gap <= x.opts.IdleGap {
+				s.ActiveDuration += gap
+			}
+			s.LastAt = msg.Ts
+		}
+	}
+	if links := MessageLinks(msg); len(links) > 0 {
+		s.links = dedupeLinks(s.links, links)
+	}
+	if todos, ok := planTodos(msg); ok {
+		s.todos = todos
+		s.OpenTodos = countOpenTodos(todos)
+	}
+	if msg.Model != "" {
+		model := x.opts.Models.Canonical(msg.Model)
+		s.Models[model]++
+		x.stats.ByModel[model]++
+	}
+	if msg.Role != "" {
+		s.Roles[msg.Role]++
+		x.stats.ByRole[msg.Role]++
+	}
+	for _, name := range ToolCallNames(msg) {
+		if s.ToolCounts == nil {
+			s.ToolCounts = make(map[string]int)
+		}
+		s.ToolCounts[name]++
+		x.stats.ByTool[name]++
+	}
+	for _, call := range MCPCalls(msg) {
+		server, _, _ := strings.Cut(call, "/")
+		if s.MCPTools == nil {
+			s.MCPTools = make(map[string]int)
+		}
+		s.MCPTools[call]++
+		x.stats.ByMCPServer[server]++
+		x.stats.ByMCPTool[call]++
+	}
+	for _, lang := range CodeLanguages(msg) {
+		if s.Languages == nil {
+			s.Languages = make(map[string]int)
+		}
+		s.Languages[lang]++
+		x.stats.ByLanguage[lang]++
+	}
+	fc := x.fileCountsLocked(path, provider)
+	for k := range raw {
+		if k != "" {
+			x.stats.Fields[k]++
+			fc.fields[k]++
+		}
+	}
+	// track sources
+	if path != "" {
+		if !contains(s.Sources, msg.Source) {
+			s.Sources = append(s.Sources, msg.Source)
+			sort.Strings(s.Sources)
+		}
+	}
+
+	if slim != nil {
+		msg.Raw, msg.RawTruncated = slim, true
+	}
+
+	// append message; retain complete session history in memory
+	x.thawLocked(sID)
+	x.touchLocked(sID, time.Now())
+	x.messages[sID] = append(x.messages[sID], msg)
+
+	x.stats.TotalMessages++
+	x.stats.TotalSessions = len(x.sessions)
+	x.revision++
+
+	x.mu.Unlock()
+
+	// Load custom metadata for newly created sessions after releasing the lock
+	if isNewSession {
+		x.loadSessionMetadata(sID, provider, x.rootOf(path, provider))
+	}
+}
+
+// Public API
+
+func (x *Indexer) Sessions() []Session {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	out := make([]Session, 0, len(x.sessions))
+	for _, s := range x.sessions {
+		out = append(out, *s)
+	}
+	for i := range out {
+		out[i].Cost, out[i].UnpricedTokens = out[i].estimateCost(x.opts.Models)
+		out[i].Paths = make([]string, len(out[i].Sources))
+		for j, src := range out[i].Sources {
+			out[i].Paths[j] = x.sourcePath(&Message{Source: src, Provider: out[i].Provider})
+			out[i].DiskBytes += x.sizes[out[i].Paths[j]]
+		}
+	}
+	// Directory metadata: display name, default tags, and the color label
+	// for sessions without their own
+	for i := range out {
+		out[i].Tags = mergeTags(out[i].Tags, out[i].metaTags)
+		if out[i].CWD == "" {
+			continue
+		}
+		dm := x.dirInfoLocked(out[i].CWD)
+		out[i].DirName = dm.Name
+		out[i].DirHidden = dm.Hidden
+		out[i].Tags = mergeTags(out[i].Tags, dm.Tags)
+		if out[i].Color == "" {
+			out[i].Color = dm.Color
+		}
+	}
+	for i := range out {
+		out[i].applyOutcome()
+	}
+	linkChains(out)
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].LastAt.After(out[j].LastAt)
+	})
+	return out
+}
+
+func (x *Indexer) Messages(sessionID string, limit int) []*Message {
+	if x.opts.ColdAfter > 0 {
+		// reading a session keeps it warm; a cold one is decompressed first
+		x.mu.Lock()
+		x.thawLocked(sessionID)
+		x.touchLocked(sessionID, time.Now())
+		x.mu.Unlock()
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	msgs := x.messages[sessionID]
+	if limit <= 0 || limit >= len(msgs) {
+		return append([]*Message(nil), msgs...)
+	}
+	return append([]*Message(nil), msgs[len(msgs)-limit:]...)
+}
+
+// PeekMessages returns all of a session's messages like Messages(id, 0),
+// but a cold session stays compressed and the read does not keep it warm.
+// Passes over every session (listing, search, stats, background syncs) use
+// it, so they do not undo Options.ColdAfter.
+func (x *Indexer) PeekMessages(sessionID string) []*Message {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return append([]*Message(nil), x.messagesLocked(sessionID)...)
+}
+
+// Revision returns the current stats revision. It only ever grows, so a
+// client holding an older value knows something changed.
+func (x *Indexer) Revision() uint64 {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.revision
+}
+
+func (x *Indexer) Stats() Stats {
+	x.mu.RLock()
+	st := x.stats
+	// the counters keep changing under x.mu; callers get maps of their own
+	st.ByRole, st.ByModel = maps.Clone(st.ByRole), maps.Clone(st.ByModel)
+	st.ByMCPServer, st.ByMCPTool = maps.Clone(st.ByMCPServer), maps.Clone(st.ByMCPTool)
+	st.ByLanguage, st.ByTool = maps.Clone(st.ByLanguage), maps.Clone(st.ByTool)
+	st.Fields, st.badLinesByProvider = maps.Clone(st.Fields), nil
+	st.Revision = x.revision
+	st.WatchMode = x.watchMode
+	st.Cold = x.coldStatsLocked()
+	st.ByProvider = make(map[string]ProviderStats)
+	for _, s := range x.sessions {
+		st.ActiveDuration += s.ActiveDuration
+		c := *s
+		c.Cost, c.UnpricedTokens = c.estimateCost(x.opts.Models)
+		st.AddProviderSession(c)
+	}
+	for p, n := range x.stats.badLinesByProvider {
+		ps := st.ByProvider[p]
+		ps.BadLines = n
+		st.ByProvider[p] = ps
+	}
+	st.RecentEdits = append([]ExternalEdit(nil), x.edits...)
+	st.IngestQueue = nil
+	for _, fp := range x.streams {
+		st.IngestQueue = append(st.IngestQueue, *fp)
+	}
+	sort.Slice(st.IngestQueue, func(i, j int) bool { return st.IngestQueue[i].QueuedAt.Before(st.IngestQueue[j].QueuedAt) })
+	for p, l := range x.lag {
+		ps := st.ByProvider[p]
+		l := l
+		ps.IngestLag = &l
+		st.ByProvider[p] = ps
+	}
+	x.mu.RUnlock()
+	st.Indexing = x.Progress()
+	return st
+}
+
+func (x *Indexer) Reindex() error {
+	x.mu.Lock()
+	x.sessions = make(map[string]*Session)
+	x.messages = make(map[string][]*Message)
+	x.cold, x.touched = nil, nil
+	x.gens, x.inodes = nil, nil
+	x.sums, x.edits = nil, nil
+	x.sizes = nil
+	x.fileTs, x.untimed = nil, nil
+	x.epoch++
+	x.positions = make(map[string]int64)
+	x.lineNos = make(map[string]int)
+	x.counts = nil
+	x.stats = Stats{ByRole: map[string]int{}, ByModel: map[string]int{}, ByMCPServer: map[string]int{}, ByMCPTool: map[string]int{}, ByLanguage: map[string]int{}, ByTool: map[string]int{}, Fields: map[string]int{}, badLinesByProvider: map[string]int{}}
+	x.progress = IndexProgress{}
+	x.projectDirs = nil
+	x.lag = nil
+	x.revision++
+	x.mu.Unlock()
+	return x.scanAll()
+}
+
+// IngestForTest allows tests to inject a raw JSON object as a line for a session.
+// It bypasses file I/O and directly feeds the ingest pipeline with minimal locking.
+func (x *Indexer) IngestForTest(sessionID string, raw map[string]any) {
+	if raw == nil {
+		return
+	}
+	b, _ := json.Marshal(raw)
+	// mimic a file path for line numbers and source
+	path := "/tmp/.codex/sessions/" + sessionID + ".jsonl"
+	x.ingestLine("codex", "", sessionID, path, string(b))
+}
+
+// CompressColdForTest compresses the sessions a rescan at now would, see
+// Options.ColdAfter.
+func (x *Indexer) CompressColdForTest(now time.Time) {
+	x.compressCold(now)
+}
+
+// DeleteSession removes a session and all its messages from memory and moves
+// the source file to the trash, from where RestoreTrash can bring it back.
+func (x *Indexer) DeleteSession(sessionID string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	sess, exists := x.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	if err := readOnly(sess); err != nil {
+		return err
+	}
+
+	// Determine file path based on provider
+	var filePath string
+	if sess.Provider == "claude" {
+		// Parse "claude:<project>:<sid>"
+		parts := strings.SplitN(sessionID, ":", 3)
+		if len(parts) >= 3 {
+			project := parts[1]
+			sid := parts[2]
+			filePath = filepath.Join(x.claudeDir, project, sid+".jsonl")
+		} else {
+			return fmt.Errorf("invalid claude session ID format: %s", sessionID)
+		}
+	} else {
+		// Codex: the recorded file, under whichever Codex directory it is in
+		filePath, _ = x.sessionFilePath(sess)
+	}
+
+	// Move the file to the trash
+	if _, err := os.Stat(filePath); err == nil {
+		if _, err := x.trashFile(filePath, TrashEntry{Kind: TrashSession, SessionID: sessionID, Title: sess.Title}); err != nil {
+			return err
+		}
+	}
+
+	// Remove from memory
+	delete(x.sessions, sessionID)
+	delete(x.messages, sessionID)
+	delete(x.cold, sessionID)
+	delete(x.touched, sessionID)
+	x.rewroteLocked(filePath)
+	x.dropFileCountsLocked(filePath)
+	delete(x.positions, filePath)
+	delete(x.lineNos, filePath)
+
+	// Update stats
+	x.stats.TotalSessions = len(x.sessions)
+	x.revision++
+	return nil
+}
+
+// DeleteMessage removes a single message from a session in memory and rewrites
+// the JSONL file, keeping the removed line in the trash.
+func (x *Indexer) DeleteMessage(sessionID, messageID string) error {
+	// the tail offset moves with the rewrite, so no scan may read the file
+	// in between
+	x.scanMu.Lock()
+	defer x.scanMu.Unlock()
+	x.streamMu.Lock()
+	defer x.streamMu.Unlock()
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	sess, exists := x.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	if err := readOnly(sess); err != nil {
+		return err
+	}
+
+	x.thawLocked(sessionID)
+	msgs := x.messages[sessionID]
+	if len(msgs) == 0 {
+		return fmt.Errorf("no messages in session: %s", sessionID)
+	}
+
+	// Find the message to delete
+	msgIndex := -1
+	for i, msg := range msgs {
+		if msg.ID == messageID {
+			msgIndex = i
+			break
+		}
+	}
+	if msgIndex == -1 {
+		return fmt.Errorf("message not found: %s", messageID)
+	}
+
+	// Determine file path
+	var filePath string
+	if sess.Provider == "claude" {
+		parts := strings.SplitN(sessionID, ":", 3)
+		if len(parts) >= 3 {
+			project := parts[1]
+			sid := parts[2]
+			filePath = filepath.Join(x.claudeDir, project, sid+".jsonl")
+		} else {
+			return fmt.Errorf("invalid claude session ID format: %s", sessionID)
+		}
+	} else if m := msgs[msgIndex]; m.Source != "" {
+		filePath = x.sourcePath(m)
+	} else {
+		filePath = x.codexSessionPath(sess, ".jsonl")
+	}
+
+	// Rewrite the file without the target line
+	targetLineNo := msgs[msgIndex].LineNo
+	var removed string
+	if err := forEachLine(filePath, func(lineNo int, line string) {
+		if lineNo == targetLineNo {
+			removed = line
+		}
+	}); err != nil {
+		return err
+	}
+	var trashed TrashEntry
+	if removed != "" {
+		var err error
+		if trashed, err = x.trashLine(filePath, TrashEntry{Kind: TrashMessage, SessionID: sessionID, MessageID: messageID, Line: targetLineNo, Title: sess.Title, Text: removed}); err != nil {
+			return err
+		}
+	}
+	if err := rewriteFileLines(filePath, func(lineNo int, line string) (string, bool) {
+		return line, lineNo != targetLineNo
+	}); err != nil {
+		if trashed.ID != "" {
+			os.RemoveAll(filepath.Join(x.trashDir(), trashed.ID))
+		}
+		return err
+	}
+
+	// Remove from memory
+	msg := msgs[msgIndex]
+	x.messages[sessionID] = append(msgs[:msgIndex], msgs[msgIndex+1:]...)
+	x.uncountMessageLocked(sess, msg, filePath, removed)
+	x.revision++
+
+	// The rest of the file was already ingested; later lines move up by one
+	// and keep their IDs, so the next scan goes on from the shifted offset
+	if removed != "" {
+		x.shiftTailLocked(filePath, -int64(len(removed)+1), -1)
+		source := msg.Source
+		for id, s := range x.sessions {
+			if !contains(s.Sources, source) {
+				continue
+			}
+			x.thawLocked(id)
+			for _, m := range x.messages[id] {
+				if m.Source == source && m.LineNo > targetLineNo {
+					m.LineNo--
+				}
+			}
+		}
+	}
+	x.rewroteLocked(filePath)
+
+	return nil
+}
+
+// uncountMessageLocked takes a deleted message off the session aggregates
+// and totals ingestLine added it to; line is its raw JSONL line, if known.
+func (x *Indexer) uncountMessageLocked(s *Session, m *Message, path, line string) {
+	s.MessageCount--
+	x.stats.TotalMessages--
+	if strings.TrimSpace(m.Content) != "" {
+		s.TextCount--
+	}
+	switch TurnKind(m) {
+	case TurnAnswer, TurnReasoning, TurnToolCall:
+		s.OutputTokens -= m.TokenCount
+	default:
+		s.InputTokens -= m.TokenCount
+	}
+	one := func(k string) map[string]int { return map[string]int{k: 1} }
+	if m.Model != "" {
+		model := x.opts.Models.Canonical(m.Model)
+		subtractCounts(s.Models, one(model))
+		subtractCounts(x.stats.ByModel, one(model))
+	}
+	if m.Role != "" {
+		subtractCounts(s.Roles, one(m.Role))
+		subtractCounts(x.stats.ByRole, one(m.Role))
+	}
+	for _, name := range ToolCallNames(m) {
+		subtractCounts(s.ToolCounts, one(name))
+		subtractCounts(x.stats.ByTool, one(name))
+	}
+	for _, call := range MCPCalls(m) {
+		server, _, _ := strings.Cut(call, "/")
+		subtractCounts(s.MCPTools, one(call))
+		subtractCounts(x.stats.ByMCPServer, one(server))
+		subtractCounts(x.stats.ByMCPTool, one(call))
+	}
+	for _, lang := range CodeLanguages(m) {
+		subtractCounts(s.Languages, one(lang))
+		subtractCounts(x.stats.ByLanguage, one(lang))
+	}
+	if raw, err := decodeLine(line); err == nil {
+		fc := x.counts[path]
+		for k := range raw {
+			subtractCounts(x.stats.Fields, one(k))
+			if fc != nil {
+				subtractCounts(fc.fields, one(k))
+			}
+		}
+	}
+}
+
+// forEachLine calls fn for every non-blank line of a JSONL file. lineNo counts
+// non-blank lines, matching the numbering used during ingest. Blank lines are
+// reported with lineNo 0.
+func forEachLine(filePath string, fn func(lineNo int, line string)) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	lineNum := 0
+	for {
+		raw, err := reader.ReadString('\n')
+		if len(raw) > 0 {
+			line := strings.TrimRight(raw, "\r\n")
+			if strings.TrimSpace(line) == "" {
+				fn(0, line)
+			} else {
+				lineNum++
+				fn(lineNum, line)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read file %s: %w", filePath, err)
+		}
+	}
+}
+
+// rewriteFileLines streams a JSONL file through fn and atomically replaces it
+// via a temp file + rename. Blank lines are preserved untouched. fn returns the
+// line to write (without newline) and whether to keep it.
+func rewriteFileLines(filePath string, fn func(lineNo int, line string) (string, bool)) error {
+	var lines []string
+	err := forEachLine(filePath, func(lineNo int, line string) {
+		if lineNo == 0 {
+			lines = append(lines, line)
+			return
+		}
+		if out, keep := fn(lineNo, line); keep {
+			lines = append(lines, out)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write back the filtered lines
+	tmpPath := filePath + ".tmp"
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	writer := bufio.NewWriter(tmpFile)
+	for _, line := range lines {
+		if _, err := writer.WriteString(line + "\n"); err != nil {
+			tmpFile.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to write temp file: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to flush temp file: %w", err)
+	}
+	tmpFile.Close()
+
+	// Replace original file with temp file
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
+
+// Helpers
+
+func stringOr(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case fmt.Stringer:
+		return t.String()
+	case float64:
+		return fmt.Sprintf("%g", t)
+	case int64:
+		return fmt.Sprintf("%d", t)
+	case json.Number:
+		return t.String()
+	default:
+		return ""
+	}
+}
+
+func parseTime(values ...any) (time.Time, bool) {
+	for _, v := range values {
+		switch t := v.(type) {
+		case string:
+			// try common formats
+			if ts, err := time.Parse(time.RFC3339Nano, t); err == nil {
+				return ts, true
+			}
+			if ts, err := time.Parse(time.RFC3339, t); err == nil {
+				return ts, true
+			}
+			// unix seconds as string
+			if n, err := parseUnixMaybe(t); err == nil {
+				return time.Unix(n, 0), true
+			}
+		case float64:
+			// unix seconds
+			if t > 1000000000 {
+				return time.Unix(int64(t), 0), true
+			}
+		case json.Number:
+			if n, err := t.Int64(); err == nil {
+				return time.Unix(n, 0), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseUnixMaybe(s string) (int64, error) {
+	// crude: only ints
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return 0, fmt.Errorf("not unix")
+		}
+	}
+	var n int64
+	// use base 10 parse for safety
+	// fallback to Sscan if needed
+	if _, err := fmt.Sscan(s, &n); err == nil {
+		return n, nil
+	}
+	return 0, fmt.Errorf("parse error")
+}
+
+func contains(sl []string, t string) bool {
+	for _, v := range sl {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+func relSource(path, root string) string {
+	if path == "" {
+		return ""
+	}
+	if r, err := filepath.Rel(root, path); err == nil {
+		return r
+	}
+	return path
+}
+
+// relSource is the Message.Source of lines from path: relative to the
+// provider's first root, or absolute for files under its other roots, so a
+// Source alone still identifies the file.
+func (x *Indexer) relSource(path, provider string) string {
+	if root := x.providerRoot(path, provider); root != "" && root != x.primaryRoot(provider) {
+		return path
+	}
+	if root := x.primaryRoot(provider); strings.TrimSpace(root) != "" {
+		if r, err := filepath.Rel(root, path); err == nil {
+			return r
+		}
+	}
+	return path
+}
+
+// primaryRoot is the provider's first root, against which relative Sources
+// resolve; providers without roots use the first Codex directory.
+func (x *Indexer) primaryRoot(provider string) string {
+	if roots := x.roots[provider]; len(roots) > 0 {
+		return roots[0]
+	}
+	return x.codexDir
+}
+
+// providerRoot returns the provider root whose session tree holds path, or
+// "" when none does.
+func (x *Indexer) providerRoot(path, provider string) string {
+	p := providerFor(provider)
+	for _, root := range x.roots[provider] {
+		if inDir(sessionTree(p, root), path) {
+			return root
+		}
+	}
+	return ""
+}
+
+// rootOf is the directory recorded as Session.Root for a file of provider.
+func (x *Indexer) rootOf(path, provider string) string {
+	if root := x.providerRoot(path, provider); root != "" {
+		return root
+	}
+	return x.primaryRoot(provider)
+}
+
+// inDir reports whether path lies under dir.
+func inDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// codexSessionPath is where a Codex session's file lives when its sources
+// are unknown: under the session's root, else the first Codex directory.
+func (x *Indexer) codexSessionPath(sess *Session, suffix string) string {
+	root := x.codexDir
+	if sess != nil && sess.Root != "" {
+		root = sess.Root
+	}
+	return filepath.Join(root, "sessions", sess.ID+suffix)
+}
+
+// sourcePath resolves a message's relative Source back to an absolute file path.
+func (x *Indexer) sourcePath(m *Message) string {
+	if m == nil || m.Source == "" {
+		return ""
+	}
+	if filepath.IsAbs(m.Source) {
+		return m.Source
+	}
+	return filepath.Join(x.primaryRoot(m.Provider), m.Source)
+}
+
+// extractClaudeSegments returns (text, thinking) extracted from message.content (string or array).
+func extractClaudeSegments(messageObj map[string]any) (string, string) {
+	var textParts []string
+	var thinkParts []string
+	if messageObj == nil {
+		return "", ""
+	}
+
+	// Handle content as string (user messages)
+	if str, ok := messageObj["content"].(string); ok && strings.TrimSpace(str) != "" {
+		return str, ""
+	}
+
+	// Handle content as array (assistant messages with structured content)
+	arr, _ := messageObj["content"].([]any)
+	for _, el := range arr {
+		m, ok := el.(map[string]any)
+		if !ok || m == nil {
+			continue
+		}
+		t, _ := m["type"].(string)
+		switch strings.ToLower(t) {
+		case "text", "input_text", "output_text":
+			if s, _ := m["text"].(string); strings.TrimSpace(s) != "" {
+				textParts = append(textParts, s)
+			}
+			if s, _ := m["content"].(string); strings.TrimSpace(s) != "" {
+				textParts = append(textParts, s)
+			}
+		case "thinking":
+			if s, _ := m["thinking"].(string); strings.TrimSpace(s) != "" {
+				thinkParts = append(thinkParts, s)
+			}
+		}
+	}
+	return strings.Join(textParts, "\n\n"), strings.Join(thinkParts, "\n\n")
+}
+
+func firstNonEmpty(a, b string) string {
+	if strings.TrimSpace(a) != "" {
+		return a
+	}
+	return b
+}
+
+func trimTitle(s string) string {
+	s = strings.TrimSpace(strings.ReplaceAll(s, "\n", " "))
+	// Use runes to avoid splitting multi-byte UTF-8 characters
+	runes := []rune(s)
+	if len(runes) <= 80 {
+		return s
+	}
+	return string(runes[:80]) + "…"
+}
+
+func normalizeTitleCandidate(candidate string, sess *Session) string {
+	cand := strings.TrimSpace(candidate)
+	if cand == "" {
+		return ""
+	}
+	if sess != nil && strings.EqualFold(strings.TrimSpace(sess.ID), cand) {
+		return ""
+	}
+	if looksLikeEnvironmentContext(cand) || looksLikeGeneratedIdentifier(cand) || looksLikeMemoryIntermediateText(cand) {
+		return ""
+	}
+	return trimTitle(cand)
+}
+
+// looksLikeEnvironmentContext detects the XML-ish metadata blob emitted by Codex.
+func looksLikeEnvironmentContext(s string) bool {
+	if s == "" {
+		return false
+	}
+	lower := strings.ToLower(s)
+	if strings.Contains(lower, "<environment_context") {
+		return true
+	}
+	markers := []string{
+		"<cwd>",
+		"</cwd>",
+		"<approval_pol",
+		"<sandbox_mode",
+		"<network_access",
+		"<shell>",
+	}
+	hits := 0
+	for _, marker := range markers {
+		if strings.Contains(lower, marker) {
+			hits++
+		}
+	}
+	return hits >= 2
+}
+
+func fallbackTitleFromSession(s *Session) string {
+	if s == nil {
+		return ""
+	}
+	if base := strings.TrimSpace(s.CWDBase); base != "" {
+		return base
+	}
+	if cwd := strings.TrimSpace(s.CWD); cwd != "" {
+		return cwd
+	}
+	id := strings.TrimSpace(s.ID)
+	if id != "" && !looksLikeGeneratedIdentifier(id) {
+		return id
+	}
+	return ""
+}
+
+var autoGeneratedTitleRe = regexp.MustCompile(`^[a-z]+-\d{4}-\d{2}-\d{2}t\d{2}-\d{2}-\d{2}(?:-[0-9a-z]+)+$`)
+
+func looksLikeGeneratedIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	str := strings.ToLower(strings.TrimSpace(s))
+	if str == "" {
+		return false
+	}
+	if autoGeneratedTitleRe.MatchString(str) {
+		return true
+	}
+	if strings.HasPrefix(str, "rollout-") {
+		return true
+	}
+	return false
+}
+
+// extractText returns only human-readable text content from a raw JSONL line.
+// Rules:
+// - If content is a string, return it.
+// - If content is an array, concatenate parts with type=="text" and .text string.
+// - Else if raw["text"] is string, return it.
+// - Otherwise return empty.
+func extractText(raw map[string]any) string {
+	if raw == nil {
+		return ""
+	}
+	if msg := extractMessageLikeText(raw["message"]); msg != "" {
+		return msg
+	}
+	// Codex stores most chat text under payload.*; mirror message parsing there.
+	if msg := extractMessageLikeText(raw["payload"]); msg != "" {
+		return msg
+	}
+	if txt := extractContentText(raw["content"], false); txt != "" {
+		return txt
+	}
+	if s := strings.TrimSpace(stringOr(raw["text"])); s != "" {
+		return s
+	}
+	if s := strings.TrimSpace(stringOr(raw["message"])); s != "" {
+		return s
+	}
+	return ""
+}
+
+func extractMessageLikeText(v any) string {
+	m, ok := v.(map[string]any)
+	if !ok || m == nil {
+		return ""
+	}
+	if txt := extractContentText(m["content"], true); txt != "" {
+		return txt
+	}
+	if s := strings.TrimSpace(stringOr(m["text"])); s != "" {
+		return s
+	}
+	if s := strings.TrimSpace(stringOr(m["message"])); s != "" {
+		return s
+	}
+	return ""
+}
+
+func extractContentText(v any, includeThinking bool) string {
+	switch c := v.(type) {
+	case string:
+		if strings.TrimSpace(c) != "" {
+			return c
+		}
+	case []any:
+		var parts []string
+		appendPart := func(s string) {
+			if strings.TrimSpace(s) == "" {
+				return
+			}
+			parts = append(parts, s)
+		}
+		for _, el := range c {
+			if s, ok := el.(string); ok {
+				appendPart(s)
+				continue
+			}
+			m, ok := el.(map[string]any)
+			if !ok || m == nil {
+				continue
+			}
+			t := strings.ToLower(stringOr(m["type"]))
+			switch t {
+			case "text", "input_text", "output_text":
+				if tx := stringOr(m["text"]); strings.TrimSpace(tx) != "" {
+					appendPart(tx)
+					continue
+				}
+				if cx := stringOr(m["content"]); strings.TrimSpace(cx) != "" {
+					appendPart(cx)
+					continue
+				}
+			case "thinking":
+				if includeThinking {
+					if th := stringOr(m["thinking"]); strings.TrimSpace(th) != "" {
+						appendPart(th)
+					}
+				}
+			default:
+				if includeThinking {
+					if tx := stringOr(m["text"]); strings.TrimSpace(tx) != "" {
+						appendPart(tx)
+					}
+				}
+			}
+		}
+		if len(parts) > 0 {
+			return strings.Join(parts, "\n\n")
+		}
+	}
+	return ""
+}
+
+func shouldSkipEventMessage(raw map[string]any) bool {
+	if raw == nil {
+		return false
+	}
+	if strings.ToLower(stringOr(raw["type"])) != "event_msg" {
+		return false
+	}
+	payload, ok := raw["payload"].(map[string]any)
+	if !ok || payload == nil {
+		return false
+	}
+	switch strings.ToLower(stringOr(payload["type"])) {
+	case "user_message", "agent_message":
+		return true
+	default:
+		return false
+	}
+}
+
+// extractCWD attempts to find a current working directory value from common fields.
+// Priority:
+// 1) raw["cwd"], raw["working_dir"], raw["current_working_directory"] (string)
+// 2) raw["git"].(map)["cwd"|"root"] (string)
+// 3) raw["environment_context"] (string) with a <cwd>...</cwd> segment
+// Otherwise returns empty string.
+func extractCWD(raw map[string]any) string {
+	if raw == nil {
+		return ""
+	}
+	// direct fields
+	for _, k := range []string{"cwd", "working_dir", "current_working_directory"} {
+		if v, ok := raw[k].(string); ok {
+			v = strings.TrimSpace(v)
+			if v != "" {
+				return v
+			}
+		}
+	}
+	// nested git object
+	if g, ok := raw["git"].(map[string]any); ok && g != nil {
+		for _, k := range []string{"cwd", "root"} {
+			if v, ok := g[k].(string); ok {
+				v = strings.TrimSpace(v)
+				if v != "" {
+					return v
+				}
+			}
+		}
+	}
+	// environment_context with <cwd>... markup
+	if s, ok := raw["environment_context"].(string); ok {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			// try exact <cwd>...</cwd>
+			if cwd := between(s, "<cwd>", "</cwd>"); cwd != "" {
+				return cwd
+			}
+			// fallback: find substring after <cwd> up to next <
+			if i := strings.Index(strings.ToLower(s), "<cwd>"); i >= 0 {
+				rest := s[i+5:] // len("<cwd>")
+				if j := strings.Index(rest, "<"); j > 0 {
+					cwd := strings.TrimSpace(rest[:j])
+					if cwd != "" {
+						return cwd
+					}
+				}
+			}
+		}
+	}
+	// content-based extraction: look for <cwd>... in content strings or parts
+	if v, ok := raw["content"]; ok {
+		switch c := v.(type) {
+		case string:
+			if cwd := findCWDInText(c); cwd != "" {
+				return cwd
+			}
+		case []any:
+			for _, el := range c {
+				if s, ok := el.(string); ok {
+					if cwd := findCWDInText(s); cwd != "" {
+						return cwd
+					}
+					continue
+				}
+				if m, ok := el.(map[string]any); ok {
+					if t, _ := m["type"].(string); t == "text" || t == "input_text" || t == "output_text" {
+						if tx, _ := m["text"].(string); strings.TrimSpace(tx) != "" {
+							if cwd := findCWDInText(tx); cwd != "" {
+								return cwd
+							}
+						}
+						if cx, _ := m["content"].(string); strings.TrimSpace(cx) != "" {
+							if cwd := findCWDInText(cx); cwd != "" {
+								return cwd
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func between(s, a, b string) string {
+	i := strings.Index(s, a)
+	if i < 0 {
+		return ""
+	}
+	i += len(a)
+	j := strings.Index(s[i:], b)
+	if j < 0 {
+		return ""
+	}
+	return strings.TrimSpace(s[i : i+j])
+}
+
+func findCWDInText(s string) string {
+	if s == "" {
+		return ""
+	}
+	if cwd := between(s, "<cwd>", "</cwd>"); cwd != "" {
+		return cwd
+	}
+	return ""
+}
+
+// UpdateSessionTitle updates the custom title for a session and persists it to a metadata file.
+func (x *Indexer) UpdateSessionTitle(sessionID, newTitle string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	sess, exists := x.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	// Update the in-memory title
+	sess.Title = trimTitle(newTitle)
+	sess.hasSummary = true
+
+	return x.updateSessionMeta(sess, func(m *sessionMeta) { m.CustomTitle = sess.Title })
+}
+
+// loadSessionMetadata loads custom metadata from .meta.json file if it exists.
+func (x *Indexer) loadSessionMetadata(sessionID, provider, root string) {
+	// A missing or unreadable file just means no custom metadata
+	metadata := x.sessionMetaOf(sessionID, provider, root)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	sess := x.sessions[sessionID]
+	if sess == nil {
+		return
+	}
+	// Apply custom title if present
+	if strings.TrimSpace(metadata.CustomTitle) != "" {
+		sess.Title = metadata.CustomTitle
+		sess.hasSummary = true
+	}
+	sess.Pinned = metadata.Pinned
+	sess.Color = metadata.Color
+	sess.Archived = metadata.Archived
+	sess.Summary = metadata.Summary
+	sess.Notes = metadata.Notes
+	sess.metaTags = metadata.Tags
+}
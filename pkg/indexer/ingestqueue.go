@@ -0,0 +1,166 @@
+package indexer
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Files with more unread bytes than StreamThreshold are not tailed inside
+// the scan loop once the initial scan is done: they go to a queue served by
+// at most StreamWorkers background workers, so a multi-hundred-MB session
+// file streams in while every other file keeps updating on each poll.
+//
+// Deprecated: set Options.StreamThreshold and Options.StreamWorkers; these
+// are only their defaults.
+var (
+	StreamThreshold int64 = 32 << 20
+	StreamWorkers         = 2
+)
+
+// streamBatchBytes is how much a worker reads per hold of streamMu; scans and
+// file rewrites wait for at most one batch.
+const streamBatchBytes = 1 << 20
+
+// FileProgress reports a file in the ingest queue.
+type FileProgress struct {
+	Path      string    `json:"path"`
+	Provider  string    `json:"provider"`
+	SessionID string    `json:"session_id"`
+	State     string    `json:"state"` // queued|streaming
+	BytesDone int64     `json:"bytes_done"`
+	BytesLeft int64     `json:"bytes_left"` // as of queueing; the file may keep growing
+	QueuedAt  time.Time `json:"queued_at"`
+}
+
+// IngestQueue lists the files waiting for or being streamed by the ingest
+// workers, oldest first.
+func (x *Indexer) IngestQueue() []FileProgress {
+	x.mu.RLock()
+	out := make([]FileProgress, 0, len(x.streams))
+	for _, p := range x.streams {
+		out = append(out, *p)
+	}
+	x.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].QueuedAt.Equal(out[j].QueuedAt) {
+			return out[i].QueuedAt.Before(out[j].QueuedAt)
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+// queueLargeFile hands f to the ingest workers when its backlog is over
+// Options.StreamThreshold, and reports whether the scan should skip it: it is then
+// queued or already in flight. Callers hold scanMu and streamMu.
+func (x *Indexer) queueLargeFile(f scanFile) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if _, busy := x.streams[f.path]; busy {
+		return true
+	}
+	if !x.progress.Ready {
+		return false // the initial scan reads everything inline, with progress
+	}
+	left := fileSize(f.path) - x.positions[f.path]
+	if left <= x.opts.StreamThreshold {
+		return false
+	}
+	if _, ok := x.positions[f.path]; !ok {
+		x.positions[f.path] = 0 // the worker stops once the entry goes away
+	}
+	p := &FileProgress{Path: f.path, Provider: f.provider, SessionID: f.sessionID, State: "queued", BytesLeft: left, QueuedAt: time.Now()}
+	x.streams[f.path] = p
+	x.revision++
+	go x.streamFile(f, p)
+	return true
+}
+
+// streamFile reads one queued file to EOF in batches. Between batches the
+// tail offset is re-read: a rewrite that moved it (redact, delete message)
+// makes the worker reopen the file there, and one that dropped it (reindex,
+// delete, split) ends the stream; the next scan picks the file up again.
+func (x *Indexer) streamFile(f scanFile, p *FileProgress) {
+	x.streamSlots <- struct{}{}
+	defer func() {
+		<-x.streamSlots
+		x.mu.Lock()
+		delete(x.streams, f.path)
+		x.revision++
+		x.mu.Unlock()
+	}()
+	x.mu.Lock()
+	p.State = "streaming"
+	x.mu.Unlock()
+
+	var (
+		file   *os.File
+		reader *bufio.Reader
+		pos    int64 = -1
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+	for {
+		x.streamMu.RLock()
+		x.mu.RLock()
+		want, ok := x.positions[f.path]
+		x.mu.RUnlock()
+		if !ok {
+			x.streamMu.RUnlock()
+			return
+		}
+		if want != pos {
+			if file != nil {
+				file.Close()
+			}
+			var err error
+			if file, err = os.Open(f.path); err != nil {
+				x.streamMu.RUnlock()
+				return
+			}
+			if _, err := file.Seek(want, io.SeekStart); err != nil {
+				x.streamMu.RUnlock()
+				return
+			}
+			reader, pos = bufio.NewReader(file), want
+		}
+		var n int64
+		eof := false
+		for n < streamBatchBytes {
+			line, err := reader.ReadBytes('\n')
+			n += int64(len(line))
+			if len(strings.TrimSpace(string(line))) > 0 {
+				x.ingestLine(f.provider, f.project, f.sessionID, f.path, string(line))
+			}
+			if err != nil { // EOF or a read error; either ends the stream
+				eof = true
+				break
+			}
+		}
+		pos += n
+		x.mu.Lock()
+		if _, ok := x.positions[f.path]; ok {
+			x.positions[f.path] = pos
+		}
+		p.BytesDone += n
+		x.mu.Unlock()
+		if eof {
+			var modTime time.Time
+			if fi, err := os.Stat(f.path); err == nil {
+				modTime = fi.ModTime()
+			}
+			x.touchSessionFile(f.provider, f.project, f.sessionID, f.path, modTime, p.BytesDone)
+		}
+		x.streamMu.RUnlock()
+		if eof {
+			return
+		}
+	}
+}
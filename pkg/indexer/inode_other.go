@@ -0,0 +1,8 @@
+//go:build !unix
+
+package indexer
+
+import "os"
+
+// fileInode is only known on Unix; elsewhere checkpoints skip the check.
+func fileInode(fi os.FileInfo) uint64 { return 0 }
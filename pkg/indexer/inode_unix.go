@@ -0,0 +1,16 @@
+//go:build unix
+
+package indexer
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns the inode number of fi, or 0 when it is unknown.
+func fileInode(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
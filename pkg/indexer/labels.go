@@ -0,0 +1,73 @@
+package indexer
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// ColorLabels is the palette of named color labels the UI offers; values are
+// CSS hex colors.
+//
+// Deprecated: set Options.ColorLabels; this is only its default.
+var ColorLabels = map[string]string{
+	"red":    "#ef4444",
+	"orange": "#f97316",
+	"yellow": "#eab308",
+	"green":  "#22c55e",
+	"blue":   "#3b82f6",
+	"purple": "#a855f7",
+	"gray":   "#9ca3af",
+}
+
+var hexColorRe = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// ValidColor reports whether c is a label of the default palette or a
+// #rgb/#rrggbb color.
+func ValidColor(c string) bool {
+	return validColor(ColorLabels, c)
+}
+
+// ColorLabels returns the indexer's palette, Options.ColorLabels.
+func (x *Indexer) ColorLabels() map[string]string {
+	return x.opts.ColorLabels
+}
+
+// ValidColor reports whether c is a label of the indexer's palette or a
+// #rgb/#rrggbb color.
+func (x *Indexer) ValidColor(c string) bool {
+	return validColor(x.opts.ColorLabels, c)
+}
+
+func validColor(palette map[string]string, c string) bool {
+	if _, ok := palette[c]; ok {
+		return true
+	}
+	return hexColorRe.MatchString(c)
+}
+
+// SetDirColor assigns (or with "" clears) the color label of a directory.
+// Sessions in it without their own color inherit it.
+func (x *Indexer) SetDirColor(cwd, color string) error {
+	if color != "" && !x.ValidColor(color) {
+		return fmt.Errorf("unknown color %q", color)
+	}
+	return x.updateDirMeta(cwd, func(m *DirMeta) { m.Color = color })
+}
+
+// SetSessionColor assigns (or with "" clears) a session's own color label.
+func (x *Indexer) SetSessionColor(sessionID, color string) error {
+	if color != "" && !x.ValidColor(color) {
+		return fmt.Errorf("unknown color %q", color)
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	sess, ok := x.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	if err := x.updateSessionMeta(sess, func(m *sessionMeta) { m.Color = color }); err != nil {
+		return err
+	}
+	sess.Color = color
+	return nil
+}
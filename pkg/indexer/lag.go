@@ -0,0 +1,46 @@
+package indexer
+
+import "time"
+
+// IngestLag measures how far the watcher trails the agents: for each file
+// that had new lines, the time between the file's mtime and the moment
+// those lines were ingested. Poll interval and parse time both count.
+// Samples are taken only after the initial scan, whose backlog would
+// otherwise dominate.
+type IngestLag struct {
+	LastMs       int64     `json:"last_ms"`
+	AvgMs        int64     `json:"avg_ms"` // moving average, recent samples weigh most
+	MaxMs        int64     `json:"max_ms"` // since start or the last reindex
+	Samples      int       `json:"samples"`
+	LastIngestAt time.Time `json:"last_ingest_at"`
+}
+
+// lagWeight is the weight of a new sample in AvgMs.
+const lagWeight = 0.2
+
+// recordLagLocked adds a sample for provider. Callers hold x.mu.
+func (x *Indexer) recordLagLocked(provider string, modTime, at time.Time) {
+	if !x.progress.Ready || modTime.IsZero() {
+		return
+	}
+	ms := at.Sub(modTime).Milliseconds()
+	if ms < 0 {
+		ms = 0 // mtime from a clock slightly ahead
+	}
+	if x.lag == nil {
+		x.lag = make(map[string]IngestLag)
+	}
+	l := x.lag[provider]
+	if l.Samples == 0 {
+		l.AvgMs = ms
+	} else {
+		l.AvgMs = int64(lagWeight*float64(ms) + (1-lagWeight)*float64(l.AvgMs))
+	}
+	l.LastMs = ms
+	if ms > l.MaxMs {
+		l.MaxMs = ms
+	}
+	l.Samples++
+	l.LastIngestAt = at
+	x.lag[provider] = l
+}
@@ -0,0 +1,162 @@
+package indexer
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// languageAliases maps fence info strings to the language name sessions,
+// stats, and lang: searches use; "" drops the block.
+var languageAliases = func() map[string]string {
+	m := make(map[string]string)
+	for lang, aliases := range map[string][]string{
+		"go":          {"golang"},
+		"python":      {"py", "py3", "python3"},
+		"javascript":  {"js", "jsx", "mjs", "cjs", "node"},
+		"typescript":  {"ts", "tsx"},
+		"shell":       {"sh", "bash", "zsh", "fish", "console", "shell-session", "shellsession"},
+		"powershell":  {"ps1", "pwsh"},
+		"terraform":   {"tf", "tfvars", "hcl"},
+		"yaml":        {"yml"},
+		"rust":        {"rs"},
+		"ruby":        {"rb"},
+		"kotlin":      {"kt", "kts"},
+		"csharp":      {"cs", "c#"},
+		"cpp":         {"c++", "cc", "cxx", "hpp"},
+		"c":           {"h"},
+		"objective-c": {"objc"},
+		"markdown":    {"md"},
+		"docker":      {"dockerfile"},
+		"diff":        {"patch"},
+		"json":        {"jsonc", "json5"},
+		"sql":         {"postgres", "postgresql", "mysql", "sqlite", "plsql"},
+		"html":        {"htm", "xhtml"},
+		"protobuf":    {"proto"},
+		"":            {"text", "txt", "plain", "plaintext", "output", "log"},
+	} {
+		for _, a := range aliases {
+			m[a] = lang
+		}
+	}
+	return m
+}()
+
+var (
+	fenceRe     = regexp.MustCompile("(?m)^[ \t]*(```+|~~~+)[ \t]*([^\\s`{]*)[^\\n]*\\n")
+	goRe        = regexp.MustCompile(`(?m)^(package [a-z_][a-z0-9_]*$|func (\([^)]*\) )?[A-Za-z_]\w*\()`)
+	terraformRe = regexp.MustCompile(`(?m)^(resource|provider|variable|module|data|output|terraform)\b[^\n{]*\{`)
+	pythonRe    = regexp.MustCompile(`(?m)^(def [A-Za-z_]\w*\(.*\)( -> .+)?:$|from [\w.]+ import |import [\w.]+$|class \w+(\(.*\))?:$)`)
+	rustRe      = regexp.MustCompile(`(?m)^\s*(pub )?fn \w+|^\s*let mut |^use \w+::`)
+	sqlRe       = regexp.MustCompile(`(?is)^\s*(select\b.+\bfrom\b|insert into\b|update \w+ set\b|create (table|index)\b|alter table\b)`)
+	diffRe      = regexp.MustCompile(`(?m)^(@@ -\d|\+\+\+ |--- a/|diff --git )`)
+	shellRe     = regexp.MustCompile(`^(\$ |(git|go|npm|npx|yarn|pnpm|cd|ls|make|docker|kubectl|terraform|pip|cargo|brew|curl|sudo|export|echo|mkdir|rm|cp|mv)( |$))`)
+)
+
+// NormalizeLanguage maps a fence info string (or a lang: search value) to
+// its canonical language name; "" means no language.
+func NormalizeLanguage(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, "language-")
+	if l, ok := languageAliases[s]; ok {
+		return l
+	}
+	return s
+}
+
+// CodeLanguages lists the language of each fenced code block in a message's
+// text, in order, leaving out blocks whose language is neither named in the
+// fence nor recognizable from the code.
+func CodeLanguages(m *Message) []string {
+	if m == nil || !strings.Contains(m.Content, "```") && !strings.Contains(m.Content, "~~~") {
+		return nil
+	}
+	var out []string
+	text := m.Content
+	for {
+		loc := fenceRe.FindStringSubmatchIndex(text)
+		if loc == nil {
+			return out
+		}
+		fence, info := text[loc[2]:loc[3]], text[loc[4]:loc[5]]
+		body := text[loc[1]:]
+		end := closingFence(body, fence)
+		code := body
+		if end >= 0 {
+			code = body[:end]
+		}
+		lang := NormalizeLanguage(info)
+		if info == "" {
+			lang = detectLanguage(code)
+		}
+		if lang != "" {
+			out = append(out, lang)
+		}
+		if end < 0 {
+			return out
+		}
+		text = body[end:]
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		} else {
+			return out
+		}
+	}
+}
+
+// closingFence returns the offset of the line closing a block opened by
+// fence, or -1 when the block runs to the end of the text.
+func closingFence(body, fence string) int {
+	off := 0
+	for off < len(body) {
+		line := body[off:]
+		if i := strings.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+		}
+		t := strings.TrimSpace(line)
+		if strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" {
+			return off
+		}
+		off += len(line) + 1
+	}
+	return -1
+}
+
+// detectLanguage guesses the language of an untagged code block from a few
+// unambiguous markers; "" when unsure.
+func detectLanguage(code string) string {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ""
+	}
+	if strings.HasPrefix(code, "#!") {
+		first, _, _ := strings.Cut(code, "\n")
+		switch {
+		case strings.Contains(first, "python"):
+			return "python"
+		case strings.Contains(first, "node"):
+			return "javascript"
+		case strings.Contains(first, "sh"):
+			return "shell"
+		}
+	}
+	switch {
+	case diffRe.MatchString(code):
+		return "diff"
+	case (code[0] == '{' || code[0] == '[') && json.Valid([]byte(code)):
+		return "json"
+	case goRe.MatchString(code) && (strings.Contains(code, ":=") || strings.HasPrefix(code, "package ")):
+		return "go"
+	case terraformRe.MatchString(code) && strings.Contains(code, `"`):
+		return "terraform"
+	case pythonRe.MatchString(code):
+		return "python"
+	case rustRe.MatchString(code):
+		return "rust"
+	case sqlRe.MatchString(code):
+		return "sql"
+	case shellRe.MatchString(code):
+		return "shell"
+	}
+	return ""
+}
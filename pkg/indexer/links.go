@@ -0,0 +1,158 @@
+package indexer
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Link is a web reference seen in a session: a search result, a fetched
+// page, or a citation attached to an answer.
+type Link struct {
+	URL       string    `json:"url"`
+	Title     string    `json:"title,omitempty"`
+	Kind      string    `json:"kind"`            // search|fetch|citation
+	Query     string    `json:"query,omitempty"` // search that produced it, when known
+	MessageID string    `json:"message_id,omitempty"`
+	Ts        time.Time `json:"ts,omitempty"`
+}
+
+// MessageLinks extracts web references from one message. It understands
+// Codex web_search_call actions and url_citation annotations, Claude
+// WebSearch/WebFetch tool calls and their results, and server-side
+// web_search_result blocks. Bare URLs in prose are not collected.
+func MessageLinks(m *Message) []Link {
+	if m == nil || m.Raw == nil {
+		return nil
+	}
+	var out []Link
+	add := func(url, title, kind, query string) {
+		url = strings.TrimSpace(url)
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return
+		}
+		out = append(out, Link{URL: url, Title: strings.TrimSpace(title), Kind: kind, Query: query, MessageID: m.ID, Ts: m.Ts})
+	}
+	query := ""
+	if strings.EqualFold(m.Type, "web_search_call") {
+		if action, ok := MessageData(m)["action"].(map[string]any); ok {
+			query, _ = action["query"].(string)
+			if url, _ := action["url"].(string); url != "" {
+				add(url, "", "fetch", "")
+			}
+		}
+	}
+	if res, ok := m.Raw["toolUseResult"].(map[string]any); ok {
+		if q, _ := res["query"].(string); q != "" {
+			query = q
+		}
+	}
+	var walk func(v any, depth int)
+	walk = func(v any, depth int) {
+		if depth > 8 {
+			return
+		}
+		switch t := v.(type) {
+		case map[string]any:
+			typ, _ := t["type"].(string)
+			url, _ := t["url"].(string)
+			title, _ := t["title"].(string)
+			switch {
+			case typ == "url_citation":
+				add(url, title, "citation", "")
+			case typ == "web_search_result":
+				add(url, title, "search", query)
+			case typ == "tool_use":
+				name, _ := t["name"].(string)
+				input, _ := t["input"].(map[string]any)
+				switch name {
+				case "WebFetch":
+					u, _ := input["url"].(string)
+					add(u, "", "fetch", "")
+				case "WebSearch":
+					q, _ := input["query"].(string)
+					if q != "" {
+						query = q
+					}
+				}
+			case url != "" && title != "":
+				add(url, title, "search", query)
+			}
+			keys := make([]string, 0, len(t))
+			for k := range t {
+				if k != "url" && k != "title" {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys) // stable link order within a message
+			for _, k := range keys {
+				walk(t[k], depth+1)
+			}
+		case []any:
+			for _, child := range t {
+				walk(child, depth+1)
+			}
+		case string:
+			for _, l := range searchResultLinks(t) {
+				add(l.URL, l.Title, "search", query)
+			}
+		}
+	}
+	walk(map[string]any(m.Raw), 0)
+	return dedupeLinks(nil, out)
+}
+
+// searchResultLinks parses the "Links: [{...}]" list that Claude's WebSearch
+// tool puts in its text result.
+func searchResultLinks(s string) []Link {
+	i := strings.Index(s, "Links: [")
+	if i < 0 {
+		return nil
+	}
+	var items []struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	}
+	if err := json.NewDecoder(strings.NewReader(s[i+len("Links: "):])).Decode(&items); err != nil {
+		return nil
+	}
+	out := make([]Link, 0, len(items))
+	for _, it := range items {
+		out = append(out, Link{URL: it.URL, Title: it.Title})
+	}
+	return out
+}
+
+// dedupeLinks appends the links of more to list whose URL it does not hold
+// yet, filling in a missing title from a later sighting.
+func dedupeLinks(list, more []Link) []Link {
+	for _, l := range more {
+		found := false
+		for i := range list {
+			if list[i].URL == l.URL {
+				if list[i].Title == "" {
+					list[i].Title = l.Title
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, l)
+		}
+	}
+	return list
+}
+
+// Links returns the web references collected for a session during ingest,
+// in the order first seen.
+func (x *Indexer) Links(sessionID string) []Link {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	s, ok := x.sessions[sessionID]
+	if !ok {
+		return nil
+	}
+	return append([]Link(nil), s.links...)
+}
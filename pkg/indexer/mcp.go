@@ -0,0 +1,139 @@
+package indexer
+
+import "strings"
+
+// mcpPrefix starts the names MCP tools are exposed under by both providers:
+// mcp__<server>__<tool>.
+const mcpPrefix = "mcp__"
+
+// ParseMCPTool splits an MCP tool name into its server and tool parts. The
+// server is everything up to the first "__" after the prefix, so tool names
+// may themselves contain double underscores.
+func ParseMCPTool(name string) (server, tool string, ok bool) {
+	rest, found := strings.CutPrefix(name, mcpPrefix)
+	if !found {
+		return "", "", false
+	}
+	server, tool, ok = strings.Cut(rest, "__")
+	if !ok || server == "" || tool == "" {
+		return "", "", false
+	}
+	return server, tool, true
+}
+
+// Kinds of tool a tool call message invokes (Message.ToolKind): a shell
+// command, an MCP server's tool, or another tool built into the agent
+// (apply_patch, web_search, Claude's Read or Edit, ...).
+const (
+	ToolKindShell   = "shell"
+	ToolKindMCP     = "mcp"
+	ToolKindBuiltin = "builtin"
+)
+
+// shellTools are the tools that run a command, as toolKey names.
+var shellTools = map[string]bool{"shell": true, "localshell": true, "shellcommand": true, "execcommand": true, "container.exec": true, "bash": true}
+
+// setToolKind sets the ToolName and ToolKind of a message that invokes tools.
+// An MCP tool is named "server/tool"; a message calling several tools is
+// of the kind of the first MCP or shell one among them.
+func setToolKind(m *Message) {
+	names := ToolCallNames(m)
+	if len(names) == 0 {
+		return
+	}
+	kind, name := ToolKindBuiltin, names[0]
+	for _, n := range names {
+		if server, tool, ok := ParseMCPTool(n); ok {
+			kind, name = ToolKindMCP, server+"/"+tool
+			break
+		}
+		if kind == ToolKindBuiltin && shellTools[toolKey(n)] {
+			kind, name = ToolKindShell, n
+		}
+	}
+	m.ToolKind = kind
+	if m.ToolName == "" {
+		m.ToolName = name
+	}
+}
+
+// MessageData returns the object holding a message's fields: the payload of
+// a Codex response_item line, else the raw line itself.
+func MessageData(m *Message) map[string]any {
+	if m == nil || m.Raw == nil {
+		return nil
+	}
+	if payload, ok := m.Raw["payload"].(map[string]any); ok && payload != nil {
+		return payload
+	}
+	return m.Raw
+}
+
+// ToolCallNames lists the tools a message invokes: the name of a Codex
+// function/custom tool call ("shell" and "web_search" for Codex's built-in
+// local shell and web search calls), or the tool_use parts of a Claude
+// message.
+func ToolCallNames(m *Message) []string {
+	data := MessageData(m)
+	if data == nil {
+		return nil
+	}
+	switch strings.ToLower(m.Type) {
+	case "local_shell_call":
+		return []string{"shell"}
+	case "web_search_call":
+		return []string{"web_search"}
+	case "function_call", "custom_tool_call":
+		if name, _ := data["name"].(string); name != "" {
+			return []string{name}
+		}
+		if m.ToolName != "" {
+			return []string{m.ToolName}
+		}
+		return nil
+	}
+	mobj, ok := data["message"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	parts, _ := mobj["content"].([]any)
+	var names []string
+	for _, p := range parts {
+		part, _ := p.(map[string]any)
+		if t, _ := part["type"].(string); t != "tool_use" {
+			continue
+		}
+		if name, _ := part["name"].(string); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// UsedTool reports whether counts (a Session's ToolCounts) include a call to
+// name. Case and underscores are ignored, so web_search also finds Claude's
+// WebSearch.
+func UsedTool(counts map[string]int, name string) bool {
+	want := toolKey(name)
+	for tool, n := range counts {
+		if n > 0 && toolKey(tool) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func toolKey(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "_", "")
+}
+
+// MCPCalls returns the "server/tool" of every MCP tool a message invokes.
+func MCPCalls(m *Message) []string {
+	var out []string
+	for _, name := range ToolCallNames(m) {
+		if server, tool, ok := ParseMCPTool(name); ok {
+			out = append(out, server+"/"+tool)
+		}
+	}
+	return out
+}
@@ -0,0 +1,257 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sessionMeta is the content of a session's <id>.meta.json sidecar, schema
+// version metaVersion:
+//
+//	{"version": 2, "custom_title": "...", "tags": ["..."], "notes": "...",
+//	 "color": "blue", "pinned": true, "archived": true, "summary": "...",
+//	 "revision": 7}
+//
+// Sync tools, other watcher instances, or newer versions may share the file,
+// so parsing is forgiving: keys the watcher does not know, and known keys
+// whose value it cannot read, are kept as they are and written back; files
+// of an older version are migrated on read (see metaMigrations). Revision
+// counts the writes so a change made between reading and writing is not
+// lost.
+type sessionMeta struct {
+	Version     int      `json:"version"`
+	CustomTitle string   `json:"custom_title,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Notes       string   `json:"notes,omitempty"` // free text about the session, unlike watcher_note lines
+	Color       string   `json:"color,omitempty"` // color label name or #hex
+	Pinned      bool     `json:"pinned,omitempty"`
+	Archived    bool     `json:"archived,omitempty"`
+	Summary     string   `json:"summary,omitempty"`
+	Revision    int      `json:"revision,omitempty"`
+
+	extra map[string]json.RawMessage // unknown or unreadable keys, written back unchanged
+}
+
+// metaVersion is the sidecar schema version the watcher writes.
+const metaVersion = 2
+
+// metaMigrations[v] upgrades the keys of a version v sidecar to version
+// v+1; files without a version field are version 1.
+var metaMigrations = map[int]func(map[string]json.RawMessage){
+	// 1: custom_title, pinned, color, and revision, unversioned. Version 2
+	// only adds keys.
+	1: func(map[string]json.RawMessage) {},
+}
+
+// metaWriteAttempts bounds how often updateSessionMeta starts over when the
+// sidecar changed while it was writing.
+const metaWriteAttempts = 5
+
+// ErrMetaConflict is returned when a sidecar kept changing underneath an
+// update.
+var ErrMetaConflict = errors.New("metadata file changed concurrently")
+
+func (m *sessionMeta) UnmarshalJSON(data []byte) error {
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	*m = sessionMeta{Version: 1}
+	if v, ok := all["version"]; ok && json.Unmarshal(v, &m.Version) == nil {
+		delete(all, "version")
+	}
+	for v := m.Version; v < metaVersion; v++ {
+		if migrate := metaMigrations[v]; migrate != nil {
+			migrate(all)
+		}
+	}
+	m.Version = max(m.Version, metaVersion)
+	fields := map[string]any{
+		"custom_title": &m.CustomTitle, "tags": &m.Tags, "notes": &m.Notes, "color": &m.Color,
+		"pinned": &m.Pinned, "archived": &m.Archived, "summary": &m.Summary, "revision": &m.Revision,
+	}
+	for k, dst := range fields {
+		raw, ok := all[k]
+		if !ok {
+			continue
+		}
+		if k == "tags" {
+			if tags, ok := parseMetaTags(raw); ok {
+				m.Tags = tags
+				delete(all, k)
+			}
+		} else if json.Unmarshal(raw, dst) == nil {
+			delete(all, k)
+		}
+	}
+	if len(all) > 0 {
+		m.extra = all
+	}
+	return nil
+}
+
+// parseMetaTags reads tags written as a list or as one comma-separated
+// string, as people editing the file by hand do.
+func parseMetaTags(raw json.RawMessage) ([]string, bool) {
+	var list []string
+	if json.Unmarshal(raw, &list) != nil {
+		var s string
+		if json.Unmarshal(raw, &s) != nil {
+			return nil, false
+		}
+		list = strings.Split(s, ",")
+	}
+	var out []string
+	for _, t := range list {
+		if t = strings.TrimSpace(t); t != "" {
+			out = mergeTags(out, []string{t})
+		}
+	}
+	return out, true
+}
+
+func (m sessionMeta) MarshalJSON() ([]byte, error) {
+	type plain sessionMeta
+	m.Version = max(m.Version, metaVersion)
+	known, err := json.Marshal(plain(m))
+	if err != nil || len(m.extra) == 0 {
+		return known, err
+	}
+	all := make(map[string]json.RawMessage, len(m.extra)+9)
+	for k, v := range m.extra {
+		all[k] = v
+	}
+	if err := json.Unmarshal(known, &all); err != nil {
+		return nil, err
+	}
+	return json.Marshal(all)
+}
+
+// metaPath returns the sidecar path for a session: next to the Claude
+// project file, or under the sessions directory of its Codex root ("" for
+// the first).
+func (x *Indexer) metaPath(sessionID, provider, root string) (string, error) {
+	if provider == ProviderHistory {
+		return "", fmt.Errorf("%w: %s", ErrReadOnly, sessionID)
+	}
+	if provider == ProviderClaude {
+		parts := strings.SplitN(sessionID, ":", 3)
+		if len(parts) < 3 {
+			return "", fmt.Errorf("invalid claude session ID format: %s", sessionID)
+		}
+		return filepath.Join(x.claudeDir, parts[1], parts[2]+".meta.json"), nil
+	}
+	return x.codexSessionPath(&Session{ID: sessionID, Root: root}, ".meta.json"), nil
+}
+
+// readSessionMeta returns the sidecar contents; a missing or invalid file
+// yields empty metadata.
+func readSessionMeta(path string) sessionMeta {
+	var m sessionMeta
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &m)
+	}
+	return m
+}
+
+// sessionMetaOf returns a session's metadata from the central store or its
+// sidecar; none yields empty metadata.
+func (x *Indexer) sessionMetaOf(sessionID, provider, root string) sessionMeta {
+	path, err := x.metaPath(sessionID, provider, root)
+	if err != nil {
+		return sessionMeta{}
+	}
+	if x.opts.MetaStorePath != "" {
+		return centralSessionMeta(x.opts.MetaStorePath, sessionID)
+	}
+	return readSessionMeta(path)
+}
+
+// updateSessionMeta applies fn to the session's metadata, in the central
+// store or its sidecar, and writes it back, keeping fields fn does not
+// touch. The caller holds x.mu.
+func (x *Indexer) updateSessionMeta(sess *Session, fn func(*sessionMeta)) error {
+	path, err := x.metaPath(sess.ID, sess.Provider, sess.Root)
+	if err != nil {
+		return err
+	}
+	if x.opts.MetaStorePath != "" {
+		return updateCentralMeta(x.opts.MetaStorePath, func(entries map[string]sessionMeta) {
+			m := entries[sess.ID]
+			fn(&m)
+			m.Revision++
+			entries[sess.ID] = m
+		})
+	}
+	return updateSidecar(path, fn)
+}
+
+// updateSidecar applies fn to the sidecar at path and replaces the file
+// atomically (temp file and rename); if another writer bumped its revision
+// meanwhile, fn is applied again to the newer content.
+func updateSidecar(path string, fn func(*sessionMeta)) error {
+	for attempt := 0; attempt < metaWriteAttempts; attempt++ {
+		m := readSessionMeta(path)
+		base := m.Revision
+		fn(&m)
+		m.Revision = base + 1
+		data, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+		tmp, err := writeTemp(path, data)
+		if err != nil {
+			return fmt.Errorf("failed to write metadata file %s: %w", path, err)
+		}
+		if readSessionMeta(path).Revision != base {
+			os.Remove(tmp)
+			continue
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to write metadata file %s: %w", path, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrMetaConflict, path)
+}
+
+// writeTemp writes data to a new temporary file next to path, for renaming
+// over it, and returns its name.
+func writeTemp(path string, data []byte) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0o644)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// SetPinned pins or unpins a session. Pinned sessions are listed first.
+func (x *Indexer) SetPinned(sessionID string, pinned bool) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	sess, ok := x.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	if err := x.updateSessionMeta(sess, func(m *sessionMeta) { m.Pinned = pinned }); err != nil {
+		return err
+	}
+	sess.Pinned = pinned
+	return nil
+}
@@ -0,0 +1,222 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// MetaStorePath, when set, keeps the metadata of all sessions (title, pin,
+// color, tags, ...) in this one JSON file instead of a <id>.meta.json
+// sidecar next to each session file. Read when metadata is loaded or
+// written; see ImportSidecars and ExportSidecars to move between the two.
+//
+// Deprecated: set Options.MetaStorePath; this is only its default.
+var MetaStorePath string
+
+// MetaStoreFile is the central store's name in the watcher's data directory.
+const MetaStoreFile = "codex-watcher-meta.json"
+
+// centralMeta is the content of the central store. Revision counts the
+// writes of the whole file, like sessionMeta.Revision for a sidecar.
+type centralMeta struct {
+	Version  int                    `json:"version"`
+	Revision int                    `json:"revision"`
+	Sessions map[string]sessionMeta `json:"sessions"`
+}
+
+// centralCache holds the last central store read, reloaded when the file
+// changes; sessions load their metadata on every tail.
+var centralCache struct {
+	sync.Mutex
+	path  string
+	size  int64
+	modAt time.Time
+	meta  centralMeta
+}
+
+// readCentralMeta reads the central store at path; a missing file is an
+// empty store.
+func readCentralMeta(path string) (centralMeta, error) {
+	c := centralMeta{Version: metaVersion, Sessions: map[string]sessionMeta{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("invalid metadata store %s: %w", path, err)
+	}
+	if c.Sessions == nil {
+		c.Sessions = map[string]sessionMeta{}
+	}
+	return c, nil
+}
+
+// centralSessionMeta returns a session's entry of the central store at
+// path; a missing or invalid store yields empty metadata.
+func centralSessionMeta(path, sessionID string) sessionMeta {
+	centralCache.Lock()
+	defer centralCache.Unlock()
+	fi, err := os.Stat(path)
+	if err != nil {
+		return sessionMeta{}
+	}
+	if centralCache.path != path || centralCache.size != fi.Size() || !centralCache.modAt.Equal(fi.ModTime()) {
+		c, err := readCentralMeta(path)
+		if err != nil {
+			return sessionMeta{}
+		}
+		centralCache.path, centralCache.size, centralCache.modAt, centralCache.meta = path, fi.Size(), fi.ModTime(), c
+	}
+	return centralCache.meta.Sessions[sessionID]
+}
+
+// updateCentralMeta applies fn to the entries of the central store at path
+// and replaces the file atomically, starting over if another writer bumped
+// its revision meanwhile. An invalid store is left alone.
+func updateCentralMeta(path string, fn func(map[string]sessionMeta)) error {
+	centralCache.Lock()
+	defer centralCache.Unlock()
+	for attempt := 0; attempt < metaWriteAttempts; attempt++ {
+		c, err := readCentralMeta(path)
+		if err != nil {
+			return err
+		}
+		base := c.Revision
+		fn(c.Sessions)
+		c.Version, c.Revision = metaVersion, base+1
+		data, err := json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+		tmp, err := writeTemp(path, data)
+		if err != nil {
+			return fmt.Errorf("failed to write metadata store %s: %w", path, err)
+		}
+		if cur, err := readCentralMeta(path); err != nil || cur.Revision != base {
+			os.Remove(tmp)
+			continue
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to write metadata store %s: %w", path, err)
+		}
+		centralCache.path = "" // reread on next use
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrMetaConflict, path)
+}
+
+// metaSession names a session whose sidecar ImportSidecars or
+// ExportSidecars moves.
+type metaSession struct{ id, provider, root string }
+
+// metaSessions lists the indexed sessions that can carry metadata.
+func (x *Indexer) metaSessions() []metaSession {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var out []metaSession
+	for id, s := range x.sessions {
+		if readOnly(s) == nil {
+			out = append(out, metaSession{id, s.Provider, s.Root})
+		}
+	}
+	return out
+}
+
+// ImportSidecars copies the sidecars of the indexed sessions into the
+// central store at Options.MetaStorePath and returns how many it copied.
+// An entry already in the store is only replaced by a sidecar with a
+// higher revision. With remove, copied sidecars are deleted.
+func (x *Indexer) ImportSidecars(remove bool) (int, error) {
+	if x.opts.MetaStorePath == "" {
+		return 0, fmt.Errorf("no central metadata store configured")
+	}
+	found := make(map[string]sessionMeta)
+	paths := make(map[string]string)
+	for _, s := range x.metaSessions() {
+		path, err := x.metaPath(s.id, s.provider, s.root)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			found[s.id], paths[s.id] = readSessionMeta(path), path
+		}
+	}
+	n := 0
+	err := updateCentralMeta(x.opts.MetaStorePath, func(entries map[string]sessionMeta) {
+		n = 0
+		for id, m := range found {
+			if have, ok := entries[id]; !ok || m.Revision > have.Revision {
+				entries[id] = m
+				n++
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if remove {
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil {
+				return n, err
+			}
+		}
+	}
+	x.reloadSessionMeta()
+	return n, nil
+}
+
+// ExportSidecars writes the central store's entries of the indexed sessions
+// to their sidecars and returns how many it wrote. Keys a sidecar has that
+// the entry lacks are kept.
+func (x *Indexer) ExportSidecars() (int, error) {
+	if x.opts.MetaStorePath == "" {
+		return 0, fmt.Errorf("no central metadata store configured")
+	}
+	c, err := readCentralMeta(x.opts.MetaStorePath)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, s := range x.metaSessions() {
+		e, ok := c.Sessions[s.id]
+		if !ok {
+			continue
+		}
+		path, err := x.metaPath(s.id, s.provider, s.root)
+		if err != nil {
+			continue
+		}
+		err = updateSidecar(path, func(m *sessionMeta) {
+			extra := m.extra
+			*m = e
+			for k, v := range extra {
+				if _, ok := m.extra[k]; !ok {
+					if m.extra == nil {
+						m.extra = make(map[string]json.RawMessage)
+					}
+					m.extra[k] = v
+				}
+			}
+		})
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// reloadSessionMeta applies the stored metadata to every indexed session
+// again, after the store changed underneath them.
+func (x *Indexer) reloadSessionMeta() {
+	for _, s := range x.metaSessions() {
+		x.loadSessionMetadata(s.id, s.provider, s.root)
+	}
+}
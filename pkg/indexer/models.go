@@ -0,0 +1,223 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ModelsFile is the default model config, read from the codex directory
+// when --models_config is not given.
+const ModelsFile = "codex-watcher-models.json"
+
+// ModelPrice is the price of a model in USD per 1,000 tokens.
+type ModelPrice struct {
+	InputPer1K       float64 `json:"input_per_1k"`
+	CachedInputPer1K float64 `json:"cached_input_per_1k,omitempty"` // 0 = same as input
+	OutputPer1K      float64 `json:"output_per_1k"`
+}
+
+// ModelConfig maps provider-specific model names to the names stats, facets,
+// and filters group by, and prices those names for cost estimates.
+//
+//	{
+//	  "normalize": ["region", "snapshot", "lowercase"],
+//	  "aliases": {"gpt-5-codex": "gpt-5", "claude-sonnet-4-5-*": "claude-sonnet-4-5"},
+//	  "roles":   {"human": "user", "model": "assistant"},
+//	  "prices":  {"gpt-5": {"input_per_1k": 0.00125, "output_per_1k": 0.01}}
+//	}
+//
+// Normalize rules run first, in order (see modelNormalizers): "region"
+// drops cloud prefixes such as Bedrock's "us.anthropic.", "snapshot" drops
+// dated snapshot and version suffixes ("-20241022", "-2024-08-06",
+// "@20240620", "-v2:0"), and "lowercase" folds case. An alias key ending in
+// "*" matches any name with that prefix; exact keys win over prefixes and
+// longer prefixes over shorter ones. Matching ignores case. Prices are
+// looked up by the aliased name, then by the raw one. Roles renames message
+// roles at ingest, so provider-specific roles count as user or assistant.
+type ModelConfig struct {
+	Normalize []string              `json:"normalize,omitempty"`
+	Aliases   map[string]string     `json:"aliases,omitempty"`
+	Roles     map[string]string     `json:"roles,omitempty"`
+	Prices    map[string]ModelPrice `json:"prices,omitempty"`
+}
+
+var (
+	regionPrefix   = regexp.MustCompile(`(?i)^(?:(?:us|us-gov|eu|apac|jp|au|ca|global)\.)?(?:anthropic|amazon|meta|mistral|cohere|ai21|deepseek|openai)\.`)
+	snapshotSuffix = regexp.MustCompile(`(?i)(?:[-@_]\d{4}-?\d{2}-?\d{2}|-(?:0[1-9]|1[0-2])\d{2}|-v\d+(?::\d+)?)$`)
+)
+
+// modelNormalizers are the rules ModelConfig.Normalize may name.
+var modelNormalizers = map[string]func(string) string{
+	"region": func(m string) string { return regionPrefix.ReplaceAllString(m, "") },
+	"snapshot": func(m string) string {
+		for {
+			next := snapshotSuffix.ReplaceAllString(m, "")
+			if next == m || next == "" {
+				return m
+			}
+			m = next
+		}
+	},
+	"lowercase": strings.ToLower,
+}
+
+// Models is the default model config; the zero value leaves names
+// unchanged.
+//
+// Deprecated: set Options.Models; this is only its default.
+var Models ModelConfig
+
+// LoadModelConfig reads a model config file. Alias keys are lower-cased and
+// aliases to the empty string are rejected.
+func LoadModelConfig(path string) (ModelConfig, error) {
+	var cfg ModelConfig
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	aliases := make(map[string]string, len(cfg.Aliases))
+	for from, to := range cfg.Aliases {
+		from, to = strings.ToLower(strings.TrimSpace(from)), strings.TrimSpace(to)
+		if from == "" || from == "*" || to == "" {
+			return cfg, fmt.Errorf("%s: invalid alias %q -> %q", path, from, to)
+		}
+		aliases[from] = to
+	}
+	cfg.Aliases = aliases
+	for _, rule := range cfg.Normalize {
+		if modelNormalizers[rule] == nil {
+			return cfg, fmt.Errorf("%s: unknown normalize rule %q (want region, snapshot, or lowercase)", path, rule)
+		}
+	}
+	roles := make(map[string]string, len(cfg.Roles))
+	for from, to := range cfg.Roles {
+		from, to = strings.ToLower(strings.TrimSpace(from)), strings.TrimSpace(to)
+		if from == "" || to == "" {
+			return cfg, fmt.Errorf("%s: invalid role %q -> %q", path, from, to)
+		}
+		roles[from] = to
+	}
+	cfg.Roles = roles
+	prices := make(map[string]ModelPrice, len(cfg.Prices))
+	for name, p := range cfg.Prices {
+		if p.InputPer1K < 0 || p.OutputPer1K < 0 || p.CachedInputPer1K < 0 {
+			return cfg, fmt.Errorf("%s: negative price for %q", path, name)
+		}
+		prices[strings.ToLower(strings.TrimSpace(name))] = p
+	}
+	cfg.Prices = prices
+	return cfg, nil
+}
+
+// Canonical returns the name model is grouped under.
+func (c ModelConfig) Canonical(model string) string {
+	model = strings.TrimSpace(model)
+	for _, rule := range c.Normalize {
+		if f := modelNormalizers[rule]; f != nil && model != "" {
+			model = f(model)
+		}
+	}
+	if model == "" || len(c.Aliases) == 0 {
+		return model
+	}
+	key := strings.ToLower(model)
+	if to, ok := c.Aliases[key]; ok {
+		return to
+	}
+	best, bestLen := "", -1
+	for from, to := range c.Aliases {
+		prefix, ok := strings.CutSuffix(from, "*")
+		if ok && strings.HasPrefix(key, prefix) && len(prefix) > bestLen {
+			best, bestLen = to, len(prefix)
+		}
+	}
+	if bestLen >= 0 {
+		return best
+	}
+	return model
+}
+
+// Price returns the configured price of model, if any.
+func (c ModelConfig) Price(model string) (ModelPrice, bool) {
+	if len(c.Prices) == 0 {
+		return ModelPrice{}, false
+	}
+	if p, ok := c.Prices[strings.ToLower(c.Canonical(model))]; ok {
+		return p, true
+	}
+	p, ok := c.Prices[strings.ToLower(strings.TrimSpace(model))]
+	return p, ok
+}
+
+// CanonicalRole returns the role a message with role is counted as.
+func (c ModelConfig) CanonicalRole(role string) string {
+	if to, ok := c.Roles[strings.ToLower(strings.TrimSpace(role))]; ok {
+		return to
+	}
+	return role
+}
+
+// CanonicalModel applies the default config's normalize rules and aliases.
+func CanonicalModel(model string) string { return Models.Canonical(model) }
+
+// CanonicalModel applies the normalize rules and aliases of the indexer's
+// Options.Models, under which its sessions and stats group models.
+func (x *Indexer) CanonicalModel(model string) string { return x.opts.Models.Canonical(model) }
+
+// ModelUsage describes one grouped model for /api/models.
+type ModelUsage struct {
+	Model    string         `json:"model"`              // canonical name
+	Variants map[string]int `json:"variants,omitempty"` // raw names seen, with message counts
+	Messages int            `json:"messages"`
+	Sessions int            `json:"sessions"`
+	Price    *ModelPrice    `json:"price,omitempty"`
+}
+
+// ModelUsages lists every model seen, grouped by canonical name, most used
+// first.
+func (x *Indexer) ModelUsages() []ModelUsage {
+	byName := make(map[string]*ModelUsage)
+	x.mu.RLock()
+	for id := range x.sessions {
+		seen := make(map[string]bool)
+		for _, m := range x.messagesLocked(id) {
+			if m.Model == "" {
+				continue
+			}
+			name := x.opts.Models.Canonical(m.Model)
+			u := byName[name]
+			if u == nil {
+				u = &ModelUsage{Model: name, Variants: make(map[string]int)}
+				byName[name] = u
+			}
+			u.Messages++
+			u.Variants[m.Model]++
+			if !seen[name] {
+				seen[name] = true
+				u.Sessions++
+			}
+		}
+	}
+	x.mu.RUnlock()
+	out := make([]ModelUsage, 0, len(byName))
+	for _, u := range byName {
+		if p, ok := x.opts.Models.Price(u.Model); ok {
+			u.Price = &p
+		}
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Messages != out[j].Messages {
+			return out[i].Messages > out[j].Messages
+		}
+		return out[i].Model < out[j].Model
+	})
+	return out
+}
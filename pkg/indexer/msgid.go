@@ -0,0 +1,39 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// stableIDPrefix marks message IDs the indexer made up.
+const stableIDPrefix = "h-"
+
+// stableMessageID derives an ID for a message whose line has none from its
+// session, time, and content (the whole line for tool calls and other
+// lines without text), so it survives rewrites that shift line numbers.
+// Identical messages in a session are told apart by a -2, -3, ... suffix in
+// file order. Callers hold x.mu for writing.
+func stableMessageID(s *Session, ts time.Time, content, line string) string {
+	if content == "" {
+		content = line
+	}
+	h := sha256.New()
+	h.Write([]byte(s.ID))
+	h.Write([]byte{0})
+	if !ts.IsZero() {
+		h.Write([]byte(ts.UTC().Format(time.RFC3339Nano)))
+	}
+	h.Write([]byte{0})
+	h.Write([]byte(content))
+	id := stableIDPrefix + hex.EncodeToString(h.Sum(nil)[:8])
+	if s.genIDs == nil {
+		s.genIDs = make(map[string]int)
+	}
+	s.genIDs[id]++
+	if n := s.genIDs[id]; n > 1 {
+		id += "-" + strconv.Itoa(n)
+	}
+	return id
+}
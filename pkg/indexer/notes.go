@@ -0,0 +1,89 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// NoteType is the provider-neutral line type used for human annotations that the
+// watcher appends to a session file.
+const NoteType = "watcher_note"
+
+// AppendNote appends a watcher_note line to the session's JSONL file so the
+// annotation lives alongside the transcript. The regular tail loop ingests it.
+func (x *Indexer) AppendNote(sessionID, text, author string) (map[string]any, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("empty note")
+	}
+	x.mu.RLock()
+	sess, exists := x.sessions[sessionID]
+	var filePath string
+	var err error
+	if exists {
+		if err = readOnly(sess); err == nil {
+			filePath, err = x.sessionFilePath(sess)
+		}
+	}
+	x.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	note := map[string]any{
+		"type":      NoteType,
+		"id":        fmt.Sprintf("note-%d", time.Now().UnixNano()),
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+		"role":      "note",
+		"content":   text,
+	}
+	if a := strings.TrimSpace(author); a != "" {
+		note["author"] = a
+	}
+	b, err := marshalLine(note)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filePath, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer f.Close()
+	// never glue the note onto an unterminated last line
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, fi.Size()-1); err == nil && last[0] != '\n' {
+			b = append([]byte("\n"), b...)
+		}
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to append note: %w", err)
+	}
+	return note, nil
+}
+
+// sessionFilePath returns the JSONL file backing a session, preferring the
+// recorded sources (which handle nested Codex rollout directories).
+func (x *Indexer) sessionFilePath(sess *Session) (string, error) {
+	if sess == nil {
+		return "", fmt.Errorf("session not found")
+	}
+	if len(sess.Sources) > 0 {
+		return x.sourcePath(&Message{Source: sess.Sources[0], Provider: sess.Provider}), nil
+	}
+	if sess.Provider == ProviderClaude {
+		parts := strings.SplitN(sess.ID, ":", 3)
+		if len(parts) < 3 {
+			return "", fmt.Errorf("invalid claude session ID format: %s", sess.ID)
+		}
+		return filepath.Join(x.claudeDir, parts[1], parts[2]+".jsonl"), nil
+	}
+	return x.codexSessionPath(sess, ".jsonl"), nil
+}
@@ -0,0 +1,141 @@
+package indexer
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FailedTag is added to the tags of sessions whose outcome looks failed; see
+// Session.FailureReasons.
+const FailedTag = "likely-failed"
+
+// Reasons a session is tagged FailedTag.
+const (
+	FailureApology     = "apology"     // the final reply apologizes or reports an error
+	FailureToolErrors  = "tool_errors" // at least FailedToolRatio of the tool outputs failed
+	FailureInterrupted = "interrupted" // the user interrupted the last turn and nothing followed
+)
+
+// FailedToolRatio is the share of failed tool outputs (non-zero exit code,
+// stderr, or an error result) above which a session counts as failed once
+// it has at least two outputs.
+var FailedToolRatio = 0.5
+
+var (
+	apologyPattern  = regexp.MustCompile(`(?i)\b(?:sorry|apologi[sz]e|unfortunately|i (?:was|am|'m) (?:unable|not able)|i (?:can't|cannot|couldn't|could not)|(?:still|keeps?) failing|failed to)\b`)
+	exitCodePattern = regexp.MustCompile(`(?m)^(?:Exit code|Process exited with code):? (-?\d+)`)
+)
+
+// outcomeState is the running evidence for FailureReasons, updated message
+// by message so appended lines do not need a rescan.
+type outcomeState struct {
+	apology     bool // of the latest reply
+	interrupted bool // no work since the latest interrupt
+	outputs     int
+	failed      int
+}
+
+// noteOutcome updates the session's outcome evidence with msg.
+func (s *Session) noteOutcome(msg *Message) {
+	o := &s.outcome
+	if isInterrupt(msg) {
+		o.interrupted = true
+		return
+	}
+	switch TurnKind(msg) {
+	case TurnPrompt, TurnToolCall:
+		o.interrupted = false
+	case TurnAnswer:
+		o.interrupted = false
+		o.apology = apologyPattern.MatchString(msg.Content)
+	case TurnToolOutput:
+		o.outputs++
+		if toolOutputFailed(msg) {
+			o.failed++
+		}
+	}
+}
+
+// reasons lists the failure signals that currently hold, in a fixed order.
+func (o outcomeState) reasons() []string {
+	var out []string
+	if o.apology {
+		out = append(out, FailureApology)
+	}
+	if o.outputs >= 2 && float64(o.failed) >= FailedToolRatio*float64(o.outputs) {
+		out = append(out, FailureToolErrors)
+	}
+	if o.interrupted {
+		out = append(out, FailureInterrupted)
+	}
+	return out
+}
+
+// applyOutcome fills FailureReasons and adds or removes FailedTag to match.
+func (s *Session) applyOutcome() {
+	s.FailureReasons = s.outcome.reasons()
+	tags := s.Tags[:0:0]
+	for _, t := range s.Tags {
+		if !strings.EqualFold(t, FailedTag) {
+			tags = append(tags, t)
+		}
+	}
+	if len(s.FailureReasons) > 0 {
+		tags = append(tags, FailedTag)
+	}
+	if len(tags) == 0 {
+		tags = nil
+	}
+	s.Tags = tags
+}
+
+// isInterrupt reports whether msg records the user stopping a turn: Codex's
+// turn_aborted event or Claude's "[Request interrupted by user]" marker.
+func isInterrupt(m *Message) bool {
+	if strings.EqualFold(m.Type, "turn_aborted") {
+		return true
+	}
+	return strings.EqualFold(m.Role, "user") && strings.HasPrefix(strings.TrimSpace(m.Content), "[Request interrupted by user")
+}
+
+// toolOutputFailed reports whether a tool output reports failure: a Claude
+// tool_result marked is_error or with stderr, or a Codex output with a
+// non-zero exit code.
+func toolOutputFailed(m *Message) bool {
+	if res, ok := m.Raw["toolUseResult"].(map[string]any); ok {
+		if strings.TrimSpace(stringOr(res["stderr"])) != "" {
+			return true
+		}
+	}
+	if mobj, ok := m.Raw["message"].(map[string]any); ok {
+		parts, _ := mobj["content"].([]any)
+		for _, p := range parts {
+			if part, ok := p.(map[string]any); ok && part["type"] == "tool_result" && part["is_error"] == true {
+				return true
+			}
+		}
+	}
+	data := m.Raw
+	if payload, ok := m.Raw["payload"].(map[string]any); ok {
+		data = payload
+	}
+	out := stringOr(data["output"])
+	if out == "" {
+		out = m.Content
+	}
+	var wrapped struct {
+		Metadata struct {
+			ExitCode *int `json:"exit_code"`
+		} `json:"metadata"`
+	}
+	if json.Unmarshal([]byte(out), &wrapped) == nil && wrapped.Metadata.ExitCode != nil {
+		return *wrapped.Metadata.ExitCode != 0
+	}
+	if sm := exitCodePattern.FindStringSubmatch(out); sm != nil {
+		code, _ := strconv.Atoi(sm[1])
+		return code != 0
+	}
+	return false
+}
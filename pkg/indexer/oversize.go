@@ -0,0 +1,85 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// OversizeLine is the line length above which the indexer does not keep the
+// whole decoded line in memory. Tool output can run to megabytes of JSON;
+// holding every such map for the life of the process is most of the heap on
+// busy machines. 0 disables slimming.
+var OversizeLine = 256 << 10
+
+// rawStringKeep is how much of a long string an oversized line keeps.
+const rawStringKeep = 16 << 10
+
+// slimRaw returns a copy of v with every string longer than rawStringKeep
+// cut to a valid UTF-8 prefix plus a marker giving the original length.
+// Structure, keys, and short values are kept, so type and field checks on
+// the slimmed map still work.
+func slimRaw(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, child := range t {
+			out[k] = slimRaw(child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, child := range t {
+			out[i] = slimRaw(child)
+		}
+		return out
+	case string:
+		if len(t) <= rawStringKeep {
+			return t
+		}
+		cut := rawStringKeep
+		for cut > 0 && !utf8.RuneStart(t[cut]) {
+			cut--
+		}
+		return t[:cut] + fmt.Sprintf("…[%d bytes truncated]", len(t)-cut)
+	}
+	return v
+}
+
+// FullRaw returns the complete decoded line of m. Messages ingested from
+// oversized lines keep only a slimmed Raw (see OversizeLine); for those the
+// line is read back from the session file.
+func (x *Indexer) FullRaw(m *Message) (map[string]any, error) {
+	if m == nil {
+		return nil, fmt.Errorf("no message")
+	}
+	if !m.RawTruncated {
+		return m.Raw, nil
+	}
+	filePath := x.sourcePath(m)
+	if filePath == "" {
+		return nil, fmt.Errorf("no source file for message: %s", m.ID)
+	}
+	var (
+		raw    map[string]any
+		found  bool
+		decErr error
+	)
+	err := forEachLine(filePath, func(lineNo int, line string) {
+		if lineNo != m.LineNo || found {
+			return
+		}
+		found = true
+		decErr = json.Unmarshal([]byte(line), &raw)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("line %d not found in %s", m.LineNo, filePath)
+	}
+	if decErr != nil {
+		return nil, fmt.Errorf("line %d is not valid JSON: %w", m.LineNo, decErr)
+	}
+	return raw, nil
+}
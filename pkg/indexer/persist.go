@@ -0,0 +1,126 @@
+package indexer
+
+import (
+	"os"
+	"sort"
+	"time"
+)
+
+// FileState is the tail state of one session file, for stores that persist
+// the index (see internal/store). Gen changes whenever the indexer rewrites
+// the file in place or forgets it, so a store knows its copy of the lines
+// is stale even when the offset did not move back.
+type FileState struct {
+	Path      string
+	Provider  string
+	Project   string
+	SessionID string // as discovered from the path
+	Source    string // Message.Source of its lines
+	Offset    int64
+	LineNo    int
+	Size      int64
+	ModAt     time.Time
+	Gen       uint64
+}
+
+// FileStates lists the tail state of every file read so far, by path.
+func (x *Indexer) FileStates() []FileState {
+	x.scanMu.Lock()
+	x.mu.RLock()
+	out := make([]FileState, 0, len(x.positions))
+	for path, off := range x.positions {
+		provider, project, sessionID, ok := x.fileIdentity(path)
+		if !ok {
+			continue
+		}
+		out = append(out, FileState{
+			Path: path, Provider: provider, Project: project, SessionID: sessionID,
+			Source: x.relSource(path, provider),
+			Offset: off, LineNo: x.lineNos[path], Gen: x.gens[path],
+		})
+	}
+	x.mu.RUnlock()
+	x.scanMu.Unlock()
+	for i := range out {
+		if fi, err := os.Stat(out[i].Path); err == nil {
+			out[i].Size = fi.Size()
+			out[i].ModAt = fi.ModTime().UTC()
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// Epoch changes on every Reindex; a store holding data from an older epoch
+// must start over.
+func (x *Indexer) Epoch() uint64 {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.epoch
+}
+
+// RestoreFile feeds lines saved by a store back through ingest and resumes
+// tailing the file after them, instead of reading it from the start. It
+// must be called before Run. It returns false, ingesting nothing, when the
+// file no longer matches st (gone, shrunk, or rewritten), or lines do not
+// account for st.LineNo; the file is then read normally.
+func (x *Indexer) RestoreFile(st FileState, lines []string) bool {
+	cp := fileCheckpoint{Offset: st.Offset, LineNo: st.LineNo, Size: st.Size, ModAt: st.ModAt}
+	if len(lines) != st.LineNo || !checkpointValid(st.Path, cp) {
+		return false
+	}
+	x.scanMu.Lock()
+	defer x.scanMu.Unlock()
+	x.streamMu.Lock()
+	defer x.streamMu.Unlock()
+	x.mu.RLock()
+	_, seen := x.positions[st.Path]
+	x.mu.RUnlock()
+	if seen {
+		return false
+	}
+	for _, line := range lines {
+		x.ingestLine(st.Provider, st.Project, st.SessionID, st.Path, line)
+	}
+	x.mu.Lock()
+	x.positions[st.Path] = st.Offset
+	x.lineNos[st.Path] = st.LineNo
+	x.restored = true
+	x.mu.Unlock()
+	return true
+}
+
+// FileMessages returns the messages ingested from path with a line number
+// above afterLine, in line order.
+func (x *Indexer) FileMessages(path string, afterLine int) []*Message {
+	provider, _, _, ok := x.fileIdentity(path)
+	if !ok {
+		return nil
+	}
+	source := x.relSource(path, provider)
+	x.mu.RLock()
+	var out []*Message
+	for id, s := range x.sessions {
+		if !contains(s.Sources, source) {
+			continue
+		}
+		for _, m := range x.messagesLocked(id) {
+			if m.Source == source && m.LineNo > afterLine {
+				out = append(out, m)
+			}
+		}
+	}
+	x.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].LineNo < out[j].LineNo })
+	return out
+}
+
+// rewroteLocked records that path changed underneath its tail state.
+// Callers hold x.mu for writing.
+func (x *Indexer) rewroteLocked(path string) {
+	if x.gens == nil {
+		x.gens = make(map[string]uint64)
+	}
+	x.gens[path]++
+	delete(x.sums, path)
+}
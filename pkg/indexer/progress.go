@@ -0,0 +1,86 @@
+package indexer
+
+import (
+	"os"
+	"time"
+)
+
+// IndexProgress reports how far the initial (or a forced full) scan has got.
+// Active is true while that scan runs; Ready becomes true once it finished and
+// stays true while the watcher only tails new lines.
+type IndexProgress struct {
+	Active     bool      `json:"active"`
+	Ready      bool      `json:"ready"`
+	FilesDone  int       `json:"files_done"`
+	FilesTotal int       `json:"files_total"`
+	BytesDone  int64     `json:"bytes_done"`
+	BytesTotal int64     `json:"bytes_total"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	ETASeconds int       `json:"eta_seconds,omitempty"`
+}
+
+// Ready reports whether the initial scan has completed.
+func (x *Indexer) Ready() bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.progress.Ready
+}
+
+// Progress returns a snapshot of the full-scan progress with a fresh ETA.
+func (x *Indexer) Progress() IndexProgress {
+	x.mu.RLock()
+	p := x.progress
+	x.mu.RUnlock()
+	if p.Active && p.BytesDone > 0 && p.BytesTotal > p.BytesDone {
+		elapsed := time.Since(p.StartedAt)
+		remaining := time.Duration(float64(elapsed) * float64(p.BytesTotal-p.BytesDone) / float64(p.BytesDone))
+		p.ETASeconds = int(remaining.Round(time.Second) / time.Second)
+	}
+	return p
+}
+
+// scanFile is one discovered session file queued for tailing.
+type scanFile struct {
+	provider, project, sessionID, path string
+	size                               int64
+}
+
+// beginFullScan records the files about to be read while not yet ready. Later
+// polls leave the progress untouched.
+func (x *Indexer) beginFullScan(files []scanFile) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.progress.Ready {
+		return false
+	}
+	x.progress = IndexProgress{Active: true, FilesTotal: len(files), StartedAt: time.Now()}
+	x.revision++
+	for _, f := range files {
+		x.progress.BytesTotal += f.size
+	}
+	return true
+}
+
+func (x *Indexer) advanceFullScan(size int64) {
+	x.mu.Lock()
+	x.progress.FilesDone++
+	x.progress.BytesDone += size
+	x.revision++
+	x.mu.Unlock()
+}
+
+func (x *Indexer) endFullScan() {
+	x.mu.Lock()
+	x.progress.Active = false
+	x.progress.Ready = true
+	x.progress.ETASeconds = 0
+	x.revision++
+	x.mu.Unlock()
+}
+
+func fileSize(path string) int64 {
+	if fi, err := os.Stat(path); err == nil {
+		return fi.Size()
+	}
+	return 0
+}
@@ -0,0 +1,256 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Provider reads one agent's session logs. For every root directory given
+// to the indexer for it, Discover lists the session files, SessionIDFor
+// names the session a file holds, and ParseLine turns each decoded JSONL
+// line into a Message; sessions, stats, and search are shared. Codex and
+// Claude are built in; RegisterProvider adds others (Cursor, opencode, ...)
+// and Indexer.AddRoots points them at their directories.
+type Provider interface {
+	// Name is the identifier stored as Message.Provider and Session.Provider.
+	Name() string
+	// Discover calls fn for every session file under root.
+	Discover(root string, fn func(path string))
+	// SessionIDFor returns the project (if the format has one) and session
+	// ID of the file at path under root; ok is false for files that are
+	// not session logs.
+	SessionIDFor(root, path string) (project, sessionID string, ok bool)
+	// ParseLine maps a decoded line of a file in project to a message. It
+	// sets msg.SessionID only when the line names its session itself; the
+	// file's session ID is used otherwise. title is a session title the
+	// line carries (a Claude summary), or "".
+	ParseLine(project string, raw map[string]any) (msg *Message, title string)
+}
+
+// sessionDirer is implemented by providers whose session files live in one
+// subdirectory of each root; watch mode and verify only look there.
+type sessionDirer interface {
+	SessionDir(root string) string
+}
+
+var (
+	providersMu   sync.RWMutex
+	providers     = make(map[string]Provider)
+	providerOrder []string
+)
+
+func init() {
+	RegisterProvider(codexProvider{})
+	RegisterProvider(claudeProvider{})
+	RegisterProvider(historyProvider{})
+}
+
+// RegisterProvider makes p available to every indexer. It panics if a
+// provider of that name is already registered, like database/sql drivers.
+func RegisterProvider(p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	name := p.Name()
+	if _, dup := providers[name]; dup || name == "" {
+		panic(fmt.Sprintf("indexer: RegisterProvider called twice or without a name for %q", name))
+	}
+	providers[name] = p
+	providerOrder = append(providerOrder, name)
+}
+
+// providerFor returns the named provider; lines of unknown providers are
+// read as Codex lines.
+func providerFor(name string) Provider {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	if p, ok := providers[name]; ok {
+		return p
+	}
+	return providers[ProviderCodex]
+}
+
+// AddRoots adds directories for a registered provider to read, in addition
+// to the Codex and Claude directories given to New. Call it before Run.
+func (x *Indexer) AddRoots(provider string, dirs ...string) error {
+	providersMu.RLock()
+	_, ok := providers[provider]
+	providersMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown provider: %s", provider)
+	}
+	x.scanMu.Lock()
+	defer x.scanMu.Unlock()
+	for _, d := range dirs {
+		if strings.TrimSpace(d) != "" && !contains(x.roots[provider], d) {
+			x.roots[provider] = append(x.roots[provider], d)
+		}
+	}
+	return nil
+}
+
+// providerRoots calls fn for every root in registration order.
+func (x *Indexer) providerRoots(fn func(p Provider, root string)) {
+	providersMu.RLock()
+	order := append([]string(nil), providerOrder...)
+	providersMu.RUnlock()
+	for _, name := range order {
+		p := providerFor(name)
+		for _, root := range x.roots[name] {
+			fn(p, root)
+		}
+	}
+}
+
+// sessionTree is the directory under root that holds p's session files.
+func sessionTree(p Provider, root string) string {
+	if d, ok := p.(sessionDirer); ok {
+		return d.SessionDir(root)
+	}
+	return root
+}
+
+// walkJSONL calls fn for every .jsonl file below dir, ignoring errors.
+func walkJSONL(dir string, fn func(path string)) {
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d == nil || d.IsDir() {
+			return nil // ignore errors per-file
+		}
+		if strings.HasSuffix(strings.ToLower(d.Name()), ".jsonl") {
+			fn(path)
+		}
+		return nil
+	})
+}
+
+// codexProvider reads <root>/sessions/**/*.jsonl, where each file is one
+// session and lines wrap the message in a payload object.
+type codexProvider struct{}
+
+func (codexProvider) Name() string { return ProviderCodex }
+
+func (codexProvider) SessionDir(root string) string { return filepath.Join(root, "sessions") }
+
+func (p codexProvider) Discover(root string, fn func(path string)) {
+	walkJSONL(p.SessionDir(root), fn)
+}
+
+func (p codexProvider) SessionIDFor(root, path string) (string, string, bool) {
+	name := filepath.Base(path)
+	if !strings.HasSuffix(strings.ToLower(name), ".jsonl") || !inDir(p.SessionDir(root), path) {
+		return "", "", false
+	}
+	return "", codexSessionID(name), true
+}
+
+func (codexProvider) ParseLine(_ string, raw map[string]any) (*Message, string) {
+	data := raw
+	payload, _ := raw["payload"].(map[string]any)
+	if payload != nil {
+		data = payload
+	}
+	msg := commonMessage(data)
+	// payload.id keeps IDs consistent with Codex's own session format; a
+	// top-level session_id is the fallback
+	if payload != nil {
+		msg.SessionID = stringOr(payload["id"])
+	}
+	if msg.SessionID == "" {
+		msg.SessionID = stringOr(raw["session_id"])
+	}
+	return msg, ""
+}
+
+// codexSessionID derives a Codex session ID from a file name: the UUID at
+// the end of rollout-YYYY-MM-DDTHH-mm-ss-<uuid>.jsonl, else the base name.
+func codexSessionID(name string) string {
+	id := strings.TrimSuffix(name, filepath.Ext(name))
+	if id == "" {
+		id = name
+	}
+	// The UUID is always the last 36 characters
+	if strings.HasPrefix(id, rolloutPrefix) && len(id) > uuidLen {
+		possibleUUID := id[len(id)-uuidLen:]
+		// Verify it looks like a UUID (8-4-4-4-12 format)
+		if len(possibleUUID) == uuidLen && strings.Count(possibleUUID, "-") == uuidDashCount {
+			id = possibleUUID
+		}
+	}
+	return id
+}
+
+// claudeProvider reads <root>/<project>/**/*.jsonl. Session IDs are
+// namespaced as claude:<project>:<sid> to avoid collisions with Codex.
+type claudeProvider struct{}
+
+func (claudeProvider) Name() string { return ProviderClaude }
+
+func (p claudeProvider) Discover(root string, fn func(path string)) {
+	entries, _ := os.ReadDir(root)
+	for _, ent := range entries {
+		if ent.IsDir() {
+			walkJSONL(filepath.Join(root, ent.Name()), fn)
+		}
+	}
+}
+
+func (claudeProvider) SessionIDFor(root, path string) (string, string, bool) {
+	name := filepath.Base(path)
+	if !strings.HasSuffix(strings.ToLower(name), ".jsonl") || !inDir(root, path) {
+		return "", "", false
+	}
+	rel, _ := filepath.Rel(root, path)
+	project, _, nested := strings.Cut(rel, string(filepath.Separator))
+	if !nested {
+		return "", "", false
+	}
+	sid := strings.TrimSuffix(name, filepath.Ext(name))
+	return project, ProviderClaude + ":" + project + ":" + sid, true
+}
+
+func (claudeProvider) ParseLine(project string, raw map[string]any) (*Message, string) {
+	msg := commonMessage(raw)
+	if msg.ID == "" {
+		msg.ID = stringOr(raw["uuid"])
+	}
+	// nested message fields
+	if mobj, ok := raw["message"].(map[string]any); ok && mobj != nil {
+		if msg.Role == "" {
+			msg.Role = stringOr(mobj["role"])
+		}
+		if msg.Model == "" {
+			msg.Model = stringOr(mobj["model"])
+		}
+		// Extract content text ("text" parts) and thinking ("thinking" parts)
+		textOut, thinkOut := extractClaudeSegments(mobj)
+		if strings.TrimSpace(textOut) != "" {
+			msg.Content = textOut
+		}
+		if strings.TrimSpace(thinkOut) != "" {
+			msg.Thinking = thinkOut
+		}
+	}
+	// prefer the nested sessionId when present
+	if sid := stringOr(raw["sessionId"]); sid != "" {
+		msg.SessionID = ProviderClaude + ":" + project + ":" + sid
+	}
+	title := ""
+	if strings.ToLower(msg.Type) == "summary" {
+		title = stringOr(raw["summary"])
+	}
+	return msg, title
+}
+
+// commonMessage maps the fields most formats share.
+func commonMessage(data map[string]any) *Message {
+	return &Message{
+		ID:       stringOr(data["id"]),
+		Role:     stringOr(data["role"]),
+		Content:  extractText(data),
+		Model:    stringOr(data["model"]),
+		Type:     stringOr(data["type"]),
+		ToolName: stringOr(data["tool_name"]),
+	}
+}
@@ -0,0 +1,49 @@
+package indexer
+
+import "time"
+
+// ProviderStats are the per-provider totals in Stats.ByProvider.
+type ProviderStats struct {
+	Sessions       int           `json:"sessions"`
+	Messages       int           `json:"messages"`
+	Tokens         int           `json:"tokens"` // estimated text tokens, see EstimateTokens
+	InputTokens    int           `json:"input_tokens"`
+	OutputTokens   int           `json:"output_tokens"`
+	Cost           float64       `json:"cost,omitempty"` // estimated USD, see Session.Cost
+	BadLines       int           `json:"bad_lines,omitempty"`
+	FirstAt        time.Time     `json:"first_at,omitempty"`
+	LastAt         time.Time     `json:"last_at,omitempty"`
+	ActiveDuration time.Duration `json:"active_duration,omitempty"`
+	IngestLag      *IngestLag    `json:"ingest_lag,omitempty"` // nil until new lines arrive after the initial scan
+}
+
+// AddProviderSession counts s into st.ByProvider under its provider and
+// adds its tokens and cost to the totals.
+func (st *Stats) AddProviderSession(s Session) {
+	if st.ByProvider == nil {
+		st.ByProvider = make(map[string]ProviderStats)
+	}
+	p := s.Provider
+	if p == "" {
+		p = ProviderCodex
+	}
+	st.InputTokens += s.InputTokens
+	st.OutputTokens += s.OutputTokens
+	st.Cost += s.Cost
+	st.UnpricedTokens += s.UnpricedTokens
+	ps := st.ByProvider[p]
+	ps.Sessions++
+	ps.Messages += s.MessageCount
+	ps.Tokens += s.InputTokens + s.OutputTokens
+	ps.InputTokens += s.InputTokens
+	ps.OutputTokens += s.OutputTokens
+	ps.Cost += s.Cost
+	ps.ActiveDuration += s.ActiveDuration
+	if !s.FirstAt.IsZero() && (ps.FirstAt.IsZero() || s.FirstAt.Before(ps.FirstAt)) {
+		ps.FirstAt = s.FirstAt
+	}
+	if s.LastAt.After(ps.LastAt) {
+		ps.LastAt = s.LastAt
+	}
+	st.ByProvider[p] = ps
+}
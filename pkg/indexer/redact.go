@@ -0,0 +1,175 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RedactedMarker replaces scrubbed text in redacted messages.
+const RedactedMarker = "[redacted]"
+
+// redactKeys lists JSON keys whose string values carry free-form text that may
+// contain pasted secrets. Structural keys (id, type, role, call_id, ...) are kept.
+var redactKeys = map[string]bool{
+	"content":   true,
+	"text":      true,
+	"thinking":  true,
+	"message":   true,
+	"summary":   true,
+	"title":     true,
+	"output":    true,
+	"arguments": true,
+	"input":     true,
+}
+
+// RedactMessage replaces the text of a single message with RedactedMarker both in
+// memory and in the backing JSONL line, preserving the JSON structure of the line.
+// The file is rewritten atomically (temp file + rename) like DeleteMessage.
+func (x *Indexer) RedactMessage(sessionID, messageID string) error {
+	// a scan tailing the file in between would overwrite the shifted offset
+	x.scanMu.Lock()
+	defer x.scanMu.Unlock()
+	x.streamMu.Lock()
+	defer x.streamMu.Unlock()
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	sess, exists := x.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	if err := readOnly(sess); err != nil {
+		return err
+	}
+
+	x.thawLocked(sessionID)
+	var msg *Message
+	for _, m := range x.messages[sessionID] {
+		if m.ID == messageID {
+			msg = m
+			break
+		}
+	}
+	if msg == nil {
+		return fmt.Errorf("message not found: %s", messageID)
+	}
+
+	filePath := x.sourcePath(msg)
+	if filePath == "" {
+		return fmt.Errorf("no source file for message: %s", messageID)
+	}
+
+	var (
+		redactedRaw map[string]any
+		sizeDelta   int64
+		found       bool
+		lineErr     error
+	)
+	err := rewriteFileLines(filePath, func(lineNo int, line string) (string, bool) {
+		if lineNo != msg.LineNo {
+			return line, true
+		}
+		found = true
+		raw, err := decodeLine(line)
+		if err != nil {
+			lineErr = fmt.Errorf("line %d is not valid JSON: %w", lineNo, err)
+			return line, true
+		}
+		// refuse to touch a line that does not belong to the message
+		if id := lineMessageID(raw, msg.Provider); id != "" && id != messageID {
+			lineErr = fmt.Errorf("line %d belongs to message %s, not %s", lineNo, id, messageID)
+			return line, true
+		}
+		redactValue(raw, false)
+		b, err := marshalLine(raw)
+		if err != nil {
+			lineErr = err
+			return line, true
+		}
+		redactedRaw = raw
+		sizeDelta = int64(len(b)) - int64(len(line))
+		return string(b), true
+	})
+	if err != nil {
+		return err
+	}
+	if lineErr != nil {
+		return lineErr
+	}
+	if !found {
+		return fmt.Errorf("line %d not found in %s", msg.LineNo, filePath)
+	}
+
+	// Update memory; the title may have been derived from the secret text
+	oldContent := msg.Content
+	if strings.TrimSpace(msg.Content) != "" {
+		msg.Content = RedactedMarker
+	}
+	if strings.TrimSpace(msg.Thinking) != "" {
+		msg.Thinking = RedactedMarker
+	}
+	msg.Raw = redactedRaw
+	if oldContent != "" && strings.TrimSpace(sess.Title) == trimTitle(oldContent) {
+		sess.Title = trimTitle(fallbackTitleFromSession(sess))
+		sess.hasSummary = false
+	}
+
+	// The line was already ingested, so shift the tail offset by the size change
+	x.shiftTailLocked(filePath, sizeDelta, 0)
+	x.rewroteLocked(filePath)
+	return nil
+}
+
+// redactValue replaces string values under redactKeys with RedactedMarker,
+// recursing through nested objects and arrays.
+func redactValue(v any, inText bool) any {
+	switch t := v.(type) {
+	case string:
+		if inText && strings.TrimSpace(t) != "" {
+			return RedactedMarker
+		}
+		return t
+	case map[string]any:
+		for k, el := range t {
+			t[k] = redactValue(el, redactKeys[k])
+		}
+		return t
+	case []any:
+		for i, el := range t {
+			t[i] = redactValue(el, inText)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// decodeLine parses a JSONL line keeping numbers intact (json.Number).
+func decodeLine(line string) (map[string]any, error) {
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// marshalLine encodes raw as a single JSONL line without HTML escaping.
+func marshalLine(raw map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(raw); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// lineMessageID is the ID ingestLine gives a line.
+func lineMessageID(raw map[string]any, provider string) string {
+	msg, _ := providerFor(provider).ParseLine("", raw)
+	return msg.ID
+}
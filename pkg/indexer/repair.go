@@ -0,0 +1,125 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// RepairResult describes what RepairFile did to one JSONL file.
+type RepairResult struct {
+	Path    string `json:"path"`
+	Kept    int    `json:"kept"`
+	Removed int    `json:"removed"`
+	Sidecar string `json:"sidecar,omitempty"` // <path>.bad when lines were quarantined
+}
+
+// RepairFile rewrites a JSONL file without its unparseable lines. Unless drop is
+// set, removed lines are appended to a "<path>.bad" sidecar so nothing is lost.
+// Files without bad lines are left untouched.
+func RepairFile(path string, drop bool) (RepairResult, error) {
+	res := RepairResult{Path: path}
+	var bad []string
+	if err := forEachLine(path, func(lineNo int, line string) {
+		if lineNo == 0 {
+			return
+		}
+		if json.Valid([]byte(strings.TrimSpace(line))) {
+			res.Kept++
+			return
+		}
+		bad = append(bad, line)
+	}); err != nil {
+		return res, err
+	}
+	if len(bad) == 0 {
+		return res, nil
+	}
+
+	// Quarantine first so a failed rewrite never loses the bad lines.
+	if !drop {
+		res.Sidecar = path + ".bad"
+		f, err := os.OpenFile(res.Sidecar, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return res, fmt.Errorf("failed to open %s: %w", res.Sidecar, err)
+		}
+		for _, line := range bad {
+			if _, err := f.WriteString(line + "\n"); err != nil {
+				f.Close()
+				return res, fmt.Errorf("failed to write %s: %w", res.Sidecar, err)
+			}
+		}
+		if err := f.Close(); err != nil {
+			return res, fmt.Errorf("failed to write %s: %w", res.Sidecar, err)
+		}
+	}
+	if err := rewriteFileLines(path, func(lineNo int, line string) (string, bool) {
+		return line, json.Valid([]byte(strings.TrimSpace(line)))
+	}); err != nil {
+		return res, err
+	}
+	res.Removed = len(bad)
+	return res, nil
+}
+
+// RepairSession runs RepairFile over every file backing a session and reindexes
+// when anything changed, so BadLines reflects the repaired files.
+func (x *Indexer) RepairSession(sessionID string, drop bool) ([]RepairResult, error) {
+	x.scanMu.Lock()
+	x.streamMu.Lock()
+	x.mu.RLock()
+	sess, exists := x.sessions[sessionID]
+	if !exists {
+		x.mu.RUnlock()
+		x.streamMu.Unlock()
+		x.scanMu.Unlock()
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+	if err := readOnly(sess); err != nil {
+		x.mu.RUnlock()
+		x.streamMu.Unlock()
+		x.scanMu.Unlock()
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	var paths []string
+	for _, src := range sess.Sources {
+		p := x.sourcePath(&Message{Source: src, Provider: sess.Provider})
+		if _, ok := seen[p]; !ok {
+			seen[p] = struct{}{}
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		if p, err := x.sessionFilePath(sess); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	x.mu.RUnlock()
+	sort.Strings(paths)
+
+	results := make([]RepairResult, 0, len(paths))
+	changed := false
+	var firstErr error
+	for _, p := range paths {
+		res, err := RepairFile(p, drop)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if res.Removed > 0 {
+			changed = true
+		}
+		results = append(results, res)
+	}
+	x.streamMu.Unlock()
+	x.scanMu.Unlock()
+
+	if changed {
+		if err := x.Reindex(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return results, firstErr
+}
@@ -0,0 +1,133 @@
+package indexer
+
+import "os"
+
+// resetIfReplaced drops everything read from path when the file shrank below
+// its tail offset (truncated) or now has another inode (rotated, or replaced
+// by a rename), so the caller reads it again from the start instead of
+// seeking past the end and missing the new content. Sessions fed by the file
+// are forgotten whole, together with the tail state of their other files.
+// Callers hold scanMu and streamMu.
+func (x *Indexer) resetIfReplaced(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	ino := fileInode(fi)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	pos, seen := x.positions[path]
+	old := x.inodes[path]
+	if x.inodes == nil {
+		x.inodes = make(map[string]uint64)
+	}
+	x.inodes[path] = ino
+	if !seen || pos == 0 {
+		return false
+	}
+	if fi.Size() >= pos && (old == 0 || ino == 0 || ino == old) {
+		return false
+	}
+	x.forgetFileLocked(path)
+	x.stats.FileResets++
+	return true
+}
+
+// forgetFileLocked drops the sessions whose messages came from path and the
+// tail state of every file feeding them. Callers hold x.mu for writing.
+func (x *Indexer) forgetFileLocked(path string) {
+	provider, _, _, ok := x.fileIdentity(path)
+	if !ok {
+		return
+	}
+	source := x.relSource(path, provider)
+	sources := map[string]bool{source: true}
+	var ids []string
+	for id, s := range x.sessions {
+		if contains(s.Sources, source) {
+			ids = append(ids, id)
+			for _, src := range s.Sources {
+				sources[src] = true
+			}
+		}
+	}
+	for _, id := range ids {
+		x.forgetSessionLocked(id, path)
+	}
+	// a session also fed by other files is only whole again once they are
+	// read from the start too
+	for p := range x.positions {
+		if p == path {
+			continue
+		}
+		if prov, _, _, ok := x.fileIdentity(p); ok && sources[x.relSource(p, prov)] {
+			x.rewroteLocked(p)
+			x.dropFileCountsLocked(p)
+			delete(x.positions, p)
+			delete(x.lineNos, p)
+			delete(x.fileTs, p)
+			delete(x.untimed, p)
+		}
+	}
+	x.rewroteLocked(path)
+	x.dropFileCountsLocked(path)
+	delete(x.positions, path)
+	delete(x.lineNos, path)
+	delete(x.sizes, path)
+	delete(x.fileTs, path)
+	delete(x.untimed, path)
+	x.revision++
+}
+
+// fileCounts are the Stats counters a file's lines added that its sessions
+// do not record: bad lines and top-level JSON keys.
+type fileCounts struct {
+	provider string
+	badLines int
+	fields   map[string]int
+}
+
+// fileCountsLocked returns path's counters, creating them. Callers hold x.mu
+// for writing.
+func (x *Indexer) fileCountsLocked(path, provider string) *fileCounts {
+	fc := x.counts[path]
+	if fc == nil {
+		if x.counts == nil {
+			x.counts = make(map[string]*fileCounts)
+		}
+		fc = &fileCounts{provider: provider, fields: make(map[string]int)}
+		x.counts[path] = fc
+	}
+	return fc
+}
+
+// dropFileCountsLocked takes path's counters off the totals before the file
+// is read again from the start or goes away. Callers hold x.mu for writing.
+func (x *Indexer) dropFileCountsLocked(path string) {
+	fc := x.counts[path]
+	if fc == nil {
+		return
+	}
+	delete(x.counts, path)
+	x.stats.BadLines -= fc.badLines
+	subtractCounts(x.stats.badLinesByProvider, map[string]int{fc.provider: fc.badLines})
+	subtractCounts(x.stats.Fields, fc.fields)
+}
+
+// shiftTailLocked moves path's tail offset and line count by the bytes and
+// lines an in-place rewrite added (or, if negative, removed) before it, and
+// adopts the rewritten file's inode so the next scan does not take the
+// rename for a replaced file. Callers hold scanMu, streamMu and x.mu.
+func (x *Indexer) shiftTailLocked(path string, bytes int64, lines int) {
+	if pos, ok := x.positions[path]; ok && pos > 0 {
+		x.positions[path] = max(pos+bytes, 0)
+		x.lineNos[path] = max(x.lineNos[path]+lines, 0)
+	}
+	if fi, err := os.Stat(path); err == nil {
+		if x.inodes == nil {
+			x.inodes = make(map[string]uint64)
+		}
+		x.inodes[path] = fileInode(fi)
+		x.noteSizeLocked(path, fi.Size())
+	}
+}
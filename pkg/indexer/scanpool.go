@@ -0,0 +1,67 @@
+package indexer
+
+import "sync"
+
+// ScanWorkers bounds how many files a scan tails at once. Files of the same
+// session go to one worker in discovery order, so a session's messages keep
+// their file order; 1 scans sequentially.
+//
+// Deprecated: set Options.ScanWorkers; this is only its default.
+var ScanWorkers = 4
+
+// scanLanes groups files by session, keeping their order, with lanes in the
+// order their first file was found.
+func scanLanes(queue []scanFile) [][]scanFile {
+	index := make(map[string]int)
+	var lanes [][]scanFile
+	for _, f := range queue {
+		key := f.provider + "\x00" + f.sessionID
+		i, ok := index[key]
+		if !ok {
+			i = len(lanes)
+			index[key] = i
+			lanes = append(lanes, nil)
+		}
+		lanes[i] = append(lanes[i], f)
+	}
+	return lanes
+}
+
+// tailQueue tails the scan queue on at most Options.ScanWorkers goroutines, one
+// session lane per worker at a time. Callers hold scanMu and streamMu.
+func (x *Indexer) tailQueue(queue []scanFile, full bool) {
+	lanes := scanLanes(queue)
+	next := make(chan []scanFile)
+	var wg sync.WaitGroup
+	for n := min(max(x.opts.ScanWorkers, 1), len(lanes)); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for lane := range next {
+				for _, f := range lane {
+					x.scanOne(f, full)
+				}
+			}
+		}()
+	}
+	for _, lane := range lanes {
+		next <- lane
+	}
+	close(next)
+	wg.Wait()
+}
+
+// scanOne tails one file of a scan, or hands it to the ingest workers.
+func (x *Indexer) scanOne(f scanFile, full bool) {
+	if x.queueLargeFile(f) {
+		return
+	}
+	if err := x.tailFile(f.provider, f.project, f.sessionID, f.path); err != nil {
+		x.mu.Lock()
+		x.stats.ScanErrors++
+		x.mu.Unlock()
+	}
+	if full {
+		x.advanceFullScan(f.size)
+	}
+}
@@ -0,0 +1,141 @@
+package indexer
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SecretPattern is one rule of the redaction regex set used to spot credentials.
+type SecretPattern struct {
+	Kind string
+	Re   *regexp.Regexp
+}
+
+// SecretPatterns is the redaction regex set. Patterns aim for high precision;
+// generic key=value rules require a reasonably long value.
+var SecretPatterns = []SecretPattern{
+	{Kind: "private_key", Re: regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP )?PRIVATE KEY(?: BLOCK)?-----`)},
+	{Kind: "aws_access_key", Re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Kind: "github_token", Re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{Kind: "anthropic_key", Re: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_\-]{20,}`)},
+	{Kind: "openai_key", Re: regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_\-]{20,}`)},
+	{Kind: "slack_token", Re: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{Kind: "google_api_key", Re: regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{Kind: "jwt", Re: regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{10,}\.eyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}`)},
+	{Kind: "generic_secret", Re: regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret|token|passw(?:or)?d)["']?\s*[:=]\s*["']?[A-Za-z0-9_\-/+.]{16,}`)},
+}
+
+// SecretMatch is a single credential-like hit inside a text.
+type SecretMatch struct {
+	Kind    string `json:"kind"`
+	Preview string `json:"preview"` // masked; never contains the full value
+}
+
+// SecretFinding reports a message that contains likely credentials.
+type SecretFinding struct {
+	SessionID    string        `json:"session_id"`
+	SessionTitle string        `json:"session_title,omitempty"`
+	MessageID    string        `json:"message_id,omitempty"`
+	Source       string        `json:"source,omitempty"`
+	LineNo       int           `json:"line_no,omitempty"`
+	Matches      []SecretMatch `json:"matches"`
+}
+
+// FindSecrets runs the redaction regex set over s. Kinds are reported once per text.
+func FindSecrets(s string) []SecretMatch {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var out []SecretMatch
+	seen := make(map[string]bool)
+	for _, p := range SecretPatterns {
+		loc := p.Re.FindStringIndex(s)
+		if loc == nil {
+			continue
+		}
+		// anthropic keys also look like openai keys; report the more specific one
+		if p.Kind == "openai_key" && seen["anthropic_key"] {
+			continue
+		}
+		seen[p.Kind] = true
+		out = append(out, SecretMatch{Kind: p.Kind, Preview: maskSecret(s[loc[0]:loc[1]])})
+	}
+	return out
+}
+
+// ScanSecrets checks every indexed message (text, thinking, and raw tool
+// arguments/outputs) for likely credentials. The index lock is only held per
+// session snapshot, so this is safe to run in the background.
+func (x *Indexer) ScanSecrets() []SecretFinding {
+	var findings []SecretFinding
+	for _, s := range x.Sessions() {
+		for _, m := range x.PeekMessages(s.ID) {
+			matches := messageSecrets(m)
+			if len(matches) == 0 {
+				continue
+			}
+			findings = append(findings, SecretFinding{
+				SessionID:    s.ID,
+				SessionTitle: s.Title,
+				MessageID:    m.ID,
+				Source:       m.Source,
+				LineNo:       m.LineNo,
+				Matches:      matches,
+			})
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].SessionID != findings[j].SessionID {
+			return findings[i].SessionID < findings[j].SessionID
+		}
+		return findings[i].LineNo < findings[j].LineNo
+	})
+	return findings
+}
+
+func messageSecrets(m *Message) []SecretMatch {
+	if m == nil {
+		return nil
+	}
+	texts := []string{m.Content, m.Thinking}
+	collectTextValues(m.Raw, false, &texts)
+	var out []SecretMatch
+	seen := make(map[string]bool)
+	for _, t := range texts {
+		for _, sm := range FindSecrets(t) {
+			if seen[sm.Kind] {
+				continue
+			}
+			seen[sm.Kind] = true
+			out = append(out, sm)
+		}
+	}
+	return out
+}
+
+// collectTextValues gathers the string values that RedactMessage would scrub.
+func collectTextValues(v any, inText bool, out *[]string) {
+	switch t := v.(type) {
+	case string:
+		if inText {
+			*out = append(*out, t)
+		}
+	case map[string]any:
+		for k, el := range t {
+			collectTextValues(el, redactKeys[k], out)
+		}
+	case []any:
+		for _, el := range t {
+			collectTextValues(el, inText, out)
+		}
+	}
+}
+
+func maskSecret(s string) string {
+	r := []rune(s)
+	if len(r) <= 8 {
+		return strings.Repeat("*", len(r))
+	}
+	return string(r[:4]) + strings.Repeat("*", 6) + string(r[len(r)-2:])
+}
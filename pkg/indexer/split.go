@@ -0,0 +1,226 @@
+package indexer
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SplitSession moves the messages from atMessageID onwards into a new JSONL file
+// next to the original and truncates the original before that message. Session
+// id fields inside moved lines are rewritten so they index under the new session.
+// Both files are re-ingested before returning; the new session ID is returned.
+func (x *Indexer) SplitSession(sessionID, atMessageID string) (string, error) {
+	x.scanMu.Lock()
+	defer x.scanMu.Unlock()
+	x.streamMu.Lock()
+	defer x.streamMu.Unlock()
+
+	x.mu.Lock()
+	sess, exists := x.sessions[sessionID]
+	if !exists {
+		x.mu.Unlock()
+		return "", fmt.Errorf("session not found: %s", sessionID)
+	}
+	if err := readOnly(sess); err != nil {
+		x.mu.Unlock()
+		return "", err
+	}
+	if len(sess.Sources) > 1 {
+		x.mu.Unlock()
+		return "", fmt.Errorf("session spans %d files; split is only supported for single-file sessions", len(sess.Sources))
+	}
+	x.thawLocked(sessionID)
+	msgs := x.messages[sessionID]
+	var at *Message
+	for i, m := range msgs {
+		if m.ID == atMessageID {
+			if i == 0 {
+				x.mu.Unlock()
+				return "", fmt.Errorf("cannot split at the first message")
+			}
+			at = m
+			break
+		}
+	}
+	if at == nil {
+		x.mu.Unlock()
+		return "", fmt.Errorf("message not found: %s", atMessageID)
+	}
+	filePath, err := x.sessionFilePath(sess)
+	if err != nil {
+		x.mu.Unlock()
+		return "", err
+	}
+	provider, project := sess.Provider, sess.Project
+
+	newUUID, err := newUUIDv4()
+	if err != nil {
+		x.mu.Unlock()
+		return "", err
+	}
+	var newPath, newSessionID string
+	dir := filepath.Dir(filePath)
+	base := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	switch {
+	case provider == ProviderClaude:
+		newPath = filepath.Join(dir, newUUID+".jsonl")
+		newSessionID = ProviderClaude + ":" + project + ":" + newUUID
+	case strings.HasPrefix(base, rolloutPrefix):
+		ts := at.Ts
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		newPath = filepath.Join(dir, rolloutPrefix+ts.Local().Format("2006-01-02T15-04-05")+"-"+newUUID+".jsonl")
+		newSessionID = newUUID
+	default:
+		newPath = filepath.Join(dir, newUUID+".jsonl")
+		newSessionID = newUUID
+	}
+
+	// Collect the tail (plus a copy of the Codex session_meta header) for the
+	// new file, and write it before touching the original.
+	var tail []string
+	err = forEachLine(filePath, func(lineNo int, line string) {
+		switch {
+		case lineNo >= at.LineNo:
+			tail = append(tail, retagSessionLine(line, provider, newUUID))
+		case lineNo == 1 && provider == ProviderCodex && strings.Contains(line, `"session_meta"`):
+			if raw, err := decodeLine(line); err == nil && stringOr(raw["type"]) == "session_meta" {
+				if p, ok := raw["payload"].(map[string]any); ok && p != nil {
+					p["id"] = newUUID
+				}
+				if b, err := marshalLine(raw); err == nil {
+					tail = append(tail, string(b))
+				}
+			}
+		}
+	})
+	if err != nil {
+		x.mu.Unlock()
+		return "", err
+	}
+	if err := writeLines(newPath, tail); err != nil {
+		x.mu.Unlock()
+		return "", err
+	}
+	if err := rewriteFileLines(filePath, func(lineNo int, line string) (string, bool) {
+		return line, lineNo < at.LineNo
+	}); err != nil {
+		os.Remove(newPath)
+		x.mu.Unlock()
+		return "", err
+	}
+
+	// Forget the original so both files are re-read from the start
+	x.forgetSessionLocked(sessionID, filePath)
+	x.mu.Unlock()
+
+	if err := x.tailFile(provider, project, sessionID, filePath); err != nil {
+		return newSessionID, err
+	}
+	if err := x.tailFile(provider, project, newSessionID, newPath); err != nil {
+		return newSessionID, err
+	}
+	return newSessionID, nil
+}
+
+// retagSessionLine points a moved line at the new session: Claude lines carry
+// sessionId, legacy Codex lines may carry session_id. Other lines stay verbatim.
+func retagSessionLine(line, provider, newUUID string) string {
+	key := "session_id"
+	if provider == ProviderClaude {
+		key = "sessionId"
+	}
+	if !strings.Contains(line, `"`+key+`"`) {
+		return line
+	}
+	raw, err := decodeLine(line)
+	if err != nil {
+		return line
+	}
+	if _, ok := raw[key]; !ok {
+		return line
+	}
+	raw[key] = newUUID
+	b, err := marshalLine(raw)
+	if err != nil {
+		return line
+	}
+	return string(b)
+}
+
+// forgetSessionLocked drops a session and the tail state of its file, and
+// takes its messages off the index-wide counters so re-reading the file
+// does not count them twice. Callers hold x.mu.
+func (x *Indexer) forgetSessionLocked(sessionID, filePath string) {
+	x.thawLocked(sessionID)
+	x.stats.TotalMessages -= len(x.messages[sessionID])
+	if s := x.sessions[sessionID]; s != nil {
+		// the session's own counts were added in step with the totals in
+		// ingestLine, so they are exactly what its messages contributed
+		subtractCounts(x.stats.ByModel, s.Models)
+		subtractCounts(x.stats.ByRole, s.Roles)
+		subtractCounts(x.stats.ByTool, s.ToolCounts)
+		subtractCounts(x.stats.ByLanguage, s.Languages)
+		subtractCounts(x.stats.ByMCPTool, s.MCPTools)
+		for call, n := range s.MCPTools {
+			server, _, _ := strings.Cut(call, "/")
+			subtractCounts(x.stats.ByMCPServer, map[string]int{server: n})
+		}
+	}
+	delete(x.sessions, sessionID)
+	delete(x.messages, sessionID)
+	delete(x.touched, sessionID)
+	x.rewroteLocked(filePath)
+	x.dropFileCountsLocked(filePath)
+	delete(x.positions, filePath)
+	delete(x.lineNos, filePath)
+	x.stats.TotalSessions = len(x.sessions)
+	x.revision++
+}
+
+// subtractCounts takes part off total, dropping keys that reach zero.
+func subtractCounts(total, part map[string]int) {
+	for k, n := range part {
+		if left := total[k] - n; left > 0 {
+			total[k] = left
+		} else {
+			delete(total, k)
+		}
+	}
+}
+
+// writeLines creates path exclusively and writes lines to it.
+func writeLines(path string, lines []string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		if _, err := w.WriteString(line + "\n"); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to flush %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+func newUUIDv4() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,140 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// watchStateVersion is bumped whenever the state layout or the meaning of its
+// offsets changes; files written with another version are ignored.
+const watchStateVersion = 1
+
+// stateSaveInterval is how often Run checkpoints tail state to disk.
+const stateSaveInterval = 30 * time.Second
+
+// fileCheckpoint is the persisted tail state for one JSONL file. Inode, Size,
+// and ModAt record the file as it was when Offset was taken, so a restore can
+// tell when the file was truncated or replaced underneath the checkpoint.
+type fileCheckpoint struct {
+	Offset int64     `json:"offset"`
+	LineNo int       `json:"line_no"`
+	Inode  uint64    `json:"inode,omitempty"` // 0 when unknown (non-Unix, older state files)
+	Size   int64     `json:"size"`
+	ModAt  time.Time `json:"mod_at"`
+}
+
+// watchState is the on-disk layout of the state file.
+type watchState struct {
+	Version int                       `json:"version"`
+	SavedAt time.Time                 `json:"saved_at"`
+	Files   map[string]fileCheckpoint `json:"files"`
+}
+
+// SetStatePath enables periodic checkpointing of per-file offsets to path.
+// When resume is true, Run restores those offsets before the first scan so
+// already-read lines are not ingested again. The in-memory index has no copy
+// of the skipped lines, so Run only resumes once a store has restored the
+// index with RestoreFile; without one every file is read from the start.
+func (x *Indexer) SetStatePath(path string, resume bool) {
+	x.statePath = path
+	x.resumeState = resume
+}
+
+// SaveState writes the current per-file offsets to the state file atomically.
+func (x *Indexer) SaveState() error {
+	if x.statePath == "" {
+		return nil
+	}
+	x.scanMu.Lock()
+	st := watchState{Version: watchStateVersion, SavedAt: time.Now().UTC(), Files: make(map[string]fileCheckpoint)}
+	x.mu.RLock()
+	for path, off := range x.positions {
+		cp := fileCheckpoint{Offset: off, LineNo: x.lineNos[path]}
+		if fi, err := os.Stat(path); err == nil {
+			cp.Inode = fileInode(fi)
+			cp.Size = fi.Size()
+			cp.ModAt = fi.ModTime().UTC()
+		}
+		st.Files[path] = cp
+	}
+	x.mu.RUnlock()
+	x.scanMu.Unlock()
+
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := x.statePath + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, x.statePath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
+
+// restoreState loads checkpoints from the state file into the tail state and
+// returns how many files were restored. Entries whose file is gone, was
+// replaced by another file (new inode, as after log rotation), has shrunk
+// below the checkpoint, or was rewritten in place (same size, newer mtime)
+// are dropped so those files are re-read from the start.
+func (x *Indexer) restoreState() (int, error) {
+	if x.statePath == "" {
+		return 0, nil
+	}
+	b, err := os.ReadFile(x.statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var st watchState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return 0, fmt.Errorf("invalid state file %s: %w", x.statePath, err)
+	}
+	if st.Version != watchStateVersion {
+		return 0, nil
+	}
+
+	x.scanMu.Lock()
+	defer x.scanMu.Unlock()
+	x.streamMu.Lock()
+	defer x.streamMu.Unlock()
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	n := 0
+	for path, cp := range st.Files {
+		if _, ok := x.positions[path]; ok {
+			continue // a store restored it with its own lines
+		}
+		if !checkpointValid(path, cp) {
+			continue
+		}
+		x.positions[path] = cp.Offset
+		x.lineNos[path] = cp.LineNo
+		n++
+	}
+	return n, nil
+}
+
+func checkpointValid(path string, cp fileCheckpoint) bool {
+	fi, err := os.Stat(path)
+	if err != nil || cp.Offset <= 0 {
+		return false
+	}
+	if cp.Inode != 0 && fileInode(fi) != cp.Inode {
+		return false
+	}
+	if fi.Size() < cp.Offset || fi.Size() < cp.Size {
+		return false
+	}
+	if fi.Size() == cp.Size && !cp.ModAt.IsZero() && fi.ModTime().After(cp.ModAt) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package indexer
+
+import "time"
+
+// Lines without a timestamp (or with one that does not parse) get an
+// estimate, marked TsEstimated, so they sort and bucket with their
+// neighbours: the timestamp of the line before them in the same file, else
+// that of the first timestamped line after them read in the same pass, else
+// the file's mod time. Estimates do not feed the message's stable ID.
+
+// estimateTsLocked records a timestamped message as its file's latest, or
+// estimates the timestamp of one without. Callers hold x.mu for writing.
+func (x *Indexer) estimateTsLocked(path string, msg *Message) {
+	if !msg.Ts.IsZero() {
+		if x.fileTs == nil {
+			x.fileTs = make(map[string]time.Time)
+		}
+		x.fileTs[path] = msg.Ts
+		for _, m := range x.untimed[path] {
+			m.Ts, m.TsEstimated = msg.Ts, true
+			x.noteSessionTsLocked(m.SessionID, msg.Ts)
+		}
+		delete(x.untimed, path)
+		return
+	}
+	if ts, ok := x.fileTs[path]; ok {
+		msg.Ts, msg.TsEstimated = ts, true
+		return
+	}
+	if x.untimed == nil {
+		x.untimed = make(map[string][]*Message)
+	}
+	x.untimed[path] = append(x.untimed[path], msg)
+}
+
+// settleTsLocked gives the messages of path still without a timestamp at
+// the end of a read the file's mod time. Callers hold x.mu for writing.
+func (x *Indexer) settleTsLocked(path string, modTime time.Time) {
+	for _, m := range x.untimed[path] {
+		m.Ts, m.TsEstimated = modTime, true
+		x.noteSessionTsLocked(m.SessionID, modTime)
+	}
+	delete(x.untimed, path)
+}
+
+// noteSessionTsLocked widens a session's first/last activity to ts.
+func (x *Indexer) noteSessionTsLocked(sessionID string, ts time.Time) {
+	s := x.sessions[sessionID]
+	if s == nil {
+		return
+	}
+	if s.FirstAt.IsZero() || ts.Before(s.FirstAt) {
+		s.FirstAt = ts
+	}
+	if ts.After(s.LastAt) {
+		s.LastAt = ts
+	}
+}
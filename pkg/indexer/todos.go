@@ -0,0 +1,150 @@
+package indexer
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Todo is one item of an agent's plan: a Claude TodoWrite entry or a Codex
+// update_plan step.
+type Todo struct {
+	Text   string    `json:"text"`
+	Status string    `json:"status"` // pending|in_progress|completed
+	Ts     time.Time `json:"ts,omitempty"`
+}
+
+// Open reports whether the item is still to do.
+func (t Todo) Open() bool { return t.Status != "completed" }
+
+// planTodos returns the items of a plan-writing tool call in m, and false
+// when m is not one. Both tools send the whole list each time.
+func planTodos(m *Message) ([]Todo, bool) {
+	if m == nil {
+		return nil, false
+	}
+	if strings.EqualFold(m.Type, "function_call") {
+		data := MessageData(m)
+		if name, _ := data["name"].(string); name != "update_plan" {
+			return nil, false
+		}
+		var args struct {
+			Plan []struct {
+				Step   string `json:"step"`
+				Status string `json:"status"`
+			} `json:"plan"`
+		}
+		s, _ := data["arguments"].(string)
+		if json.Unmarshal([]byte(s), &args) != nil {
+			return nil, false
+		}
+		out := make([]Todo, 0, len(args.Plan))
+		for _, p := range args.Plan {
+			if text := strings.TrimSpace(p.Step); text != "" {
+				out = append(out, Todo{Text: text, Status: strings.ToLower(p.Status), Ts: m.Ts})
+			}
+		}
+		return out, true
+	}
+	mobj, ok := m.Raw["message"].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	parts, _ := mobj["content"].([]any)
+	for _, p := range parts {
+		part, _ := p.(map[string]any)
+		if t, _ := part["type"].(string); t != "tool_use" {
+			continue
+		}
+		if name, _ := part["name"].(string); name != "TodoWrite" {
+			continue
+		}
+		input, _ := part["input"].(map[string]any)
+		items, _ := input["todos"].([]any)
+		out := make([]Todo, 0, len(items))
+		for _, it := range items {
+			item, _ := it.(map[string]any)
+			text, _ := item["content"].(string)
+			status, _ := item["status"].(string)
+			if text = strings.TrimSpace(text); text != "" {
+				out = append(out, Todo{Text: text, Status: strings.ToLower(status), Ts: m.Ts})
+			}
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// LatestTodos returns the most recent plan written in msgs (display order),
+// or nil when the session never wrote one. The indexer keeps the same list
+// per session as it ingests; see Todos.
+func LatestTodos(msgs []*Message) []Todo {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if todos, ok := planTodos(msgs[i]); ok {
+			return todos
+		}
+	}
+	return nil
+}
+
+func countOpenTodos(todos []Todo) int {
+	n := 0
+	for _, t := range todos {
+		if t.Open() {
+			n++
+		}
+	}
+	return n
+}
+
+// Todos returns the latest plan recorded for a session during ingest.
+func (x *Indexer) Todos(sessionID string) []Todo {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	s, ok := x.sessions[sessionID]
+	if !ok {
+		return nil
+	}
+	return append([]Todo(nil), s.todos...)
+}
+
+// SessionTodos is one session's plan in a project-level aggregate.
+type SessionTodos struct {
+	SessionID string    `json:"session_id"`
+	Title     string    `json:"title"`
+	CWD       string    `json:"cwd,omitempty"`
+	LastAt    time.Time `json:"last_at"`
+	Todos     []Todo    `json:"todos"`
+}
+
+// ProjectTodos collects the latest plan of every session under cwdPrefix
+// ("" = all), newest session first. With openOnly, completed items and
+// sessions with nothing left to do are dropped.
+func (x *Indexer) ProjectTodos(cwdPrefix string, openOnly bool) []SessionTodos {
+	x.mu.RLock()
+	var out []SessionTodos
+	for _, s := range x.sessions {
+		if len(s.todos) == 0 || (cwdPrefix != "" && !strings.HasPrefix(s.CWD, cwdPrefix)) {
+			continue
+		}
+		var todos []Todo
+		for _, t := range s.todos {
+			if !openOnly || t.Open() {
+				todos = append(todos, t)
+			}
+		}
+		if len(todos) == 0 {
+			continue
+		}
+		out = append(out, SessionTodos{SessionID: s.ID, Title: SessionDisplayTitle(*s, nil), CWD: s.CWD, LastAt: s.LastAt, Todos: todos})
+	}
+	x.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].LastAt.Equal(out[j].LastAt) {
+			return out[i].LastAt.After(out[j].LastAt)
+		}
+		return out[i].SessionID < out[j].SessionID
+	})
+	return out
+}
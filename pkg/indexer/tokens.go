@@ -0,0 +1,133 @@
+package indexer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// EstimateTokens approximates what tiktoken's cl100k_base encoding would
+// count without shipping its vocabulary. The text is split the way that
+// encoding's pre-tokenizer splits it (words with their leading space, digit
+// groups of up to three, punctuation runs, whitespace) and each piece is
+// priced the way BPE usually merges it: a common-length word is one token,
+// longer words about one per four letters, and CJK and other non-ASCII
+// letters one each. It errs on the high side so budgets are not exceeded in
+// practice.
+func EstimateTokens(s string) int {
+	tokens := 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		// a single space before a word, number or punctuation belongs to it
+		if r == ' ' && i+1 < len(s) {
+			if next, _ := utf8.DecodeRuneInString(s[i+1:]); !unicode.IsSpace(next) {
+				i++
+				continue
+			}
+		}
+		switch {
+		case unicode.IsLetter(r):
+			n, ascii := 0, 0
+			for i < len(s) {
+				r, size = utf8.DecodeRuneInString(s[i:])
+				if !unicode.IsLetter(r) {
+					break
+				}
+				if r < utf8.RuneSelf {
+					ascii++
+				} else {
+					n++
+				}
+				i += size
+			}
+			tokens += n + wordTokens(ascii)
+		case unicode.IsDigit(r):
+			digits := 0
+			for i < len(s) {
+				r, size = utf8.DecodeRuneInString(s[i:])
+				if !unicode.IsDigit(r) {
+					break
+				}
+				digits++
+				i += size
+			}
+			tokens += (digits + 2) / 3
+		case unicode.IsSpace(r):
+			// runs of whitespace (indentation, blank lines) merge into one
+			for i < len(s) {
+				r, size = utf8.DecodeRuneInString(s[i:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				i += size
+			}
+			tokens++
+		default:
+			if n := contraction(s[i:]); n > 0 {
+				tokens++
+				i += n
+				continue
+			}
+			punct := 0
+			for i < len(s) {
+				r, size = utf8.DecodeRuneInString(s[i:])
+				if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+					break
+				}
+				punct++
+				i += size
+			}
+			tokens += (punct + 2) / 3
+		}
+	}
+	return tokens
+}
+
+// wordTokens prices a run of n ASCII letters: words up to seven letters are
+// usually in the vocabulary whole, longer ones split into about four-letter
+// pieces.
+func wordTokens(n int) int {
+	switch {
+	case n == 0:
+		return 0
+	case n <= 7:
+		return 1
+	}
+	return (n + 3) / 4
+}
+
+// contraction returns the length of an English contraction suffix ('s, 't,
+// 're, 've, 'm, 'll, 'd) at the start of s, which cl100k keeps as one piece,
+// or 0.
+func contraction(s string) int {
+	if len(s) < 2 || s[0] != '\'' {
+		return 0
+	}
+	for _, suf := range []string{"ll", "re", "ve", "s", "t", "m", "d"} {
+		if len(s) >= 1+len(suf) && s[1:1+len(suf)] == suf {
+			return 1 + len(suf)
+		}
+	}
+	return 0
+}
+
+// addTokens counts msg.TokenCount into the session: what the model wrote
+// (answers, reasoning, tool calls) is output, everything it read is input.
+// Messages without a model are priced as the latest model named before them.
+func (s *Session) addTokens(msg *Message) {
+	if msg.Model != "" {
+		s.lastModel = msg.Model
+	}
+	if s.modelTokens == nil {
+		s.modelTokens = make(map[string]tokenPair)
+	}
+	t := s.modelTokens[s.lastModel]
+	switch TurnKind(msg) {
+	case TurnAnswer, TurnReasoning, TurnToolCall:
+		s.OutputTokens += msg.TokenCount
+		t.out += msg.TokenCount
+	default:
+		s.InputTokens += msg.TokenCount
+		t.in += msg.TokenCount
+	}
+	s.modelTokens[s.lastModel] = t
+}
@@ -0,0 +1,297 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of trash entries.
+const (
+	TrashSession   = "session"   // a whole session file, see DeleteSession
+	TrashMessage   = "message"   // one line of a session file, see DeleteMessage
+	TrashDuplicate = "duplicate" // a copy removed by Dedupe
+)
+
+// trashEntryFile holds an entry's manifest inside its trash folder.
+const trashEntryFile = "entry.json"
+
+// DefaultTrashRetention is how long deletions stay restorable unless
+// SetTrashRetention says otherwise.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// ErrTrashNotFound is returned for an unknown or malformed trash entry id.
+var ErrTrashNotFound = errors.New("trash entry not found")
+
+// trashPurgeInterval is how often Run drops expired trash entries.
+const trashPurgeInterval = time.Hour
+
+// TrashEntry is one deletion kept in the trash.
+type TrashEntry struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	SessionID string    `json:"session_id,omitempty"`
+	MessageID string    `json:"message_id,omitempty"`
+	Path      string    `json:"path"`           // where the file was
+	Line      int       `json:"line,omitempty"` // a message's line number in Path
+	DeletedAt time.Time `json:"deleted_at"`
+	Title     string    `json:"title,omitempty"`
+	// Text is a deleted message's line; File is the trashed copy of a file
+	// relative to the entry folder.
+	Text string `json:"text,omitempty"`
+	File string `json:"file,omitempty"`
+}
+
+// trashDir is where files removed by the watcher are kept instead of deleted.
+func (x *Indexer) trashDir() string {
+	return filepath.Join(x.codexDir, "codex-watcher-trash")
+}
+
+// SetTrashRetention sets how long deletions stay in the trash; zero or less
+// keeps them until removed by hand. Call before Run.
+func (x *Indexer) SetTrashRetention(d time.Duration) {
+	if d <= 0 {
+		d = -1
+	}
+	x.trashKeep = d
+}
+
+func (x *Indexer) trashRetention() time.Duration {
+	if x.trashKeep == 0 {
+		return DefaultTrashRetention
+	}
+	return x.trashKeep
+}
+
+// newTrashEntry creates the folder of a new entry and returns it.
+func (x *Indexer) newTrashEntry(e TrashEntry) (TrashEntry, string, error) {
+	e.DeletedAt = time.Now().UTC()
+	if err := os.MkdirAll(x.trashDir(), 0o755); err != nil {
+		return e, "", fmt.Errorf("failed to create trash dir: %w", err)
+	}
+	base := e.DeletedAt.Format("20060102T150405.000000")
+	for n := 1; ; n++ {
+		e.ID = base
+		if n > 1 {
+			e.ID += "-" + strconv.Itoa(n)
+		}
+		dir := filepath.Join(x.trashDir(), e.ID)
+		err := os.Mkdir(dir, 0o755)
+		if err == nil {
+			return e, dir, nil
+		}
+		if !os.IsExist(err) {
+			return e, "", fmt.Errorf("failed to create trash dir: %w", err)
+		}
+	}
+}
+
+func writeTrashEntry(dir string, e TrashEntry) error {
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, trashEntryFile), b, 0o644); err != nil {
+		return fmt.Errorf("failed to write trash entry: %w", err)
+	}
+	return nil
+}
+
+// trashFile moves a file into a new trash entry, keeping its path relative
+// to the provider root so the origin stays recognizable.
+func (x *Indexer) trashFile(path string, e TrashEntry) (TrashEntry, error) {
+	e, dir, err := x.newTrashEntry(e)
+	if err != nil {
+		return e, err
+	}
+	rel := path
+	for _, root := range append(append([]string(nil), x.codexDirs...), x.claudeDir) {
+		if strings.TrimSpace(root) == "" {
+			continue
+		}
+		if r, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(r, "..") {
+			rel = r
+			break
+		}
+	}
+	e.Path = path
+	e.File = strings.TrimPrefix(rel, string(filepath.Separator))
+	if err := moveFile(path, filepath.Join(dir, e.File)); err != nil {
+		os.RemoveAll(dir)
+		return e, fmt.Errorf("failed to trash %s: %w", path, err)
+	}
+	return e, writeTrashEntry(dir, e)
+}
+
+// trashLine records a message line about to be removed from path.
+func (x *Indexer) trashLine(path string, e TrashEntry) (TrashEntry, error) {
+	e, dir, err := x.newTrashEntry(e)
+	if err != nil {
+		return e, err
+	}
+	e.Path = path
+	if err := writeTrashEntry(dir, e); err != nil {
+		os.RemoveAll(dir)
+		return e, err
+	}
+	return e, nil
+}
+
+// moveFile renames src to dst, creating dst's folder, and copies across
+// devices.
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		if err := copyFile(src, dst); err != nil {
+			return err
+		}
+		return os.Remove(src)
+	}
+	return nil
+}
+
+// Trash lists the restorable deletions, newest first, after dropping those
+// older than the retention period.
+func (x *Indexer) Trash() ([]TrashEntry, error) {
+	x.PurgeTrash(time.Now())
+	dirs, err := os.ReadDir(x.trashDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []TrashEntry
+	for _, d := range dirs {
+		if e, err := x.trashEntry(d.Name()); err == nil {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].DeletedAt.After(out[j].DeletedAt) })
+	return out, nil
+}
+
+// trashEntry reads an entry's manifest; folders without one (trash from
+// before entries were recorded) are not entries.
+func (x *Indexer) trashEntry(id string) (TrashEntry, error) {
+	var e TrashEntry
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return e, fmt.Errorf("%w: %q", ErrTrashNotFound, id)
+	}
+	b, err := os.ReadFile(filepath.Join(x.trashDir(), id, trashEntryFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return e, fmt.Errorf("%w: %s", ErrTrashNotFound, id)
+		}
+		return e, err
+	}
+	if err := json.Unmarshal(b, &e); err != nil {
+		return e, fmt.Errorf("invalid trash entry %s: %w", id, err)
+	}
+	e.ID = id
+	return e, nil
+}
+
+// PurgeTrash removes the entries deleted longer than the retention period
+// before now and returns how many went.
+func (x *Indexer) PurgeTrash(now time.Time) int {
+	keep := x.trashRetention()
+	if keep < 0 {
+		return 0
+	}
+	dirs, err := os.ReadDir(x.trashDir())
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, d := range dirs {
+		e, err := x.trashEntry(d.Name())
+		if err != nil || now.Sub(e.DeletedAt) < keep {
+			continue
+		}
+		if os.RemoveAll(filepath.Join(x.trashDir(), e.ID)) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// RestoreTrash puts a deletion back: a session or duplicate file returns to
+// its path (which must be free), a message line is inserted at its old line
+// number (or appended if the file is now shorter). The file is re-read
+// before returning and the entry leaves the trash.
+func (x *Indexer) RestoreTrash(id string) (TrashEntry, error) {
+	x.scanMu.Lock()
+	defer x.scanMu.Unlock()
+	x.streamMu.Lock()
+	defer x.streamMu.Unlock()
+
+	e, err := x.trashEntry(id)
+	if err != nil {
+		return e, err
+	}
+	dir := filepath.Join(x.trashDir(), e.ID)
+	switch e.Kind {
+	case TrashSession, TrashDuplicate:
+		if _, err := os.Stat(e.Path); err == nil {
+			return e, fmt.Errorf("cannot restore %s: the file exists again", e.Path)
+		}
+		if err := moveFile(filepath.Join(dir, e.File), e.Path); err != nil {
+			return e, fmt.Errorf("failed to restore %s: %w", e.Path, err)
+		}
+	case TrashMessage:
+		inserted := false
+		err := rewriteFileLines(e.Path, func(lineNo int, line string) (string, bool) {
+			if lineNo == e.Line {
+				inserted = true
+				return e.Text + "\n" + line, true
+			}
+			return line, true
+		})
+		if err == nil && !inserted {
+			err = appendLine(e.Path, e.Text)
+		}
+		if err != nil {
+			return e, fmt.Errorf("failed to restore message: %w", err)
+		}
+	default:
+		return e, fmt.Errorf("unknown trash entry kind: %s", e.Kind)
+	}
+	_ = os.RemoveAll(dir)
+
+	// re-read the file from the start
+	provider, project, sessionID, ok := x.fileIdentity(e.Path)
+	if !ok {
+		return e, nil
+	}
+	x.mu.Lock()
+	x.forgetFileLocked(e.Path)
+	x.mu.Unlock()
+	return e, x.tailFile(provider, project, sessionID, e.Path)
+}
+
+// appendLine adds line to the end of path, after a newline if the file does
+// not end with one.
+func appendLine(path, line string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		line = "\n" + line
+	}
+	_, err = f.WriteString(line + "\n")
+	return errors.Join(err, f.Close())
+}
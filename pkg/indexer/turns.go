@@ -0,0 +1,137 @@
+package indexer
+
+import (
+	"strings"
+	"time"
+)
+
+// Turn is one logical exchange: a user prompt and everything the assistant
+// did in response (reasoning, tool calls with their outputs, and replies).
+type Turn struct {
+	Index     int        `json:"index"` // 1 for the first prompt; 0 for a preamble turn
+	StartAt   time.Time  `json:"start_at,omitempty"`
+	EndAt     time.Time  `json:"end_at,omitempty"`
+	Prompt    *Message   `json:"prompt,omitempty"`    // nil for messages before the first prompt
+	Reasoning []*Message `json:"reasoning,omitempty"` // reasoning/thinking steps
+	Tools     []*Message `json:"tools,omitempty"`     // tool calls and their outputs, in order
+	Answer    []*Message `json:"answer,omitempty"`    // assistant replies
+	Other     []*Message `json:"other,omitempty"`     // context, notes, summaries
+	ToolCalls int        `json:"tool_calls"`          // calls only, outputs not counted
+}
+
+// Message kinds returned by TurnKind.
+const (
+	TurnPrompt     = "prompt"
+	TurnReasoning  = "reasoning"
+	TurnToolCall   = "tool_call"
+	TurnToolOutput = "tool_output"
+	TurnAnswer     = "answer"
+	TurnOther      = "other"
+)
+
+// TurnKind classifies a message for turn grouping across both providers:
+// Codex uses top-level types (reasoning, function_call, ...), Claude nests
+// tool_use/tool_result/thinking parts inside message.content.
+func TurnKind(m *Message) string {
+	if m == nil {
+		return TurnOther
+	}
+	switch typ := strings.ToLower(m.Type); typ {
+	case "reasoning":
+		return TurnReasoning
+	case "function_call", "custom_tool_call", "local_shell_call", "web_search_call":
+		return TurnToolCall
+	case "function_call_output", "custom_tool_call_output":
+		return TurnToolOutput
+	case NoteType, "summary":
+		return TurnOther
+	}
+	switch claudePartTypes(m) {
+	case "tool_use":
+		return TurnToolCall
+	case "tool_result":
+		return TurnToolOutput
+	}
+	switch strings.ToLower(m.Role) {
+	case "user":
+		if looksLikeEnvironmentContext(m.Content) || strings.TrimSpace(m.Content) == "" {
+			return TurnOther
+		}
+		return TurnPrompt
+	case "assistant":
+		if strings.TrimSpace(m.Content) == "" && strings.TrimSpace(m.Thinking) != "" {
+			return TurnReasoning
+		}
+		return TurnAnswer
+	}
+	return TurnOther
+}
+
+// claudePartTypes reports "tool_use" or "tool_result" when a Claude message's
+// content parts include one, "" otherwise.
+func claudePartTypes(m *Message) string {
+	mobj, ok := m.Raw["message"].(map[string]any)
+	if !ok {
+		return ""
+	}
+	parts, ok := mobj["content"].([]any)
+	if !ok {
+		return ""
+	}
+	for _, p := range parts {
+		part, ok := p.(map[string]any)
+		if !ok {
+			continue
+		}
+		switch t, _ := part["type"].(string); t {
+		case "tool_use", "tool_result":
+			return t
+		}
+	}
+	return ""
+}
+
+// GroupTurns splits messages (in display order) into turns. A new turn
+// starts at every prompt, numbered from 1; anything before the first prompt
+// forms turn 0 without one.
+func GroupTurns(msgs []*Message) []Turn {
+	var turns []Turn
+	prompts := 0
+	for _, m := range msgs {
+		if m == nil {
+			continue
+		}
+		kind := TurnKind(m)
+		if kind == TurnPrompt {
+			prompts++
+			turns = append(turns, Turn{Index: prompts})
+		} else if len(turns) == 0 {
+			turns = append(turns, Turn{})
+		}
+		t := &turns[len(turns)-1]
+		switch kind {
+		case TurnPrompt:
+			t.Prompt = m
+		case TurnReasoning:
+			t.Reasoning = append(t.Reasoning, m)
+		case TurnToolCall:
+			t.Tools = append(t.Tools, m)
+			t.ToolCalls++
+		case TurnToolOutput:
+			t.Tools = append(t.Tools, m)
+		case TurnAnswer:
+			t.Answer = append(t.Answer, m)
+		default:
+			t.Other = append(t.Other, m)
+		}
+		if !m.Ts.IsZero() {
+			if t.StartAt.IsZero() || m.Ts.Before(t.StartAt) {
+				t.StartAt = m.Ts
+			}
+			if m.Ts.After(t.EndAt) {
+				t.EndAt = m.Ts
+			}
+		}
+	}
+	return turns
+}
@@ -0,0 +1,107 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// VerifyIssue is one problem found by Verify.
+type VerifyIssue struct {
+	Path   string `json:"path"`
+	Line   int    `json:"line,omitempty"`
+	Kind   string `json:"kind"` // invalid_json|encoding|timestamp_order|orphan_meta|unreadable
+	Detail string `json:"detail,omitempty"`
+}
+
+// VerifyReport summarizes an integrity check over all session files.
+type VerifyReport struct {
+	Files  int           `json:"files"`
+	Lines  int           `json:"lines"`
+	Issues []VerifyIssue `json:"issues"`
+}
+
+// OK reports whether no issues were found.
+func (r VerifyReport) OK() bool { return len(r.Issues) == 0 }
+
+// Verify checks every session file for JSON validity, encoding problems, and
+// non-monotonic timestamps, and looks for .meta.json files without a session.
+// It reads files directly and does not touch the in-memory index.
+func (x *Indexer) Verify() VerifyReport {
+	report := VerifyReport{Issues: []VerifyIssue{}}
+	x.discoverFiles(func(provider, project, sessionID, path string) {
+		report.Files++
+		if d, ok := providerFor(provider).(documentProvider); ok && d.IsDocument(path) {
+			return // not JSONL
+		}
+		report.Issues = append(report.Issues, verifyFile(path, &report.Lines)...)
+	})
+	report.Issues = append(report.Issues, x.orphanMetaFiles()...)
+	return report
+}
+
+func verifyFile(path string, lines *int) []VerifyIssue {
+	var issues []VerifyIssue
+	var prevTs time.Time
+	prevLine := 0
+	err := forEachLine(path, func(lineNo int, line string) {
+		if lineNo == 0 {
+			return
+		}
+		*lines++
+		if lineNo == 1 && strings.HasPrefix(line, "\uFEFF") {
+			issues = append(issues, VerifyIssue{Path: path, Line: lineNo, Kind: "encoding", Detail: "UTF-8 byte order mark"})
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+		if !utf8.ValidString(line) {
+			issues = append(issues, VerifyIssue{Path: path, Line: lineNo, Kind: "encoding", Detail: "invalid UTF-8"})
+		} else if strings.ContainsRune(line, 0) {
+			issues = append(issues, VerifyIssue{Path: path, Line: lineNo, Kind: "encoding", Detail: "NUL byte"})
+		}
+		var raw map[string]any
+		if err := json.Unmarshal([]byte(line), &raw); err != nil {
+			issues = append(issues, VerifyIssue{Path: path, Line: lineNo, Kind: "invalid_json", Detail: err.Error()})
+			return
+		}
+		ts, ok := parseTime(raw["timestamp"], raw["ts"], raw["created_at"])
+		if !ok {
+			return
+		}
+		if !prevTs.IsZero() && ts.Before(prevTs) {
+			issues = append(issues, VerifyIssue{
+				Path:   path,
+				Line:   lineNo,
+				Kind:   "timestamp_order",
+				Detail: fmt.Sprintf("%s is before line %d (%s)", ts.Format(time.RFC3339Nano), prevLine, prevTs.Format(time.RFC3339Nano)),
+			})
+		}
+		prevTs, prevLine = ts, lineNo
+	})
+	if err != nil {
+		issues = append(issues, VerifyIssue{Path: path, Kind: "unreadable", Detail: err.Error()})
+	}
+	return issues
+}
+
+// orphanMetaFiles finds <name>.meta.json sidecars whose <name>.jsonl is gone.
+func (x *Indexer) orphanMetaFiles() []VerifyIssue {
+	var issues []VerifyIssue
+	check := func(path string, d os.DirEntry, err error) error {
+		if err != nil || d == nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".meta.json") {
+			return nil
+		}
+		jsonl := strings.TrimSuffix(path, ".meta.json") + ".jsonl"
+		if _, err := os.Stat(jsonl); os.IsNotExist(err) {
+			issues = append(issues, VerifyIssue{Path: path, Kind: "orphan_meta", Detail: "no session file " + filepath.Base(jsonl)})
+		}
+		return nil
+	}
+	for _, root := range x.watchRoots() {
+		_ = filepath.WalkDir(root, check)
+	}
+	return issues
+}
@@ -69,8 +69,19 @@ func SessionDisplayTitle(s Session, visibleMsgs []*Message) string {
 }
 
 // SessionView projects session metadata from visible messages only. Sessions
-// with no visible messages should be hidden by callers.
+// with no visible messages should be hidden by callers. Models, active time,
+// and cost follow DefaultOptions; the method of the same name follows the
+// options of the indexer the session came from.
 func SessionView(s Session, visibleMsgs []*Message) (Session, bool) {
+	return sessionView(s, visibleMsgs, DefaultOptions())
+}
+
+// SessionView is the package SessionView under the indexer's Options.
+func (x *Indexer) SessionView(s Session, visibleMsgs []*Message) (Session, bool) {
+	return sessionView(s, visibleMsgs, x.opts)
+}
+
+func sessionView(s Session, visibleMsgs []*Message, o Options) (Session, bool) {
 	if len(visibleMsgs) == 0 {
 		return Session{}, false
 	}
@@ -78,10 +89,18 @@ func SessionView(s Session, visibleMsgs []*Message) (Session, bool) {
 	view := s
 	view.MessageCount = 0
 	view.TextCount = 0
+	view.InputTokens = 0
+	view.OutputTokens = 0
+	view.modelTokens = nil
+	view.lastModel = ""
+	view.outcome = outcomeState{}
 	view.FirstAt = time.Time{}
 	view.LastAt = time.Time{}
 	view.Models = make(map[string]int)
 	view.Roles = make(map[string]int)
+	view.MCPTools = nil
+	view.Languages = nil
+	view.ToolCounts = nil
 	view.Sources = nil
 
 	sourcesSeen := make(map[string]struct{})
@@ -90,6 +109,8 @@ func SessionView(s Session, visibleMsgs []*Message) (Session, bool) {
 			continue
 		}
 		view.MessageCount++
+		view.addTokens(msg)
+		view.noteOutcome(msg)
 		if strings.TrimSpace(msg.Content) != "" {
 			view.TextCount++
 		}
@@ -101,12 +122,30 @@ func SessionView(s Session, visibleMsgs []*Message) (Session, bool) {
 				view.LastAt = msg.Ts
 			}
 		}
-		if model := strings.TrimSpace(msg.Model); model != "" {
+		if model := o.Models.Canonical(msg.Model); model != "" {
 			view.Models[model]++
 		}
 		if role := strings.TrimSpace(msg.Role); role != "" {
 			view.Roles[role]++
 		}
+		for _, name := range ToolCallNames(msg) {
+			if view.ToolCounts == nil {
+				view.ToolCounts = make(map[string]int)
+			}
+			view.ToolCounts[name]++
+		}
+		for _, call := range MCPCalls(msg) {
+			if view.MCPTools == nil {
+				view.MCPTools = make(map[string]int)
+			}
+			view.MCPTools[call]++
+		}
+		for _, lang := range CodeLanguages(msg) {
+			if view.Languages == nil {
+				view.Languages = make(map[string]int)
+			}
+			view.Languages[lang]++
+		}
 		if src := strings.TrimSpace(msg.Source); src != "" {
 			if _, ok := sourcesSeen[src]; !ok {
 				sourcesSeen[src] = struct{}{}
@@ -115,7 +154,10 @@ func SessionView(s Session, visibleMsgs []*Message) (Session, bool) {
 		}
 	}
 	sort.Strings(view.Sources)
+	view.ActiveDuration = activeDuration(visibleMsgs, o.IdleGap)
 	view.Title = SessionDisplayTitle(view, visibleMsgs)
+	view.Cost, view.UnpricedTokens = view.estimateCost(o.Models)
+	view.applyOutcome()
 	return view, true
 }
 
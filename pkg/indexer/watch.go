@@ -0,0 +1,227 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchRescan is how often Run still walks both trees while file events
+// drive ingest. The walk picks up anything the watcher missed: new roots,
+// directory metadata edits, and events dropped on queue overflow.
+//
+// Deprecated: set Options.WatchRescan; this is only its default.
+var WatchRescan = 30 * time.Second
+
+// watchDebounce collects a burst of events (an agent writing several lines)
+// into one tail of each file.
+const watchDebounce = 50 * time.Millisecond
+
+// SetWatch makes Run follow file system events instead of polling every
+// PollInterval. Where events are unavailable (no watcher for the platform,
+// the system's watch limit reached) Run falls back to polling.
+func (x *Indexer) SetWatch(on bool) {
+	x.mu.Lock()
+	x.watch = on
+	x.mu.Unlock()
+}
+
+// watchRoots are the trees session files live in.
+func (x *Indexer) watchRoots() []string {
+	var roots []string
+	x.providerRoots(func(p Provider, root string) {
+		roots = append(roots, sessionTree(p, root))
+	})
+	return roots
+}
+
+func (x *Indexer) setWatchMode(mode string) {
+	x.mu.Lock()
+	x.watchMode = mode
+	x.mu.Unlock()
+}
+
+// fileIdentity maps a path under the watched roots to what discoverFiles
+// would report for it. ok is false for anything that is not a session file.
+func (x *Indexer) fileIdentity(path string) (provider, project, sessionID string, ok bool) {
+	x.providerRoots(func(p Provider, root string) {
+		if !ok {
+			project, sessionID, ok = p.SessionIDFor(root, path)
+			provider = p.Name()
+		}
+	})
+	if !ok {
+		return "", "", "", false
+	}
+	return provider, project, sessionID, true
+}
+
+// scanPaths tails just the given files, for watch events. Paths that are
+// not session files are left to the next full scan; deleted ones are
+// forgotten.
+func (x *Indexer) scanPaths(paths []string) {
+	if !x.Ready() {
+		return // the initial scan reads everything anyway
+	}
+	x.scanMu.Lock()
+	defer x.scanMu.Unlock()
+	x.streamMu.Lock()
+	defer x.streamMu.Unlock()
+	start := time.Now()
+	for _, p := range paths {
+		provider, project, sessionID, ok := x.fileIdentity(p)
+		if !ok || x.skipFile(provider, p) {
+			continue
+		}
+		if _, err := os.Stat(p); err != nil {
+			x.forgetMissing([]string{p})
+			continue
+		}
+		if !x.resetIfReplaced(p) {
+			x.checkSum(p, sessionID)
+		}
+		f := scanFile{provider, project, sessionID, p, 0}
+		if x.queueLargeFile(f) {
+			continue
+		}
+		if err := x.tailFile(provider, project, sessionID, p); err != nil {
+			x.mu.Lock()
+			x.stats.ScanErrors++
+			x.mu.Unlock()
+		}
+	}
+	x.mu.Lock()
+	x.stats.LastScanMs = int(time.Since(start).Milliseconds())
+	x.mu.Unlock()
+}
+
+// watchBatch accumulates watcher events until the debounce timer fires.
+type watchBatch struct {
+	paths map[string]bool
+	full  bool // a directory changed or events were lost
+}
+
+func (b *watchBatch) add(path string) {
+	if path == "" {
+		b.full = true
+		return
+	}
+	if b.paths == nil {
+		b.paths = make(map[string]bool)
+	}
+	b.paths[path] = true
+}
+
+// flush scans what the batch collected and empties it.
+func (b *watchBatch) flush(x *Indexer) {
+	if b.full {
+		_ = x.scanAll()
+	} else if len(b.paths) > 0 {
+		paths := make([]string, 0, len(b.paths))
+		for p := range b.paths {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		x.scanPaths(paths)
+	}
+	*b = watchBatch{}
+}
+
+// fileWatcher follows every directory under the roots with fsnotify: inotify
+// on Linux, kqueue on macOS and the BSDs, ReadDirectoryChangesW on Windows.
+// Events carries the path of each changed file, or "" when a directory
+// appeared or events were lost and everything should be rescanned. It is
+// closed when the watcher fails or is closed.
+type fileWatcher struct {
+	Events chan string
+
+	w     *fsnotify.Watcher
+	roots []string
+	done  chan struct{}
+}
+
+func newFileWatcher(roots []string) (*fileWatcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &fileWatcher{
+		Events: make(chan string, 256),
+		w:      fw,
+		roots:  roots,
+		done:   make(chan struct{}),
+	}
+	w.Refresh()
+	go w.read()
+	return w, nil
+}
+
+// Refresh adds watches for directories created while no watch saw them,
+// including roots that did not exist yet. Existing watches are kept.
+func (w *fileWatcher) Refresh() {
+	for _, root := range w.roots {
+		w.addTree(root)
+	}
+}
+
+// addTree watches dir and every directory below it; fsnotify does not
+// recurse on its own.
+func (w *fileWatcher) addTree(dir string) {
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		_ = w.w.Add(path)
+		return nil
+	})
+}
+
+func (w *fileWatcher) Close() error {
+	close(w.done)
+	return w.w.Close()
+}
+
+func (w *fileWatcher) read() {
+	defer close(w.Events)
+	for {
+		select {
+		case ev, ok := <-w.w.Events:
+			if !ok || !w.handle(ev) {
+				return
+			}
+		case _, ok := <-w.w.Errors:
+			// an overflowed queue or a failed read may have lost events
+			if !ok || !w.send("") {
+				return
+			}
+		}
+	}
+}
+
+// handle turns one event into a path on Events; false means the watcher
+// was closed.
+func (w *fileWatcher) handle(ev fsnotify.Event) bool {
+	if ev.Op == fsnotify.Chmod {
+		return true
+	}
+	if ev.Has(fsnotify.Create) {
+		if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+			w.addTree(ev.Name)
+			// files may have landed before the watch did
+			return w.send("")
+		}
+	}
+	return w.send(ev.Name)
+}
+
+func (w *fileWatcher) send(path string) bool {
+	select {
+	case w.Events <- path:
+		return true
+	case <-w.done:
+		return false
+	}
+}
@@ -0,0 +1,175 @@
+package search
+
+import (
+	"fmt"
+	"time"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// Plan explains how Exec evaluates a query, for /api/search?explain=1.
+type Plan struct {
+	Scope  string         `json:"scope"` // content|tools|all
+	Index  string         `json:"index"` // access path: linear|fts
+	Groups [][]ClausePlan `json:"groups"`
+	// Candidate counts: sessions and visible messages scanned, messages
+	// passing the field filters, and messages matching the whole query.
+	Sessions   int `json:"sessions"`
+	Messages   int `json:"messages"`
+	Candidates int `json:"candidates"`
+	Matches    int `json:"matches"`
+	// IndexCandidates counts messages the full-text index let through, when
+	// Index is fts.
+	IndexCandidates int  `json:"index_candidates,omitempty"`
+	Partial         bool `json:"partial,omitempty"` // counts stopped at the time budget
+	TookMS          int  `json:"took_ms"`
+	// Settings that change what is found.
+	BudgetMs       int  `json:"budget_ms"`
+	MaxReturn      int  `json:"max_return"`
+	ToolOutputs    bool `json:"tool_outputs"`
+	MaxOutputBytes int  `json:"max_output_bytes,omitempty"`
+	// Warnings point at likely reasons for an empty result.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ClausePlan is one parsed clause and how many messages satisfy it on its
+// own (after the session filter, before the other clauses). For a negative
+// clause those are the messages it lets through.
+type ClausePlan struct {
+	Kind     string `json:"kind"`            // term|phrase|prefix|wildcard|regex|field
+	Field    string `json:"field,omitempty"` // for field filters
+	Value    string `json:"value,omitempty"`
+	Pattern  string `json:"pattern,omitempty"` // compiled regex
+	Negative bool   `json:"negative,omitempty"`
+	Matches  int    `json:"matches"`
+}
+
+var kindNames = map[ClauseKind]string{
+	KindTerm: "term", KindPhrase: "phrase", KindPrefix: "prefix", KindRegex: "regex", KindField: "field",
+	KindWildcard: "wildcard",
+}
+
+var scopeNames = map[Scope]string{ScopeContent: "content", ScopeTools: "tools", ScopeAll: "all"}
+
+// Explain describes q and counts, per clause and overall, the messages it
+// matches. Counting walks the same messages Exec does, so it stops at
+// twice the search budget and reports Partial.
+func Explain(idx *indexer.Indexer, q Query) Plan {
+	return explain(idx, q, CurrentOptions())
+}
+
+func explain(idx *indexer.Indexer, q Query, o Options) Plan {
+	start := time.Now()
+	plan := Plan{
+		Scope:          scopeNames[q.Scope],
+		Index:          "linear",
+		BudgetMs:       int(o.Budget / time.Millisecond),
+		MaxReturn:      o.MaxReturn,
+		ToolOutputs:    o.ToolOutputs,
+		MaxOutputBytes: o.MaxOutputBytes,
+	}
+	plan.Groups = make([][]ClausePlan, len(q.Groups))
+	fields := 0
+	for i, g := range q.Groups {
+		plan.Groups[i] = make([]ClausePlan, len(g))
+		for j, c := range g {
+			cp := ClausePlan{Kind: kindNames[c.Kind], Value: c.Value, Negative: c.Negative}
+			if c.Kind == KindField {
+				cp.Field = c.Field
+				fields++
+			}
+			if c.Regex != nil {
+				cp.Pattern = c.Regex.String()
+			}
+			plan.Groups[i][j] = cp
+		}
+	}
+
+	var mayMatch func(m *indexer.Message) bool
+	if o.Index != nil {
+		if f, ok := o.Index(q); ok {
+			mayMatch, plan.Index = f, "fts"
+		}
+	}
+
+	// one single-clause query per clause, evaluated like the whole one
+	single := func(c Clause) Query { return Query{Groups: [][]Clause{{c}}, Scope: q.Scope} }
+	limit := 2 * o.Budget
+	for _, s := range idx.Sessions() {
+		if o.SessionFilter != nil && o.SessionFilter(s) {
+			continue
+		}
+		msgs := indexer.VisibleMessages(idx.PeekMessages(s.ID), 0)
+		view, ok := idx.SessionView(s, msgs)
+		if !ok {
+			continue
+		}
+		plan.Sessions++
+		for _, m := range msgs {
+			if !o.ToolOutputs && indexer.TurnKind(m) == indexer.TurnToolOutput {
+				continue
+			}
+			plan.Messages++
+			for i, g := range q.Groups {
+				for j, c := range g {
+					var hit bool
+					if c.Kind == KindField {
+						hit = matchesFieldFilters(idx, single(c), m, view)
+					} else {
+						hit, _ = matchesTextGroups(single(c), m, o.MaxOutputBytes)
+					}
+					if hit {
+						plan.Groups[i][j].Matches++
+					}
+				}
+			}
+			if mayMatch != nil {
+				if !mayMatch(m) {
+					continue
+				}
+				plan.IndexCandidates++
+			}
+			if !matchesFieldFilters(idx, q, m, view) {
+				continue
+			}
+			plan.Candidates++
+			if ok, _ := matchesTextGroups(q, m, o.MaxOutputBytes); ok {
+				plan.Matches++
+			}
+		}
+		if time.Since(start) > limit {
+			plan.Partial = true
+			break
+		}
+	}
+	plan.TookMS = int(time.Since(start).Milliseconds())
+
+	if len(q.Groups) == 1 && len(q.Groups[0]) == 0 {
+		plan.Warnings = append(plan.Warnings, "empty query: every message matches")
+	}
+	if fields > 0 && len(q.Groups) > 1 {
+		plan.Warnings = append(plan.Warnings, "field filters apply to every OR group, not just their own")
+	}
+	if !o.ToolOutputs && q.Scope != ScopeContent {
+		plan.Warnings = append(plan.Warnings, "tool outputs are excluded from search (search_tool_outputs=false)")
+	}
+	for _, g := range plan.Groups {
+		for _, c := range g {
+			desc := c.Value
+			if c.Field != "" {
+				desc = c.Field + ":" + c.Value
+			}
+			switch {
+			case c.Kind == "regex" && c.Pattern == "":
+				plan.Warnings = append(plan.Warnings, "a regex did not compile and matches nothing")
+			case c.Negative && c.Matches == 0 && plan.Messages > 0:
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("-%s excludes every message", desc))
+			case !c.Negative && c.Matches == 0 && c.Kind != "regex":
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("%q matches no message on its own", desc))
+			case !c.Negative && c.Matches == 0:
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("regex %s matches no message on its own", c.Pattern))
+			}
+		}
+	}
+	return plan
+}
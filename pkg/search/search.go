@@ -1,3 +1,11 @@
+// Package search provides a minimal zero-dependency, in-memory search engine
+// over the indexer's messages. It implements a basic Google-style query
+// parser with AND/OR, phrase, exclude, field filters, regex, and simple
+// wildcard handling. This is a pragmatic baseline that can be upgraded to
+// SQLite FTS-backed search later without changing the API.
+//
+//	s := search.New(idx, search.CurrentOptions())
+//	res := s.Exec(search.Parse("flaky role:user", "all"), 50, 0)
 package search
 
 import (
@@ -5,21 +13,19 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
-	"codex-watcher/internal/indexer"
+	"codex-watcher/pkg/indexer"
 )
 
 // SessionFilter is a function that returns true if a session should be hidden/filtered out.
 // Can be set by the API layer to implement filtering logic.
+//
+// Deprecated: set Options.SessionFilter; this is only its default.
 var SessionFilter func(s indexer.Session) bool
 
-// Package search provides a minimal zero-dependency, in-memory search engine
-// over the indexer's messages. It implements a basic Google-style query
-// parser with AND/OR, phrase, exclude, field filters, regex, and simple
-// wildcard handling. This is a pragmatic baseline that can be upgraded to
-// SQLite FTS-backed search later without changing the API.
-
 // Scope controls which textual fields are considered for term/phrase/regex matching.
 type Scope int
 
@@ -32,7 +38,7 @@ const (
 // Query describes a parsed search.
 // It is represented as a disjunction (OR) of conjunctions (AND) of clauses.
 // Each clause may be a text match (term, phrase, regex, prefix/wildcard)
-// or a field filter applied to metadata (role/type/model/cwd/cwd_base).
+// or a field filter applied to metadata (role/type/model/cwd/branch/...).
 type Query struct {
 	// OR-groups of AND-clauses
 	Groups [][]Clause
@@ -47,23 +53,24 @@ type Clause struct {
 	Negative bool
 
 	// Fielded metadata filters
-	Field string // one of: role, type, model, cwd, cwd_base, in
+	Field string // one of: role, type, model, toolkind, cwd, cwd_base, dir, branch, repo, tag, mcp, lang, in
 	Value string // raw value for field filters or text clauses
 
 	// Text matching
 	Kind  ClauseKind
-	Regex *regexp.Regexp // for KindRegex or wildcard converted to regex
+	Regex *regexp.Regexp // for KindRegex and KindWildcard
 }
 
 type ClauseKind int
 
 const (
-	KindUnknown ClauseKind = iota
-	KindTerm               // case-insensitive substring (AND default)
-	KindPhrase             // quoted phrase
-	KindPrefix             // foo*
-	KindRegex              // /re/
-	KindField              // role:assistant, etc.
+	KindUnknown  ClauseKind = iota
+	KindTerm                // case-insensitive substring (AND default)
+	KindPhrase              // quoted phrase
+	KindPrefix              // foo*: a word starting with foo (see segment.go)
+	KindRegex               // /re/
+	KindField               // role:assistant, etc.
+	KindWildcard            // f*o, *foo: * is any run of non-space characters
 )
 
 // Result is one matched message with minimal context for Phase 1.
@@ -79,14 +86,28 @@ type Result struct {
 	Ts           time.Time `json:"ts,omitempty"`
 	Field        string    `json:"field,omitempty"` // which field matched: content|tool_cmd|stdout|stderr
 	Content      string    `json:"content,omitempty"`
+	// Marks are the pieces of Content the query matched, as written there,
+	// for highlighting; CJK-aware where a word boundary matters.
+	Marks []string `json:"marks,omitempty"`
 }
 
 // Response shapes the API output for /api/search.
 type Response struct {
-	TookMS    int      `json:"took_ms"`
-	Truncated bool     `json:"truncated"`
-	Total     int      `json:"total"` // count before offset/limit (best-effort)
-	Hits      []Result `json:"hits"`
+	TookMS    int  `json:"took_ms"`
+	Truncated bool `json:"truncated"`
+	// Total counts matches before offset/limit. It is exact unless
+	// TotalIsEstimate is set, in which case the time budget stopped counting
+	// after the page was filled and it is a lower bound.
+	Total           int      `json:"total"`
+	TotalIsEstimate bool     `json:"total_is_estimate,omitempty"`
+	Hits            []Result `json:"hits"`
+	// Facets counts matching messages per directory display name ("dir"),
+	// per session tag ("tag"), per MCP server called ("mcp"), and per code
+	// language of the session ("lang"), for narrowing with dir:, tag:, mcp:,
+	// and lang:.
+	Facets map[string]map[string]int `json:"facets,omitempty"`
+	// Explain is set by callers that asked for the query plan; see Explain.
+	Explain *Plan `json:"explain,omitempty"`
 }
 
 // Parse converts a raw query string and optional scope string into a Query.
@@ -99,7 +120,8 @@ func Parse(raw string, scopeStr string) Query {
 		scope = ScopeAll
 	}
 
-	tokens := tokenize(raw)
+	// IMEs type the ideographic space between CJK words
+	tokens := tokenize(strings.ReplaceAll(raw, "\u3000", " "))
 	// Detect in: scope inside the query and let it override explicit param.
 	filtered := make([]token, 0, len(tokens))
 	for _, t := range tokens {
@@ -121,16 +143,99 @@ func Parse(raw string, scopeStr string) Query {
 	return Query{Groups: groups, Scope: scope}
 }
 
-// Tunables (can be adjusted by callers, e.g., via flags/env in main)
+// Tunables, the initial values of CurrentOptions.
+//
+// Deprecated: pass Options to New, or use SetOptions for the package-level
+// Exec and Explain; these are only the defaults before the first SetOptions.
 var (
 	MaxReturn = 200
 	Budget    = 350 * time.Millisecond
+
+	// ToolOutputs keeps tool outputs (Codex function_call_output, Claude
+	// tool_result) in the search corpus. When false they are skipped
+	// entirely; the viewer and exports still show them.
+	ToolOutputs = true
+	// MaxOutputBytes caps how much of each tool output is searched (0 = all).
+	// Matches past the cap are not found.
+	MaxOutputBytes = 0
+
+	// Index, when set, narrows a query with a full-text index (--db). It
+	// returns a filter passing every message that may match, including any
+	// the index has not seen yet, or ok=false when it cannot answer the query
+	// and Exec scans every message.
+	Index func(q Query) (mayMatch func(m *indexer.Message) bool, ok bool)
 )
 
+// Options are the tunables of one search; see the package variables of the
+// same names.
+type Options struct {
+	MaxReturn      int
+	Budget         time.Duration
+	ToolOutputs    bool
+	MaxOutputBytes int
+
+	// SessionFilter, when set, hides the sessions it returns true for.
+	SessionFilter func(s indexer.Session) bool
+	// Index, when set, narrows a query with a full-text index; see the
+	// package variable.
+	Index func(q Query) (mayMatch func(m *indexer.Message) bool, ok bool)
+}
+
+// Searcher runs queries against one index with fixed options.
+type Searcher struct {
+	idx  *indexer.Indexer
+	opts Options
+}
+
+// New returns a Searcher over idx. Start from CurrentOptions and change what
+// differs.
+func New(idx *indexer.Indexer, o Options) *Searcher {
+	return &Searcher{idx: idx, opts: o}
+}
+
+// Options returns the options the Searcher was created with.
+func (s *Searcher) Options() Options { return s.opts }
+
+// Exec is the package Exec with the Searcher's options.
+func (s *Searcher) Exec(q Query, limit, offset int) Response {
+	return exec(s.idx, q, limit, offset, s.opts)
+}
+
+// Explain is the package Explain with the Searcher's options.
+func (s *Searcher) Explain(q Query) Plan {
+	return explain(s.idx, q, s.opts)
+}
+
+var options atomic.Pointer[Options]
+
+// CurrentOptions returns the options the package-level Exec and Explain
+// use: the last ones given to SetOptions, or the package variables before
+// the first call.
+func CurrentOptions() Options {
+	if o := options.Load(); o != nil {
+		return *o
+	}
+	return Options{MaxReturn: MaxReturn, Budget: Budget, ToolOutputs: ToolOutputs, MaxOutputBytes: MaxOutputBytes, SessionFilter: SessionFilter, Index: Index}
+}
+
+// SetOptions replaces the options for searches started afterwards. Unlike
+// assigning the package variables it is safe while searches run; each
+// search keeps the options it started with.
+func SetOptions(o Options) {
+	options.Store(&o)
+}
+
 // Exec evaluates the Query against the in-memory index and returns results.
 // limit is the number of rows to return; offset skips that many initial hits.
-// A soft time budget is enforced to avoid long scans on large datasets.
+// A soft time budget is enforced to avoid long scans on large datasets: once
+// the requested page is full, counting the remaining matches stops at the
+// budget. Filling the page is never cut short, so a deep offset costs a
+// longer scan rather than an empty page.
 func Exec(idx *indexer.Indexer, q Query, limit, offset int) Response {
+	return exec(idx, q, limit, offset, CurrentOptions())
+}
+
+func exec(idx *indexer.Indexer, q Query, limit, offset int, o Options) Response {
 	start := time.Now()
 	if limit <= 0 {
 		limit = 50
@@ -139,18 +244,24 @@ func Exec(idx *indexer.Indexer, q Query, limit, offset int) Response {
 		offset = 0
 	}
 	// soft caps
-	if limit > MaxReturn {
-		limit = MaxReturn
+	if limit > o.MaxReturn {
+		limit = o.MaxReturn
+	}
+	budget := o.Budget // conservative baseline
+	var mayMatch func(m *indexer.Message) bool
+	if o.Index != nil {
+		if f, ok := o.Index(q); ok {
+			mayMatch = f
+		}
 	}
-	budget := Budget // conservative baseline
 
 	// sessions lookup for CWD filters
 	sessions := idx.Sessions()
 	// Apply session filter if configured (e.g., to hide plugin intermediate sessions)
-	if SessionFilter != nil {
+	if o.SessionFilter != nil {
 		filtered := make([]indexer.Session, 0, len(sessions))
 		for _, s := range sessions {
-			if !SessionFilter(s) {
+			if !o.SessionFilter(s) {
 				filtered = append(filtered, s)
 			}
 		}
@@ -166,27 +277,52 @@ func Exec(idx *indexer.Indexer, q Query, limit, offset int) Response {
 	results := make([]Result, 0, limit)
 	total := 0
 	truncated := false
+	facets := map[string]map[string]int{"dir": {}, "tag": {}, "mcp": {}, "lang": {}}
 
 	// Decide which textual fields are searched under current scope.
 	// For each message we'll build target strings lazily.
+scan:
 	for _, s := range sessions {
-		visibleMsgs := indexer.VisibleMessages(idx.Messages(s.ID, 0), 0)
-		sessionView, ok := indexer.SessionView(s, visibleMsgs)
+		visibleMsgs := indexer.VisibleMessages(idx.PeekMessages(s.ID), 0)
+		sessionView, ok := idx.SessionView(s, visibleMsgs)
 		if !ok {
 			continue
 		}
 		for _, m := range visibleMsgs {
+			// checked before every message, matching or not, so a query
+			// with few matches still honors the budget once its page is full
+			if len(results) >= limit && time.Since(start) > budget {
+				truncated = true
+				break scan
+			}
+			if !o.ToolOutputs && indexer.TurnKind(m) == indexer.TurnToolOutput {
+				continue
+			}
+			if mayMatch != nil && !mayMatch(m) {
+				continue
+			}
 			// Apply field filters first (role/type/model/cwd/cwd_base)
-			if !matchesFieldFilters(q, m, sessionView) {
+			if !matchesFieldFilters(idx, q, m, sessionView) {
 				continue
 			}
 			// Evaluate text groups
-			matched, field := matchesTextGroups(q, m)
+			matched, field := matchesTextGroups(q, m, o.MaxOutputBytes)
 			if !matched {
 				continue
 			}
 			total++
-			if total <= offset {
+			facets["dir"][dirLabel(sessionView)]++
+			for _, t := range sessionView.Tags {
+				facets["tag"][strings.ToLower(t)]++
+			}
+			for _, call := range indexer.MCPCalls(m) {
+				server, _, _ := strings.Cut(call, "/")
+				facets["mcp"][strings.ToLower(server)]++
+			}
+			for lang := range sessionView.Languages {
+				facets["lang"][lang]++
+			}
+			if total <= offset || len(results) >= limit {
 				continue
 			}
 			// Append result
@@ -214,21 +350,8 @@ func Exec(idx *indexer.Indexer, q Query, limit, offset int) Response {
 				res.Content = strings.TrimSpace(m.Content)
 			}
 			res.Content = truncateRunes(res.Content, 240)
+			res.Marks = marksFor(q, res.Content)
 			results = append(results, res)
-			if len(results) >= limit {
-				// still compute total within budget for better UX
-				if time.Since(start) > budget {
-					truncated = true
-					break
-				}
-			}
-			if time.Since(start) > budget {
-				truncated = true
-				break
-			}
-		}
-		if truncated || len(results) >= limit && time.Since(start) > budget {
-			break
 		}
 	}
 
@@ -244,7 +367,16 @@ func Exec(idx *indexer.Indexer, q Query, limit, offset int) Response {
 	})
 
 	took := int(time.Since(start).Milliseconds())
-	return Response{TookMS: took, Truncated: truncated, Total: total, Hits: results}
+	return Response{TookMS: took, Truncated: truncated, Total: total, TotalIsEstimate: truncated, Hits: results, Facets: facets}
+}
+
+// dirLabel is the name a session's directory is shown and faceted under:
+// its display name from directory metadata, else the cwd base name.
+func dirLabel(s indexer.Session) string {
+	if name := strings.TrimSpace(s.DirName); name != "" {
+		return name
+	}
+	return s.CWDBase
 }
 
 func displayTitleForSession(s indexer.Session) string {
@@ -265,6 +397,17 @@ func displayTitleForSession(s indexer.Session) string {
 	return ""
 }
 
+// clipBytes cuts s to at most n bytes without splitting a rune.
+func clipBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
 func truncateRunes(s string, max int) string {
 	if max <= 0 || len(s) == 0 {
 		return ""
@@ -276,8 +419,9 @@ func truncateRunes(s string, max int) string {
 	return string(runes[:max])
 }
 
-// matchesFieldFilters applies only Field clauses to a message and its session.
-func matchesFieldFilters(q Query, m *indexer.Message, s indexer.Session) bool {
+// matchesFieldFilters applies only Field clauses to a message and its
+// session. Models compare under idx's aliases.
+func matchesFieldFilters(idx *indexer.Indexer, q Query, m *indexer.Message, s indexer.Session) bool {
 	if len(q.Groups) == 0 {
 		return true
 	}
@@ -290,10 +434,17 @@ func matchesFieldFilters(q Query, m *indexer.Message, s indexer.Session) bool {
 	for _, g := range q.Groups {
 		for _, c := range g {
 			if c.Kind == KindField {
+				cs := []Clause{c}
+				if c.Field == "model" {
+					// model:gpt-5-codex finds messages grouped under its alias too
+					alias := c
+					alias.Value = idx.CanonicalModel(c.Value)
+					cs = append(cs, alias)
+				}
 				if c.Negative {
-					deny[c.Field] = append(deny[c.Field], c)
+					deny[c.Field] = append(deny[c.Field], cs...)
 				} else {
-					allow[c.Field] = append(allow[c.Field], c)
+					allow[c.Field] = append(allow[c.Field], cs...)
 				}
 			}
 		}
@@ -324,14 +475,17 @@ func matchesFieldFilters(q Query, m *indexer.Message, s indexer.Session) bool {
 		return true
 	}
 
-	// role, type, model from message; cwd/cwd_base from session
+	// role, type, model, toolkind from message; cwd, cwd_base, dir, branch, repo from session
 	if !fieldMatches("role", strings.ToLower(m.Role)) {
 		return false
 	}
 	if !fieldMatches("type", strings.ToLower(m.Type)) {
 		return false
 	}
-	if !fieldMatches("model", strings.ToLower(m.Model)) {
+	if !fieldMatches("model", strings.ToLower(idx.CanonicalModel(m.Model))) {
+		return false
+	}
+	if !fieldMatches("toolkind", m.ToolKind) {
 		return false
 	}
 	if !fieldMatches("cwd", strings.ToLower(s.CWD)) {
@@ -340,9 +494,82 @@ func matchesFieldFilters(q Query, m *indexer.Message, s indexer.Session) bool {
 	if !fieldMatches("cwd_base", strings.ToLower(s.CWDBase)) {
 		return false
 	}
+	if !fieldMatches("dir", strings.ToLower(dirLabel(s))) {
+		return false
+	}
+	if !fieldMatches("branch", strings.ToLower(s.GitBranch)) {
+		return false
+	}
+	if !fieldMatches("repo", strings.ToLower(s.GitRepo)) {
+		return false
+	}
+	// tag is multi-valued: an allow needs some tag to match, a deny none.
+	for _, c := range allow["tag"] {
+		if !hasTag(s.Tags, c.Value) {
+			return false
+		}
+	}
+	for _, c := range deny["tag"] {
+		if hasTag(s.Tags, c.Value) {
+			return false
+		}
+	}
+	// lang matches the languages of the session's code blocks, multi-valued
+	// like tag.
+	for _, c := range allow["lang"] {
+		if s.Languages[indexer.NormalizeLanguage(c.Value)] == 0 {
+			return false
+		}
+	}
+	for _, c := range deny["lang"] {
+		if s.Languages[indexer.NormalizeLanguage(c.Value)] > 0 {
+			return false
+		}
+	}
+	// mcp matches the message's MCP tool calls, multi-valued like tag.
+	if len(allow["mcp"]) > 0 || len(deny["mcp"]) > 0 {
+		calls := indexer.MCPCalls(m)
+		for _, c := range allow["mcp"] {
+			if !hasMCPCall(calls, c.Value) {
+				return false
+			}
+		}
+		for _, c := range deny["mcp"] {
+			if hasMCPCall(calls, c.Value) {
+				return false
+			}
+		}
+	}
 	return true
 }
 
+// hasMCPCall reports whether calls ("server/tool") include want, given as
+// a server, "server/tool", the raw "mcp__server__tool" name, or "*" for any
+// MCP call.
+func hasMCPCall(calls []string, want string) bool {
+	want = strings.ToLower(strings.TrimSpace(want))
+	if server, tool, ok := indexer.ParseMCPTool(want); ok {
+		want = server + "/" + tool
+	}
+	for _, call := range calls {
+		call = strings.ToLower(call)
+		server, _, _ := strings.Cut(call, "/")
+		if want == "*" || want == call || want == server {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTag(tags []string, want string) bool {
+	for _, t := range tags {
+		if fieldValueMatches("tag", t, want) {
+			return true
+		}
+	}
+	return false
+}
+
 func fieldValueMatches(field, got, want string) bool {
 	got = strings.ToLower(strings.TrimSpace(got))
 	want = strings.ToLower(strings.TrimSpace(want))
@@ -350,8 +577,8 @@ func fieldValueMatches(field, got, want string) bool {
 		return true
 	}
 	switch field {
-	case "cwd":
-		// substring to support subdirectories
+	case "cwd", "repo":
+		// substring to support subdirectories, and owner/name for remote URLs
 		return strings.Contains(got, want)
 	default:
 		return got == want
@@ -360,12 +587,19 @@ func fieldValueMatches(field, got, want string) bool {
 
 // matchesTextGroups evaluates the OR-of-AND groups for textual clauses only.
 // Returns whether it matched and the field that matched (best-effort).
-func matchesTextGroups(q Query, m *indexer.Message) (bool, string) {
+// Tool outputs are searched up to maxOutput bytes (0 = all).
+func matchesTextGroups(q Query, m *indexer.Message, maxOutput int) (bool, string) {
 	// Precompute target strings depending on scope.
-	content := strings.ToLower(m.Content)
+	content, outStd, outErr := m.Content, extractToolOut(m, true), extractToolOut(m, false)
+	if maxOutput > 0 && indexer.TurnKind(m) == indexer.TurnToolOutput {
+		content = clipBytes(content, maxOutput)
+		outStd = clipBytes(outStd, maxOutput)
+		outErr = clipBytes(outErr, maxOutput)
+	}
+	content = strings.ToLower(content)
 	toolCmd := strings.ToLower(extractToolCmd(m))
-	outStd := strings.ToLower(extractToolOut(m, true))
-	outErr := strings.ToLower(extractToolOut(m, false))
+	outStd = strings.ToLower(outStd)
+	outErr = strings.ToLower(outErr)
 
 	// Helper to test a clause against a specific string
 	testClause := func(c Clause, text string) bool {
@@ -382,16 +616,13 @@ func matchesTextGroups(q Query, m *indexer.Message) (bool, string) {
 		case KindPhrase:
 			return strings.Contains(text, strings.ToLower(c.Value))
 		case KindPrefix:
-			// treat as substring with word boundary preference if possible
 			pref := strings.ToLower(strings.TrimSuffix(c.Value, "*"))
 			if pref == "" {
 				return true
 			}
-			// fast path: substring
-			if strings.Contains(text, pref) {
-				return true
-			}
-			return false
+			return hasWordPrefix(text, pref)
+		case KindWildcard:
+			return matchWildcard(c, text)
 		case KindTerm:
 			v := strings.ToLower(c.Value)
 			if v == "" {
@@ -593,7 +824,7 @@ func tokenize(s string) []token {
 
 func isKnownField(f string) bool {
 	switch f {
-	case "role", "type", "model", "cwd", "cwd_base", "in":
+	case "role", "type", "model", "toolkind", "cwd", "cwd_base", "dir", "branch", "repo", "tag", "mcp", "lang", "in":
 		return true
 	default:
 		return false
@@ -662,11 +893,7 @@ func parseToDNF(toks []token) [][]Clause {
 			if strings.Count(raw, "*") == 1 && strings.HasSuffix(raw, "*") {
 				cur = append(cur, Clause{Kind: KindPrefix, Value: strings.TrimSuffix(raw, "*"), Negative: t.negative})
 			} else {
-				// convert to regex: escape specials except '*', then replace '*' with '.*'
-				esc := regexp.QuoteMeta(raw)
-				esc = strings.ReplaceAll(esc, "\\*", ".*")
-				re := safeCompile("(?i)" + esc)
-				cur = append(cur, Clause{Kind: KindRegex, Regex: re, Negative: t.negative})
+				cur = append(cur, Clause{Kind: KindWildcard, Value: raw, Regex: wildcardRegex(raw), Negative: t.negative})
 			}
 			continue
 		}
@@ -749,6 +976,13 @@ func extractToolCmd(m *indexer.Message) string {
 	return ""
 }
 
+// ToolText is the tool command and outputs of a message as searched under
+// in:tools, for full-text indexes.
+func ToolText(m *indexer.Message) string {
+	parts := []string{extractToolCmd(m), extractToolOut(m, true), extractToolOut(m, false)}
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
+
 func extractToolOut(m *indexer.Message, stdout bool) string {
 	if m == nil || m.Raw == nil {
 		return ""
@@ -0,0 +1,372 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"codex-watcher/pkg/indexer"
+)
+
+// helper to build an indexer with a few messages
+func buildTestIndexer(t *testing.T) *indexer.Indexer {
+	t.Helper()
+	x := indexer.New([]string{"/tmp/.codex"}, "")
+	now := time.Now()
+	// Session s1: content with "go build"
+	x.IngestForTest("s1", map[string]any{
+		"id": "m1", "session_id": "s1", "role": "user", "content": "please run go build for me", "ts": now.Format(time.RFC3339),
+	})
+	// Session s2: tool outputs with go build
+	x.IngestForTest("s2", map[string]any{
+		"id": "m2", "session_id": "s2", "type": "function_call", "arguments": `{"command":["bash","-lc","go build ./..."]}`,
+	})
+	x.IngestForTest("s2", map[string]any{
+		"id": "m3", "session_id": "s2", "type": "function_call_output", "output": `{"output":"go build ok","stderr":""}`,
+	})
+	return x
+}
+
+func TestRegexContent(t *testing.T) {
+	idx := buildTestIndexer(t)
+	q := Parse(`/go\s+build/i`, "content")
+	res := Exec(idx, q, 50, 0)
+	if res.Total <= 0 {
+		t.Fatalf("want content regex hits > 0, got %d; hits=%v", res.Total, res.Hits)
+	}
+}
+
+func TestRegexTools(t *testing.T) {
+	idx := buildTestIndexer(t)
+	q := Parse(`/go\s+build/i`, "tools")
+	res := Exec(idx, q, 50, 0)
+	if res.Total <= 0 {
+		t.Fatalf("want tools regex hits > 0, got %d; hits=%v", res.Total, res.Hits)
+	}
+}
+
+func TestInScopeOverridesParam(t *testing.T) {
+	idx := buildTestIndexer(t)
+	// Even if param says content, in:tools should switch to tool scope
+	q := Parse(`in:tools go build`, "content")
+	res := Exec(idx, q, 50, 0)
+	if res.Total <= 0 {
+		t.Fatalf("in:tools should search tools scope, got %d", res.Total)
+	}
+}
+
+func TestSearchSkipsMemoryMessagesAndUsesVisibleTitle(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	now := time.Date(2026, time.March, 18, 12, 0, 0, 0, time.UTC)
+
+	idx.IngestForTest("s1", map[string]any{
+		"id":         "mem-1",
+		"session_id": "s1",
+		"role":       "user",
+		"content":    "Hello memory agent, you are continuing to observe the primary Claude session.",
+		"cwd":        "/workspace/app",
+		"ts":         now.Format(time.RFC3339),
+	})
+	idx.IngestForTest("s1", map[string]any{
+		"id":         "msg-1",
+		"session_id": "s1",
+		"role":       "user",
+		"content":    "Ship the dashboard fix today",
+		"cwd":        "/workspace/app",
+		"ts":         now.Add(time.Minute).Format(time.RFC3339),
+	})
+	idx.IngestForTest("s2", map[string]any{
+		"id":         "mem-2",
+		"session_id": "s2",
+		"role":       "assistant",
+		"content":    "MEMORY PROCESSING CONTINUED",
+		"cwd":        "/workspace/hidden",
+		"ts":         now.Format(time.RFC3339),
+	})
+
+	memoryOnly := Exec(idx, Parse(`"memory agent"`, "content"), 50, 0)
+	if memoryOnly.Total != 0 {
+		t.Fatalf("memory search should be filtered, got total=%d hits=%v", memoryOnly.Total, memoryOnly.Hits)
+	}
+
+	continuedOnly := Exec(idx, Parse(`"MEMORY PROCESSING CONTINUED"`, "content"), 50, 0)
+	if continuedOnly.Total != 0 {
+		t.Fatalf("memory continuation search should be filtered, got total=%d hits=%v", continuedOnly.Total, continuedOnly.Hits)
+	}
+
+	visible := Exec(idx, Parse(`dashboard`, "content"), 50, 0)
+	if visible.Total != 1 {
+		t.Fatalf("visible search should still work, got total=%d hits=%v", visible.Total, visible.Hits)
+	}
+	if got := visible.Hits[0].SessionTitle; got != "Ship the dashboard fix today" {
+		t.Fatalf("session title=%q want %q", got, "Ship the dashboard fix today")
+	}
+	if strings.Contains(strings.ToLower(visible.Hits[0].Content), "memory agent") {
+		t.Fatalf("visible hit content should not include memory prompt: %q", visible.Hits[0].Content)
+	}
+}
+
+func TestMCPFilterSeparatesMCPFromBuiltinTools(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("s1", map[string]any{
+		"id": "m1", "session_id": "s1", "type": "function_call", "name": "mcp__github__create_issue", "arguments": `{"title":"flaky bug"}`,
+	})
+	idx.IngestForTest("s1", map[string]any{
+		"id": "m2", "session_id": "s1", "type": "function_call", "name": "shell", "arguments": `{"command":["grep","bug"]}`,
+	})
+
+	res := Exec(idx, Parse(`in:tools bug mcp:github`, "content"), 50, 0)
+	if res.Total != 1 || res.Hits[0].MessageID != "m1" {
+		t.Fatalf("mcp:github should keep only the MCP call, got %+v", res.Hits)
+	}
+	if res.Facets["mcp"]["github"] != 1 {
+		t.Fatalf("expected mcp facet, got %v", res.Facets)
+	}
+	if res := Exec(idx, Parse(`in:tools bug mcp:github/create_issue`, "content"), 50, 0); res.Total != 1 {
+		t.Fatalf("server/tool form should match, got %d", res.Total)
+	}
+	if res := Exec(idx, Parse(`in:tools bug -mcp:*`, "content"), 50, 0); res.Total != 1 || res.Hits[0].MessageID != "m2" {
+		t.Fatalf("-mcp:* should drop MCP calls, got %+v", res.Hits)
+	}
+	if res := Exec(idx, Parse(`in:tools toolkind:mcp`, "content"), 50, 0); res.Total != 1 || res.Hits[0].MessageID != "m1" {
+		t.Fatalf("toolkind:mcp should keep only the MCP call, got %+v", res.Hits)
+	}
+	if res := Exec(idx, Parse(`in:tools bug -toolkind:mcp`, "content"), 50, 0); res.Total != 1 || res.Hits[0].MessageID != "m2" {
+		t.Fatalf("-toolkind:mcp should drop MCP calls, got %+v", res.Hits)
+	}
+}
+
+func TestToolOutputOptOutAndCap(t *testing.T) {
+	idx := buildTestIndexer(t)
+	idx.IngestForTest("s3", map[string]any{
+		"id": "m4", "session_id": "s3", "type": "function_call_output", "output": strings.Repeat("x", 100) + " needle",
+	})
+	defer SetOptions(CurrentOptions())
+	o := CurrentOptions()
+
+	if res := Exec(idx, Parse("in:tools needle", ""), 50, 0); res.Total != 1 {
+		t.Fatalf("needle should be found in tool output, got %d", res.Total)
+	}
+	o.MaxOutputBytes = 50
+	SetOptions(o)
+	if res := Exec(idx, Parse("in:tools needle", ""), 50, 0); res.Total != 0 {
+		t.Fatalf("needle past the cap should not match, got %d", res.Total)
+	}
+	if res := Exec(idx, Parse("in:tools xxx", ""), 50, 0); res.Total != 1 {
+		t.Fatalf("text within the cap should match, got %d", res.Total)
+	}
+	o.MaxOutputBytes, o.ToolOutputs = 0, false
+	SetOptions(o)
+	res := Exec(idx, Parse(`/go\s+build/i`, "tools"), 50, 0)
+	for _, h := range res.Hits {
+		if h.Type == "function_call_output" {
+			t.Fatalf("tool outputs should be excluded: %+v", h)
+		}
+	}
+	if res.Total != 1 {
+		t.Fatalf("the tool call should still match, got %d", res.Total)
+	}
+}
+
+func TestExplainCountsClausesAndWarns(t *testing.T) {
+	idx := buildTestIndexer(t)
+	plan := Explain(idx, Parse(`go build -nothere zzz role:user`, "all"))
+	if plan.Scope != "all" || plan.Index != "linear" || plan.Messages != 3 {
+		t.Fatalf("unexpected plan header: %+v", plan)
+	}
+	if len(plan.Groups) != 1 || len(plan.Groups[0]) != 5 {
+		t.Fatalf("want one group of 5 clauses, got %+v", plan.Groups)
+	}
+	byValue := map[string]ClausePlan{}
+	for _, c := range plan.Groups[0] {
+		byValue[c.Value] = c
+	}
+	if c := byValue["go"]; c.Kind != "term" || c.Matches != 3 {
+		t.Fatalf("go: %+v", c)
+	}
+	if c := byValue["nothere"]; !c.Negative || c.Matches != 3 {
+		t.Fatalf("-nothere should let every message through: %+v", c)
+	}
+	if c := byValue["user"]; c.Kind != "field" || c.Field != "role" || c.Matches != 1 {
+		t.Fatalf("role:user: %+v", c)
+	}
+	if plan.Candidates != 1 || plan.Matches != 0 {
+		t.Fatalf("candidates=%d matches=%d", plan.Candidates, plan.Matches)
+	}
+	found := false
+	for _, w := range plan.Warnings {
+		found = found || strings.Contains(w, `"zzz" matches no message`)
+	}
+	if !found {
+		t.Fatalf("expected a warning for zzz, got %v", plan.Warnings)
+	}
+}
+
+func TestOffsetPageFillsDespiteBudgetAndTotalIsMarked(t *testing.T) {
+	x := indexer.New([]string{"/tmp/.codex"}, "")
+	for i := 0; i < 10; i++ {
+		id := string(rune('a' + i))
+		x.IngestForTest("s"+id, map[string]any{"id": "m" + id, "session_id": "s" + id, "role": "user", "content": "needle " + id})
+	}
+	q := Parse("needle", "content")
+
+	res := Exec(x, q, 2, 3)
+	if len(res.Hits) != 2 || res.Total != 10 || res.TotalIsEstimate || res.Truncated {
+		t.Fatalf("within budget: hits=%d total=%d estimate=%v", len(res.Hits), res.Total, res.TotalIsEstimate)
+	}
+
+	o := CurrentOptions()
+	o.Budget = time.Nanosecond
+	s := New(x, o)
+	// the page past the offset is filled before the budget applies
+	res = s.Exec(q, 2, 3)
+	if len(res.Hits) != 2 || res.Total != 5 || !res.TotalIsEstimate || !res.Truncated {
+		t.Fatalf("over budget: hits=%d total=%d estimate=%v", len(res.Hits), res.Total, res.TotalIsEstimate)
+	}
+	// a page that cannot be filled scans everything, so the total is exact
+	res = s.Exec(q, 2, 20)
+	if len(res.Hits) != 0 || res.Total != 10 || res.TotalIsEstimate {
+		t.Fatalf("past the end: hits=%d total=%d estimate=%v", len(res.Hits), res.Total, res.TotalIsEstimate)
+	}
+}
+
+func TestSearcherUsesItsOwnOptionsAndModelAliases(t *testing.T) {
+	io := indexer.DefaultOptions()
+	io.Models = indexer.ModelConfig{Aliases: map[string]string{"gpt-5-codex": "gpt-5"}}
+	x := indexer.New([]string{"/tmp/.codex"}, "", io)
+	x.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "assistant", "model": "gpt-5-codex", "content": "needle one"})
+	x.IngestForTest("s1", map[string]any{"id": "m2", "session_id": "s1", "role": "assistant", "model": "gpt-5", "content": "needle two"})
+	x.IngestForTest("s1", map[string]any{"id": "m3", "session_id": "s1", "role": "assistant", "model": "o3", "content": "needle three"})
+
+	o := CurrentOptions()
+	o.MaxReturn = 1
+	s := New(x, o)
+	res := s.Exec(Parse("needle model:gpt-5-codex", "content"), 50, 0)
+	if res.Total != 2 || len(res.Hits) != 1 {
+		t.Fatalf("model alias under the indexer's options: total=%d hits=%d", res.Total, len(res.Hits))
+	}
+	if res := Exec(x, Parse("needle -model:gpt-5", "content"), 50, 0); res.Total != 1 || len(res.Hits) != 1 {
+		t.Fatalf("package Exec keeps the package options: total=%d hits=%d", res.Total, len(res.Hits))
+	}
+	if plan := s.Explain(Parse("needle", "content")); plan.MaxReturn != 1 {
+		t.Fatalf("explain should report the searcher's options: %+v", plan)
+	}
+
+	// hidden sessions and the full-text index come with the options too
+	x.IngestForTest("s2", map[string]any{"id": "m4", "session_id": "s2", "role": "user", "content": "needle four"})
+	o = CurrentOptions()
+	o.SessionFilter = func(s indexer.Session) bool { return s.ID == "s2" }
+	o.Index = func(Query) (func(m *indexer.Message) bool, bool) {
+		return func(m *indexer.Message) bool { return m.ID != "m3" }, true
+	}
+	s = New(x, o)
+	if res := s.Exec(Parse("needle", "content"), 50, 0); res.Total != 2 {
+		t.Fatalf("filtered search: total=%d hits=%+v", res.Total, res.Hits)
+	}
+	if plan := s.Explain(Parse("needle", "content")); plan.Index != "fts" {
+		t.Fatalf("explain should use the searcher's index: %+v", plan)
+	}
+	if res := Exec(x, Parse("needle", "content"), 50, 0); res.Total != 4 {
+		t.Fatalf("package Exec keeps the package options: total=%d", res.Total)
+	}
+}
+
+func TestWildcardsUseWordStartsAndCJKCharacters(t *testing.T) {
+	x := indexer.New([]string{"/tmp/.codex"}, "")
+	for id, text := range map[string]string{
+		"m1": "rebuild the cache",
+		"m2": "builds are green",
+		"m3": "修复数据库连接池的问题",
+		"m4": "foo-bar_baz",
+	} {
+		x.IngestForTest("s"+id, map[string]any{"id": id, "session_id": "s" + id, "role": "user", "content": text})
+	}
+	ids := func(query string) string {
+		var out []string
+		for _, h := range Exec(x, Parse(query, "content"), 50, 0).Hits {
+			out = append(out, h.MessageID)
+		}
+		sort.Strings(out)
+		return strings.Join(out, ",")
+	}
+	for query, want := range map[string]string{
+		"build*":        "m2",    // a word start, not inside "rebuild"
+		"*build":        "m1,m2", // a leading * drops the anchor
+		"b*s":           "m2",
+		"数据库*":          "m3", // every CJK character starts a word
+		"连接　问题":         "m3", // ideographic space separates terms
+		"数据*问题":         "m3",
+		"bar*":          "m4",
+		"ba*z":          "m4",
+		"-build* cache": "m1",
+	} {
+		if got := ids(query); got != want {
+			t.Errorf("%q matched %q, want %q", query, got, want)
+		}
+	}
+
+	marks := map[string][]string{}
+	res := Exec(x, Parse("数据 OR build*", "content"), 50, 0)
+	for _, h := range res.Hits {
+		marks[h.MessageID] = h.Marks
+	}
+	if strings.Join(marks["m2"], ",") != "builds" || strings.Join(marks["m3"], ",") != "数据" {
+		t.Fatalf("marks = %v", marks)
+	}
+	if got := Segment("go build 修复bug"); strings.Join(got, "|") != "go|build|修|复|bug" {
+		t.Fatalf("Segment = %q", got)
+	}
+}
+
+func TestBranchAndRepoFiltersUseSessionGitInfo(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("s1", map[string]any{
+		"type": "session_meta", "payload": map[string]any{"id": "s1", "cwd": "/work/api",
+			"git": map[string]any{"branch": "feature/login", "repository_url": "git@github.com:acme/api.git", "commit_hash": "abc123"}},
+	})
+	idx.IngestForTest("s1", map[string]any{"id": "m1", "session_id": "s1", "role": "user", "content": "fix the login flow"})
+	idx.IngestForTest("s2", map[string]any{"id": "n1", "session_id": "s2", "role": "user", "content": "fix the login page", "gitBranch": "main"})
+
+	sessions := map[string]indexer.Session{}
+	for _, s := range idx.Sessions() {
+		sessions[s.ID] = s
+	}
+	if s := sessions["s1"]; s.GitBranch != "feature/login" || s.GitRepo != "git@github.com:acme/api.git" || s.GitCommit != "abc123" {
+		t.Fatalf("s1 git info = %q %q %q", s.GitBranch, s.GitRepo, s.GitCommit)
+	}
+	if sessions["s2"].GitBranch != "main" {
+		t.Fatalf("s2 branch = %q", sessions["s2"].GitBranch)
+	}
+	if res := Exec(idx, Parse(`login branch:feature/login`, "content"), 50, 0); res.Total != 1 || res.Hits[0].MessageID != "m1" {
+		t.Fatalf("branch: should keep s1, got %+v", res.Hits)
+	}
+	if res := Exec(idx, Parse(`login repo:acme/api`, "content"), 50, 0); res.Total != 1 || res.Hits[0].MessageID != "m1" {
+		t.Fatalf("repo: should match part of the remote URL, got %+v", res.Hits)
+	}
+	if res := Exec(idx, Parse(`login -branch:main`, "content"), 50, 0); res.Total != 1 || res.Hits[0].MessageID != "m1" {
+		t.Fatalf("-branch:main should drop s2, got %+v", res.Hits)
+	}
+}
+
+func TestLangFilterFindsSessionsByCodeLanguage(t *testing.T) {
+	idx := indexer.New([]string{"/tmp/.codex"}, "")
+	idx.IngestForTest("tf", map[string]any{"id": "t1", "session_id": "tf", "role": "user", "content": "set up the bucket"})
+	idx.IngestForTest("tf", map[string]any{"id": "t2", "session_id": "tf", "role": "assistant",
+		"content": "Here is the bucket:\n```hcl\nresource \"aws_s3_bucket\" \"logs\" {\n  bucket = \"logs\"\n}\n```\n"})
+	idx.IngestForTest("go", map[string]any{"id": "g1", "session_id": "go", "role": "user", "content": "set up the bucket client"})
+	idx.IngestForTest("go", map[string]any{"id": "g2", "session_id": "go", "role": "assistant",
+		"content": "```\nclient := s3.New(cfg)\nfunc upload() {}\n```"})
+
+	res := Exec(idx, Parse(`bucket lang:terraform`, "content"), 50, 0)
+	if res.Total != 2 || res.Hits[0].SessionID != "tf" {
+		t.Fatalf("lang:terraform should keep the Terraform session, got %+v", res.Hits)
+	}
+	if res := Exec(idx, Parse(`bucket lang:tf`, "content"), 50, 0); res.Total != 2 {
+		t.Fatalf("aliases should match, got %d", res.Total)
+	}
+	all := Exec(idx, Parse(`bucket -lang:golang`, "content"), 50, 0)
+	if all.Total != 2 || all.Facets["lang"]["terraform"] != 2 || all.Facets["lang"]["go"] != 0 {
+		t.Fatalf("-lang:golang: total=%d facets=%v", all.Total, all.Facets)
+	}
+}
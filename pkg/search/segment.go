@@ -0,0 +1,197 @@
+package search
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Word boundaries.
+//
+// Latin-script text splits into words at anything that is not a letter,
+// digit, or underscore. Chinese, Japanese, and Korean text is written
+// without spaces and there is no dictionary here, so every Han, Hiragana,
+// Katakana, or Hangul character counts as a word of its own. Wildcards and
+// highlighting use these boundaries:
+//
+//   - foo* matches words starting with foo; with CJK it matches anywhere,
+//     since each character starts a word.
+//   - Elsewhere * stands for any run of characters within one stretch of
+//     non-space text: f*o matches a word starting with f followed by o
+//     before the next space. A leading * drops the word-start anchor.
+//   - Terms and phrases are plain substrings in every scope.
+
+// isCJK reports whether r is written without spaces between words.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Segment splits s into words: runs of letters, digits, and underscores,
+// with each CJK character a word of its own.
+func Segment(s string) []string {
+	var out []string
+	start := -1
+	for i, r := range s {
+		switch {
+		case isCJK(r):
+			if start >= 0 {
+				out = append(out, s[start:i])
+				start = -1
+			}
+			out = append(out, string(r))
+		case isWordRune(r):
+			if start < 0 {
+				start = i
+			}
+		default:
+			if start >= 0 {
+				out = append(out, s[start:i])
+				start = -1
+			}
+		}
+	}
+	if start >= 0 {
+		out = append(out, s[start:])
+	}
+	return out
+}
+
+// wordStartAt reports whether a word starts at byte offset i of s.
+func wordStartAt(s string, i int) bool {
+	if i <= 0 || i >= len(s) {
+		return i == 0
+	}
+	prev, _ := utf8.DecodeLastRuneInString(s[:i])
+	cur, _ := utf8.DecodeRuneInString(s[i:])
+	return !isWordRune(prev) || isCJK(prev) || isCJK(cur) || !isWordRune(cur)
+}
+
+// hasWordPrefix reports whether a word of text starts with pref. Both are
+// already lower-cased.
+func hasWordPrefix(text, pref string) bool {
+	for off := 0; off < len(text); {
+		k := strings.Index(text[off:], pref)
+		if k < 0 {
+			return false
+		}
+		if wordStartAt(text, off+k) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(text[off+k:])
+		off += k + size
+	}
+	return false
+}
+
+// wildcardRegex compiles a term containing * other than a single trailing
+// one: * becomes any run of non-space characters.
+func wildcardRegex(raw string) *regexp.Regexp {
+	parts := strings.Split(raw, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return safeCompile(`(?i)` + strings.Join(parts, `\S*`))
+}
+
+// matchWildcard reports whether re matches text at a word start, or
+// anywhere when the pattern starts with *.
+func matchWildcard(c Clause, text string) bool {
+	if c.Regex == nil {
+		return false
+	}
+	if strings.HasPrefix(c.Value, "*") {
+		return c.Regex.MatchString(text)
+	}
+	for off := 0; off < len(text); {
+		loc := c.Regex.FindStringIndex(text[off:])
+		if loc == nil {
+			return false
+		}
+		if wordStartAt(text, off+loc[0]) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(text[off+loc[0]:])
+		off += loc[0] + size
+	}
+	return false
+}
+
+// maxMarks caps the highlight strings returned per hit.
+const maxMarks = 8
+
+// marksFor lists the distinct pieces of text (as written there) that the
+// positive text clauses of q match, for highlighting a hit's preview. Prefix
+// marks extend to the end of the word, so "build*" marks "builds".
+func marksFor(q Query, text string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	add := func(m string) bool {
+		if m != "" && !seen[m] {
+			seen[m] = true
+			out = append(out, m)
+		}
+		return len(out) < maxMarks
+	}
+	for _, g := range q.Groups {
+		for _, c := range g {
+			if c.Negative || c.Kind == KindField {
+				continue
+			}
+			var re *regexp.Regexp
+			anchored := false
+			switch c.Kind {
+			case KindTerm, KindPhrase:
+				if c.Value != "" {
+					re = safeCompile(`(?i)` + regexp.QuoteMeta(c.Value))
+				}
+			case KindPrefix:
+				if c.Value != "" {
+					re = safeCompile(`(?i)` + regexp.QuoteMeta(c.Value))
+					anchored = true
+				}
+			case KindWildcard:
+				re, anchored = c.Regex, !strings.HasPrefix(c.Value, "*")
+			case KindRegex:
+				re = c.Regex
+			}
+			if re == nil {
+				continue
+			}
+			for _, loc := range re.FindAllStringIndex(text, maxMarks*4) {
+				if loc[0] == loc[1] || anchored && !wordStartAt(text, loc[0]) {
+					continue
+				}
+				end := loc[1]
+				if c.Kind == KindPrefix {
+					end = wordEnd(text, loc[0], end)
+				}
+				if !add(text[loc[0]:end]) {
+					return out
+				}
+			}
+		}
+	}
+	return out
+}
+
+// wordEnd extends a match at [start, end) of s to the end of its word; a
+// CJK character is a word of its own, so a CJK match does not grow.
+func wordEnd(s string, start, end int) int {
+	last, _ := utf8.DecodeLastRuneInString(s[start:end])
+	if isCJK(last) {
+		return end
+	}
+	for end < len(s) {
+		r, size := utf8.DecodeRuneInString(s[end:])
+		if !isWordRune(r) || isCJK(r) {
+			break
+		}
+		end += size
+	}
+	return end
+}
@@ -4,11 +4,11 @@ import (
   "fmt"
   "time"
 
-  "codex-watcher/internal/indexer"
+  "codex-watcher/pkg/indexer"
 )
 
 func main() {
-  idx := indexer.New("/home/henry/.codex", "/home/henry/.claude/projects")
+  idx := indexer.New([]string{"/home/henry/.codex"}, "/home/henry/.claude/projects")
   if err := idx.Reindex(); err != nil {
     panic(err)
   }